@@ -122,6 +122,484 @@ func (c *Client) UserAdd(passkey string) error {
 	return json.Unmarshal(b, &uar)
 }
 
+// UserGet returns the user matching the user id provided
+func (c *Client) UserGet(userID uint32) (model.User, error) {
+	var user model.User
+	resp, err := h.DoRequest(c.client, "GET", c.u(fmt.Sprintf("/user/%d", userID)), nil, c.headers())
+	if err != nil {
+		return user, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return user, readStatus(resp)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return user, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if err := json.Unmarshal(b, &user); err != nil {
+		return user, err
+	}
+	return user, nil
+}
+
+// userUpdate applies the changes in the request to the user
+func (c *Client) userUpdate(userID uint32, req h.UserUpdateRequest) error {
+	resp, err := h.DoRequest(c.client, "PATCH", c.u(fmt.Sprintf("/user/%d", userID)), req, c.headers())
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return readStatus(resp)
+	}
+	return nil
+}
+
+// UserSetDownloadEnabled enables or disables downloading for the user. Seeding is not affected.
+func (c *Client) UserSetDownloadEnabled(userID uint32, enabled bool) error {
+	if err := c.userUpdate(userID, h.UserUpdateRequest{DownloadEnabled: &enabled}); err != nil {
+		return err
+	}
+	log.Debugf("User download enabled set to %t: %d", enabled, userID)
+	return nil
+}
+
+// UserSetSlotLimits replaces the peer slot limits of the user. 0 uses the tracker wide limit while
+// negative values remove the limit for the user.
+func (c *Client) UserSetSlotLimits(userID uint32, limits model.SlotLimits) error {
+	if err := c.userUpdate(userID, h.UserUpdateRequest{Slots: &limits}); err != nil {
+		return err
+	}
+	log.Debugf("User slot limits updated: %d", userID)
+	return nil
+}
+
+// UserRotatePasskey replaces the passkey of the user. A random passkey is generated when passkey is
+// empty. The previous passkey keeps working until expire, a zero expire uses the trackers grace period.
+func (c *Client) UserRotatePasskey(userID uint32, passkey string, expire time.Time) (h.PasskeyRotateResponse, error) {
+	var prr h.PasskeyRotateResponse
+	req := h.PasskeyRotateRequest{Passkey: passkey, TimeExpire: expire}
+	resp, err := h.DoRequest(c.client, "POST", c.u(fmt.Sprintf("/user/%d/passkey", userID)), req, c.headers())
+	if err != nil {
+		return prr, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return prr, readStatus(resp)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return prr, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if err := json.Unmarshal(b, &prr); err != nil {
+		return prr, err
+	}
+	log.Debugf("User passkey rotated successfully: %d", userID)
+	return prr, nil
+}
+
+// UserPasskeyAdd gives the user an additional passkey for the device named by label. A random passkey is
+// generated when passkey is empty. A zero expire creates a passkey which works until it is revoked.
+func (c *Client) UserPasskeyAdd(userID uint32, label string, passkey string, expire time.Time) (model.Passkey, error) {
+	var pk model.Passkey
+	req := h.PasskeyAddRequest{UserID: userID, Label: label, Passkey: passkey, TimeExpire: expire}
+	resp, err := h.DoRequest(c.client, "POST", c.u("/passkey"), req, c.headers())
+	if err != nil {
+		return pk, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return pk, readStatus(resp)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return pk, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if err := json.Unmarshal(b, &pk); err != nil {
+		return pk, err
+	}
+	log.Debugf("User passkey added successfully: %d (%s)", userID, label)
+	return pk, nil
+}
+
+// UserPasskeyRevoke removes one of the additional passkeys of the user
+func (c *Client) UserPasskeyRevoke(userID uint32, passkey string) error {
+	resp, err := h.DoRequest(c.client, "DELETE", c.u(fmt.Sprintf("/passkey/%d/%s", userID, passkey)), nil, c.headers())
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return readStatus(resp)
+	}
+	log.Debugf("User passkey revoked successfully: %d", userID)
+	return nil
+}
+
+// UserPasskeys returns the additional passkeys of the user, such as the passkeys of their devices and
+// previous passkeys which are still within their grace period
+func (c *Client) UserPasskeys(userID uint32) ([]model.Passkey, error) {
+	resp, err := h.DoRequest(c.client, "GET", c.u(fmt.Sprintf("/user/%d/passkey", userID)), nil, c.headers())
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, readStatus(resp)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var passkeys []model.Passkey
+	if err := json.Unmarshal(b, &passkeys); err != nil {
+		return nil, err
+	}
+	return passkeys, nil
+}
+
+// PromotionAdd creates a new promotion or replaces an existing promotion with the same name
+func (c *Client) PromotionAdd(promo model.Promotion) error {
+	resp, err := h.DoRequest(c.client, "POST", c.u("/promotion"), promo, c.headers())
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return readStatus(resp)
+	}
+	log.Debugf("Promotion added successfully: %s", promo.Name)
+	return nil
+}
+
+// PromotionDelete deletes the promotion matching the name provided
+func (c *Client) PromotionDelete(name string) error {
+	resp, err := h.DoRequest(c.client, "DELETE", c.u(fmt.Sprintf("/promotion/%s", name)), nil, c.headers())
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return readStatus(resp)
+	}
+	log.Debugf("Promotion deleted successfully: %s", name)
+	return nil
+}
+
+// PromotionGetAll returns all the promotions known to the tracker
+func (c *Client) PromotionGetAll() ([]model.Promotion, error) {
+	resp, err := h.DoRequest(c.client, "GET", c.u("/promotion"), nil, c.headers())
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, readStatus(resp)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var promos []model.Promotion
+	if err := json.Unmarshal(b, &promos); err != nil {
+		return nil, err
+	}
+	return promos, nil
+}
+
+// BanAdd bans the addresses and CIDR ranges provided, replacing any existing bans with the same CIDR
+func (c *Client) BanAdd(bans []model.Ban) error {
+	resp, err := h.DoRequest(c.client, "POST", c.u("/ban"), bans, c.headers())
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return readStatus(resp)
+	}
+	log.Debugf("Added %d bans successfully", len(bans))
+	return nil
+}
+
+// BanDelete lifts the ban matching the address or CIDR range provided
+func (c *Client) BanDelete(cidr string) error {
+	n, err := model.ParseBanNetwork(cidr)
+	if err != nil {
+		return err
+	}
+	resp, err := h.DoRequest(c.client, "DELETE", c.u(fmt.Sprintf("/ban/%s", n.String())), nil, c.headers())
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return readStatus(resp)
+	}
+	log.Debugf("Ban deleted successfully: %s", n.String())
+	return nil
+}
+
+// BanGetAll returns all the bans known to the tracker
+func (c *Client) BanGetAll() ([]model.Ban, error) {
+	resp, err := h.DoRequest(c.client, "GET", c.u("/ban"), nil, c.headers())
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, readStatus(resp)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var bans []model.Ban
+	if err := json.Unmarshal(b, &bans); err != nil {
+		return nil, err
+	}
+	return bans, nil
+}
+
+// HNRGetByUser returns the hit and run records for the user
+func (c *Client) HNRGetByUser(userID uint32) ([]model.HitAndRun, error) {
+	resp, err := h.DoRequest(c.client, "GET", c.u(fmt.Sprintf("/hnr/user/%d", userID)), nil, c.headers())
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, readStatus(resp)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var records []model.HitAndRun
+	if err := json.Unmarshal(b, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// HNRDelete removes the hit and run record for the user and torrent
+func (c *Client) HNRDelete(userID uint32, ih model.InfoHash) error {
+	resp, err := h.DoRequest(c.client, "DELETE", c.u(fmt.Sprintf("/hnr/%d/%s", userID, ih.String())), nil, c.headers())
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return readStatus(resp)
+	}
+	log.Debugf("Hit and run deleted successfully: %d %s", userID, ih.String())
+	return nil
+}
+
+// snatchGet fetches the snatches from the API path provided
+func (c *Client) snatchGet(path string) ([]model.Snatch, error) {
+	resp, err := h.DoRequest(c.client, "GET", c.u(path), nil, c.headers())
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, readStatus(resp)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var snatches []model.Snatch
+	if err := json.Unmarshal(b, &snatches); err != nil {
+		return nil, err
+	}
+	return snatches, nil
+}
+
+// SnatchGetByUser returns up to limit snatches of the user starting from offset, newest first
+func (c *Client) SnatchGetByUser(userID uint32, offset int, limit int) ([]model.Snatch, error) {
+	return c.snatchGet(fmt.Sprintf("/snatch/user/%d?offset=%d&limit=%d", userID, offset, limit))
+}
+
+// SnatchGetByTorrent returns up to limit snatches of the torrent starting from offset, newest first
+func (c *Client) SnatchGetByTorrent(ih model.InfoHash, offset int, limit int) ([]model.Snatch, error) {
+	return c.snatchGet(fmt.Sprintf("/snatch/torrent/%s?offset=%d&limit=%d", ih.String(), offset, limit))
+}
+
+// FreeleechGrant grants the user personal freeleech on the torrent until the expiry time provided
+func (c *Client) FreeleechGrant(userID uint32, ih model.InfoHash, expire time.Time) error {
+	resp, err := h.DoRequest(c.client, "POST", c.u(fmt.Sprintf("/freeleech/%d/%s", userID, ih.String())),
+		h.FreeleechGrantRequest{TimeExpire: expire}, c.headers())
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return readStatus(resp)
+	}
+	log.Debugf("Freeleech token granted successfully: %d %s", userID, ih.String())
+	return nil
+}
+
+// FreeleechConsume removes the users freeleech token for the torrent
+func (c *Client) FreeleechConsume(userID uint32, ih model.InfoHash) error {
+	resp, err := h.DoRequest(c.client, "DELETE", c.u(fmt.Sprintf("/freeleech/%d/%s", userID, ih.String())),
+		nil, c.headers())
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return readStatus(resp)
+	}
+	log.Debugf("Freeleech token consumed successfully: %d %s", userID, ih.String())
+	return nil
+}
+
+// FreeleechGetByUser returns the freeleech tokens of the user
+func (c *Client) FreeleechGetByUser(userID uint32) ([]model.FreeleechToken, error) {
+	resp, err := h.DoRequest(c.client, "GET", c.u(fmt.Sprintf("/freeleech/user/%d", userID)), nil, c.headers())
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, readStatus(resp)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var tokens []model.FreeleechToken
+	if err := json.Unmarshal(b, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// bonusRequest performs the bonus point request returning the users resulting bonus points
+func (c *Client) bonusRequest(method string, userID uint32, payload interface{}) (float64, error) {
+	resp, err := h.DoRequest(c.client, method, c.u(fmt.Sprintf("/bonus/%d", userID)), payload, c.headers())
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, readStatus(resp)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var bonus h.BonusResponse
+	if err := json.Unmarshal(b, &bonus); err != nil {
+		return 0, err
+	}
+	return bonus.BonusPoints, nil
+}
+
+// BonusGet returns the bonus points of the user
+func (c *Client) BonusGet(userID uint32) (float64, error) {
+	return c.bonusRequest("GET", userID, nil)
+}
+
+// BonusAdjust adds the amount to the users bonus points, negative amounts remove points. The
+// users new bonus points are returned.
+func (c *Client) BonusAdjust(userID uint32, amount float64) (float64, error) {
+	return c.bonusRequest("POST", userID, h.BonusAdjustRequest{Amount: amount})
+}
+
+// LedgerAdjust applies a manual adjustment to the users stats, returning the recorded ledger entry
+func (c *Client) LedgerAdjust(userID uint32, req h.LedgerAdjustRequest) (model.LedgerEntry, error) {
+	var entry model.LedgerEntry
+	resp, err := h.DoRequest(c.client, "POST", c.u(fmt.Sprintf("/ledger/%d", userID)), req, c.headers())
+	if err != nil {
+		return entry, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return entry, readStatus(resp)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return entry, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return entry, err
+	}
+	log.Debugf("Ledger adjustment applied successfully: %d", userID)
+	return entry, nil
+}
+
+// LedgerGetByUser returns up to limit ledger entries of the user starting from offset, newest first
+func (c *Client) LedgerGetByUser(userID uint32, offset int, limit int) ([]model.LedgerEntry, error) {
+	resp, err := h.DoRequest(c.client, "GET",
+		c.u(fmt.Sprintf("/ledger/%d?offset=%d&limit=%d", userID, offset, limit)), nil, c.headers())
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, readStatus(resp)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var entries []model.LedgerEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// RatioWatchGetAll returns the ratio rules and the users who are warned or have downloading disabled
+func (c *Client) RatioWatchGetAll() (h.RatioWatchResponse, error) {
+	var rwr h.RatioWatchResponse
+	resp, err := h.DoRequest(c.client, "GET", c.u("/ratio_watch"), nil, c.headers())
+	if err != nil {
+		return rwr, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return rwr, readStatus(resp)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return rwr, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if err := json.Unmarshal(b, &rwr); err != nil {
+		return rwr, err
+	}
+	return rwr, nil
+}
+
+// RatioWatchGet returns the ratio watch record of the user
+func (c *Client) RatioWatchGet(userID uint32) (model.RatioWatch, error) {
+	var rw model.RatioWatch
+	resp, err := h.DoRequest(c.client, "GET", c.u(fmt.Sprintf("/ratio_watch/%d", userID)), nil, c.headers())
+	if err != nil {
+		return rw, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return rw, readStatus(resp)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return rw, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if err := json.Unmarshal(b, &rw); err != nil {
+		return rw, err
+	}
+	return rw, nil
+}
+
+// RatioWatchClear clears the ratio watch of the user, re-enabling downloading if it was disabled
+func (c *Client) RatioWatchClear(userID uint32) error {
+	resp, err := h.DoRequest(c.client, "DELETE", c.u(fmt.Sprintf("/ratio_watch/%d", userID)), nil, c.headers())
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return readStatus(resp)
+	}
+	log.Debugf("Ratio watch cleared successfully: %d", userID)
+	return nil
+}
+
 // Ping tests communication between the API server and the client
 func (c *Client) Ping() error {
 	const msg = "hello world"
@@ -6,6 +6,7 @@ import (
 	"github.com/leighmacdonald/mika/examples/api"
 	h "github.com/leighmacdonald/mika/http"
 	"github.com/leighmacdonald/mika/model"
+	"github.com/leighmacdonald/mika/store"
 	"github.com/leighmacdonald/mika/tracker"
 	"github.com/stretchr/testify/require"
 	"net/http"
@@ -17,6 +18,7 @@ import (
 var (
 	host   = "localhost:34100"
 	server *http.Server
+	tkr    *tracker.Tracker
 	ihStr  = "ff503e9ca036f1647c2dfc1337b163e2c54f13f8"
 )
 
@@ -27,6 +29,269 @@ func TestClient_Torrent(t *testing.T) {
 	require.NoError(t, c.TorrentAdd(ih, "test torrent"))
 	require.NoError(t, c.TorrentDelete(ih))
 
+	multi := -1.0
+	resp, err := h.DoRequest(c.client, "POST", c.u("/torrent"), h.TorrentAddRequest{
+		InfoHash: ih.String(),
+		Name:     "negative multiplier",
+		MultiUp:  &multi,
+	}, c.headers())
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestClient_Promotion(t *testing.T) {
+	c := New(host, api.DefaultAuthKey)
+	var ih model.InfoHash
+	_ = model.InfoHashFromString(&ih, ihStr)
+	promo := model.Promotion{
+		Name:       "double_up",
+		Scope:      model.PromotionTorrent,
+		InfoHashes: model.InfoHashes{ih},
+		MultiUp:    2,
+		MultiDn:    1,
+		TimeStart:  time.Now(),
+		TimeEnd:    time.Now().Add(time.Hour),
+	}
+	require.NoError(t, c.PromotionAdd(promo))
+	promos, err := c.PromotionGetAll()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(promos))
+	require.Equal(t, promo.InfoHashes, promos[0].InfoHashes)
+	require.NoError(t, c.PromotionDelete(promo.Name))
+	require.Error(t, c.PromotionDelete(promo.Name))
+	promo.TimeEnd = promo.TimeStart
+	require.Error(t, c.PromotionAdd(promo))
+}
+
+func TestClient_Ban(t *testing.T) {
+	c := New(host, api.DefaultAuthKey)
+	now := time.Now()
+	require.NoError(t, c.BanAdd([]model.Ban{
+		{CIDR: "10.0.0.1", Reason: "address"},
+		{CIDR: "2001:db8::/32", Reason: "network", TimeExpire: now.Add(time.Hour)},
+	}))
+	bans, err := c.BanGetAll()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(bans))
+	require.Equal(t, "10.0.0.1/32", bans[0].CIDR)
+	require.True(t, bans[0].Permanent())
+	require.False(t, bans[1].Permanent())
+	require.Error(t, c.BanAdd([]model.Ban{{CIDR: "10.0.0.256", Reason: "invalid"}}))
+	require.Error(t, c.BanAdd([]model.Ban{{CIDR: "10.0.0.2"}}))
+	require.NoError(t, c.BanDelete("10.0.0.1"))
+	require.Error(t, c.BanDelete("10.0.0.1"))
+	require.NoError(t, c.BanDelete("2001:db8::/32"))
+	bans, err = c.BanGetAll()
+	require.NoError(t, err)
+	require.Equal(t, 0, len(bans))
+}
+
+func TestClient_HNR(t *testing.T) {
+	c := New(host, api.DefaultAuthKey)
+	var ih model.InfoHash
+	_ = model.InfoHashFromString(&ih, ihStr)
+	hnr := model.NewHitAndRun(100, ih, time.Now().Add(-time.Hour))
+	require.NoError(t, tkr.Users.HNRSync([]model.HitAndRun{hnr}))
+	records, err := c.HNRGetByUser(hnr.UserID)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(records))
+	require.Equal(t, ih, records[0].InfoHash)
+	require.Equal(t, model.HNRPending, records[0].Status)
+	require.NoError(t, c.HNRDelete(hnr.UserID, ih))
+	require.Error(t, c.HNRDelete(hnr.UserID, ih))
+	records, err = c.HNRGetByUser(hnr.UserID)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(records))
+}
+
+func TestClient_Snatch(t *testing.T) {
+	c := New(host, api.DefaultAuthKey)
+	var ih model.InfoHash
+	_ = model.InfoHashFromString(&ih, ihStr)
+	now := time.Now()
+	require.NoError(t, tkr.Users.SnatchAdd([]model.Snatch{
+		{UserID: 100, InfoHash: ih, TimeCompleted: now.Add(-time.Hour)},
+		{UserID: 101, InfoHash: ih, TimeCompleted: now},
+	}))
+	snatches, err := c.SnatchGetByTorrent(ih, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(snatches))
+	require.Equal(t, uint32(101), snatches[0].UserID)
+	snatches, err = c.SnatchGetByTorrent(ih, 1, 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(snatches))
+	require.Equal(t, uint32(100), snatches[0].UserID)
+	snatches, err = c.SnatchGetByUser(100, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(snatches))
+	_, err = c.SnatchGetByUser(100, 0, 0)
+	require.Error(t, err)
+}
+
+func TestClient_Freeleech(t *testing.T) {
+	c := New(host, api.DefaultAuthKey)
+	user := store.GenerateTestUser()
+	require.NoError(t, tkr.Users.Add(user))
+	tor := store.GenerateTestTorrent()
+	require.NoError(t, tkr.Torrents.Add(tor))
+	require.NoError(t, c.FreeleechGrant(user.UserID, tor.InfoHash, time.Now().Add(time.Hour)))
+	require.True(t, tkr.FreeleechActive(user.UserID, tor.InfoHash, time.Now()))
+	tokens, err := c.FreeleechGetByUser(user.UserID)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(tokens))
+	require.Equal(t, tor.InfoHash, tokens[0].InfoHash)
+	// Tokens must expire in the future and apply to known torrents
+	require.Error(t, c.FreeleechGrant(user.UserID, tor.InfoHash, time.Now().Add(-time.Hour)))
+	require.Error(t, c.FreeleechGrant(user.UserID, store.GenerateTestTorrent().InfoHash, time.Now().Add(time.Hour)))
+	require.NoError(t, c.FreeleechConsume(user.UserID, tor.InfoHash))
+	require.Error(t, c.FreeleechConsume(user.UserID, tor.InfoHash))
+	tokens, err = c.FreeleechGetByUser(user.UserID)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(tokens))
+}
+
+func TestClient_Bonus(t *testing.T) {
+	c := New(host, api.DefaultAuthKey)
+	user := store.GenerateTestUser()
+	user.BonusPoints = 10
+	require.NoError(t, tkr.Users.Add(user))
+	points, err := c.BonusGet(user.UserID)
+	require.NoError(t, err)
+	require.Equal(t, 10.0, points)
+	points, err = c.BonusAdjust(user.UserID, -2.5)
+	require.NoError(t, err)
+	require.Equal(t, 7.5, points)
+	points, err = c.BonusGet(user.UserID)
+	require.NoError(t, err)
+	require.Equal(t, 7.5, points)
+	// Users cannot be left with negative points
+	_, err = c.BonusAdjust(user.UserID, -10)
+	require.Error(t, err)
+	_, err = c.BonusGet(0)
+	require.Error(t, err)
+}
+
+func TestClient_Ledger(t *testing.T) {
+	c := New(host, api.DefaultAuthKey)
+	user := store.GenerateTestUser()
+	user.Uploaded = 1000
+	require.NoError(t, tkr.Users.Add(user))
+	entry, err := c.LedgerAdjust(user.UserID, h.LedgerAdjustRequest{
+		Uploaded: 500, Reason: "Compensation for tracker outage", Actor: "admin"})
+	require.NoError(t, err)
+	require.Equal(t, model.LedgerAdjustment, entry.Source)
+	var updated model.User
+	require.NoError(t, tkr.Users.GetByID(&updated, user.UserID))
+	require.Equal(t, uint64(1500), updated.Uploaded)
+	// Adjustments must be attributed
+	_, err = c.LedgerAdjust(user.UserID, h.LedgerAdjustRequest{Uploaded: 500})
+	require.Error(t, err)
+	// Totals cannot go below zero
+	_, err = c.LedgerAdjust(user.UserID, h.LedgerAdjustRequest{
+		Uploaded: -2000, Reason: "Cheating", Actor: "admin"})
+	require.Error(t, err)
+	_, err = c.BonusAdjust(user.UserID, 5)
+	require.NoError(t, err)
+	entries, err := c.LedgerGetByUser(user.UserID, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(entries))
+	require.Equal(t, 5.0, entries[0].BonusPoints)
+	require.Equal(t, int64(500), entries[1].Uploaded)
+	require.Equal(t, "admin", entries[1].Actor)
+}
+
+func TestClient_RatioWatch(t *testing.T) {
+	c := New(host, api.DefaultAuthKey)
+	user := store.GenerateTestUser()
+	user.Uploaded = 100
+	user.Downloaded = 1000
+	require.NoError(t, tkr.Users.Add(user))
+	tkr.RatioWatchRatio = 0.5
+	defer func() { tkr.RatioWatchRatio = 0 }()
+	tkr.RatioWatchMinDownload = 1000
+	require.NotEmpty(t, tkr.RatioWatchCheck(user, time.Now()))
+	rwr, err := c.RatioWatchGetAll()
+	require.NoError(t, err)
+	require.Equal(t, 0.5, rwr.Rules.Ratio)
+	require.Equal(t, 1, len(rwr.Records))
+	rw, err := c.RatioWatchGet(user.UserID)
+	require.NoError(t, err)
+	require.Equal(t, model.RatioWatchWarned, rw.Status)
+	require.NoError(t, c.RatioWatchClear(user.UserID))
+	require.Error(t, c.RatioWatchClear(user.UserID))
+	rw, err = c.RatioWatchGet(user.UserID)
+	require.NoError(t, err)
+	require.Equal(t, model.RatioWatchCleared, rw.Status)
+}
+
+func TestClient_UserUpdate(t *testing.T) {
+	c := New(host, api.DefaultAuthKey)
+	user := store.GenerateTestUser()
+	require.NoError(t, tkr.Users.Add(user))
+	require.NoError(t, c.UserSetDownloadEnabled(user.UserID, false))
+	fetched, err := c.UserGet(user.UserID)
+	require.NoError(t, err)
+	require.False(t, fetched.DownloadEnabled)
+	require.NoError(t, c.UserSetDownloadEnabled(user.UserID, true))
+	fetched, err = c.UserGet(user.UserID)
+	require.NoError(t, err)
+	require.True(t, fetched.DownloadEnabled)
+	limits := model.SlotLimits{Leech: 2, Seed: -1}
+	require.NoError(t, c.UserSetSlotLimits(user.UserID, limits))
+	fetched, err = c.UserGet(user.UserID)
+	require.NoError(t, err)
+	require.Equal(t, limits, fetched.SlotLimits)
+	require.True(t, fetched.DownloadEnabled)
+	require.Error(t, c.UserSetDownloadEnabled(user.UserID+1000000, false))
+	_, err = c.UserGet(user.UserID + 1000000)
+	require.Error(t, err)
+}
+
+func TestClient_UserRotatePasskey(t *testing.T) {
+	c := New(host, api.DefaultAuthKey)
+	user := store.GenerateTestUser()
+	require.NoError(t, tkr.Users.Add(user))
+	expire := time.Now().Add(time.Hour)
+	resp, err := c.UserRotatePasskey(user.UserID, "", expire)
+	require.NoError(t, err)
+	require.Len(t, resp.Passkey, 20)
+	require.Equal(t, user.Passkey, resp.Previous.Passkey)
+	require.True(t, expire.Equal(resp.Previous.TimeExpire))
+	fetched, err := c.UserGet(user.UserID)
+	require.NoError(t, err)
+	require.Equal(t, resp.Passkey, fetched.Passkey)
+	passkeys, err := c.UserPasskeys(user.UserID)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(passkeys))
+	require.Equal(t, user.Passkey, passkeys[0].Passkey)
+	_, err = c.UserRotatePasskey(user.UserID, "short", time.Time{})
+	require.Error(t, err)
+	_, err = c.UserRotatePasskey(user.UserID+1000000, "", time.Time{})
+	require.Error(t, err)
+}
+
+func TestClient_UserPasskeyAdd(t *testing.T) {
+	c := New(host, api.DefaultAuthKey)
+	user := store.GenerateTestUser()
+	require.NoError(t, tkr.Users.Add(user))
+	pk, err := c.UserPasskeyAdd(user.UserID, "seedbox", "", time.Time{})
+	require.NoError(t, err)
+	require.Len(t, pk.Passkey, 20)
+	require.Equal(t, "seedbox", pk.Label)
+	_, err = c.UserPasskeyAdd(user.UserID, "seedbox", "", time.Time{})
+	require.Error(t, err)
+	_, err = c.UserPasskeyAdd(user.UserID, "", "", time.Time{})
+	require.Error(t, err)
+	passkeys, err := c.UserPasskeys(user.UserID)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(passkeys))
+	require.Equal(t, pk.Passkey, passkeys[0].Passkey)
+	require.NoError(t, c.UserPasskeyRevoke(user.UserID, pk.Passkey))
+	require.Error(t, c.UserPasskeyRevoke(user.UserID, pk.Passkey))
+	passkeys, err = c.UserPasskeys(user.UserID)
+	require.NoError(t, err)
+	require.Empty(t, passkeys)
 }
 
 func TestClient_Ping(t *testing.T) {
@@ -36,7 +301,7 @@ func TestClient_Ping(t *testing.T) {
 
 func TestMain(m *testing.M) {
 	ctx := context.Background()
-	tkr, _, _, _ := tracker.NewTestTracker()
+	tkr, _, _, _ = tracker.NewTestTracker()
 	handler := h.NewAPIHandler(tkr)
 	server = h.CreateServer(handler, host, false)
 	go func() {
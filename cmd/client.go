@@ -5,11 +5,15 @@ import (
 	"fmt"
 	"github.com/leighmacdonald/mika/client"
 	"github.com/leighmacdonald/mika/config"
+	h "github.com/leighmacdonald/mika/http"
 	"github.com/leighmacdonald/mika/model"
 	"github.com/leighmacdonald/mika/util"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -159,16 +163,800 @@ var userDeleteCmd = &cobra.Command{
 	},
 }
 
+var userGetCmd = &cobra.Command{
+	Use:     "get <user_id>",
+	Aliases: []string{"g"},
+	Short:   "Show a user and their totals",
+	Long:    "Show a user and their totals, including leech attempts denied while downloading was disabled",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		user, err := newClient().UserGet(parseUserID(args[0]))
+		if err != nil {
+			log.Fatalf("Error fetching user: %s", err.Error())
+		}
+		fmt.Printf("%d\t%s\tdownload enabled: %t\tup: %d dn: %d\tannounces: %d\tleech denied: %d\t"+
+			"slots leech: %d seed: %d torrent: %d\n", user.UserID, user.Passkey, user.DownloadEnabled, user.Uploaded,
+			user.Downloaded, user.Announces, user.LeechDenied, user.Leech, user.Seed, user.PerTorrent)
+	},
+}
+
+var userDownloadCmd = &cobra.Command{
+	Use:     "download <user_id> <enable|disable>",
+	Aliases: []string{"dl"},
+	Short:   "Enable or disable downloading for a user",
+	Long:    "Enable or disable downloading for a user. Users with downloading disabled can still seed.",
+	Args:    cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		userID := parseUserID(args[0])
+		var enabled bool
+		switch args[1] {
+		case "enable", "on":
+			enabled = true
+		case "disable", "off":
+			enabled = false
+		default:
+			log.Fatalf("Invalid state, must be enable or disable: %s", args[1])
+		}
+		if err := newClient().UserSetDownloadEnabled(userID, enabled); err != nil {
+			log.Fatalf("Error updating user: %s", err.Error())
+		}
+	},
+}
+
+var userSlotsCmd = &cobra.Command{
+	Use:   "slots <user_id>",
+	Short: "Override the peer slot limits of a user",
+	Long: "Override the peer slot limits of a user. 0 uses the tracker wide limit while negative " +
+		"values remove the limit for the user.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		leech, _ := cmd.Flags().GetInt("leech")
+		seed, _ := cmd.Flags().GetInt("seed")
+		perTorrent, _ := cmd.Flags().GetInt("torrent")
+		limits := model.SlotLimits{Leech: leech, Seed: seed, PerTorrent: perTorrent}
+		if err := newClient().UserSetSlotLimits(parseUserID(args[0]), limits); err != nil {
+			log.Fatalf("Error updating user: %s", err.Error())
+		}
+	},
+}
+
+var userRotateCmd = &cobra.Command{
+	Use:     "rotate <user_id>",
+	Aliases: []string{"r"},
+	Short:   "Issue a new passkey for a user",
+	Long: `Issue a new passkey for a user, eg: after their passkey has leaked.
+
+The previous passkey keeps working for the trackers tracker_passkey_grace period unless
+--grace is set. Announces using the previous passkey are warned to redownload their
+.torrent files.
+
+eg: Stop the previous passkey from working immediately
+
+    mika client user rotate 100 --grace 0`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		passkey, _ := cmd.Flags().GetString("passkey")
+		var expire time.Time
+		if cmd.Flags().Changed("grace") {
+			grace, _ := cmd.Flags().GetDuration("grace")
+			expire = time.Now().Add(grace)
+		}
+		resp, err := newClient().UserRotatePasskey(parseUserID(args[0]), passkey, expire)
+		if err != nil {
+			log.Fatalf("Error rotating passkey: %s", err.Error())
+		}
+		log.Infof("New passkey: %s", resp.Passkey)
+		if resp.Previous.Passkey != "" {
+			log.Infof("Previous passkey %s works until %s", resp.Previous.Passkey,
+				resp.Previous.TimeExpire.Format(time.RFC3339))
+		}
+	},
+}
+
+// userPasskeyCmd represents the base client user passkey command set
+var userPasskeyCmd = &cobra.Command{
+	Use:     "passkey",
+	Aliases: []string{"pk"},
+	Short:   "Manage the additional passkeys of a user",
+	Long: `Manage the additional passkeys of a user.
+
+Users can hold a labelled passkey for each of their devices or seedboxes. Every passkey
+resolves to the same user and can be revoked on its own.`,
+}
+
+var userPasskeyAddCmd = &cobra.Command{
+	Use:     "add <user_id> <label>",
+	Aliases: []string{"a"},
+	Short:   "Add a labelled passkey for one of the users devices",
+	Long: `Add a labelled passkey for one of the users devices.
+
+eg: Give a users seedbox its own passkey
+
+    mika client user passkey add 100 seedbox`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		passkey, _ := cmd.Flags().GetString("passkey")
+		var expire time.Time
+		if duration, _ := cmd.Flags().GetDuration("duration"); duration > 0 {
+			expire = time.Now().Add(duration)
+		}
+		pk, err := newClient().UserPasskeyAdd(parseUserID(args[0]), args[1], passkey, expire)
+		if err != nil {
+			log.Fatalf("Error adding passkey: %s", err.Error())
+		}
+		log.Infof("New %s passkey: %s", pk.Label, pk.Passkey)
+	},
+}
+
+var userPasskeyRevokeCmd = &cobra.Command{
+	Use:     "revoke <user_id> <passkey>",
+	Aliases: []string{"rm"},
+	Short:   "Revoke one of the additional passkeys of a user",
+	Long:    "Revoke one of the additional passkeys of a user",
+	Args:    cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := newClient().UserPasskeyRevoke(parseUserID(args[0]), args[1]); err != nil {
+			log.Fatalf("Error revoking passkey: %s", err.Error())
+		}
+		log.Infof("Revoked passkey successfully")
+	},
+}
+
+var userPasskeyListCmd = &cobra.Command{
+	Use:     "list <user_id>",
+	Aliases: []string{"ls", "l"},
+	Short:   "List the additional passkeys of a user",
+	Long:    "List the additional passkeys of a user along with when and where they were last used",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		passkeys, err := newClient().UserPasskeys(parseUserID(args[0]))
+		if err != nil {
+			log.Fatalf("Error fetching passkeys: %s", err.Error())
+		}
+		for _, pk := range passkeys {
+			expire := "never"
+			if !pk.TimeExpire.IsZero() {
+				expire = pk.TimeExpire.Format(time.RFC3339)
+			}
+			lastUsed := "never"
+			if !pk.TimeLastUsed.IsZero() {
+				lastUsed = fmt.Sprintf("%s %s", pk.TimeLastUsed.Format(time.RFC3339), pk.IP)
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\n", pk.Passkey, pk.Label, expire, lastUsed)
+		}
+	},
+}
+
+// promotionCmd represents the base client promotion command set
+var promotionCmd = &cobra.Command{
+	Use:     "promotion",
+	Aliases: []string{"p"},
+	Short:   "Promotion administration related operations",
+	Long:    "Promotion administration related operations",
+}
+
+var promotionAddCmd = &cobra.Command{
+	Use:     "add",
+	Aliases: []string{"a"},
+	Short:   "Add or replace a scheduled promotion",
+	Long: `Add or replace a scheduled promotion. 
+
+Promotions apply to every torrent (global), torrents with a tag (tag) or a list of info hashes (torrent).
+eg: Weekend freeleech starting now
+
+    mika client promotion add -n weekend -s global --dn 0 -d 48h`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := cmd.Flags()
+		name, _ := flags.GetString("name")
+		scope, _ := flags.GetString("scope")
+		tag, _ := flags.GetString("tag")
+		hashes, _ := flags.GetString("info-hashes")
+		multiUp, _ := flags.GetFloat64("up")
+		multiDn, _ := flags.GetFloat64("dn")
+		startStr, _ := flags.GetString("start")
+		duration, _ := flags.GetDuration("duration")
+		start := time.Now()
+		if startStr != "" {
+			t, err := time.Parse(time.RFC3339, startStr)
+			if err != nil {
+				log.Fatalf("Invalid start time, expected RFC3339 format: %s", startStr)
+			}
+			start = t
+		}
+		infoHashes, err := model.ParseInfoHashes(hashes)
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		promo := model.Promotion{
+			Name:       name,
+			Scope:      model.PromotionScope(scope),
+			Tag:        tag,
+			InfoHashes: infoHashes,
+			MultiUp:    multiUp,
+			MultiDn:    multiDn,
+			TimeStart:  start,
+			TimeEnd:    start.Add(duration),
+		}
+		if err := promo.Validate(); err != nil {
+			log.Fatalf("Invalid promotion: %s", err.Error())
+		}
+		if err := newClient().PromotionAdd(promo); err != nil {
+			log.Fatalf("Error adding promotion: %s", err.Error())
+		}
+		log.Infof("Added promotion: %s", name)
+	},
+}
+
+var promotionDeleteCmd = &cobra.Command{
+	Use:     "delete",
+	Aliases: []string{"del", "d"},
+	Short:   "Delete a promotion",
+	Long:    "Delete a promotion",
+	Args:    cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := newClient()
+		for _, name := range args {
+			if err := c.PromotionDelete(name); err != nil {
+				log.Fatalf("Error trying to delete %s: %s", name, err.Error())
+			}
+		}
+	},
+}
+
+var promotionListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls", "l"},
+	Short:   "List the known promotions",
+	Long:    "List the known promotions",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		promos, err := newClient().PromotionGetAll()
+		if err != nil {
+			log.Fatalf("Error fetching promotions: %s", err.Error())
+		}
+		for _, p := range promos {
+			fmt.Printf("%s\t%s\t%s%s\tup: %.2f dn: %.2f\t%s - %s\n", p.Name, p.Scope, p.Tag, p.InfoHashes,
+				p.MultiUp, p.MultiDn, p.TimeStart.Format(time.RFC3339), p.TimeEnd.Format(time.RFC3339))
+		}
+	},
+}
+
+// banImportBatchSize is the number of bans sent in each request when importing a blocklist
+const banImportBatchSize = 5000
+
+// banCmd represents the base client ban command set
+var banCmd = &cobra.Command{
+	Use:   "ban",
+	Short: "IP and CIDR ban administration related operations",
+	Long:  "IP and CIDR ban administration related operations",
+}
+
+// banExpiry returns the expiry time for the duration flag, 0 creates a permanent ban
+func banExpiry(cmd *cobra.Command, now time.Time) time.Time {
+	duration, _ := cmd.Flags().GetDuration("duration")
+	if duration <= 0 {
+		return time.Time{}
+	}
+	return now.Add(duration)
+}
+
+var banAddCmd = &cobra.Command{
+	Use:     "add <ip|cidr>...",
+	Aliases: []string{"a"},
+	Short:   "Ban IPs or CIDR ranges",
+	Long: `Ban IPs or CIDR ranges, both IPv4 and IPv6 are supported.
+
+eg: Ban a network for a week
+
+    mika client ban add 10.0.0.0/24 -r "Monitoring network" -d 168h`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		reason, _ := cmd.Flags().GetString("reason")
+		now := time.Now()
+		expire := banExpiry(cmd, now)
+		var bans []model.Ban
+		for _, addr := range args {
+			b, err := model.NewBan(addr, reason, now, expire)
+			if err != nil {
+				log.Fatalf("Invalid ban %s: %s", addr, err.Error())
+			}
+			bans = append(bans, b)
+		}
+		if err := newClient().BanAdd(bans); err != nil {
+			log.Fatalf("Error adding bans: %s", err.Error())
+		}
+	},
+}
+
+var banDeleteCmd = &cobra.Command{
+	Use:     "delete <ip|cidr>...",
+	Aliases: []string{"del", "d"},
+	Short:   "Lift bans on IPs or CIDR ranges",
+	Long:    "Lift bans on IPs or CIDR ranges",
+	Args:    cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := newClient()
+		for _, addr := range args {
+			if err := c.BanDelete(addr); err != nil {
+				log.Fatalf("Error trying to delete %s: %s", addr, err.Error())
+			}
+		}
+	},
+}
+
+var banListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls", "l"},
+	Short:   "List the banned IPs and CIDR ranges",
+	Long:    "List the banned IPs and CIDR ranges",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		bans, err := newClient().BanGetAll()
+		if err != nil {
+			log.Fatalf("Error fetching bans: %s", err.Error())
+		}
+		for _, b := range bans {
+			expire := "never"
+			if !b.Permanent() {
+				expire = b.TimeExpire.Format(time.RFC3339)
+			}
+			fmt.Printf("%s\t%s\t%s\n", b.CIDR, expire, b.Reason)
+		}
+	},
+}
+
+var banImportCmd = &cobra.Command{
+	Use:     "import <file>...",
+	Aliases: []string{"i"},
+	Short:   "Import PeerGuardian .p2p or eMule .dat blocklists",
+	Long: `Import PeerGuardian .p2p or eMule .dat blocklists from local disk.
+
+Ranges are converted into CIDR bans using the description of each range as the reason.
+eMule ranges with an access level of 127 or higher are allowed ranges and are skipped.
+
+    mika client ban import level1.p2p ipfilter.dat`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		reason, _ := cmd.Flags().GetString("reason")
+		now := time.Now()
+		expire := banExpiry(cmd, now)
+		c := newClient()
+		for _, path := range args {
+			f, err := os.Open(path)
+			if err != nil {
+				log.Fatalf("Failed to open blocklist: %s", err.Error())
+			}
+			bans, err := model.ParseBlocklist(f, now, expire)
+			_ = f.Close()
+			if err != nil {
+				log.Fatalf("Failed to parse blocklist %s: %s", path, err.Error())
+			}
+			if reason != "" {
+				for i := range bans {
+					bans[i].Reason = reason
+				}
+			}
+			for i := 0; i < len(bans); i += banImportBatchSize {
+				if err := c.BanAdd(bans[i:util.MinInt(i+banImportBatchSize, len(bans))]); err != nil {
+					log.Fatalf("Error adding bans: %s", err.Error())
+				}
+			}
+			log.Infof("Imported %d bans from %s", len(bans), path)
+		}
+	},
+}
+
+// hnrCmd represents the base client hit and run command set
+var hnrCmd = &cobra.Command{
+	Use:   "hnr",
+	Short: "Hit and run administration related operations",
+	Long:  "Hit and run administration related operations",
+}
+
+// parseUserID parses a user_id argument
+func parseUserID(s string) uint32 {
+	userID, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || userID == 0 {
+		log.Fatalf("Invalid user_id: %s", s)
+	}
+	return uint32(userID)
+}
+
+var hnrListCmd = &cobra.Command{
+	Use:     "list <user_id>",
+	Aliases: []string{"ls", "l"},
+	Short:   "List the hit and run records of a user",
+	Long:    "List the hit and run records of a user",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		records, err := newClient().HNRGetByUser(parseUserID(args[0]))
+		if err != nil {
+			log.Fatalf("Error fetching hit and runs: %s", err.Error())
+		}
+		for _, h := range records {
+			fmt.Printf("%s\t%s\tseeded: %s\tcompleted: %s\tlast seed: %s\n", h.InfoHash.String(), h.Status,
+				time.Duration(h.SeedTime)*time.Second, h.TimeCompleted.Format(time.RFC3339),
+				h.TimeLastSeed.Format(time.RFC3339))
+		}
+	},
+}
+
+var hnrForgiveCmd = &cobra.Command{
+	Use:     "forgive <user_id> <info_hash>...",
+	Aliases: []string{"delete", "del", "d"},
+	Short:   "Remove hit and run records of a user",
+	Long:    "Remove hit and run records of a user",
+	Args:    cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := newClient()
+		userID := parseUserID(args[0])
+		var ih model.InfoHash
+		for _, hashString := range args[1:] {
+			if err := model.InfoHashFromString(&ih, hashString); err != nil {
+				log.Fatalf("Error trying to parse infohash %s: %s", hashString, err.Error())
+			}
+			if err := c.HNRDelete(userID, ih); err != nil {
+				log.Fatalf("Error trying to forgive %s: %s", hashString, err.Error())
+			}
+		}
+	},
+}
+
+// snatchCmd represents the base client snatch command set
+var snatchCmd = &cobra.Command{
+	Use:     "snatch",
+	Aliases: []string{"s"},
+	Short:   "Snatch history related operations",
+	Long:    "Snatch history related operations",
+}
+
+// printSnatches outputs the snatches, one per line
+func printSnatches(snatches []model.Snatch) {
+	for _, s := range snatches {
+		fmt.Printf("%d\t%s\t%s\t%s\t%s\tup: %d dn: %d\n", s.UserID, s.InfoHash.String(),
+			s.TimeCompleted.Format(time.RFC3339), s.IP, s.Client, s.Uploaded, s.Downloaded)
+	}
+}
+
+var snatchUserCmd = &cobra.Command{
+	Use:     "user <user_id>",
+	Aliases: []string{"u"},
+	Short:   "List the snatches of a user, newest first",
+	Long:    "List the snatches of a user, newest first",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		offset, _ := cmd.Flags().GetInt("offset")
+		limit, _ := cmd.Flags().GetInt("limit")
+		snatches, err := newClient().SnatchGetByUser(parseUserID(args[0]), offset, limit)
+		if err != nil {
+			log.Fatalf("Error fetching snatches: %s", err.Error())
+		}
+		printSnatches(snatches)
+	},
+}
+
+var snatchTorrentCmd = &cobra.Command{
+	Use:     "torrent <info_hash>",
+	Aliases: []string{"t"},
+	Short:   "List the snatches of a torrent, newest first",
+	Long:    "List the snatches of a torrent, newest first",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		offset, _ := cmd.Flags().GetInt("offset")
+		limit, _ := cmd.Flags().GetInt("limit")
+		var ih model.InfoHash
+		if err := model.InfoHashFromString(&ih, args[0]); err != nil {
+			log.Fatalf("Error trying to parse infohash %s: %s", args[0], err.Error())
+		}
+		snatches, err := newClient().SnatchGetByTorrent(ih, offset, limit)
+		if err != nil {
+			log.Fatalf("Error fetching snatches: %s", err.Error())
+		}
+		printSnatches(snatches)
+	},
+}
+
+// freeleechCmd represents the base client freeleech token command set
+var freeleechCmd = &cobra.Command{
+	Use:     "freeleech",
+	Aliases: []string{"fl"},
+	Short:   "Personal freeleech token related operations",
+	Long:    "Personal freeleech token related operations",
+}
+
+var freeleechGrantCmd = &cobra.Command{
+	Use:     "grant <user_id> <info_hash>",
+	Aliases: []string{"add", "a"},
+	Short:   "Grant a user personal freeleech on a torrent",
+	Long:    "Grant a user personal freeleech on a torrent",
+	Args:    cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		duration, _ := cmd.Flags().GetDuration("duration")
+		var ih model.InfoHash
+		if err := model.InfoHashFromString(&ih, args[1]); err != nil {
+			log.Fatalf("Error trying to parse infohash %s: %s", args[1], err.Error())
+		}
+		if err := newClient().FreeleechGrant(parseUserID(args[0]), ih, time.Now().Add(duration)); err != nil {
+			log.Fatalf("Error granting freeleech token: %s", err.Error())
+		}
+	},
+}
+
+var freeleechConsumeCmd = &cobra.Command{
+	Use:     "consume <user_id> <info_hash>",
+	Aliases: []string{"delete", "del", "d"},
+	Short:   "Remove a users personal freeleech on a torrent",
+	Long:    "Remove a users personal freeleech on a torrent",
+	Args:    cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		var ih model.InfoHash
+		if err := model.InfoHashFromString(&ih, args[1]); err != nil {
+			log.Fatalf("Error trying to parse infohash %s: %s", args[1], err.Error())
+		}
+		if err := newClient().FreeleechConsume(parseUserID(args[0]), ih); err != nil {
+			log.Fatalf("Error consuming freeleech token: %s", err.Error())
+		}
+	},
+}
+
+var freeleechListCmd = &cobra.Command{
+	Use:     "list <user_id>",
+	Aliases: []string{"ls", "l"},
+	Short:   "List the freeleech tokens of a user",
+	Long:    "List the freeleech tokens of a user",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		tokens, err := newClient().FreeleechGetByUser(parseUserID(args[0]))
+		if err != nil {
+			log.Fatalf("Error fetching freeleech tokens: %s", err.Error())
+		}
+		for _, f := range tokens {
+			fmt.Printf("%s\tgranted: %s\texpires: %s\n", f.InfoHash.String(),
+				f.TimeCreated.Format(time.RFC3339), f.TimeExpire.Format(time.RFC3339))
+		}
+	},
+}
+
+// bonusCmd represents the base client bonus point command set
+var bonusCmd = &cobra.Command{
+	Use:     "bonus",
+	Aliases: []string{"b"},
+	Short:   "Bonus point related operations",
+	Long:    "Bonus point related operations",
+}
+
+var bonusGetCmd = &cobra.Command{
+	Use:     "get <user_id>",
+	Aliases: []string{"g"},
+	Short:   "Show the bonus points of a user",
+	Long:    "Show the bonus points of a user",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		points, err := newClient().BonusGet(parseUserID(args[0]))
+		if err != nil {
+			log.Fatalf("Error fetching bonus points: %s", err.Error())
+		}
+		fmt.Printf("%.2f\n", points)
+	},
+}
+
+var bonusAdjustCmd = &cobra.Command{
+	Use:     "adjust <user_id> <amount>",
+	Aliases: []string{"a"},
+	Short:   "Add to the bonus points of a user, negative amounts remove points",
+	Long:    "Add to the bonus points of a user, negative amounts remove points",
+	Args:    cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		amount, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			log.Fatalf("Invalid amount: %s", args[1])
+		}
+		points, err := newClient().BonusAdjust(parseUserID(args[0]), amount)
+		if err != nil {
+			log.Fatalf("Error adjusting bonus points: %s", err.Error())
+		}
+		fmt.Printf("%.2f\n", points)
+	},
+}
+
+// ledgerCmd represents the base client stats ledger command set
+var ledgerCmd = &cobra.Command{
+	Use:     "ledger",
+	Aliases: []string{"led"},
+	Short:   "Stats ledger related operations",
+	Long:    "Stats ledger related operations",
+}
+
+var ledgerAdjustCmd = &cobra.Command{
+	Use:     "adjust <user_id>",
+	Aliases: []string{"a"},
+	Short:   "Manually adjust the stats of a user, negative values remove credit",
+	Long:    "Manually adjust the stats of a user, negative values remove credit",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		up, _ := cmd.Flags().GetInt64("up")
+		dn, _ := cmd.Flags().GetInt64("dn")
+		bonus, _ := cmd.Flags().GetFloat64("bonus")
+		reason, _ := cmd.Flags().GetString("reason")
+		actor, _ := cmd.Flags().GetString("actor")
+		entry, err := newClient().LedgerAdjust(parseUserID(args[0]), h.LedgerAdjustRequest{
+			Uploaded:    up,
+			Downloaded:  dn,
+			BonusPoints: bonus,
+			Reason:      reason,
+			Actor:       actor,
+		})
+		if err != nil {
+			log.Fatalf("Error adjusting stats: %s", err.Error())
+		}
+		printLedger([]model.LedgerEntry{entry})
+	},
+}
+
+// printLedger outputs the ledger entries, one per line
+func printLedger(entries []model.LedgerEntry) {
+	for _, e := range entries {
+		fmt.Printf("%s\t%s\tup: %d dn: %d bonus: %.2f\t%s\t%s\n", e.TimeCreated.Format(time.RFC3339),
+			e.Source, e.Uploaded, e.Downloaded, e.BonusPoints, e.Actor, e.Reason)
+	}
+}
+
+var ledgerListCmd = &cobra.Command{
+	Use:     "list <user_id>",
+	Aliases: []string{"ls", "l"},
+	Short:   "List the ledger entries of a user, newest first",
+	Long:    "List the ledger entries of a user, newest first",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		offset, _ := cmd.Flags().GetInt("offset")
+		limit, _ := cmd.Flags().GetInt("limit")
+		entries, err := newClient().LedgerGetByUser(parseUserID(args[0]), offset, limit)
+		if err != nil {
+			log.Fatalf("Error fetching ledger: %s", err.Error())
+		}
+		printLedger(entries)
+	},
+}
+
+// ratioWatchCmd represents the base client ratio watch command set
+var ratioWatchCmd = &cobra.Command{
+	Use:     "ratiowatch",
+	Aliases: []string{"rw"},
+	Short:   "Ratio watch related operations",
+	Long:    "Ratio watch related operations",
+}
+
+// printRatioWatch outputs the ratio watch record on a single line
+func printRatioWatch(rw model.RatioWatch) {
+	fmt.Printf("%d\t%s\tratio: %.2f required: %.2f\twarned: %s\tdeadline: %s\tupdated: %s\n", rw.UserID,
+		rw.Status, rw.Ratio, rw.RequiredRatio, rw.TimeWarned.Format(time.RFC3339),
+		rw.TimeDeadline.Format(time.RFC3339), rw.TimeUpdated.Format(time.RFC3339))
+}
+
+var ratioWatchListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls", "l"},
+	Short:   "List the ratio rules and the users being watched",
+	Long:    "List the ratio rules and the users being watched",
+	Run: func(cmd *cobra.Command, args []string) {
+		rwr, err := newClient().RatioWatchGetAll()
+		if err != nil {
+			log.Fatalf("Error fetching ratio watches: %s", err.Error())
+		}
+		fmt.Printf("ratio: %.2f min download: %d period: %s\n", rwr.Rules.Ratio, rwr.Rules.MinDownload,
+			rwr.Rules.Period)
+		for _, rw := range rwr.Records {
+			printRatioWatch(rw)
+		}
+	},
+}
+
+var ratioWatchGetCmd = &cobra.Command{
+	Use:     "get <user_id>",
+	Aliases: []string{"g"},
+	Short:   "Show the ratio watch of a user",
+	Long:    "Show the ratio watch of a user",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		rw, err := newClient().RatioWatchGet(parseUserID(args[0]))
+		if err != nil {
+			log.Fatalf("Error fetching ratio watch: %s", err.Error())
+		}
+		printRatioWatch(rw)
+	},
+}
+
+var ratioWatchClearCmd = &cobra.Command{
+	Use:     "clear <user_id>",
+	Aliases: []string{"delete", "del", "d"},
+	Short:   "Clear the ratio watch of a user, re-enabling downloading",
+	Long:    "Clear the ratio watch of a user, re-enabling downloading",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := newClient().RatioWatchClear(parseUserID(args[0])); err != nil {
+			log.Fatalf("Error clearing ratio watch: %s", err.Error())
+		}
+	},
+}
+
 func init() {
 	userAddCmd.PersistentFlags().StringP("passkey", "p", "", "User Passkey")
 	userDeleteCmd.PersistentFlags().StringP("passkey", "p", "", "User Passkey")
+	userSlotsCmd.Flags().Int("leech", 0, "Peers which may be downloading at once")
+	userSlotsCmd.Flags().Int("seed", 0, "Peers which may be seeding at once")
+	userSlotsCmd.Flags().Int("torrent", 0, "Peers which may be active in a single swarm")
+	userRotateCmd.Flags().StringP("passkey", "p", "", "New passkey, a random passkey is generated when empty")
+	userRotateCmd.Flags().DurationP("grace", "g", 0, "How long the previous passkey keeps working")
+	userPasskeyAddCmd.Flags().StringP("passkey", "p", "", "New passkey, a random passkey is generated when empty")
+	userPasskeyAddCmd.Flags().DurationP("duration", "d", 0, "How long the passkey works, 0 until revoked")
+	promotionAddCmd.Flags().StringP("name", "n", "", "Unique promotion name")
+	promotionAddCmd.Flags().StringP("scope", "s", string(model.PromotionGlobal), "Scope: global, tag or torrent")
+	promotionAddCmd.Flags().StringP("tag", "t", "", "Torrent tag for tag scoped promotions")
+	promotionAddCmd.Flags().StringP("info-hashes", "i", "", "Comma separated info hashes for torrent scoped promotions")
+	promotionAddCmd.Flags().Float64("up", 1.0, "Upload multiplier")
+	promotionAddCmd.Flags().Float64("dn", 1.0, "Download multiplier, 0 for freeleech")
+	promotionAddCmd.Flags().String("start", "", "Start time in RFC3339 format, defaults to now")
+	promotionAddCmd.Flags().DurationP("duration", "d", 24*time.Hour, "How long the promotion runs for")
 
 	torrentCmd.AddCommand(torrentAddCmd)
 	torrentCmd.AddCommand(torrentDeleteCmd)
 	userCmd.AddCommand(userAddCmd)
 	userCmd.AddCommand(userDeleteCmd)
+	userCmd.AddCommand(userGetCmd)
+	userCmd.AddCommand(userDownloadCmd)
+	userCmd.AddCommand(userSlotsCmd)
+	userCmd.AddCommand(userRotateCmd)
+	userPasskeyCmd.AddCommand(userPasskeyAddCmd)
+	userPasskeyCmd.AddCommand(userPasskeyRevokeCmd)
+	userPasskeyCmd.AddCommand(userPasskeyListCmd)
+	userCmd.AddCommand(userPasskeyCmd)
+	promotionCmd.AddCommand(promotionAddCmd)
+	promotionCmd.AddCommand(promotionDeleteCmd)
+	promotionCmd.AddCommand(promotionListCmd)
+	banAddCmd.Flags().StringP("reason", "r", "", "Reason for the ban")
+	banAddCmd.Flags().DurationP("duration", "d", 0, "How long the ban lasts, 0 for a permanent ban")
+	banImportCmd.Flags().StringP("reason", "r", "", "Reason used for every range instead of its description")
+	banImportCmd.Flags().DurationP("duration", "d", 0, "How long the bans last, 0 for permanent bans")
+	banCmd.AddCommand(banAddCmd)
+	banCmd.AddCommand(banDeleteCmd)
+	banCmd.AddCommand(banListCmd)
+	banCmd.AddCommand(banImportCmd)
+	snatchCmd.PersistentFlags().Int("offset", 0, "Number of snatches to skip")
+	snatchCmd.PersistentFlags().Int("limit", 50, "Maximum number of snatches to list")
+
+	hnrCmd.AddCommand(hnrListCmd)
+	hnrCmd.AddCommand(hnrForgiveCmd)
+	snatchCmd.AddCommand(snatchUserCmd)
+	snatchCmd.AddCommand(snatchTorrentCmd)
+	freeleechGrantCmd.Flags().DurationP("duration", "d", 24*time.Hour, "How long the token applies for")
+	freeleechCmd.AddCommand(freeleechGrantCmd)
+	freeleechCmd.AddCommand(freeleechConsumeCmd)
+	freeleechCmd.AddCommand(freeleechListCmd)
+	bonusCmd.AddCommand(bonusGetCmd)
+	bonusCmd.AddCommand(bonusAdjustCmd)
+	ledgerAdjustCmd.Flags().Int64("up", 0, "Change to the uploaded total in bytes")
+	ledgerAdjustCmd.Flags().Int64("dn", 0, "Change to the downloaded total in bytes")
+	ledgerAdjustCmd.Flags().Float64("bonus", 0, "Change to the bonus points")
+	ledgerAdjustCmd.Flags().StringP("reason", "r", "", "Reason for the adjustment")
+	ledgerAdjustCmd.Flags().StringP("actor", "a", "", "Who is making the adjustment")
+	ledgerListCmd.Flags().Int("offset", 0, "Number of entries to skip")
+	ledgerListCmd.Flags().Int("limit", 50, "Maximum number of entries to list")
+	ledgerCmd.AddCommand(ledgerAdjustCmd)
+	ledgerCmd.AddCommand(ledgerListCmd)
+	ratioWatchCmd.AddCommand(ratioWatchListCmd)
+	ratioWatchCmd.AddCommand(ratioWatchGetCmd)
+	ratioWatchCmd.AddCommand(ratioWatchClearCmd)
 	clientCmd.AddCommand(pingCmd)
 	clientCmd.AddCommand(torrentCmd)
 	clientCmd.AddCommand(userCmd)
+	clientCmd.AddCommand(promotionCmd)
+	clientCmd.AddCommand(banCmd)
+	clientCmd.AddCommand(hnrCmd)
+	clientCmd.AddCommand(snatchCmd)
+	clientCmd.AddCommand(freeleechCmd)
+	clientCmd.AddCommand(bonusCmd)
+	clientCmd.AddCommand(ledgerCmd)
+	clientCmd.AddCommand(ratioWatchCmd)
 	rootCmd.AddCommand(clientCmd)
 }
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"github.com/leighmacdonald/mika/config"
+	"github.com/leighmacdonald/mika/store"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// hashpasskeysCmd represents the hashpasskeys command
+var hashpasskeysCmd = &cobra.Command{
+	Use:   "hashpasskeys",
+	Short: "Convert the passkeys of existing users to keyed digests",
+	Long: `Convert the plain passkeys of existing users, including their additional passkeys, to the
+HMAC-SHA256 digests stored when store_users_passkey_secret is set.
+
+The tracker should be stopped while converting and started again with the same secret. Passkeys
+which have already been converted are skipped so it is safe to run more than once. The passkey
+columns of SQL databases created before hashing was supported are widened to fit the digests.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		secret := viper.GetString(string(config.StoreUsersPasskeySecret))
+		if secret == "" {
+			log.Fatalf("%s must be set to hash passkeys", config.StoreUsersPasskeySecret)
+		}
+		us, err := store.NewUserStore(viper.GetString(string(config.StoreUsersType)),
+			config.GetStoreConfig(config.Users))
+		if err != nil {
+			log.Fatalf("Failed to setup user store: %s", err.Error())
+		}
+		changed, err := store.NewHashedUserStore(us, secret).Migrate()
+		if closeErr := us.Close(); closeErr != nil {
+			log.Warnf("Failed to close user store: %s", closeErr.Error())
+		}
+		if err != nil {
+			log.Fatalf("Failed to hash passkeys: %s", err.Error())
+		}
+		log.Infof("Hashed %d passkeys successfully", changed)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(hashpasskeysCmd)
+}
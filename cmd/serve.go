@@ -33,7 +33,25 @@ var serveCmd = &cobra.Command{
 		apiHandler := h.NewAPIHandler(tkr)
 		apiServer := h.CreateServer(apiHandler, listenAPI, listenAPITLS)
 
+		var udpHandler *h.UDPHandler
+		listenUDP := viper.GetString(string(config.TrackerUDPListen))
+		if listenUDP != "" {
+			udpHandler, err = h.NewUDPHandler(tkr)
+			if err != nil {
+				log.Fatalf("Failed to initialize udp tracker: %s", err)
+			}
+			go func() {
+				if err := udpHandler.ListenAndServe(listenUDP); err != nil {
+					log.Fatalf("listen udp: %s\n", err)
+				}
+			}()
+		}
+
 		go tkr.PeerReaper()
+		go tkr.PromotionReaper()
+		go tkr.FreeleechReaper()
+		go tkr.RatioWatchReaper()
+		go tkr.BanReaper()
 		go tkr.StatWorker()
 		go func() {
 			if err := btServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -49,6 +67,11 @@ var serveCmd = &cobra.Command{
 			if err := apiServer.Shutdown(ctx); err != nil {
 				log.Fatalf("Error closing servers gracefully; %s", err)
 			}
+			if udpHandler != nil {
+				if err := udpHandler.Close(); err != nil {
+					log.Fatalf("Error closing udp listener gracefully; %s", err)
+				}
+			}
 			return nil
 		})
 	},
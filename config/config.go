@@ -22,6 +22,8 @@ const (
 	Peers
 	// Users maps to store_users_* config options
 	Users
+	// RateLimit maps to store_ratelimit_* config options
+	RateLimit
 )
 
 // Key represents a known configuration key
@@ -47,6 +49,10 @@ const (
 	// TrackerListen sets the host and port to listen on
 	// hostname:port
 	TrackerListen Key = "tracker_listen"
+	// TrackerUDPListen sets the host and port to listen on for UDP (BEP 15) tracker requests.
+	// Leave empty to disable the UDP listener
+	// hostname:port
+	TrackerUDPListen Key = "tracker_udp_listen"
 	// TrackerTLS enables TLS for the tracker component
 	// true|false
 	TrackerTLS Key = "tracker_tls"
@@ -56,6 +62,16 @@ const (
 	// TrackerIPv6Only disables ipv4 peers
 	// true|false
 	TrackerIPv6Only Key = "tracker_ipv6_only"
+	// TrackerAllowNonCompact enables the dictionary model peer list for clients requesting it
+	// with compact=0. Compact responses are always used otherwise.
+	// true|false
+	TrackerAllowNonCompact Key = "tracker_allow_non_compact"
+	// TrackerWebSocket enables the WebTorrent websocket tracker endpoint used by browser peers
+	// true|false
+	TrackerWebSocket Key = "tracker_websocket"
+	// TrackerID is the tracker id sent to clients in announce responses. A random id is
+	// generated on startup when this is empty.
+	TrackerID Key = "tracker_id"
 	// TrackerReaperInterval defines how often we do a sweep of active swarms looking for stale
 	// peers that can be removed.
 	// 60s|1m
@@ -67,11 +83,78 @@ const (
 	// TrackerAnnounceIntervalMin is the minimum interval a client is allowed
 	// 60s|1m
 	TrackerAnnounceIntervalMin Key = "tracker_announce_interval_minimum"
-	// TrackerHNRThreshold is how much time must pass before we mark a peer as Hit-N-Run
-	// 1d|12h|60m
+	// TrackerHNRThreshold is how long a user must seed a torrent after completing it to avoid
+	// being marked as a Hit-N-Run. 0 disables hit and run tracking.
+	// 24h|12h|60m
 	TrackerHNRThreshold Key = "tracker_hnr_threshold"
+	// TrackerHNRGrace is how long a user can stop seeding before the torrent is marked as a Hit-N-Run
+	// 72h|24h
+	TrackerHNRGrace Key = "tracker_hnr_grace"
+	// TrackerBonusBase is the bonus points earned for each hour spent seeding any torrent.
+	// Setting all the bonus weights to 0 disables bonus points.
+	// 1.0
+	TrackerBonusBase Key = "tracker_bonus_base"
+	// TrackerBonusSize is the weight of the torrent size, in GiB, added to the hourly bonus
+	// points. The square root of the size is used so very large torrents do not dominate.
+	// 0.5
+	TrackerBonusSize Key = "tracker_bonus_size"
+	// TrackerBonusSeeders scales the hourly bonus points by how few seeders the swarm has.
+	// The points are multiplied by 1 + (tracker_bonus_seeders / seeders)
+	// 2.0
+	TrackerBonusSeeders Key = "tracker_bonus_seeders"
+	// TrackerRatioWatchRatio is the minimum ratio users must maintain. Users below it are warned
+	// and have downloading disabled once the warning period expires. 0 disables ratio watch.
+	// 0.6
+	TrackerRatioWatchRatio Key = "tracker_ratio_watch_ratio"
+	// TrackerRatioWatchMinDownload is how many bytes a user must download before their ratio is enforced
+	// 5368709120
+	TrackerRatioWatchMinDownload Key = "tracker_ratio_watch_min_download"
+	// TrackerRatioWatchPeriod is how long users below the ratio are warned before downloading is disabled
+	// 336h|168h
+	TrackerRatioWatchPeriod Key = "tracker_ratio_watch_period"
+	// TrackerDownloadDisabledReason is the failure reason sent to users with downloading disabled
+	// when they announce with data left to download. Seeding announces are still accepted.
+	TrackerDownloadDisabledReason Key = "tracker_download_disabled_reason"
+	// TrackerSlotsLeech is the number of peers each user may have downloading at once. 0 is unlimited.
+	// 5
+	TrackerSlotsLeech Key = "tracker_slots_leech"
+	// TrackerSlotsSeed is the number of peers each user may have seeding at once. 0 is unlimited.
+	TrackerSlotsSeed Key = "tracker_slots_seed"
+	// TrackerSlotsPerTorrent is the number of peers each user may have in a single swarm. 0 is unlimited.
+	// 1|3
+	TrackerSlotsPerTorrent Key = "tracker_slots_per_torrent"
+	// TrackerPasskeyGrace is how long a users previous passkey keeps working after it is rotated.
+	// 0 disables the old passkey immediately.
+	// 72h
+	TrackerPasskeyGrace Key = "tracker_passkey_grace"
 	// TrackerBatchUpdateInterval defines how often we sync user stats to the back store
 	TrackerBatchUpdateInterval Key = "tracker_batch_update_interval"
+	// TrackerScrapeMaxHashes is the maximum number of info hashes returned in a single scrape
+	// response. Any additional hashes are ignored.
+	// 50
+	TrackerScrapeMaxHashes Key = "tracker_scrape_max_hashes"
+	// TrackerScrapeFull defines the policy used for scrape requests without any info hashes
+	// deny|allow|admin
+	TrackerScrapeFull Key = "tracker_scrape_full"
+	// TrackerScrapeIntervalMin is the minimum scrape interval sent to clients via the BEP 48
+	// min_request_interval flag
+	// 60s|1m
+	TrackerScrapeIntervalMin Key = "tracker_scrape_interval_minimum"
+	// TrackerScrapeCacheTTL is how long scrape results for a torrent are cached for. 0 disables the cache.
+	// 10s|1m
+	TrackerScrapeCacheTTL Key = "tracker_scrape_cache_ttl"
+	// TrackerRateLimitPasskey is the number of announce & scrape requests allowed per passkey over
+	// the period. Empty disables the limit.
+	// 300/1m
+	TrackerRateLimitPasskey Key = "tracker_ratelimit_passkey"
+	// TrackerRateLimitIP is the number of announce & scrape requests allowed per IP over
+	// the period. Empty disables the limit.
+	// 300/1m
+	TrackerRateLimitIP Key = "tracker_ratelimit_ip"
+	// TrackerRateLimitTorrent is the number of announces allowed per passkey for a single torrent
+	// over the period. Empty disables the limit.
+	// 6/1m
+	TrackerRateLimitTorrent Key = "tracker_ratelimit_torrent"
 
 	// APIListen sets the host and port that the admin API should bind to
 	// localhost:34001
@@ -129,6 +212,9 @@ const (
 	StoreUsersPassword Key = "store_users_password"
 	// StoreUsersProperties sets additional properties passed to the backing store configuration
 	StoreUsersProperties Key = "store_users_properties"
+	// StoreUsersPasskeySecret is the secret used to store passkeys as HMAC-SHA256 digests. Existing
+	// users must be converted with the hashpasskeys command after it is set. Empty stores plain passkeys.
+	StoreUsersPasskeySecret Key = "store_users_passkey_secret"
 
 	// StorePeersType sets the backing store type to be used for peers
 	// memory|redis|postgres|mysql|http
@@ -152,6 +238,23 @@ const (
 	// StorePeersProperties sets additional store specific properties passed to the backing store configuration
 	StorePeersProperties Key = "store_peers_properties"
 
+	// StoreRateLimitType sets the backing store type used to track rate limits. Use redis to
+	// share limits between multiple tracker instances.
+	// memory|redis
+	StoreRateLimitType Key = "store_ratelimit_type"
+	// StoreRateLimitHost is the host to connect to
+	// localhost
+	StoreRateLimitHost Key = "store_ratelimit_host"
+	// StoreRateLimitPort is the port to connect to
+	// 6379
+	StoreRateLimitPort Key = "store_ratelimit_port"
+	// StoreRateLimitDatabase is the database to open on the backing store
+	// 0
+	StoreRateLimitDatabase Key = "store_ratelimit_database"
+	// StoreRateLimitPassword password to connect with
+	// mika
+	StoreRateLimitPassword Key = "store_ratelimit_password"
+
 	// GeodbPath sets the path to use for downloading and loading the geo database. Relative to the binary's path.
 	// ./path/to/file.mmdb
 	GeodbPath Key = "geodb_path"
@@ -227,6 +330,14 @@ func GetStoreConfig(storeType StoreType) *StoreConfig {
 			Database:   viper.GetString(string(StorePeersDatabase)),
 			Properties: viper.GetString(string(StorePeersProperties)),
 		}
+	case RateLimit:
+		return &StoreConfig{
+			Type:     viper.GetString(string(StoreRateLimitType)),
+			Host:     viper.GetString(string(StoreRateLimitHost)),
+			Port:     viper.GetInt(string(StoreRateLimitPort)),
+			Password: viper.GetString(string(StoreRateLimitPassword)),
+			Database: viper.GetString(string(StoreRateLimitDatabase)),
+		}
 	}
 	return nil
 }
@@ -297,14 +408,37 @@ func init() {
 
 	viper.SetDefault(string(TrackerPublic), false)
 	viper.SetDefault(string(TrackerListen), "0.0.0.0:34000")
+	viper.SetDefault(string(TrackerUDPListen), "")
 	viper.SetDefault(string(TrackerTLS), false)
 	viper.SetDefault(string(TrackerIPv6), false)
 	viper.SetDefault(string(TrackerIPv6Only), false)
+	viper.SetDefault(string(TrackerAllowNonCompact), false)
+	viper.SetDefault(string(TrackerWebSocket), false)
+	viper.SetDefault(string(TrackerID), "")
 	viper.SetDefault(string(TrackerReaperInterval), "300s")
 	viper.SetDefault(string(TrackerAnnounceInterval), "30s")
 	viper.SetDefault(string(TrackerAnnounceIntervalMin), "10s")
 	viper.SetDefault(string(TrackerHNRThreshold), "6h")
+	viper.SetDefault(string(TrackerHNRGrace), "72h")
+	viper.SetDefault(string(TrackerBonusBase), 1.0)
+	viper.SetDefault(string(TrackerBonusSize), 0.5)
+	viper.SetDefault(string(TrackerBonusSeeders), 2.0)
+	viper.SetDefault(string(TrackerRatioWatchRatio), 0.0)
+	viper.SetDefault(string(TrackerRatioWatchMinDownload), 5368709120)
+	viper.SetDefault(string(TrackerRatioWatchPeriod), "336h")
+	viper.SetDefault(string(TrackerDownloadDisabledReason), "Downloading is disabled for your account, you can still seed")
+	viper.SetDefault(string(TrackerSlotsLeech), 0)
+	viper.SetDefault(string(TrackerSlotsSeed), 0)
+	viper.SetDefault(string(TrackerSlotsPerTorrent), 0)
+	viper.SetDefault(string(TrackerPasskeyGrace), "72h")
 	viper.SetDefault(string(TrackerBatchUpdateInterval), "30s")
+	viper.SetDefault(string(TrackerScrapeMaxHashes), 50)
+	viper.SetDefault(string(TrackerScrapeFull), "deny")
+	viper.SetDefault(string(TrackerScrapeIntervalMin), "60s")
+	viper.SetDefault(string(TrackerScrapeCacheTTL), "10s")
+	viper.SetDefault(string(TrackerRateLimitPasskey), "")
+	viper.SetDefault(string(TrackerRateLimitIP), "")
+	viper.SetDefault(string(TrackerRateLimitTorrent), "6/1m")
 
 	viper.SetDefault(string(APIListen), "0.0.0.0:34001")
 	viper.SetDefault(string(APITLS), false)
@@ -334,6 +468,13 @@ func init() {
 	viper.SetDefault(string(StoreUsersPassword), "")
 	viper.SetDefault(string(StoreUsersDatabase), "")
 	viper.SetDefault(string(StoreUsersProperties), "")
+	viper.SetDefault(string(StoreUsersPasskeySecret), "")
+
+	viper.SetDefault(string(StoreRateLimitType), "memory")
+	viper.SetDefault(string(StoreRateLimitHost), "")
+	viper.SetDefault(string(StoreRateLimitPort), "")
+	viper.SetDefault(string(StoreRateLimitPassword), "")
+	viper.SetDefault(string(StoreRateLimitDatabase), "")
 
 	viper.SetDefault(string(GeodbEnabled), false)
 	viper.SetDefault(string(GeodbAPIKey), "")
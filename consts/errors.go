@@ -33,4 +33,22 @@ var (
 
 	// ErrInvalidClient is used when an invalid client is requested/used
 	ErrInvalidClient = errors.New("invalid torrent client")
+
+	// ErrInvalidPromotion is used when an unknown promotion is requested/used
+	ErrInvalidPromotion = errors.New("invalid promotion")
+
+	// ErrInvalidHNR is used when an unknown hit and run record is requested/used
+	ErrInvalidHNR = errors.New("invalid hit and run")
+
+	// ErrInvalidFreeleech is used when an unknown freeleech token is requested/used
+	ErrInvalidFreeleech = errors.New("invalid freeleech token")
+
+	// ErrInvalidRatioWatch is used when an unknown ratio watch record is requested/used
+	ErrInvalidRatioWatch = errors.New("invalid ratio watch")
+
+	// ErrInvalidBan is used when an unknown ban is requested/used
+	ErrInvalidBan = errors.New("invalid ban")
+
+	// ErrInvalidPasskey is used when an unknown passkey is requested/used
+	ErrInvalidPasskey = errors.New("invalid passkey")
 )
@@ -207,8 +207,8 @@ func (s *ServerExample) userAdd(c *gin.Context) {
 }
 
 func (s *ServerExample) userSync(c *gin.Context) {
-	var batch map[string]model.UserStats
-	if err := c.BindJSON(batch); err != nil {
+	var batch map[uint32]model.UserStats
+	if err := c.BindJSON(&batch); err != nil {
 		errResponse(c, http.StatusBadRequest, err.Error())
 		return
 	}
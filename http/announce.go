@@ -2,6 +2,7 @@ package http
 
 import (
 	"bytes"
+	"fmt"
 	"github.com/chihaya/bencode"
 	"github.com/gin-gonic/gin"
 	"github.com/leighmacdonald/mika/consts"
@@ -10,25 +11,33 @@ import (
 	"github.com/leighmacdonald/mika/util"
 	log "github.com/sirupsen/logrus"
 	"net"
+	"net/http"
 	"time"
 )
 
 // BitTorrentHandler is the public HTTP interface for the tracker handling announces and
 // scrape requests
 type BitTorrentHandler struct {
-	tracker *tracker.Tracker
+	tracker     *tracker.Tracker
+	scrapeCache *scrapeCache
+	wsHub       *webSocketHub
 }
 
 // Represents an announce received from the bittorrent client
 //
 // TODO use gin binding func?
 type announceRequest struct {
-	Compact bool `form:"compact"` // Force compact always?
+	// Compact is true unless the client has requested the dictionary peer list model with compact=0.
+	// The dictionary model is only used when tracker_allow_non_compact is enabled.
+	Compact bool `form:"compact"`
+
+	// Optional. Omit the peer id key from dictionary model peer lists. Ignored for compact responses.
+	NoPeerID bool `form:"no_peer_id"`
 
 	// The total amount downloaded (since the client sent the 'started' event to the tracker) in
 	// base ten ASCII. While not explicitly stated in the official specification, the consensus is that
 	// this should be the total number of bytes downloaded.
-	Downloaded uint32 `form:"downloaded" binding:"required"`
+	Downloaded uint64 `form:"downloaded" binding:"required"`
 
 	// The number of bytes this peer still has to download, encoded in base ten ascii.
 	// Note that this can'tracker be computed from downloaded and the file length since it
@@ -39,7 +48,7 @@ type announceRequest struct {
 	// The total amount uploaded (since the client sent the 'started' event to the tracker) in base ten
 	// ASCII. While not explicitly stated in the official specification, the consensus is that this should
 	// be the total number of bytes uploaded.
-	Uploaded uint32 `form:"uploaded" binding:"required"`
+	Uploaded uint64 `form:"uploaded" binding:"required"`
 
 	Corrupt uint32 `form:"corrupt"`
 
@@ -64,8 +73,19 @@ type announceRequest struct {
 	// it only if the IP address that the request came in on is in RFC1918 space. Others honor it
 	// unconditionally, while others ignore it completely. In case of IPv6 address (e.g.: 2001:db8:1:2::100)
 	// it indicates only that client can communicate via IPv6.
+	//
+	// This holds the IPv4 address of the client, if any. BEP 7 clients may also supply their
+	// addresses using the ipv4 and ipv6 params.
 	IP net.IP `form:"ip" binding:"required"`
 
+	// Optional. The IPv6 address of the client as sent via either the ip or ipv6 params (BEP 7),
+	// or detected from the request itself.
+	IPv6 net.IP `form:"ipv6"`
+
+	// RemoteIP is the address the request was received from. This is sent back to the client
+	// via the BEP 24 external ip key.
+	RemoteIP net.IP
+
 	// urlencoded 20-byte SHA1 hash of the value of the info key from the Metainfo file. Note that the
 	// value will be a bencoded dictionary, given the definition of the info key above.
 	InfoHash model.InfoHash `form:"info_hash" binding:"required"`
@@ -89,7 +109,19 @@ type announceRequest struct {
 	Port uint16 `binding:"required"`
 
 	// Optional. If a previous announce contained a tracker id, it should be set here.
-	TrackerID string `form:"tracker_id"`
+	TrackerID string `form:"trackerid"`
+
+	// Optional. An additional identification that is not shared with any other peers. It is intended
+	// to allow a client to prove their identity should their IP address change.
+	Key string `form:"key"`
+}
+
+func getUint64Key(q *query, key announceParam, def uint64) uint64 {
+	v, err := q.Uint64(key)
+	if err != nil {
+		return def
+	}
+	return v
 }
 
 func getUint32Key(q *query, key announceParam, def uint32) uint32 {
@@ -116,6 +148,38 @@ func getUintKey(q *query, key announceParam, def uint) uint {
 	return util.UMax(0, left)
 }
 
+// splitIPFamilies assigns the ip to either the IPv4 or IPv6 address based on its family. The BEP 7
+// ipv4 and ipv6 params, when valid, take precedence over this.
+func splitIPFamilies(q *query, ip net.IP) (ipv4 net.IP, ipv6 net.IP) {
+	if ip.To4() != nil {
+		ipv4 = ip.To4()
+	} else {
+		ipv6 = ip.To16()
+	}
+	if v4Str, found := q.Params[paramIPv4]; found {
+		// The ipv4 param may also include the port, eg: 1.2.3.4:6881
+		if host, _, err := net.SplitHostPort(v4Str); err == nil {
+			v4Str = host
+		}
+		if v4 := net.ParseIP(v4Str).To4(); v4 != nil {
+			ipv4 = v4
+		}
+	}
+	if v6Str, found := q.Params[paramIPv6]; found {
+		if host, _, err := net.SplitHostPort(v6Str); err == nil {
+			v6Str = host
+		}
+		v6 := net.ParseIP(v6Str)
+		if v6 != nil && v6.To4() == nil {
+			ipv6 = v6
+		}
+	}
+	return ipv4, ipv6
+}
+
+// maxPeerKeyLen is the longest key value we will accept from a client
+const maxPeerKeyLen = 64
+
 // Parse the query string into an announceRequest struct
 func newAnnounce(c *gin.Context) (*announceRequest, trackerErrCode) {
 	q, err := queryStringParser(c.Request.URL.RawQuery)
@@ -135,15 +199,23 @@ func newAnnounce(c *gin.Context) (*announceRequest, trackerErrCode) {
 	if !exists {
 		return nil, msgInvalidPeerID
 	}
-	ipv4, err := getIP(q, c)
+	remoteIP, err := getRemoteIP(c)
+	if err != nil {
+		log.Warn("Could not get user IP from request")
+		return nil, msgMalformedRequest
+	}
+	ip, err := getIP(q, c)
 	if err != nil {
 		log.Warn("Could not get user IP from request")
 		return nil, msgMalformedRequest
 	}
-	if util.IsPrivateIP(ipv4) {
-		log.Warnf("Attempt to use non-routable IP value: %s", ipv4.String())
-		// TODO make this configurable
-		// return nil, msgMalformedRequest
+	ipv4, ipv6 := splitIPFamilies(q, ip)
+	for _, addr := range []net.IP{ipv4, ipv6} {
+		if addr != nil && util.IsPrivateIP(addr) {
+			log.Warnf("Attempt to use non-routable IP value: %s", addr.String())
+			// TODO make this configurable
+			// return nil, msgMalformedRequest
+		}
 	}
 	port := getUint16Key(q, paramPort, 0)
 	if port < 1024 || port > 65535 {
@@ -151,122 +223,401 @@ func newAnnounce(c *gin.Context) (*announceRequest, trackerErrCode) {
 		return nil, msgInvalidPort
 	}
 	left := getUint32Key(q, paramLeft, 0)
-	downloaded := getUint32Key(q, paramDownloaded, 0)
-	uploaded := getUint32Key(q, paramUploaded, 0)
+	downloaded := getUint64Key(q, paramDownloaded, 0)
+	uploaded := getUint64Key(q, paramUploaded, 0)
 	corrupt := getUint32Key(q, paramCorrupt, 0)
-	event := consts.ParseAnnounceType(q.Params[paramNumWant])
+	event := consts.ParseAnnounceType(q.Params[paramEvent])
 	numWant := getUintKey(q, "numwant", 30)
+	key := q.Params[paramKey]
+	if len(key) > maxPeerKeyLen {
+		return nil, msgMalformedRequest
+	}
 	return &announceRequest{
-		Compact:    true, // Ignored and always set to true
+		Compact:    q.Params[paramCompact] != "0",
+		NoPeerID:   q.Params[paramNoPeerID] == "1",
 		Corrupt:    corrupt,
 		Downloaded: downloaded,
 		Event:      event,
 		IP:         ipv4,
+		IPv6:       ipv6,
+		RemoteIP:   remoteIP,
 		InfoHash:   infoHash,
 		Left:       left,
 		NumWant:    numWant,
 		PeerID:     model.PeerIDFromString(peerID),
 		Port:       port,
 		Uploaded:   uploaded,
+		TrackerID:  q.Params[paramTrackerID],
+		Key:        key,
 	}, msgOk
 }
 
-// The meaty bits.
-// NOTE we ONLY support compact response formats (binary format) by design even though its
-// technically breaking the protocol specs.
-// There is no reason to support the older less efficient model for private needs
-func (h *BitTorrentHandler) announce(c *gin.Context) {
-	// Check that the user is valid before parsing anything
-	pk := c.Param("passkey")
-	var usr model.User
-	if valid := preFlightChecks(&usr, pk, c, h.tracker); !valid {
-		oops(c, msgInvalidAuth)
-		return
+// checkClient validates the client decoded from the peer id against the whitelist. An
+// empty whitelist allows all clients. Entries are matched by the decoded client id and
+// version range, falling back to the raw peer id prefix. A client is allowed if any of the
+// matching entries allow it, eg: multiple entries with different version ranges.
+func checkClient(t *tracker.Tracker, peerID model.PeerID) error {
+	t.WhitelistMutex.RLock()
+	defer t.WhitelistMutex.RUnlock()
+	if len(t.Whitelist) == 0 {
+		return nil
 	}
-	// Parse the announce into an announceRequest
-	req, code := newAnnounce(c)
-	if code != msgOk {
-		oops(c, code)
-		return
+	client, decoded := model.ParseClient(peerID)
+	var versionErr error
+	for _, wl := range t.Whitelist {
+		if decoded && wl.Match(client) {
+			if wl.VersionAllowed(client) {
+				return nil
+			}
+			if versionErr == nil {
+				name := wl.ClientName
+				if name == "" {
+					name = client.Name()
+				}
+				versionErr = trackerError{
+					code:    msgClientNotAllowed,
+					message: fmt.Sprintf("Client version not allowed: %s %s", name, client.Version.String()),
+				}
+			}
+			continue
+		}
+		if wl.MatchPrefix(peerID) {
+			return nil
+		}
+	}
+	if versionErr != nil {
+		return versionErr
+	}
+	if !decoded {
+		return trackerError{code: msgClientNotAllowed, message: "Client not allowed: Unknown client"}
+	}
+	return trackerError{code: msgClientNotAllowed, message: fmt.Sprintf("Client not allowed: %s", client.String())}
+}
+
+// checkSlots ensures a new peer joining a swarm does not exceed the peer slot limits of the user.
+// The limit exceeded is returned to the client as the failure reason.
+func checkSlots(t *tracker.Tracker, usr model.User, ih model.InfoHash, left uint32) error {
+	limits := t.SlotLimits(usr)
+	if !limits.Enabled() {
+		return nil
+	}
+	peers, err := t.Peers.GetByUser(usr.UserID)
+	if err != nil {
+		log.Errorf("Failed to read user peers: %s", err.Error())
+		return newTrackerErr(msgGenericError)
+	}
+	usage := peers.SlotUsage(ih)
+	switch {
+	case limits.PerTorrent > 0 && usage.Torrent >= limits.PerTorrent:
+		return trackerError{code: msgSlotLimit,
+			message: fmt.Sprintf("Peer slot limit reached: only %d clients may be active per torrent", limits.PerTorrent)}
+	case left > 0 && limits.Leech > 0 && usage.Leeching >= limits.Leech:
+		return trackerError{code: msgSlotLimit,
+			message: fmt.Sprintf("Leech slot limit reached: only %d peers may be downloading at once", limits.Leech)}
+	case left == 0 && limits.Seed > 0 && usage.Seeding >= limits.Seed:
+		return trackerError{code: msgSlotLimit,
+			message: fmt.Sprintf("Seed slot limit reached: only %d peers may be seeding at once", limits.Seed)}
+	}
+	return nil
+}
+
+// announceResult holds the transport independent results of a successful announce
+type announceResult struct {
+	// infoHash is the v1 info hash the swarm is keyed by, which can differ from the
+	// requested info hash for hybrid torrents
+	infoHash model.InfoHash
+	// peer is the announcing peer
+	peer model.Peer
+	// peers is the set of swarm members to send back to the client
+	peers    model.Swarm
+	seeders  uint
+	leechers uint
+	// size is the total size of the torrent in bytes
+	size uint64
+	// warning is sent to the client as a warning message when set
+	warning string
+}
+
+// handleAnnounce performs the announce steps which are shared between the HTTP and UDP transports.
+// The user must have already been authenticated before calling this. Failures are returned
+// as trackerError values.
+func handleAnnounce(t *tracker.Tracker, usr model.User, req *announceRequest) (*announceResult, error) {
+	// Drop any addresses for the families we have disabled
+	if !t.IPv6 {
+		req.IPv6 = nil
+	}
+	if t.IPv6Only {
+		req.IP = nil
+	}
+	if req.IP == nil && req.IPv6 == nil {
+		return nil, newTrackerErr(msgInvalidIP)
+	}
+	if err := checkBan(t, req.RemoteIP, req.IP, req.IPv6); err != nil {
+		return nil, err
+	}
+	if err := checkRateLimit(t, req.Passkey, req.RemoteIP, req.InfoHash); err != nil {
+		return nil, err
+	}
+	if err := checkClient(t, req.PeerID); err != nil {
+		return nil, err
 	}
 	// Get & Validate the torrent associated with the info_hash supplies
 	var tor model.Torrent
-	if err := h.tracker.Torrents.Get(&tor, req.InfoHash); err != nil || tor.IsDeleted {
-		oops(c, msgInvalidInfoHash)
-		return
+	if err := t.Torrents.Get(&tor, req.InfoHash); err != nil || tor.IsDeleted {
+		return nil, newTrackerErr(msgInvalidInfoHash)
 	}
 	// If disabled and reason is set, the reason is returned to the client
 	// This is mostly useful for when a torrent has been "trumped" by another torrent so it
-	// should be downloaded instead
-	//
-	// TODO send this as a "warning message" field of a normal announce response instead?
+	// should be downloaded instead. Torrents which are still enabled send the reason as
+	// a warning message instead.
 	if !tor.IsEnabled && tor.Reason != "" {
-		c.Data(int(msgInvalidInfoHash), gin.MIMEPlain, responseError(tor.Reason))
-		return
+		return nil, trackerError{code: msgInvalidInfoHash, message: tor.Reason}
+	}
+	// Announces made with one of the users additional passkeys are attributed to its device
+	altPasskey, isAlt := t.PasskeyLookup(usr, req.Passkey)
+	// Users with downloading disabled may only seed. The attempt is counted so staff can review
+	// users who keep trying to leech.
+	if !usr.DownloadEnabled && req.Left > 0 {
+		t.StateUpdateChan <- model.UpdateState{
+			Passkey:     req.Passkey,
+			UserID:      usr.UserID,
+			AltPasskey:  isAlt,
+			IP:          req.RemoteIP,
+			InfoHash:    tor.InfoHash,
+			PeerID:      req.PeerID,
+			Left:        req.Left,
+			Event:       req.Event,
+			Timestamp:   time.Now(),
+			LeechDenied: true,
+		}
+		return nil, trackerError{code: msgDownloadDisabled, message: t.LeechDeniedReason}
 	}
 	var peer model.Peer
-	err := h.tracker.Peers.Get(&peer, tor.InfoHash, req.PeerID)
+	err := t.Peers.Get(&peer, tor.InfoHash, req.PeerID)
 	if err != nil {
 		// Create a new peer for the swarm
 		peer = model.NewPeer(usr.UserID, req.PeerID, req.IP, req.Port)
-		if err := h.tracker.Peers.Add(tor.InfoHash, peer); err != nil {
+		peer.IPv6 = req.IPv6
+		peer.Key = req.Key
+		peer.PasskeyLabel = altPasskey.Label
+		// Set the initial state so the peer is counted correctly before the batch update syncs
+		peer.Left = req.Left
+		if err := checkAnnounceInterval(t, tor.InfoHash, req.PeerID, req.Event); err != nil {
+			return nil, err
+		}
+		if req.Event != consts.STOPPED {
+			if err := checkSlots(t, usr, tor.InfoHash, req.Left); err != nil {
+				return nil, err
+			}
+		}
+		if req.Event != consts.STARTED {
+			// Without a started event the counters may include transfers which were accounted for
+			// in a session we no longer know about, eg: after the peer was reaped. Only changes from
+			// this point are counted.
+			peer.SessionUploaded = req.Uploaded
+			peer.SessionDownloaded = req.Downloaded
+		}
+		if err := t.Peers.Add(tor.InfoHash, peer); err != nil {
 			log.Errorf("Failed to insert peer into swarm: %s", err.Error())
-			oops(c, msgGenericError)
-			return
+			return nil, newTrackerErr(msgGenericError)
 		}
-		if h.tracker.GeodbEnabled {
-			peer.Location = h.tracker.Geodb.GetLocation(peer.IP).Location
+		if t.GeodbEnabled {
+			peer.Location = t.Geodb.GetLocation(peer.Addr()).Location
 		}
 	} else {
+		// A peer which registered with a key must always supply it. This stops other users
+		// from hijacking a peer_id.
+		if peer.Key != "" && peer.Key != req.Key {
+			log.Warnf("Peer key mismatch for peer: %s", peer.PeerID.String())
+			return nil, newTrackerErr(msgInvalidPeerKey)
+		}
+		if err := checkAnnounceInterval(t, tor.InfoHash, peer.PeerID, req.Event); err != nil {
+			return nil, err
+		}
+		sameAddr := peer.IP.Equal(req.IP) && peer.IPv6.Equal(req.IPv6) && peer.Port == req.Port
+		switch {
+		case peer.Key == "" && req.Key != "" && sameAddr:
+			// Peers which registered without a key adopt the first key they announce with. This is
+			// only accepted from the peers known address so another user cannot lock out the peer.
+			peer.Key = req.Key
+			if err := t.Peers.UpdateAddr(tor.InfoHash, peer); err != nil {
+				log.Errorf("Failed to update peer key: %s", err.Error())
+				return nil, newTrackerErr(msgGenericError)
+			}
+		case peer.Key != "" && !sameAddr:
+			// A matching key allows the client to update its address, eg: after a dynamic ip change
+			peer.IP = req.IP
+			peer.IPv6 = req.IPv6
+			peer.Port = req.Port
+			if err := t.Peers.UpdateAddr(tor.InfoHash, peer); err != nil {
+				log.Errorf("Failed to update peer address: %s", err.Error())
+				return nil, newTrackerErr(msgGenericError)
+			}
+		}
 		peer.AnnounceLast = time.Now()
 	}
-	// Send state to another go channel for updating outside of the announce request
-	// so that we can respond asap
-	h.tracker.StateUpdateChan <- model.UpdateState{
-		Passkey:    pk,
-		InfoHash:   tor.InfoHash,
-		PeerID:     peer.PeerID,
-		Uploaded:   uint64(req.Uploaded),
-		Downloaded: uint64(req.Downloaded),
-		Left:       req.Left,
-		Event:      req.Event,
-		Timestamp:  time.Now(),
-	}
-
-	peers, err2 := h.tracker.Peers.GetN(tor.InfoHash, h.tracker.MaxPeers)
+	// Active promotions may override the torrents own multipliers
+	multiUp, multiDn := t.Multipliers(tor, time.Now())
+	peers, err2 := t.Peers.GetN(tor.InfoHash, t.MaxPeers)
 	if err2 != nil {
 		log.Errorf("Could not read peers from swarm: %s", err2.Error())
-		oops(c, msgGenericError)
-		return
+		return nil, newTrackerErr(msgGenericError)
 	}
 	seeders, leechers := peers.Counts()
+	warning := tor.Reason
+	warning = joinWarning(warning, t.RatioWatchCheck(usr, time.Now()))
+	warning = joinWarning(warning, altPasskey.Warning(time.Now()))
+	// Send state to another go channel for updating outside of the announce request
+	// so that we can respond asap
+	t.StateUpdateChan <- model.UpdateState{
+		Passkey:        req.Passkey,
+		UserID:         usr.UserID,
+		AltPasskey:     isAlt,
+		IP:             req.RemoteIP,
+		InfoHash:       tor.InfoHash,
+		PeerID:         peer.PeerID,
+		Uploaded:       req.Uploaded,
+		Downloaded:     req.Downloaded,
+		PrevUploaded:   peer.SessionUploaded,
+		PrevDownloaded: peer.SessionDownloaded,
+		MultiUp:        multiUp,
+		MultiDn:        multiDn,
+		Size:           tor.Size,
+		Seeders:        seeders,
+		Left:           req.Left,
+		Event:          req.Event,
+		Timestamp:      time.Now(),
+	}
+	return &announceResult{
+		infoHash: tor.InfoHash,
+		peer:     peer,
+		peers:    peers,
+		seeders:  seeders,
+		leechers: leechers,
+		size:     tor.Size,
+		warning:  warning,
+	}, nil
+}
+
+// The meaty bits.
+// NOTE compact response formats (binary format) are always used unless the older dictionary model
+// has been explicitly enabled with tracker_allow_non_compact and the client requests it with compact=0.
+func (h *BitTorrentHandler) announce(c *gin.Context) {
+	// Check that the user is valid before parsing anything
+	pk := c.Param("passkey")
+	var usr model.User
+	if valid := preFlightChecks(&usr, pk, c, h.tracker); !valid {
+		return
+	}
+	// Parse the announce into an announceRequest
+	req, code := newAnnounce(c)
+	if code != msgOk {
+		oops(c, code)
+		return
+	}
+	req.Passkey = pk
+	res, err := handleAnnounce(h.tracker, usr, req)
+	if err != nil {
+		oopsErr(c, err)
+		return
+	}
 	dict := bencode.Dict{
-		"complete":     seeders,
-		"incomplete":   leechers,
+		"complete":     res.seeders,
+		"incomplete":   res.leechers,
 		"interval":     int(h.tracker.AnnInterval.Seconds()),
 		"min interval": int(h.tracker.AnnIntervalMin.Seconds()),
-		"peers":        makeCompactPeers(peers, peer.PeerID),
 	}
+	if req.Compact || !h.tracker.AllowNonCompact {
+		dict["peers"] = makeCompactPeers(res.peers, res.peer.PeerID)
+		if h.tracker.IPv6 {
+			dict["peers6"] = makeCompactPeers6(res.peers, res.peer.PeerID)
+		}
+	} else {
+		dict["peers"] = makeDictPeers(res.peers, res.peer.PeerID, req.NoPeerID)
+	}
+	if req.RemoteIP != nil {
+		dict["external ip"] = []byte(req.RemoteIP)
+	}
+	if res.warning != "" {
+		dict["warning message"] = res.warning
+	}
+	// Always issue our own tracker id, client supplied values are never trusted
+	dict["tracker id"] = h.tracker.TrackerID
 
 	var outBytes bytes.Buffer
 	if err := bencode.NewEncoder(&outBytes).Encode(dict); err != nil {
 		oops(c, msgGenericError)
 		return
 	}
-	c.Data(int(msgOk), gin.MIMEPlain, outBytes.Bytes())
+	c.Data(http.StatusOK, gin.MIMEPlain, outBytes.Bytes())
 }
 
 // Generate a compact peer field array containing the byte representations
-// of a peers IP+Port appended to each other
+// of a peers IP+Port appended to each other. Only peers with a IPv4 address are included.
+// WebRTC peers are never included in peer lists as they cannot be connected to directly.
 func makeCompactPeers(peers model.Swarm, skipID model.PeerID) []byte {
 	var buf bytes.Buffer
 	for _, peer := range peers {
-		if peer.PeerID == skipID {
+		if peer.PeerID == skipID || peer.WebRTC() {
 			// Skip the peers own peer_id
 			continue
 		}
-		buf.Write(peer.IP.To4())
+		ip := peer.IP.To4()
+		if ip == nil {
+			continue
+		}
+		buf.Write(ip)
 		buf.Write([]byte{byte(peer.Port >> 8), byte(peer.Port & 0xff)})
 	}
 	return buf.Bytes()
 }
+
+// Generate a compact peers6 field array as defined in BEP 7. Each peer is represented
+// by its 16 byte IPv6 address followed by the port. Only peers with a IPv6 address are included.
+func makeCompactPeers6(peers model.Swarm, skipID model.PeerID) []byte {
+	var buf bytes.Buffer
+	for _, peer := range peers {
+		if peer.PeerID == skipID || peer.IPv6 == nil || peer.WebRTC() {
+			continue
+		}
+		buf.Write(peer.IPv6.To16())
+		buf.Write([]byte{byte(peer.Port >> 8), byte(peer.Port & 0xff)})
+	}
+	return buf.Bytes()
+}
+
+// Generate a peer list using the original dictionary model. Each address a peer has is sent
+// as its own entry. When noPeerID is true the peer id key is omitted from the entries.
+func makeDictPeers(peers model.Swarm, skipID model.PeerID, noPeerID bool) bencode.List {
+	list := bencode.List{}
+	for _, peer := range peers {
+		if peer.PeerID == skipID || peer.WebRTC() {
+			continue
+		}
+		for _, ip := range []net.IP{peer.IP, peer.IPv6} {
+			if ip == nil {
+				continue
+			}
+			entry := bencode.Dict{
+				"ip":   ip.String(),
+				"port": peer.Port,
+			}
+			if !noPeerID {
+				entry["peer id"] = peer.PeerID.RawString()
+			}
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// joinWarning appends the message to the warnings sent in the announce response
+func joinWarning(warning string, msg string) string {
+	if msg == "" {
+		return warning
+	}
+	if warning != "" {
+		warning += "; "
+	}
+	return warning + msg
+}
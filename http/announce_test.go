@@ -2,16 +2,26 @@ package http
 
 import (
 	"fmt"
+	"github.com/chihaya/bencode"
+	"github.com/leighmacdonald/mika/config"
+	"github.com/leighmacdonald/mika/model"
+	"github.com/leighmacdonald/mika/store"
 	"github.com/leighmacdonald/mika/tracker"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 )
 
 func performRequest(r http.Handler, method, path string) *httptest.ResponseRecorder {
-	req, _ := http.NewRequest(method, path, nil)
+	req := httptest.NewRequest(method, path, nil)
+	// The default httptest address is in a reserved range
+	req.RemoteAddr = "1.2.3.4:6881"
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 	return w
@@ -21,9 +31,10 @@ func TestBitTorrentHandler_Announce(t *testing.T) {
 	tkr, torrents, users, peers := tracker.NewTestTracker()
 	rh := NewBitTorrentHandler(tkr)
 	type testAnn struct {
-		key  string
-		v    url.Values
-		resp int
+		key     string
+		v       url.Values
+		resp    int
+		failure string
 	}
 	v := []testAnn{
 		{users[0].Passkey,
@@ -37,11 +48,539 @@ func TestBitTorrentHandler_Announce(t *testing.T) {
 				"left":       {"9234"},
 			},
 			200,
+			"",
+		},
+		{users[0].Passkey,
+			url.Values{
+				"info_hash": {"xxxxxxxxxxxxxxxxxxxx"},
+				"peer_id":   {peers[0].PeerID.RawString()},
+				"ip":        {"255.255.255.255"},
+				"port":      {"6881"},
+			},
+			200,
+			TrackerErr(msgInvalidInfoHash).Error(),
+		},
+		{"invalid-passkey",
+			url.Values{
+				"info_hash": {torrents[0].InfoHash.RawString()},
+				"peer_id":   {peers[0].PeerID.RawString()},
+				"ip":        {"255.255.255.255"},
+				"port":      {"6881"},
+			},
+			200,
+			TrackerErr(msgInvalidAuth).Error(),
 		},
 	}
 	for _, ann := range v {
 		u := fmt.Sprintf("/%s/announce?%s", ann.key, ann.v.Encode())
 		w := performRequest(rh, "GET", u)
 		assert.EqualValues(t, ann.resp, w.Code)
+		resp, err := bencode.Unmarshal(w.Body.Bytes())
+		require.NoError(t, err)
+		failure, found := resp.(bencode.Dict)["failure reason"]
+		if ann.failure == "" {
+			require.False(t, found, failure)
+		} else {
+			require.Equal(t, ann.failure, failure)
+		}
+	}
+}
+
+func TestMakeCompactPeers(t *testing.T) {
+	self := model.NewPeer(1, model.PeerIDFromString("AAAAAAAAAAAAAAAAAAAA"), net.ParseIP("1.2.3.4"), 6881)
+	v4 := model.NewPeer(2, model.PeerIDFromString("BBBBBBBBBBBBBBBBBBBB"), net.ParseIP("5.6.7.8"), 6882)
+	v6 := model.NewPeer(3, model.PeerIDFromString("CCCCCCCCCCCCCCCCCCCC"), net.ParseIP("2001:db8::1"), 6883)
+	dual := model.NewPeer(4, model.PeerIDFromString("DDDDDDDDDDDDDDDDDDDD"), net.ParseIP("9.9.9.9"), 6884)
+	dual.IPv6 = net.ParseIP("2001:db8::2")
+	swarm := model.Swarm{self, v4, v6, dual}
+
+	peers := makeCompactPeers(swarm, self.PeerID)
+	require.Equal(t, []byte{5, 6, 7, 8, 0x1a, 0xe2, 9, 9, 9, 9, 0x1a, 0xe4}, peers)
+
+	peers6 := makeCompactPeers6(swarm, self.PeerID)
+	require.Equal(t, 2*18, len(peers6))
+	require.Equal(t, net.ParseIP("2001:db8::1").To16(), net.IP(peers6[0:16]))
+	require.Equal(t, []byte{0x1a, 0xe3}, peers6[16:18])
+	require.Equal(t, net.ParseIP("2001:db8::2").To16(), net.IP(peers6[18:34]))
+}
+
+func TestMakeDictPeers(t *testing.T) {
+	self := model.NewPeer(1, model.PeerIDFromString("AAAAAAAAAAAAAAAAAAAA"), net.ParseIP("1.2.3.4"), 6881)
+	other := model.NewPeer(2, model.PeerIDFromString("BBBBBBBBBBBBBBBBBBBB"), net.ParseIP("5.6.7.8"), 6882)
+	other.IPv6 = net.ParseIP("2001:db8::1")
+	swarm := model.Swarm{self, other}
+
+	peers := makeDictPeers(swarm, self.PeerID, false)
+	require.Equal(t, 2, len(peers))
+	p4 := peers[0].(bencode.Dict)
+	require.Equal(t, "5.6.7.8", p4["ip"])
+	require.Equal(t, uint16(6882), p4["port"])
+	require.Equal(t, other.PeerID.RawString(), p4["peer id"])
+	require.Equal(t, "2001:db8::1", peers[1].(bencode.Dict)["ip"])
+
+	for _, p := range makeDictPeers(swarm, self.PeerID, true) {
+		_, found := p.(bencode.Dict)["peer id"]
+		require.False(t, found)
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	resp, err := bencode.Unmarshal(responseError("Invalid passkey", msgInvalidAuth))
+	require.NoError(t, err)
+	require.Equal(t, "Invalid passkey", resp.(bencode.Dict)["failure reason"])
+	_, found := resp.(bencode.Dict)["retry in"]
+	require.False(t, found)
+
+	resp, err = bencode.Unmarshal(responseError("Slow down", msgClientRequestTooFast))
+	require.NoError(t, err)
+	require.EqualValues(t, retryInMap[msgClientRequestTooFast], resp.(bencode.Dict)["retry in"])
+
+	resp, err = bencode.Unmarshal(responseError("Generic error", msgGenericError))
+	require.NoError(t, err)
+	_, found = resp.(bencode.Dict)["retry in"]
+	require.False(t, found)
+}
+
+func TestBitTorrentHandler_AnnounceFailure(t *testing.T) {
+	tkr, torrents, _, peers := tracker.NewTestTracker()
+	rh := NewBitTorrentHandler(tkr)
+	v := url.Values{
+		"info_hash": {torrents[0].InfoHash.RawString()},
+		"peer_id":   {peers[0].PeerID.RawString()},
+		"port":      {"6881"},
+	}
+	// Failures must still use a 200 status so clients will display the reason
+	w := performRequest(rh, "GET", fmt.Sprintf("/%s/announce?%s", "invalid-passkey", v.Encode()))
+	require.Equal(t, http.StatusOK, w.Code)
+	resp, err := bencode.Unmarshal(w.Body.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, TrackerErr(msgInvalidAuth).Error(), resp.(bencode.Dict)["failure reason"])
+}
+
+func TestBitTorrentHandler_AnnounceTrackerID(t *testing.T) {
+	tkr, torrents, users, peers := tracker.NewTestTracker()
+	// Allow re-announcing immediately
+	tkr.AnnIntervalMin = 0
+	rh := NewBitTorrentHandler(tkr)
+	v := url.Values{
+		"info_hash": {torrents[0].InfoHash.RawString()},
+		"peer_id":   {peers[0].PeerID.RawString()},
+		"ip":        {"12.34.56.78"},
+		"port":      {"6881"},
+	}
+	w := performRequest(rh, "GET", fmt.Sprintf("/%s/announce?%s", users[0].Passkey, v.Encode()))
+	resp, err := bencode.Unmarshal(w.Body.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, tkr.TrackerID, resp.(bencode.Dict)["tracker id"])
+
+	// Client supplied tracker ids are never echoed back
+	v.Set("trackerid", "previous-id")
+	w = performRequest(rh, "GET", fmt.Sprintf("/%s/announce?%s", users[0].Passkey, v.Encode()))
+	resp, err = bencode.Unmarshal(w.Body.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, tkr.TrackerID, resp.(bencode.Dict)["tracker id"])
+}
+
+func TestBitTorrentHandler_AnnounceHybrid(t *testing.T) {
+	tkr, _, users, _ := tracker.NewTestTracker()
+	rh := NewBitTorrentHandler(tkr)
+	hybrid := store.GenerateTestTorrent()
+	hybrid.InfoHashV2 = store.GenerateTestTorrent().InfoHash
+	require.NoError(t, tkr.Torrents.Add(hybrid))
+	for i, ih := range []model.InfoHash{hybrid.InfoHash, hybrid.InfoHashV2} {
+		v := url.Values{
+			"info_hash": {ih.RawString()},
+			"peer_id":   {store.GenerateTestPeer().PeerID.RawString()},
+			"ip":        {fmt.Sprintf("12.34.56.%d", i+1)},
+			"port":      {"6881"},
+		}
+		w := performRequest(rh, "GET", fmt.Sprintf("/%s/announce?%s", users[0].Passkey, v.Encode()))
+		resp, err := bencode.Unmarshal(w.Body.Bytes())
+		require.NoError(t, err)
+		_, failed := resp.(bencode.Dict)["failure reason"]
+		require.False(t, failed)
+	}
+	// Both announces must end up in the swarm keyed by the v1 info hash
+	seeders, leechers, err := tkr.Peers.Counts(hybrid.InfoHash)
+	require.NoError(t, err)
+	require.Equal(t, uint(2), seeders+leechers)
+}
+
+func TestBitTorrentHandler_AnnounceKey(t *testing.T) {
+	tkr, torrents, users, _ := tracker.NewTestTracker()
+	// Allow re-announcing immediately
+	tkr.AnnIntervalMin = 0
+	rh := NewBitTorrentHandler(tkr)
+	peerID := store.GenerateTestPeer().PeerID
+	v := url.Values{
+		"info_hash": {torrents[0].InfoHash.RawString()},
+		"peer_id":   {peerID.RawString()},
+		"ip":        {"12.34.56.78"},
+		"port":      {"6881"},
+		"key":       {"ABCD1234"},
+	}
+	announce := func() bencode.Dict {
+		w := performRequest(rh, "GET", fmt.Sprintf("/%s/announce?%s", users[0].Passkey, v.Encode()))
+		resp, err := bencode.Unmarshal(w.Body.Bytes())
+		require.NoError(t, err)
+		return resp.(bencode.Dict)
+	}
+	announce()
+
+	// The same key allows the peer to change its address
+	v.Set("ip", "12.34.56.79")
+	v.Set("port", "6882")
+	_, failed := announce()["failure reason"]
+	require.False(t, failed)
+	var peer model.Peer
+	require.NoError(t, tkr.Peers.Get(&peer, torrents[0].InfoHash, peerID))
+	require.Equal(t, "12.34.56.79", peer.IP.String())
+	require.Equal(t, uint16(6882), peer.Port)
+
+	// A different key is rejected and the peer is left untouched
+	v.Set("ip", "98.76.54.32")
+	v.Set("key", "FFFFFFFF")
+	require.Equal(t, TrackerErr(msgInvalidPeerKey).Error(), announce()["failure reason"])
+	require.NoError(t, tkr.Peers.Get(&peer, torrents[0].InfoHash, peerID))
+	require.Equal(t, "12.34.56.79", peer.IP.String())
+}
+
+func TestBitTorrentHandler_AnnounceKeyAdopted(t *testing.T) {
+	tkr, torrents, users, _ := tracker.NewTestTracker()
+	// Allow re-announcing immediately
+	tkr.AnnIntervalMin = 0
+	rh := NewBitTorrentHandler(tkr)
+	peerID := store.GenerateTestPeer().PeerID
+	v := url.Values{
+		"info_hash": {torrents[0].InfoHash.RawString()},
+		"peer_id":   {peerID.RawString()},
+		"ip":        {"12.34.56.78"},
+		"port":      {"6881"},
+	}
+	announce := func() bencode.Dict {
+		w := performRequest(rh, "GET", fmt.Sprintf("/%s/announce?%s", users[0].Passkey, v.Encode()))
+		resp, err := bencode.Unmarshal(w.Body.Bytes())
+		require.NoError(t, err)
+		return resp.(bencode.Dict)
+	}
+	announce()
+
+	// A key sent from another address is not adopted
+	v.Set("ip", "98.76.54.32")
+	v.Set("key", "FFFFFFFF")
+	announce()
+	var peer model.Peer
+	require.NoError(t, tkr.Peers.Get(&peer, torrents[0].InfoHash, peerID))
+	require.Equal(t, "", peer.Key)
+
+	// The first key sent from the peers own address is stored and required from then on
+	v.Set("ip", "12.34.56.78")
+	v.Set("key", "ABCD1234")
+	_, failed := announce()["failure reason"]
+	require.False(t, failed)
+	require.NoError(t, tkr.Peers.Get(&peer, torrents[0].InfoHash, peerID))
+	require.Equal(t, "ABCD1234", peer.Key)
+	v.Del("key")
+	require.Equal(t, TrackerErr(msgInvalidPeerKey).Error(), announce()["failure reason"])
+}
+
+func TestBitTorrentHandler_AnnounceWhitelist(t *testing.T) {
+	tkr, torrents, users, _ := tracker.NewTestTracker()
+	tkr.Whitelist["qB"] = model.WhiteListClient{
+		ClientPrefix: "qB", ClientName: "qBittorrent", MinVersion: "4.2.0", BannedVersions: "4.3.0",
+	}
+	// A second entry for the same client allowing a older release series
+	tkr.Whitelist["-qB"] = model.WhiteListClient{
+		ClientPrefix: "-qB", ClientName: "qBittorrent", MinVersion: "4.1.0", MaxVersion: "4.1.9",
+	}
+	rh := NewBitTorrentHandler(tkr)
+	for peerID, reason := range map[string]string{
+		"-qB4520-aaaaaaaaaaaa":       "",
+		"-qB4300-aaaaaaaaaaaa":       "Client version not allowed: qBittorrent 4.3.0.0",
+		"-qB4100-aaaaaaaaaaaa":       "",
+		"-qB4000-aaaaaaaaaaaa":       "Client version not allowed: qBittorrent 4.0.0.0",
+		"-TR2940-aaaaaaaaaaaa":       "Client not allowed: Transmission 2.9.4.0",
+		"\x01\x02aaaaaaaaaaaaaaaaaa": "Client not allowed: Unknown client",
+	} {
+		v := url.Values{
+			"info_hash": {torrents[0].InfoHash.RawString()},
+			"peer_id":   {peerID},
+			"ip":        {"12.34.56.78"},
+			"port":      {"6881"},
+		}
+		w := performRequest(rh, "GET", fmt.Sprintf("/%s/announce?%s", users[0].Passkey, v.Encode()))
+		resp, err := bencode.Unmarshal(w.Body.Bytes())
+		require.NoError(t, err)
+		failure, _ := resp.(bencode.Dict)["failure reason"].(string)
+		require.Equal(t, reason, failure, peerID)
+	}
+}
+
+func TestBitTorrentHandler_AnnounceRateLimit(t *testing.T) {
+	tkr, torrents, users, _ := tracker.NewTestTracker()
+	tkr.AnnIntervalMin = 0
+	tkr.RateLimitTorrent = store.Rate{Count: 2, Period: time.Minute}
+	rh := NewBitTorrentHandler(tkr)
+	announce := func(ih model.InfoHash) bencode.Dict {
+		v := url.Values{
+			"info_hash": {ih.RawString()},
+			"peer_id":   {store.GenerateTestPeer().PeerID.RawString()},
+			"ip":        {"12.34.56.78"},
+			"port":      {"6881"},
+		}
+		w := performRequest(rh, "GET", fmt.Sprintf("/%s/announce?%s", users[0].Passkey, v.Encode()))
+		resp, err := bencode.Unmarshal(w.Body.Bytes())
+		require.NoError(t, err)
+		return resp.(bencode.Dict)
+	}
+	for i := 0; i < tkr.RateLimitTorrent.Count; i++ {
+		_, failed := announce(torrents[0].InfoHash)["failure reason"]
+		require.False(t, failed)
+	}
+	resp := announce(torrents[0].InfoHash)
+	require.Equal(t, TrackerErr(msgClientRequestTooFast).Error(), resp["failure reason"])
+	require.EqualValues(t, retryInMap[msgClientRequestTooFast], resp["retry in"])
+	// Other torrents have their own bucket
+	_, failed := announce(torrents[1].InfoHash)["failure reason"]
+	require.False(t, failed)
+}
+
+func TestBitTorrentHandler_AnnounceMinInterval(t *testing.T) {
+	tkr, torrents, users, _ := tracker.NewTestTracker()
+	tkr.AnnIntervalMin = time.Hour
+	rh := NewBitTorrentHandler(tkr)
+	peer := store.GenerateTestPeer()
+	peer.AnnounceFirst = time.Now().Add(-3 * time.Hour)
+	peer.AnnounceLast = time.Now().Add(-2 * time.Hour)
+	require.NoError(t, tkr.Peers.Add(torrents[0].InfoHash, peer))
+	v := url.Values{
+		"info_hash": {torrents[0].InfoHash.RawString()},
+		"peer_id":   {peer.PeerID.RawString()},
+		"ip":        {"12.34.56.78"},
+		"port":      {"6881"},
+	}
+	w := performRequest(rh, "GET", fmt.Sprintf("/%s/announce?%s", users[0].Passkey, v.Encode()))
+	resp, err := bencode.Unmarshal(w.Body.Bytes())
+	require.NoError(t, err)
+	_, failed := resp.(bencode.Dict)["failure reason"]
+	require.False(t, failed)
+	// Re-announcing within the interval is denied before the batch update has synced
+	w = performRequest(rh, "GET", fmt.Sprintf("/%s/announce?%s", users[0].Passkey, v.Encode()))
+	resp, err = bencode.Unmarshal(w.Body.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, TrackerErr(msgClientRequestTooFast).Error(), resp.(bencode.Dict)["failure reason"])
+	// Events are always allowed
+	v.Set("event", "stopped")
+	w = performRequest(rh, "GET", fmt.Sprintf("/%s/announce?%s", users[0].Passkey, v.Encode()))
+	resp, err = bencode.Unmarshal(w.Body.Bytes())
+	require.NoError(t, err)
+	_, failed = resp.(bencode.Dict)["failure reason"]
+	require.False(t, failed)
+}
+
+func TestBitTorrentHandler_AnnounceDownloadDisabled(t *testing.T) {
+	tkr, torrents, users, peers := tracker.NewTestTracker()
+	usr := users[0]
+	require.NoError(t, tkr.Users.SetDownloadEnabled(usr.UserID, false))
+	rh := NewBitTorrentHandler(tkr)
+	announce := func(left string) bencode.Dict {
+		v := url.Values{
+			"info_hash": {torrents[0].InfoHash.RawString()},
+			"peer_id":   {peers[0].PeerID.RawString()},
+			"ip":        {"12.34.56.78"},
+			"port":      {"6881"},
+			"left":      {left},
+		}
+		w := performRequest(rh, "GET", fmt.Sprintf("/%s/announce?%s", usr.Passkey, v.Encode()))
+		resp, err := bencode.Unmarshal(w.Body.Bytes())
+		require.NoError(t, err)
+		return resp.(bencode.Dict)
+	}
+	require.Equal(t, tkr.LeechDeniedReason, announce("1000")["failure reason"])
+	denied := <-tkr.StateUpdateChan
+	require.True(t, denied.LeechDenied)
+	require.Equal(t, usr.UserID, denied.UserID)
+	// Seeding is still allowed
+	resp := announce("0")
+	require.NotContains(t, resp, "failure reason")
+	seeding := <-tkr.StateUpdateChan
+	require.False(t, seeding.LeechDenied)
+}
+
+func TestBitTorrentHandler_AnnounceBanned(t *testing.T) {
+	tkr, torrents, users, peers := tracker.NewTestTracker()
+	rh := NewBitTorrentHandler(tkr)
+	announce := func(ip string) bencode.Dict {
+		v := url.Values{
+			"info_hash": {torrents[0].InfoHash.RawString()},
+			"peer_id":   {peers[0].PeerID.RawString()},
+			"ip":        {ip},
+			"port":      {"6881"},
+			"left":      {"1000"},
+		}
+		w := performRequest(rh, "GET", fmt.Sprintf("/%s/announce?%s", users[0].Passkey, v.Encode()))
+		resp, err := bencode.Unmarshal(w.Body.Bytes())
+		require.NoError(t, err)
+		return resp.(bencode.Dict)
 	}
+	ban, err := model.NewBan("12.34.56.0/24", "Monitoring network", time.Now(), time.Time{})
+	require.NoError(t, err)
+	require.NoError(t, tkr.BanAdd([]model.Ban{ban}))
+	require.Equal(t, "IP is banned: Monitoring network", announce("12.34.56.78")["failure reason"])
+	require.NotContains(t, announce("12.34.57.78"), "failure reason")
+}
+
+func TestBitTorrentHandler_AnnounceSlots(t *testing.T) {
+	tkr, torrents, users, _ := tracker.NewTestTracker()
+	tkr.Slots = model.SlotLimits{Leech: 1, PerTorrent: 1}
+	usr := users[0]
+	rh := NewBitTorrentHandler(tkr)
+	announce := func(ih model.InfoHash, left string) bencode.Dict {
+		v := url.Values{
+			"info_hash": {ih.RawString()},
+			"peer_id":   {store.GenerateTestPeer().PeerID.RawString()},
+			"ip":        {"12.34.56.78"},
+			"port":      {"6881"},
+			"left":      {left},
+			"event":     {"started"},
+		}
+		w := performRequest(rh, "GET", fmt.Sprintf("/%s/announce?%s", usr.Passkey, v.Encode()))
+		resp, err := bencode.Unmarshal(w.Body.Bytes())
+		require.NoError(t, err)
+		return resp.(bencode.Dict)
+	}
+	require.NotContains(t, announce(torrents[0].InfoHash, "1000"), "failure reason")
+	require.Contains(t, announce(torrents[0].InfoHash, "0")["failure reason"], "Peer slot limit reached")
+	require.Contains(t, announce(torrents[1].InfoHash, "1000")["failure reason"], "Leech slot limit reached")
+	require.NotContains(t, announce(torrents[1].InfoHash, "0"), "failure reason")
+	// Per user limits override the tracker wide limits
+	require.NoError(t, tkr.Users.SetSlotLimits(usr.UserID, model.SlotLimits{Leech: -1}))
+	require.NoError(t, tkr.Users.GetByID(&usr, usr.UserID))
+	require.NotContains(t, announce(torrents[2].InfoHash, "1000"), "failure reason")
+}
+
+func TestBitTorrentHandler_AnnounceRatioWatch(t *testing.T) {
+	tkr, torrents, users, peers := tracker.NewTestTracker()
+	tkr.RatioWatchRatio = 0.5
+	tkr.RatioWatchMinDownload = 1000
+	usr := users[0]
+	usr.Uploaded = 100
+	usr.Downloaded = 1000
+	require.NoError(t, tkr.Users.Add(usr))
+	rh := NewBitTorrentHandler(tkr)
+	v := url.Values{
+		"info_hash": {torrents[0].InfoHash.RawString()},
+		"peer_id":   {peers[0].PeerID.RawString()},
+		"ip":        {"12.34.56.78"},
+		"port":      {"6881"},
+		"left":      {"1000"},
+	}
+	w := performRequest(rh, "GET", fmt.Sprintf("/%s/announce?%s", usr.Passkey, v.Encode()))
+	resp, err := bencode.Unmarshal(w.Body.Bytes())
+	require.NoError(t, err)
+	require.Contains(t, resp.(bencode.Dict)["warning message"], "Ratio watch")
+	require.Equal(t, model.RatioWatchWarned, tkr.RatioWatch[usr.UserID].Status)
+}
+
+func TestBitTorrentHandler_AnnouncePasskeyRotated(t *testing.T) {
+	tkr, torrents, users, peers := tracker.NewTestTracker()
+	tkr.PasskeyGrace = time.Hour
+	usr := users[0]
+	rotated, _, err := tkr.PasskeyRotate(usr.UserID, "", time.Time{}, time.Now())
+	require.NoError(t, err)
+	rh := NewBitTorrentHandler(tkr)
+	v := url.Values{
+		"info_hash": {torrents[0].InfoHash.RawString()},
+		"peer_id":   {peers[0].PeerID.RawString()},
+		"ip":        {"12.34.56.78"},
+		"port":      {"6881"},
+		"left":      {"1000"},
+	}
+	// The previous passkey still works but is warned to redownload
+	w := performRequest(rh, "GET", fmt.Sprintf("/%s/announce?%s", usr.Passkey, v.Encode()))
+	resp, err := bencode.Unmarshal(w.Body.Bytes())
+	require.NoError(t, err)
+	require.Nil(t, resp.(bencode.Dict)["failure reason"])
+	require.Contains(t, resp.(bencode.Dict)["warning message"], "redownload your .torrent files")
+	w = performRequest(rh, "GET", fmt.Sprintf("/%s/announce?%s", rotated.Passkey, v.Encode()))
+	resp, err = bencode.Unmarshal(w.Body.Bytes())
+	require.NoError(t, err)
+	require.Nil(t, resp.(bencode.Dict)["warning message"])
+}
+
+func TestBitTorrentHandler_AnnounceHashedPasskey(t *testing.T) {
+	viper.Set(string(config.StoreUsersPasskeySecret), "secret")
+	defer viper.Set(string(config.StoreUsersPasskeySecret), "")
+	tkr, torrents, users, peers := tracker.NewTestTracker()
+	tkr.PasskeyGrace = time.Hour
+	usr := users[0]
+	var stored model.User
+	require.NoError(t, tkr.Users.GetByID(&stored, usr.UserID))
+	require.True(t, model.IsPasskeyDigest(stored.Passkey))
+	rotated, _, err := tkr.PasskeyRotate(usr.UserID, "", time.Time{}, time.Now())
+	require.NoError(t, err)
+	rh := NewBitTorrentHandler(tkr)
+	v := url.Values{
+		"info_hash": {torrents[0].InfoHash.RawString()},
+		"peer_id":   {peers[0].PeerID.RawString()},
+		"ip":        {"12.34.56.78"},
+		"port":      {"6881"},
+		"left":      {"1000"},
+	}
+	// The previous plaintext passkey still works during the grace period
+	w := performRequest(rh, "GET", fmt.Sprintf("/%s/announce?%s", usr.Passkey, v.Encode()))
+	resp, err := bencode.Unmarshal(w.Body.Bytes())
+	require.NoError(t, err)
+	require.Nil(t, resp.(bencode.Dict)["failure reason"])
+	require.Contains(t, resp.(bencode.Dict)["warning message"], "redownload your .torrent files")
+	v.Set("peer_id", peers[1].PeerID.RawString())
+	w = performRequest(rh, "GET", fmt.Sprintf("/%s/announce?%s", rotated.Passkey, v.Encode()))
+	resp, err = bencode.Unmarshal(w.Body.Bytes())
+	require.NoError(t, err)
+	require.Nil(t, resp.(bencode.Dict)["failure reason"])
+	require.Nil(t, resp.(bencode.Dict)["warning message"])
+	// The stored digests cannot be used in place of the passkeys
+	for _, passkey := range []string{stored.Passkey, model.HashPasskey([]byte("secret"), rotated.Passkey)} {
+		w = performRequest(rh, "GET", fmt.Sprintf("/%s/announce?%s", passkey, v.Encode()))
+		resp, err = bencode.Unmarshal(w.Body.Bytes())
+		require.NoError(t, err)
+		require.Equal(t, TrackerErr(msgInvalidAuth).Error(), resp.(bencode.Dict)["failure reason"])
+	}
+}
+
+func TestBitTorrentHandler_AnnounceAltPasskey(t *testing.T) {
+	tkr, torrents, users, _ := tracker.NewTestTracker()
+	usr := users[0]
+	seedbox, err := tkr.PasskeyAdd(usr.UserID, "seedbox", "", time.Time{}, time.Now())
+	require.NoError(t, err)
+	rh := NewBitTorrentHandler(tkr)
+	peerID := store.GenerateTestPeer().PeerID
+	v := url.Values{
+		"info_hash": {torrents[0].InfoHash.RawString()},
+		"peer_id":   {peerID.RawString()},
+		"ip":        {"12.34.56.78"},
+		"port":      {"6881"},
+		"left":      {"1000"},
+		"event":     {"started"},
+	}
+	w := performRequest(rh, "GET", fmt.Sprintf("/%s/announce?%s", seedbox.Passkey, v.Encode()))
+	resp, err := bencode.Unmarshal(w.Body.Bytes())
+	require.NoError(t, err)
+	require.Nil(t, resp.(bencode.Dict)["failure reason"])
+	require.Nil(t, resp.(bencode.Dict)["warning message"])
+	// The peer records which passkey it came in on and the passkey usage is tracked
+	var peer model.Peer
+	require.NoError(t, tkr.Peers.Get(&peer, torrents[0].InfoHash, peerID))
+	require.Equal(t, usr.UserID, peer.UserID)
+	require.Equal(t, "seedbox", peer.PasskeyLabel)
+	u := <-tkr.StateUpdateChan
+	require.True(t, u.AltPasskey)
+	require.Equal(t, seedbox.Passkey, u.Passkey)
+
+	// Revoked passkeys stop working
+	require.NoError(t, tkr.PasskeyRevoke(usr.UserID, seedbox.Passkey))
+	w = performRequest(rh, "GET", fmt.Sprintf("/%s/announce?%s", seedbox.Passkey, v.Encode()))
+	resp, err = bencode.Unmarshal(w.Body.Bytes())
+	require.NoError(t, err)
+	require.NotNil(t, resp.(bencode.Dict)["failure reason"])
 }
@@ -10,6 +10,8 @@ import (
 	"github.com/leighmacdonald/mika/util"
 	log "github.com/sirupsen/logrus"
 	"net/http"
+	"sort"
+	"strconv"
 	"time"
 )
 
@@ -46,7 +48,7 @@ func (a *AdminAPI) whitelistAdd(c *gin.Context) {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	if wcl.ClientPrefix == "" || wcl.ClientName == "" {
+	if wcl.ClientPrefix == "" || wcl.ClientName == "" || wcl.Validate() != nil {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
@@ -97,6 +99,110 @@ func (a *AdminAPI) whitelistGet(c *gin.Context) {
 	c.JSON(http.StatusOK, wl)
 }
 
+func (a *AdminAPI) promotionAdd(c *gin.Context) {
+	var promo model.Promotion
+	if err := c.BindJSON(&promo); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: "Malformed request"})
+		return
+	}
+	if err := promo.Validate(); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: err.Error()})
+		return
+	}
+	if promo.Expired(time.Now()) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: "Promotion has already ended"})
+		return
+	}
+	a.t.PromotionsMutex.Lock()
+	defer a.t.PromotionsMutex.Unlock()
+	if err := a.t.Torrents.PromotionAdd(promo); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, StatusResp{Err: "Failed to add promotion"})
+		return
+	}
+	a.t.Promotions[promo.Name] = promo
+	c.JSON(http.StatusOK, StatusResp{Message: "Promotion added successfully"})
+}
+
+func (a *AdminAPI) promotionDelete(c *gin.Context) {
+	name := c.Param("name")
+	a.t.PromotionsMutex.Lock()
+	defer a.t.PromotionsMutex.Unlock()
+	promo, found := a.t.Promotions[name]
+	if !found {
+		c.AbortWithStatusJSON(http.StatusNotFound, StatusResp{Err: "Promotion not found"})
+		return
+	}
+	if err := a.t.Torrents.PromotionDelete(promo); err != nil && err != consts.ErrInvalidPromotion {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, StatusResp{Err: "Failed to delete promotion"})
+		return
+	}
+	delete(a.t.Promotions, name)
+	c.JSON(http.StatusOK, StatusResp{Message: "Deleted promotion successfully"})
+}
+
+func (a *AdminAPI) promotionGet(c *gin.Context) {
+	promos := []model.Promotion{}
+	a.t.PromotionsMutex.RLock()
+	defer a.t.PromotionsMutex.RUnlock()
+	for _, promo := range a.t.Promotions {
+		promos = append(promos, promo)
+	}
+	sort.Slice(promos, func(i, j int) bool {
+		return promos[i].TimeStart.Before(promos[j].TimeStart)
+	})
+	c.JSON(http.StatusOK, promos)
+}
+
+// banAdd bans the addresses and CIDR ranges provided. Bans are normalized before being stored so
+// single addresses may be sent without a prefix length.
+func (a *AdminAPI) banAdd(c *gin.Context) {
+	var req []model.Ban
+	if err := c.BindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: "Malformed request"})
+		return
+	}
+	if len(req) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: "No bans provided"})
+		return
+	}
+	now := time.Now()
+	bans := make([]model.Ban, len(req))
+	for i, b := range req {
+		ban, err := model.NewBan(b.CIDR, b.Reason, now, b.TimeExpire)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: b.CIDR + ": " + err.Error()})
+			return
+		}
+		bans[i] = ban
+	}
+	if err := a.t.BanAdd(bans); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, StatusResp{Err: "Failed to add bans"})
+		return
+	}
+	c.JSON(http.StatusOK, StatusResp{Message: "Added " + strconv.Itoa(len(bans)) + " bans successfully"})
+}
+
+func (a *AdminAPI) banDelete(c *gin.Context) {
+	n, err := model.ParseBanNetwork(c.Param("ip") + "/" + c.Param("bits"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: err.Error()})
+		return
+	}
+	if err := a.t.BanDelete(n.String()); err != nil {
+		if err == consts.ErrInvalidBan {
+			c.AbortWithStatusJSON(http.StatusNotFound, StatusResp{Err: "Ban not found"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, StatusResp{Err: "Failed to delete ban"})
+		return
+	}
+	c.JSON(http.StatusOK, StatusResp{Message: "Deleted ban successfully"})
+}
+
+func (a *AdminAPI) banGet(c *gin.Context) {
+	c.JSON(http.StatusOK, a.t.BanGetAll())
+}
+
 func (a *AdminAPI) ping(c *gin.Context) {
 	var r PingRequest
 	if err := c.BindJSON(&r); err != nil {
@@ -125,6 +231,15 @@ func infoHashFromCtx(infoHash *model.InfoHash, c *gin.Context) bool {
 type TorrentAddRequest struct {
 	Name     string `json:"name"`
 	InfoHash string `json:"info_hash"`
+	// InfoHashV2 is the optional BEP 52 v2 info hash of a hybrid torrent
+	InfoHashV2 string `json:"info_hash_v2"`
+	// Tags such as categories used to scope promotions
+	Tags []string `json:"tags"`
+	// MultiUp & MultiDn are optional multipliers, when unset they default to 1.0
+	MultiUp *float64 `json:"multi_up,omitempty"`
+	MultiDn *float64 `json:"multi_dn,omitempty"`
+	// Size is the total size of the torrents files in bytes, used when awarding bonus points
+	Size uint64 `json:"size"`
 }
 
 func (a *AdminAPI) torrentAdd(c *gin.Context) {
@@ -133,14 +248,30 @@ func (a *AdminAPI) torrentAdd(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: "Malformed request"})
 		return
 	}
-	var t model.Torrent
 	var ih model.InfoHash
 	if err := model.InfoHashFromString(&ih, req.InfoHash); err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: err.Error()})
 		return
 	}
-	t.ReleaseName = req.Name
-	t.InfoHash = ih
+	t := model.NewTorrent(ih, req.Name)
+	if req.MultiUp != nil {
+		t.MultiUp = *req.MultiUp
+	}
+	if req.MultiDn != nil {
+		t.MultiDn = *req.MultiDn
+	}
+	if t.MultiUp < 0 || t.MultiDn < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: "Multipliers cannot be negative"})
+		return
+	}
+	if req.InfoHashV2 != "" {
+		if err := model.InfoHashFromString(&t.InfoHashV2, req.InfoHashV2); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: err.Error()})
+			return
+		}
+	}
+	t.Tags = req.Tags
+	t.Size = req.Size
 	if err := a.t.Torrents.Add(t); err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: err.Error()})
 		return
@@ -253,6 +384,573 @@ func (a *AdminAPI) userAdd(c *gin.Context) {
 	c.JSON(http.StatusOK, UserAddResponse{Passkey: user.Passkey})
 }
 
+func (a *AdminAPI) userGet(c *gin.Context) {
+	userID, ok := userIDFromCtx(c)
+	if !ok {
+		return
+	}
+	var user model.User
+	if err := a.t.Users.GetByID(&user, userID); err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, StatusResp{Err: "User not found"})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// UserUpdateRequest represents a JSON API request to change a users settings. Only the
+// settings which are set are changed.
+type UserUpdateRequest struct {
+	DownloadEnabled *bool `json:"download_enabled,omitempty"`
+	// Slots override the tracker wide peer slot limits. 0 uses the tracker wide limit while
+	// negative values remove the limit for the user.
+	Slots *model.SlotLimits `json:"slots,omitempty"`
+}
+
+func (a *AdminAPI) userUpdate(c *gin.Context) {
+	userID, ok := userIDFromCtx(c)
+	if !ok {
+		return
+	}
+	var req UserUpdateRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: "Malformed request"})
+		return
+	}
+	if req.DownloadEnabled == nil && req.Slots == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: "Nothing to update"})
+		return
+	}
+	var err error
+	if req.DownloadEnabled != nil {
+		err = a.t.Users.SetDownloadEnabled(userID, *req.DownloadEnabled)
+	}
+	if err == nil && req.Slots != nil {
+		err = a.t.Users.SetSlotLimits(userID, *req.Slots)
+	}
+	if err != nil {
+		if err == consts.ErrInvalidUser {
+			c.AbortWithStatusJSON(http.StatusNotFound, StatusResp{Err: "User not found"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, StatusResp{Err: "Failed to update user"})
+		return
+	}
+	c.JSON(http.StatusOK, StatusResp{Message: "Updated user successfully"})
+}
+
+// PasskeyRotateRequest represents a JSON API request to replace a users passkey
+type PasskeyRotateRequest struct {
+	// Passkey is the new passkey, a random passkey is generated when empty
+	Passkey string `json:"passkey,omitempty"`
+	// TimeExpire is when the previous passkey stops working. The tracker_passkey_grace period is used
+	// when zero while times which have already passed stop the previous passkey immediately.
+	TimeExpire time.Time `json:"time_expire,omitempty"`
+}
+
+// PasskeyRotateResponse represents a JSON API response to replacing a users passkey
+type PasskeyRotateResponse struct {
+	Passkey string `json:"passkey"`
+	// Previous is the previous passkey and when it stops working, empty when it stopped immediately
+	Previous model.Passkey `json:"previous"`
+}
+
+func (a *AdminAPI) passkeyRotate(c *gin.Context) {
+	userID, ok := userIDFromCtx(c)
+	if !ok {
+		return
+	}
+	var req PasskeyRotateRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: "Malformed request"})
+		return
+	}
+	usr, previous, err := a.t.PasskeyRotate(userID, req.Passkey, req.TimeExpire, time.Now())
+	if err != nil {
+		switch err {
+		case consts.ErrInvalidUser:
+			c.AbortWithStatusJSON(http.StatusNotFound, StatusResp{Err: "User not found"})
+		case consts.ErrMalformedRequest:
+			c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: "Invalid passkey"})
+		case consts.ErrDuplicate:
+			c.AbortWithStatusJSON(http.StatusConflict, StatusResp{Err: "Passkey already in use"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, StatusResp{Err: "Failed to rotate passkey"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, PasskeyRotateResponse{Passkey: usr.Passkey, Previous: previous})
+}
+
+// PasskeyAddRequest represents a JSON API request to give a user an additional labelled passkey
+type PasskeyAddRequest struct {
+	UserID uint32 `json:"user_id"`
+	// Label identifies the device or client using the passkey, eg: seedbox
+	Label string `json:"label"`
+	// Passkey is the new passkey, a random passkey is generated when empty
+	Passkey string `json:"passkey,omitempty"`
+	// TimeExpire is when the passkey stops working, passkeys with a zero value work until revoked
+	TimeExpire time.Time `json:"time_expire,omitempty"`
+}
+
+func (a *AdminAPI) passkeyAdd(c *gin.Context) {
+	var req PasskeyAddRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: "Malformed request"})
+		return
+	}
+	pk, err := a.t.PasskeyAdd(req.UserID, req.Label, req.Passkey, req.TimeExpire, time.Now())
+	if err != nil {
+		switch err {
+		case consts.ErrInvalidUser:
+			c.AbortWithStatusJSON(http.StatusNotFound, StatusResp{Err: "User not found"})
+		case consts.ErrMalformedRequest:
+			c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: "Invalid passkey or label"})
+		case consts.ErrDuplicate:
+			c.AbortWithStatusJSON(http.StatusConflict, StatusResp{Err: "Passkey or label already in use"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, StatusResp{Err: "Failed to add passkey"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, pk)
+}
+
+func (a *AdminAPI) passkeyRevoke(c *gin.Context) {
+	userID, ok := userIDFromCtx(c)
+	if !ok {
+		return
+	}
+	if err := a.t.PasskeyRevoke(userID, c.Param("passkey")); err != nil {
+		if err == consts.ErrInvalidPasskey {
+			c.AbortWithStatusJSON(http.StatusNotFound, StatusResp{Err: "Passkey not found"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, StatusResp{Err: "Failed to revoke passkey"})
+		return
+	}
+	c.JSON(http.StatusOK, StatusResp{Message: "Revoked passkey successfully"})
+}
+
+// passkeyGet returns the additional passkeys of the user, such as the passkeys of their devices and
+// previous passkeys which are still within their grace period
+func (a *AdminAPI) passkeyGet(c *gin.Context) {
+	userID, ok := userIDFromCtx(c)
+	if !ok {
+		return
+	}
+	passkeys, err := a.t.Users.PasskeyGetByUser(userID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, StatusResp{Err: "Failed to fetch passkeys"})
+		return
+	}
+	if passkeys == nil {
+		passkeys = []model.Passkey{}
+	}
+	c.JSON(http.StatusOK, passkeys)
+}
+
+// userIDFromCtx parses the user_id path parameter
+func userIDFromCtx(c *gin.Context) (uint32, bool) {
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil || userID == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: "Invalid user_id"})
+		return 0, false
+	}
+	return uint32(userID), true
+}
+
+func (a *AdminAPI) hnrGet(c *gin.Context) {
+	userID, ok := userIDFromCtx(c)
+	if !ok {
+		return
+	}
+	records, err := a.t.HNRGetByUser(userID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, StatusResp{Err: "Failed to fetch hit and runs"})
+		return
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].TimeCompleted.Before(records[j].TimeCompleted)
+	})
+	c.JSON(http.StatusOK, records)
+}
+
+func (a *AdminAPI) hnrDelete(c *gin.Context) {
+	userID, ok := userIDFromCtx(c)
+	if !ok {
+		return
+	}
+	var ih model.InfoHash
+	if !infoHashFromCtx(&ih, c) {
+		return
+	}
+	if err := a.t.HNRForgive(userID, ih); err != nil {
+		if err == consts.ErrInvalidHNR {
+			c.AbortWithStatusJSON(http.StatusNotFound, StatusResp{Err: "Hit and run not found"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, StatusResp{Err: "Failed to delete hit and run"})
+		return
+	}
+	c.JSON(http.StatusOK, StatusResp{Message: "Deleted hit and run successfully"})
+}
+
+// FreeleechGrantRequest represents a JSON API request to grant a user personal freeleech on a torrent
+type FreeleechGrantRequest struct {
+	TimeExpire time.Time `json:"time_expire"`
+}
+
+func (a *AdminAPI) freeleechGrant(c *gin.Context) {
+	userID, ok := userIDFromCtx(c)
+	if !ok {
+		return
+	}
+	var ih model.InfoHash
+	if !infoHashFromCtx(&ih, c) {
+		return
+	}
+	var req FreeleechGrantRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: "Malformed request"})
+		return
+	}
+	now := time.Now()
+	if !req.TimeExpire.After(now) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: "Freeleech token has already expired"})
+		return
+	}
+	var user model.User
+	if err := a.t.Users.GetByID(&user, userID); err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, StatusResp{Err: "User not found"})
+		return
+	}
+	var tor model.Torrent
+	if err := a.t.Torrents.Get(&tor, ih); err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, StatusResp{Err: "Torrent not found"})
+		return
+	}
+	token := model.FreeleechToken{
+		UserID:      userID,
+		InfoHash:    tor.InfoHash,
+		TimeCreated: now,
+		TimeExpire:  req.TimeExpire,
+	}
+	if err := a.t.FreeleechGrant(token); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, StatusResp{Err: "Failed to grant freeleech token"})
+		return
+	}
+	c.JSON(http.StatusOK, StatusResp{Message: "Freeleech token granted successfully"})
+}
+
+func (a *AdminAPI) freeleechConsume(c *gin.Context) {
+	userID, ok := userIDFromCtx(c)
+	if !ok {
+		return
+	}
+	var ih model.InfoHash
+	if !infoHashFromCtx(&ih, c) {
+		return
+	}
+	if err := a.t.FreeleechConsume(userID, ih); err != nil {
+		if err == consts.ErrInvalidFreeleech {
+			c.AbortWithStatusJSON(http.StatusNotFound, StatusResp{Err: "Freeleech token not found"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, StatusResp{Err: "Failed to consume freeleech token"})
+		return
+	}
+	c.JSON(http.StatusOK, StatusResp{Message: "Freeleech token consumed successfully"})
+}
+
+func (a *AdminAPI) freeleechGet(c *gin.Context) {
+	userID, ok := userIDFromCtx(c)
+	if !ok {
+		return
+	}
+	tokens := a.t.FreeleechGetByUser(userID)
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].TimeExpire.Before(tokens[j].TimeExpire)
+	})
+	c.JSON(http.StatusOK, tokens)
+}
+
+// RatioWatchRules represents the ratio rules enforced by the tracker
+type RatioWatchRules struct {
+	// Ratio is the minimum ratio users must maintain, 0 when ratio watch is disabled
+	Ratio float64 `json:"ratio"`
+	// MinDownload is how many bytes a user must download before their ratio is enforced
+	MinDownload uint64 `json:"min_download"`
+	// Period is how long users are warned before downloading is disabled
+	Period string `json:"period"`
+}
+
+// RatioWatchResponse represents a JSON API response listing the users currently being watched
+type RatioWatchResponse struct {
+	Rules   RatioWatchRules    `json:"rules"`
+	Records []model.RatioWatch `json:"records"`
+}
+
+// ratioWatchGetAll returns the ratio rules and the users who are warned or have downloading disabled
+func (a *AdminAPI) ratioWatchGetAll(c *gin.Context) {
+	records := a.t.RatioWatchGetAll()
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].TimeDeadline.Before(records[j].TimeDeadline)
+	})
+	c.JSON(http.StatusOK, RatioWatchResponse{
+		Rules: RatioWatchRules{
+			Ratio:       a.t.RatioWatchRatio,
+			MinDownload: a.t.RatioWatchMinDownload,
+			Period:      a.t.RatioWatchPeriod.String(),
+		},
+		Records: records,
+	})
+}
+
+// ratioWatchGet returns the ratio watch record of the user, including cleared records
+func (a *AdminAPI) ratioWatchGet(c *gin.Context) {
+	userID, ok := userIDFromCtx(c)
+	if !ok {
+		return
+	}
+	var rw model.RatioWatch
+	if err := a.t.RatioWatchGet(&rw, userID); err != nil {
+		if err == consts.ErrInvalidRatioWatch {
+			c.AbortWithStatusJSON(http.StatusNotFound, StatusResp{Err: "Ratio watch not found"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, StatusResp{Err: "Failed to fetch ratio watch"})
+		return
+	}
+	c.JSON(http.StatusOK, rw)
+}
+
+func (a *AdminAPI) ratioWatchClear(c *gin.Context) {
+	userID, ok := userIDFromCtx(c)
+	if !ok {
+		return
+	}
+	if err := a.t.RatioWatchClear(userID, time.Now()); err != nil {
+		if err == consts.ErrInvalidRatioWatch {
+			c.AbortWithStatusJSON(http.StatusNotFound, StatusResp{Err: "Ratio watch not found"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, StatusResp{Err: "Failed to clear ratio watch"})
+		return
+	}
+	c.JSON(http.StatusOK, StatusResp{Message: "Ratio watch cleared successfully"})
+}
+
+// BonusResponse represents a JSON API response for a users bonus points
+type BonusResponse struct {
+	UserID      uint32  `json:"user_id"`
+	BonusPoints float64 `json:"bonus_points"`
+}
+
+// BonusAdjustRequest represents a JSON API request to change a users bonus points. Negative
+// amounts remove points from the user. The change is recorded in the users ledger.
+type BonusAdjustRequest struct {
+	Amount float64 `json:"amount"`
+	Reason string  `json:"reason"`
+	Actor  string  `json:"actor"`
+}
+
+// bonusGet returns the bonus points known to the UserStore. Points earned since the last batch
+// update are not included.
+func (a *AdminAPI) bonusGet(c *gin.Context) {
+	userID, ok := userIDFromCtx(c)
+	if !ok {
+		return
+	}
+	var user model.User
+	if err := a.t.Users.GetByID(&user, userID); err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, StatusResp{Err: "User not found"})
+		return
+	}
+	c.JSON(http.StatusOK, BonusResponse{UserID: user.UserID, BonusPoints: user.BonusPoints})
+}
+
+// bonusAdjust adds the amount to the users bonus points. The change is applied as a ledger
+// adjustment so it does not overwrite any points earned concurrently.
+func (a *AdminAPI) bonusAdjust(c *gin.Context) {
+	userID, ok := userIDFromCtx(c)
+	if !ok {
+		return
+	}
+	var req BonusAdjustRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: "Malformed request"})
+		return
+	}
+	var user model.User
+	if err := a.t.Users.GetByID(&user, userID); err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, StatusResp{Err: "User not found"})
+		return
+	}
+	if user.BonusPoints+req.Amount < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: "Insufficient bonus points"})
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "Bonus point adjustment"
+	}
+	entry := model.LedgerEntry{
+		UserID:      user.UserID,
+		Source:      model.LedgerAdjustment,
+		BonusPoints: req.Amount,
+		Reason:      req.Reason,
+		Actor:       req.Actor,
+		TimeCreated: time.Now(),
+	}
+	if err := a.t.Users.LedgerAdjust(entry); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, StatusResp{Err: "Failed to update bonus points"})
+		return
+	}
+	c.JSON(http.StatusOK, BonusResponse{UserID: user.UserID, BonusPoints: user.BonusPoints + req.Amount})
+}
+
+// LedgerAdjustRequest represents a JSON API request to manually adjust a users stats. The values
+// are added to the users totals, negative values remove credit from the user.
+type LedgerAdjustRequest struct {
+	Uploaded    int64   `json:"uploaded"`
+	Downloaded  int64   `json:"downloaded"`
+	BonusPoints float64 `json:"bonus_points"`
+	// Reason & Actor are required so every adjustment can be audited
+	Reason string `json:"reason"`
+	Actor  string `json:"actor"`
+}
+
+// ledgerAdjust applies a manual adjustment to the users stats and records it in the ledger
+func (a *AdminAPI) ledgerAdjust(c *gin.Context) {
+	userID, ok := userIDFromCtx(c)
+	if !ok {
+		return
+	}
+	var req LedgerAdjustRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: "Malformed request"})
+		return
+	}
+	if req.Reason == "" || req.Actor == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: "Reason and actor are required"})
+		return
+	}
+	entry := model.LedgerEntry{
+		UserID:      userID,
+		Source:      model.LedgerAdjustment,
+		Uploaded:    req.Uploaded,
+		Downloaded:  req.Downloaded,
+		BonusPoints: req.BonusPoints,
+		Reason:      req.Reason,
+		Actor:       req.Actor,
+		TimeCreated: time.Now(),
+	}
+	if entry.Empty() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: "Adjustment does not change any stats"})
+		return
+	}
+	var user model.User
+	if err := a.t.Users.GetByID(&user, userID); err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, StatusResp{Err: "User not found"})
+		return
+	}
+	if int64(user.Uploaded)+req.Uploaded < 0 || int64(user.Downloaded)+req.Downloaded < 0 ||
+		user.BonusPoints+req.BonusPoints < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: "Adjustment exceeds the users totals"})
+		return
+	}
+	if err := a.t.Users.LedgerAdjust(entry); err != nil {
+		if err == consts.ErrInvalidUser {
+			c.AbortWithStatusJSON(http.StatusNotFound, StatusResp{Err: "User not found"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, StatusResp{Err: "Failed to apply adjustment"})
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+func (a *AdminAPI) ledgerGetByUser(c *gin.Context) {
+	userID, ok := userIDFromCtx(c)
+	if !ok {
+		return
+	}
+	offset, limit, ok := pageFromCtx(c)
+	if !ok {
+		return
+	}
+	entries, err := a.t.Users.LedgerGetByUser(userID, offset, limit)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, StatusResp{Err: "Failed to fetch ledger"})
+		return
+	}
+	if entries == nil {
+		entries = []model.LedgerEntry{}
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+const (
+	// pageLimitDefault is the number of results returned by paginated endpoints when no limit is requested
+	pageLimitDefault = 50
+	// pageLimitMax is the maximum number of results returned by paginated endpoints
+	pageLimitMax = 500
+)
+
+// pageFromCtx parses the optional offset & limit query parameters used for pagination
+func pageFromCtx(c *gin.Context) (offset int, limit int, ok bool) {
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: "Invalid offset"})
+		return 0, 0, false
+	}
+	limit, err = strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(pageLimitDefault)))
+	if err != nil || limit <= 0 || limit > pageLimitMax {
+		c.AbortWithStatusJSON(http.StatusBadRequest, StatusResp{Err: "Invalid limit"})
+		return 0, 0, false
+	}
+	return offset, limit, true
+}
+
+func (a *AdminAPI) snatchGetByUser(c *gin.Context) {
+	userID, ok := userIDFromCtx(c)
+	if !ok {
+		return
+	}
+	offset, limit, ok := pageFromCtx(c)
+	if !ok {
+		return
+	}
+	snatches, err := a.t.Users.SnatchGetByUser(userID, offset, limit)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, StatusResp{Err: "Failed to fetch snatches"})
+		return
+	}
+	if snatches == nil {
+		snatches = []model.Snatch{}
+	}
+	c.JSON(http.StatusOK, snatches)
+}
+
+func (a *AdminAPI) snatchGetByTorrent(c *gin.Context) {
+	var ih model.InfoHash
+	if !infoHashFromCtx(&ih, c) {
+		return
+	}
+	offset, limit, ok := pageFromCtx(c)
+	if !ok {
+		return
+	}
+	snatches, err := a.t.Users.SnatchGetByTorrent(ih, offset, limit)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, StatusResp{Err: "Failed to fetch snatches"})
+		return
+	}
+	if snatches == nil {
+		snatches = []model.Snatch{}
+	}
+	c.JSON(http.StatusOK, snatches)
+}
+
 func (a *AdminAPI) configUpdate(c *gin.Context) {
 	var configValues map[config.Key]interface{}
 	if err := c.BindJSON(&configValues); err != nil {
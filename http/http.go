@@ -7,7 +7,9 @@ import (
 	"github.com/chihaya/bencode"
 	"github.com/gin-gonic/gin"
 	"github.com/leighmacdonald/mika/config"
+	"github.com/leighmacdonald/mika/consts"
 	"github.com/leighmacdonald/mika/model"
+	"github.com/leighmacdonald/mika/store"
 	"github.com/leighmacdonald/mika/tracker"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -28,6 +30,13 @@ const (
 	msgInvalidInfoHash      trackerErrCode = 150
 	msgInvalidPeerID        trackerErrCode = 151
 	msgInvalidNumWant       trackerErrCode = 152
+	msgInvalidIP            trackerErrCode = 153
+	msgFullScrapeDenied     trackerErrCode = 154
+	msgInvalidPeerKey       trackerErrCode = 155
+	msgClientNotAllowed     trackerErrCode = 156
+	msgDownloadDisabled     trackerErrCode = 157
+	msgSlotLimit            trackerErrCode = 158
+	msgIPBanned             trackerErrCode = 159
 	msgOk                   trackerErrCode = 200
 	msgInfoHashNotFound     trackerErrCode = 480
 	msgInvalidAuth          trackerErrCode = 490
@@ -49,12 +58,25 @@ var (
 		msgInvalidInfoHash:      errors.New("Invalid info hash"),
 		msgInvalidPeerID:        errors.New("Peer ID invalid"),
 		msgInvalidNumWant:       errors.New("num_want invalid"),
+		msgInvalidIP:            errors.New("No usable IP address for the enabled address families"),
+		msgFullScrapeDenied:     errors.New("Full scrapes are not allowed"),
+		msgInvalidPeerKey:       errors.New("Peer key does not match the existing peer"),
+		msgClientNotAllowed:     errors.New("Client is not allowed"),
+		msgDownloadDisabled:     errors.New("Downloading is disabled"),
+		msgSlotLimit:            errors.New("Peer slot limit reached"),
+		msgIPBanned:             errors.New("IP is banned"),
 		msgInfoHashNotFound:     errors.New("Unknown infohash"),
 		msgClientRequestTooFast: errors.New("Slow down there jimmy"),
 		msgMalformedRequest:     errors.New("Malformed request"),
 		msgGenericError:         errors.New("Generic error"),
 		msgQueryParseFail:       errors.New("Could not parse request"),
 	}
+
+	// retryInMap holds the number of minutes a client should wait before retrying a request
+	// for errors which are transient. This is sent as the BEP 31 retry in value.
+	retryInMap = map[trackerErrCode]int{
+		msgClientRequestTooFast: 1,
+	}
 )
 
 // TrackerErr maps a tracker error code to a error
@@ -63,6 +85,31 @@ func TrackerErr(code trackerErrCode) error {
 	return responseStringMap[code]
 }
 
+// trackerError is returned from the transport independent request handlers. It carries the
+// tracker error code for the failure along with an optional message which, when set, is sent
+// to the client instead of the default message for the code.
+type trackerError struct {
+	code    trackerErrCode
+	message string
+}
+
+// Error implements the error interface, returning the message sent to the client
+func (e trackerError) Error() string {
+	if e.message != "" {
+		return e.message
+	}
+	msg, exists := responseStringMap[e.code]
+	if !exists {
+		msg = responseStringMap[msgGenericError]
+	}
+	return msg.Error()
+}
+
+// newTrackerErr returns a trackerError for the code using the default code message
+func newTrackerErr(code trackerErrCode) trackerError {
+	return trackerError{code: code}
+}
+
 // NewClient returns a http.Client with reasonable default configuration values, notably
 // actual timeout values.
 // TODO use context instead for timeouts
@@ -97,42 +144,153 @@ func DoRequest(client *http.Client, method string, path string, data interface{}
 	return client.Do(req)
 }
 
-// getIP Parses and returns a IP from a string
+// getIP returns the IP the client has announced as its own. The ip parameter is used if
+// supplied, otherwise the address the request originated from is used.
 func getIP(q *query, c *gin.Context) (net.IP, error) {
 	ipStr, found := q.Params[paramIP]
 	if found {
 		ip := net.ParseIP(ipStr)
 		if ip != nil {
-			return ip.To4(), nil
+			return normalizeIP(ip), nil
 		}
 	}
+	return getRemoteIP(c)
+}
+
+// getRemoteIP returns the address the request originated from. The X-Forwarded-For header
+// is preferred over the remote address when present.
+func getRemoteIP(c *gin.Context) (net.IP, error) {
 	// Look for forwarded ip in header then default to remote address
 	forwardedIP := c.Request.Header.Get("X-Forwarded-For")
 	if forwardedIP != "" {
-		ip := net.ParseIP(forwardedIP)
+		// The first address is the originating client
+		ip := net.ParseIP(strings.TrimSpace(strings.Split(forwardedIP, ",")[0]))
 		if ip != nil {
-			return ip.To4(), nil
+			return normalizeIP(ip), nil
 		}
-		return ip, nil
 	}
-	s := strings.Split(c.Request.RemoteAddr, ":")
-	ipReq, _ := s[0], s[1]
-	ip := net.ParseIP(ipReq)
-	if ip != nil {
-		return ip.To4(), nil
+	host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		host = c.Request.RemoteAddr
 	}
-	return ip, nil
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, errors.Errorf("Invalid remote address: %s", c.Request.RemoteAddr)
+	}
+	return normalizeIP(ip), nil
+}
+
+// normalizeIP returns the 4 byte form of IPv4 (and IPv4 mapped IPv6) addresses and the 16 byte
+// form of IPv6 addresses
+func normalizeIP(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip.To16()
 }
 
 // oops will output a bencoded error code to the torrent client using
 // a preset message code constant
 func oops(ctx *gin.Context, errCode trackerErrCode) {
-	msg, exists := responseStringMap[errCode]
-	if !exists {
-		msg = responseStringMap[msgGenericError]
+	oopsErr(ctx, newTrackerErr(errCode))
+}
+
+// oopsErr outputs a bencoded error response for the error provided. trackerError values
+// will use their own code and message, any other errors are treated as a generic error.
+//
+// The response is always sent with a 200 status code, many clients will otherwise treat the
+// tracker as being unreachable and never show the failure reason to the user.
+func oopsErr(ctx *gin.Context, err error) {
+	te, ok := err.(trackerError)
+	if !ok {
+		te = newTrackerErr(msgGenericError)
 	}
-	ctx.Data(int(errCode), gin.MIMEPlain, responseError(msg.Error()))
-	log.Errorf("Error in request from: %s (%d)", ctx.Request.RequestURI, errCode)
+	ctx.Data(http.StatusOK, gin.MIMEPlain, responseError(te.Error(), te.code))
+	log.Errorf("Error in request from: %s (%d)", ctx.Request.RequestURI, te.code)
+}
+
+// authenticate fetches the user matching the passkey, ensuring they are allowed to make requests.
+// This is shared between all the tracker transports.
+func authenticate(t *tracker.Tracker, usr *model.User, pk string) error {
+	if len(pk) != 20 {
+		return newTrackerErr(msgInvalidAuth)
+	}
+	if err := t.Users.GetByPasskey(usr, pk); err != nil {
+		return newTrackerErr(msgInvalidAuth)
+	}
+	if !t.ValidUser(*usr) {
+		return newTrackerErr(msgInvalidAuth)
+	}
+	return nil
+}
+
+// checkRateLimit consumes a token from each of the enabled rate limit buckets for the request.
+// The per torrent bucket is only used when a info hash is provided. Errors from the rate limiter
+// itself are logged and the request is allowed.
+func checkRateLimit(t *tracker.Tracker, pk string, ip net.IP, ih model.InfoHash) error {
+	if t.RateLimiter == nil {
+		return nil
+	}
+	buckets := make(map[string]store.Rate)
+	if pk != "" {
+		buckets["pk:"+pk] = t.RateLimitPasskey
+		if !ih.IsZero() {
+			buckets["ih:"+pk+":"+ih.String()] = t.RateLimitTorrent
+		}
+	}
+	if ip != nil {
+		buckets["ip:"+ip.String()] = t.RateLimitIP
+	}
+	for key, rate := range buckets {
+		if !rate.Enabled() {
+			continue
+		}
+		allowed, err := t.RateLimiter.Allow(key, rate)
+		if err != nil {
+			log.Errorf("Failed to check rate limit: %s", err.Error())
+			continue
+		}
+		if !allowed {
+			log.Debugf("Rate limit exceeded: %s", key)
+			return newTrackerErr(msgClientRequestTooFast)
+		}
+	}
+	return nil
+}
+
+// checkBan returns a failure including the ban reason if any of the addresses are banned
+func checkBan(t *tracker.Tracker, ips ...net.IP) error {
+	now := time.Now()
+	for _, ip := range ips {
+		if ip == nil {
+			continue
+		}
+		if ban, found := t.BanCheck(ip, now); found {
+			log.Debugf("Rejected banned IP %s: %s", ip.String(), ban.CIDR)
+			return trackerError{code: msgIPBanned, message: "IP is banned: " + ban.Reason}
+		}
+	}
+	return nil
+}
+
+// checkAnnounceInterval records a announce for the peer, returning a error if a regular announce
+// is made within the minimum announce interval of the peers previous announce. Event announces are
+// always allowed as they are sent in response to state changes in the client. The interval is tracked
+// with the rate limiter as the peers AnnounceLast is only updated once the batch update has synced.
+func checkAnnounceInterval(t *tracker.Tracker, ih model.InfoHash, peerID model.PeerID, event consts.AnnounceType) error {
+	if t.RateLimiter == nil {
+		return nil
+	}
+	key := "ann:" + ih.String() + ":" + peerID.String()
+	allowed, err := t.RateLimiter.Allow(key, store.Rate{Count: 1, Period: t.AnnIntervalMin})
+	if err != nil {
+		log.Errorf("Failed to check announce interval: %s", err.Error())
+		return nil
+	}
+	if !allowed && event == consts.ANNOUNCE {
+		return newTrackerErr(msgClientRequestTooFast)
+	}
+	return nil
 }
 
 // preFlightChecks ensures our user meets the requirements to make an authorized request
@@ -140,15 +298,11 @@ func oops(ctx *gin.Context, errCode trackerErrCode) {
 // slightly higher cost of passing data in through the request context
 func preFlightChecks(usr *model.User, pk string, c *gin.Context, t *tracker.Tracker) bool {
 	// Check that the user is valid before parsing anything
-	if pk == "" {
-		oops(c, msgInvalidAuth)
+	if err := authenticate(t, usr, pk); err != nil {
+		oopsErr(c, err)
 		return false
 	}
-	if err := t.Users.GetByPasskey(usr, pk); err != nil {
-		oops(c, msgInvalidAuth)
-		return false
-	}
-	return usr.Valid()
+	return true
 }
 
 // handleTrackerErrors is used as the default error handler for tracker requests
@@ -172,15 +326,19 @@ func handleTrackerErrors(ctx *gin.Context) {
 }
 
 // responseError generates a bencoded error response for the torrent client to
-// parse and display to the user
+// parse and display to the user. Transient errors will also include the BEP 31
+// retry in value.
 //
-// Note that this function does not generate or support a warning reason, which are rarely if
-// ever used.
-func responseError(message string) []byte {
-	var buf bytes.Buffer
-	if err := bencode.NewEncoder(&buf).Encode(bencode.Dict{
+// http://bittorrent.org/beps/bep_0031.html
+func responseError(message string, code trackerErrCode) []byte {
+	dict := bencode.Dict{
 		"failure reason": message,
-	}); err != nil {
+	}
+	if minutes, found := retryInMap[code]; found {
+		dict["retry in"] = minutes
+	}
+	var buf bytes.Buffer
+	if err := bencode.NewEncoder(&buf).Encode(dict); err != nil {
 		log.Errorf("Failed to encode error response: %s", err)
 	}
 	return buf.Bytes()
@@ -199,10 +357,15 @@ func NewBitTorrentHandler(tkr *tracker.Tracker) *gin.Engine {
 	r := newRouter()
 	r.Use(handleTrackerErrors)
 	h := BitTorrentHandler{
-		tracker: tkr,
+		tracker:     tkr,
+		scrapeCache: newScrapeCache(tkr.ScrapeCacheTTL),
+		wsHub:       newWebSocketHub(),
 	}
 	r.GET("/:passkey/announce", h.announce)
 	r.GET("/:passkey/scrape", h.scrape)
+	if tkr.WebSocket {
+		r.GET("/:passkey/ws", h.webSocket)
+	}
 	return r
 }
 
@@ -222,10 +385,44 @@ func NewAPIHandler(tkr *tracker.Tracker) *gin.Engine {
 
 	r.POST("/user", h.userAdd)
 	r.DELETE("/user/pk/:passkey", h.userDelete)
+	r.GET("/user/:user_id", h.userGet)
+	r.PATCH("/user/:user_id", h.userUpdate)
+	r.POST("/user/:user_id/passkey", h.passkeyRotate)
+	r.GET("/user/:user_id/passkey", h.passkeyGet)
 
 	r.POST("/whitelist", h.whitelistAdd)
 	r.DELETE("/whitelist/:prefix", h.whitelistDelete)
 	r.GET("/whitelist", h.whitelistGet)
+
+	r.POST("/promotion", h.promotionAdd)
+	r.DELETE("/promotion/:name", h.promotionDelete)
+	r.GET("/promotion", h.promotionGet)
+
+	r.POST("/ban", h.banAdd)
+	r.DELETE("/ban/:ip/:bits", h.banDelete)
+	r.GET("/ban", h.banGet)
+
+	r.POST("/passkey", h.passkeyAdd)
+	r.DELETE("/passkey/:user_id/:passkey", h.passkeyRevoke)
+
+	r.GET("/hnr/user/:user_id", h.hnrGet)
+	r.DELETE("/hnr/:user_id/:info_hash", h.hnrDelete)
+
+	r.GET("/snatch/user/:user_id", h.snatchGetByUser)
+	r.GET("/snatch/torrent/:info_hash", h.snatchGetByTorrent)
+
+	r.GET("/freeleech/user/:user_id", h.freeleechGet)
+	r.POST("/freeleech/:user_id/:info_hash", h.freeleechGrant)
+	r.DELETE("/freeleech/:user_id/:info_hash", h.freeleechConsume)
+
+	r.GET("/bonus/:user_id", h.bonusGet)
+	r.POST("/bonus/:user_id", h.bonusAdjust)
+	r.GET("/ledger/:user_id", h.ledgerGetByUser)
+	r.POST("/ledger/:user_id", h.ledgerAdjust)
+
+	r.GET("/ratio_watch", h.ratioWatchGetAll)
+	r.GET("/ratio_watch/:user_id", h.ratioWatchGet)
+	r.DELETE("/ratio_watch/:user_id", h.ratioWatchClear)
 	return r
 }
 
@@ -45,13 +45,19 @@ const (
 	paramInfoHash   announceParam = "info_hash"
 	paramPeerID     announceParam = "peer_id"
 	paramIP         announceParam = "ip"
+	paramIPv4       announceParam = "ipv4"
+	paramIPv6       announceParam = "ipv6"
 	paramPort       announceParam = "port"
 	paramLeft       announceParam = "left"
 	paramDownloaded announceParam = "downloaded"
 	paramUploaded   announceParam = "uploaded"
 	paramCorrupt    announceParam = "corrupt"
 	paramNumWant    announceParam = "numwant"
-	//paramCompact    announceParam = "compact"
+	paramCompact    announceParam = "compact"
+	paramNoPeerID   announceParam = "no_peer_id"
+	paramTrackerID  announceParam = "trackerid"
+	paramKey        announceParam = "key"
+	paramEvent      announceParam = "event"
 )
 
 type query struct {
@@ -5,62 +5,240 @@ import (
 	"github.com/chihaya/bencode"
 	"github.com/gin-gonic/gin"
 	"github.com/leighmacdonald/mika/model"
+	"github.com/leighmacdonald/mika/tracker"
 	log "github.com/sirupsen/logrus"
 	"net/http"
+	"sync"
+	"time"
 )
 
-// scrape handles the bittorrent scrape protocol for
-func (h *BitTorrentHandler) scrape(c *gin.Context) {
-	var user model.User
-	if !preFlightChecks(&user, c.Param("passkey"), c, h.tracker) {
+// scrapeStats holds the swarm statistics for a single torrent returned in scrape responses
+type scrapeStats struct {
+	seeders    uint
+	leechers   uint
+	downloaded uint16
+}
+
+type scrapeCacheItem struct {
+	stats   scrapeStats
+	expires time.Time
+}
+
+// scrapeCache is a short lived cache of scrape results for each torrent. This is used to
+// stop frequent scrapes from hitting the PeerStore each time.
+type scrapeCache struct {
+	*sync.RWMutex
+	ttl       time.Duration
+	items     map[model.InfoHash]scrapeCacheItem
+	lastPurge time.Time
+	// full is the list of info hashes included in full scrapes
+	full        []model.InfoHash
+	fullExpires time.Time
+}
+
+// newScrapeCache returns a new scrapeCache. A ttl of 0 disables caching.
+func newScrapeCache(ttl time.Duration) *scrapeCache {
+	return &scrapeCache{
+		RWMutex:   &sync.RWMutex{},
+		ttl:       ttl,
+		items:     make(map[model.InfoHash]scrapeCacheItem),
+		lastPurge: time.Now(),
+	}
+}
+
+// get returns the cached stats for the info hash if they exist and have not expired
+func (c *scrapeCache) get(ih model.InfoHash) (scrapeStats, bool) {
+	if c.ttl <= 0 {
+		return scrapeStats{}, false
+	}
+	c.RLock()
+	item, found := c.items[ih]
+	c.RUnlock()
+	if !found || time.Now().After(item.expires) {
+		return scrapeStats{}, false
+	}
+	return item.stats, true
+}
+
+// set caches the stats for the info hash. Expired items are purged at most once per ttl period.
+func (c *scrapeCache) set(ih model.InfoHash, stats scrapeStats) {
+	if c.ttl <= 0 {
 		return
 	}
-	q, err := queryStringParser(c.Request.RequestURI)
-	if err != nil {
-		log.Errorf("Failed to parse request string")
-		oops(c, msgMalformedRequest)
+	now := time.Now()
+	c.Lock()
+	c.items[ih] = scrapeCacheItem{stats: stats, expires: now.Add(c.ttl)}
+	if now.Sub(c.lastPurge) > c.ttl {
+		for k, v := range c.items {
+			if now.After(v.expires) {
+				delete(c.items, k)
+			}
+		}
+		c.lastPurge = now
+	}
+	c.Unlock()
+}
+
+// getFull returns the cached info hashes used for full scrapes if they have not expired
+func (c *scrapeCache) getFull() ([]model.InfoHash, bool) {
+	if c.ttl <= 0 {
+		return nil, false
+	}
+	c.RLock()
+	defer c.RUnlock()
+	if c.full == nil || time.Now().After(c.fullExpires) {
+		return nil, false
+	}
+	return c.full, true
+}
+
+// setFull caches the info hashes used for full scrapes
+func (c *scrapeCache) setFull(hashes []model.InfoHash) {
+	if c.ttl <= 0 {
 		return
 	}
-	// Technically no info hashes means we are supposed to send data for all known torrents.
-	// This is something we do NOT want to do in a private tracker scenario (or really public for that matter)
-	// TODO Add a config toggle for this?
-	// TODO Its not technically malformed, should we return a empty file set instead?
+	c.Lock()
+	c.full = hashes
+	c.fullExpires = time.Now().Add(c.ttl)
+	c.Unlock()
+}
+
+// getScrapeStats fetches the current swarm statistics for a torrent, using the cached
+// value when available. This is shared between the HTTP and UDP transports.
+func getScrapeStats(t *tracker.Tracker, cache *scrapeCache, ih model.InfoHash) (scrapeStats, error) {
+	if stats, found := cache.get(ih); found {
+		return stats, nil
+	}
+	var torrent model.Torrent
+	if err := t.Torrents.Get(&torrent, ih); err != nil {
+		log.Debugf("Scrape request for invalid torrent: %s", ih)
+		return scrapeStats{}, err
+	}
+	// Swarms are always keyed by the v1 info hash for hybrid torrents
+	seeders, leechers, err := t.Peers.Counts(torrent.InfoHash)
+	if err != nil {
+		log.Debugf("Failed to get peer counts for scrape: %s", ih)
+		return scrapeStats{}, err
+	}
+	stats := scrapeStats{
+		seeders:    seeders,
+		leechers:   leechers,
+		downloaded: torrent.TotalCompleted,
+	}
+	cache.set(ih, stats)
+	return stats, nil
+}
+
+// scrapeInfoHashes returns the info hashes which should be included in the scrape response.
+// When no hashes are requested this is a full scrape which is handled according to the
+// configured ScrapeFullPolicy.
+func (h *BitTorrentHandler) scrapeInfoHashes(q *query, user model.User) ([]model.InfoHash, trackerErrCode) {
+	var hashes []model.InfoHash
 	if len(q.InfoHashes) == 0 {
-		log.Errorf("No infohash supplied")
-		oops(c, msgMalformedRequest)
-		return
+		// The first info_hash is only stored in the params until a second one is found
+		if ihStr, found := q.Params[paramInfoHash]; found {
+			q.InfoHashes = []string{ihStr}
+		}
+	}
+	if len(q.InfoHashes) == 0 {
+		switch h.tracker.ScrapeFull {
+		case tracker.ScrapeFullAllow:
+		case tracker.ScrapeFullAdmin:
+			if !user.IsAdmin {
+				return nil, msgFullScrapeDenied
+			}
+		default:
+			return nil, msgFullScrapeDenied
+		}
+		if cached, found := h.scrapeCache.getFull(); found {
+			return cached, msgOk
+		}
+		torrents, err := h.tracker.Torrents.GetAll()
+		if err != nil {
+			log.Errorf("Failed to fetch torrents for full scrape: %s", err.Error())
+			return nil, msgGenericError
+		}
+		// Full scrapes are subject to the same limit as regular scrapes
+		for _, t := range torrents {
+			if h.tracker.ScrapeMaxHashes > 0 && len(hashes) >= h.tracker.ScrapeMaxHashes {
+				break
+			}
+			hashes = append(hashes, t.InfoHash)
+		}
+		h.scrapeCache.setFull(hashes)
+		return hashes, msgOk
 	}
-	// Todo limit scrape to N torrents
-	resp := make(bencode.Dict, len(q.InfoHashes))
-	var ih model.InfoHash
 	for _, ihStr := range q.InfoHashes {
+		if h.tracker.ScrapeMaxHashes > 0 && len(hashes) >= h.tracker.ScrapeMaxHashes {
+			log.Debugf("Scrape info hash limit reached, ignoring remaining hashes")
+			break
+		}
+		var ih model.InfoHash
 		if err := model.InfoHashFromString(&ih, ihStr); err != nil {
 			log.Errorf("Failed to decode info hash in scrape: %s", ihStr)
 			continue
 		}
-		var torrent model.Torrent
-		if err := h.tracker.Torrents.Get(&torrent, ih); err != nil {
-			log.Debugf("Scrape request for invalid torrent: %s", ih)
-			continue
-		}
-		peers, err := h.tracker.Peers.GetN(ih, 100)
+		hashes = append(hashes, ih)
+	}
+	return hashes, msgOk
+}
+
+// scrape handles the bittorrent scrape protocol as defined in BEP 48
+// http://bittorrent.org/beps/bep_0048.html
+func (h *BitTorrentHandler) scrape(c *gin.Context) {
+	var user model.User
+	pk := c.Param("passkey")
+	if !preFlightChecks(&user, pk, c, h.tracker) {
+		return
+	}
+	remoteIP, err := getRemoteIP(c)
+	if err != nil {
+		oops(c, msgMalformedRequest)
+		return
+	}
+	if err := checkBan(h.tracker, remoteIP); err != nil {
+		oopsErr(c, err)
+		return
+	}
+	if err := checkRateLimit(h.tracker, pk, remoteIP, model.InfoHash{}); err != nil {
+		oopsErr(c, err)
+		return
+	}
+	q, err := queryStringParser(c.Request.URL.RawQuery)
+	if err != nil {
+		log.Errorf("Failed to parse request string")
+		oops(c, msgMalformedRequest)
+		return
+	}
+	hashes, code := h.scrapeInfoHashes(q, user)
+	if code != msgOk {
+		oops(c, code)
+		return
+	}
+	files := make(bencode.Dict, len(hashes))
+	for _, ih := range hashes {
+		stats, err := getScrapeStats(h.tracker, h.scrapeCache, ih)
 		if err != nil {
-			log.Debugf("Failed to get peers for scrape: %s", ih)
 			continue
 		}
-		seeders, leechers := peers.Counts()
-		resp[ih.String()] = bencode.Dict{
-			"complete":   seeders,
-			"downloaded": torrent.TotalCompleted,
-			"incomplete": leechers,
+		// Keys are the raw 20 byte info hash, not the hex encoded form
+		files[string(ih.Bytes())] = bencode.Dict{
+			"complete":   stats.seeders,
+			"downloaded": stats.downloaded,
+			"incomplete": stats.leechers,
 		}
 	}
+	resp := bencode.Dict{
+		"files": files,
+		"flags": bencode.Dict{
+			"min_request_interval": int(h.tracker.ScrapeIntervalMin.Seconds()),
+		},
+	}
 	var buf bytes.Buffer
 	if err := bencode.NewEncoder(&buf).Encode(resp); err != nil {
 		log.Errorf("Failed to encode scrape response")
+		oops(c, msgGenericError)
 		return
 	}
-	encoded := buf.String()
-	log.Debug(encoded)
-	c.String(http.StatusOK, encoded)
+	c.Data(http.StatusOK, gin.MIMEPlain, buf.Bytes())
 }
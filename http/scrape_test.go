@@ -0,0 +1,84 @@
+package http
+
+import (
+	"fmt"
+	"github.com/chihaya/bencode"
+	"github.com/leighmacdonald/mika/model"
+	"github.com/leighmacdonald/mika/tracker"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestBitTorrentHandler_Scrape(t *testing.T) {
+	tkr, torrents, users, _ := tracker.NewTestTracker()
+	rh := NewBitTorrentHandler(tkr)
+	v := url.Values{"info_hash": {
+		torrents[0].InfoHash.RawString(),
+		torrents[1].InfoHash.RawString(),
+	}}
+	w := performRequest(rh, "GET", fmt.Sprintf("/%s/scrape?%s", users[0].Passkey, v.Encode()))
+	require.EqualValues(t, msgOk, w.Code)
+	resp, err := bencode.Unmarshal(w.Body.Bytes())
+	require.NoError(t, err)
+	files := resp.(bencode.Dict)["files"].(bencode.Dict)
+	require.Equal(t, 2, len(files))
+	for _, tor := range torrents[0:2] {
+		stats, found := files[tor.InfoHash.RawString()]
+		require.True(t, found)
+		_, found = stats.(bencode.Dict)["complete"]
+		require.True(t, found)
+	}
+	flags := resp.(bencode.Dict)["flags"].(bencode.Dict)
+	require.EqualValues(t, int(tkr.ScrapeIntervalMin.Seconds()), flags["min_request_interval"])
+
+	// Full scrapes are denied by default
+	w = performRequest(rh, "GET", fmt.Sprintf("/%s/scrape", users[0].Passkey))
+	require.EqualValues(t, responseError(TrackerErr(msgFullScrapeDenied).Error(), msgFullScrapeDenied), w.Body.Bytes())
+
+	tkr.ScrapeFull = tracker.ScrapeFullAdmin
+	w = performRequest(rh, "GET", fmt.Sprintf("/%s/scrape", users[0].Passkey))
+	require.EqualValues(t, responseError(TrackerErr(msgFullScrapeDenied).Error(), msgFullScrapeDenied), w.Body.Bytes())
+
+	// Full scrapes are limited to the max hashes and cached
+	tkr.ScrapeFull = tracker.ScrapeFullAllow
+	tkr.ScrapeMaxHashes = 10
+	w = performRequest(rh, "GET", fmt.Sprintf("/%s/scrape", users[0].Passkey))
+	require.EqualValues(t, msgOk, w.Code)
+	resp, err = bencode.Unmarshal(w.Body.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, tkr.ScrapeMaxHashes, len(resp.(bencode.Dict)["files"].(bencode.Dict)))
+	tkr.ScrapeMaxHashes = len(torrents)
+	w = performRequest(rh, "GET", fmt.Sprintf("/%s/scrape", users[0].Passkey))
+	resp, err = bencode.Unmarshal(w.Body.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, 10, len(resp.(bencode.Dict)["files"].(bencode.Dict)))
+
+	// Banned addresses cannot scrape
+	ban, err := model.NewBan("1.2.3.4", "Banned", time.Now(), time.Time{})
+	require.NoError(t, err)
+	require.NoError(t, tkr.BanAdd([]model.Ban{ban}))
+	w = performRequest(rh, "GET", fmt.Sprintf("/%s/scrape?%s", users[0].Passkey, v.Encode()))
+	require.EqualValues(t, responseError("IP is banned: Banned", msgIPBanned), w.Body.Bytes())
+}
+
+func TestScrapeCache(t *testing.T) {
+	var ih model.InfoHash
+	copy(ih[:], "AAAAAAAAAAAAAAAAAAAA")
+	stats := scrapeStats{seeders: 10, leechers: 5, downloaded: 20}
+
+	disabled := newScrapeCache(0)
+	disabled.set(ih, stats)
+	_, found := disabled.get(ih)
+	require.False(t, found)
+
+	cache := newScrapeCache(time.Millisecond * 50)
+	cache.set(ih, stats)
+	cached, found := cache.get(ih)
+	require.True(t, found)
+	require.Equal(t, stats, cached)
+	time.Sleep(time.Millisecond * 60)
+	_, found = cache.get(ih)
+	require.False(t, found)
+}
@@ -0,0 +1,386 @@
+package http
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"github.com/leighmacdonald/mika/consts"
+	"github.com/leighmacdonald/mika/model"
+	"github.com/leighmacdonald/mika/tracker"
+	"github.com/leighmacdonald/mika/util"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// udpAction is the action field used in the UDP tracker protocol
+// http://bittorrent.org/beps/bep_0015.html
+type udpAction uint32
+
+const (
+	udpActionConnect udpAction = iota
+	udpActionAnnounce
+	udpActionScrape
+	udpActionError
+)
+
+// udpOption is a BEP 41 announce extension option type
+// http://bittorrent.org/beps/bep_0041.html
+type udpOption byte
+
+const (
+	udpOptionEndOfOptions udpOption = 0x0
+	udpOptionNOP          udpOption = 0x1
+	udpOptionURLData      udpOption = 0x2
+)
+
+const (
+	// udpProtocolID is the magic constant sent as the connection id of connect requests
+	udpProtocolID uint64 = 0x41727101980
+	// udpConnIDTTL is how long a issued connection id remains valid. BEP 15 specifies clients
+	// may use a connection id for 1 minute, servers should accept it for 2.
+	udpConnIDTTL = 2 * time.Minute
+	// udpMaxPacketSize is the largest request we will read, anything larger is truncated
+	udpMaxPacketSize = 2048
+	// udpAnnounceSize is the minimum size of a announce request, not including BEP 41 options
+	udpAnnounceSize = 98
+	// udpMaxScrapeHashes is the most info hashes that can fit in a single scrape request
+	udpMaxScrapeHashes = 74
+	// udpMaxWorkers is the most packets handled concurrently. Once reached we stop reading from
+	// the socket until a worker is free, leaving the kernel to drop any excess packets.
+	udpMaxWorkers = 128
+)
+
+// UDPHandler implements the BEP 15 UDP tracker protocol. Connection IDs are signed using a HMAC
+// of the clients address and issue time so that we do not need to keep any connection state.
+//
+// Passkeys are read from the BEP 41 URL data option which is expected to be in the same format as
+// the path used for HTTP announces, eg: /12345678901234567890/announce
+type UDPHandler struct {
+	tracker     *tracker.Tracker
+	scrapeCache *scrapeCache
+	secret      []byte
+	conn        net.PacketConn
+	closed      chan struct{}
+	closeMu     *sync.Mutex
+	// workers is a semaphore limiting the number of packets handled concurrently
+	workers chan struct{}
+}
+
+// NewUDPHandler configures a new UDP tracker handler using a random HMAC secret
+func NewUDPHandler(tkr *tracker.Tracker) (*UDPHandler, error) {
+	secret, err := util.GenRandomBytes(32)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to generate udp connection id secret")
+	}
+	return &UDPHandler{
+		tracker:     tkr,
+		scrapeCache: newScrapeCache(tkr.ScrapeCacheTTL),
+		secret:      secret,
+		closed:      make(chan struct{}),
+		closeMu:     &sync.Mutex{},
+		workers:     make(chan struct{}, udpMaxWorkers),
+	}, nil
+}
+
+// ListenAndServe opens a UDP socket on the address provided and serves tracker requests until
+// Close is called.
+func (h *UDPHandler) ListenAndServe(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to listen on udp address: %s", addr)
+	}
+	return h.Serve(conn)
+}
+
+// Serve reads and responds to tracker requests on the connection provided until Close is called.
+func (h *UDPHandler) Serve(conn net.PacketConn) error {
+	h.closeMu.Lock()
+	h.conn = conn
+	h.closeMu.Unlock()
+	buf := make([]byte, udpMaxPacketSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-h.closed:
+				return nil
+			default:
+			}
+			log.Errorf("Failed to read udp packet: %s", err.Error())
+			continue
+		}
+		packet := make([]byte, n)
+		copy(packet, buf[:n])
+		h.workers <- struct{}{}
+		go func() {
+			defer func() { <-h.workers }()
+			h.handlePacket(conn, addr, packet)
+		}()
+	}
+}
+
+// Close stops the listener and closes the underlying socket
+func (h *UDPHandler) Close() error {
+	h.closeMu.Lock()
+	defer h.closeMu.Unlock()
+	select {
+	case <-h.closed:
+		return nil
+	default:
+		close(h.closed)
+	}
+	if h.conn == nil {
+		return nil
+	}
+	return h.conn.Close()
+}
+
+// connectionID generates a signed connection id for the address. The first 4 bytes are
+// the unix timestamp when it was issued, the last 4 bytes are the truncated HMAC of the
+// timestamp and the clients IP.
+func (h *UDPHandler) connectionID(ip net.IP, issued time.Time) uint64 {
+	var ts [4]byte
+	binary.BigEndian.PutUint32(ts[:], uint32(issued.Unix()))
+	mac := hmac.New(sha256.New, h.secret)
+	_, _ = mac.Write(ts[:])
+	_, _ = mac.Write(ip.To16())
+	sum := mac.Sum(nil)
+	var id [8]byte
+	copy(id[0:4], ts[:])
+	copy(id[4:8], sum[0:4])
+	return binary.BigEndian.Uint64(id[:])
+}
+
+// validConnectionID checks that the connection id was issued by us to the address and has not expired
+func (h *UDPHandler) validConnectionID(connID uint64, ip net.IP) bool {
+	issued := time.Unix(int64(connID>>32), 0)
+	age := time.Since(issued)
+	if age < 0 || age > udpConnIDTTL {
+		return false
+	}
+	expected := h.connectionID(ip, issued)
+	var a, b [8]byte
+	binary.BigEndian.PutUint64(a[:], connID)
+	binary.BigEndian.PutUint64(b[:], expected)
+	return hmac.Equal(a[:], b[:])
+}
+
+func (h *UDPHandler) handlePacket(conn net.PacketConn, addr net.Addr, packet []byte) {
+	// All requests share the same 16 byte header
+	if len(packet) < 16 {
+		return
+	}
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return
+	}
+	connID := binary.BigEndian.Uint64(packet[0:8])
+	action := udpAction(binary.BigEndian.Uint32(packet[8:12]))
+	txID := packet[12:16]
+	var resp []byte
+	switch action {
+	case udpActionConnect:
+		if connID != udpProtocolID {
+			return
+		}
+		resp = h.connect(udpAddr.IP, txID)
+	case udpActionAnnounce, udpActionScrape:
+		if !h.validConnectionID(connID, udpAddr.IP) {
+			resp = udpError(txID, errors.New("Invalid connection id"))
+			break
+		}
+		if action == udpActionAnnounce {
+			resp = h.announce(udpAddr, txID, packet)
+		} else {
+			resp = h.scrape(udpAddr.IP, txID, packet)
+		}
+	default:
+		resp = udpError(txID, newTrackerErr(msgInvalidReqType))
+	}
+	if _, err := conn.WriteTo(resp, addr); err != nil {
+		log.Errorf("Failed to write udp response: %s", err.Error())
+	}
+}
+
+func (h *UDPHandler) connect(ip net.IP, txID []byte) []byte {
+	var buf bytes.Buffer
+	writeUDPHeader(&buf, udpActionConnect, txID)
+	_ = binary.Write(&buf, binary.BigEndian, h.connectionID(ip, time.Now()))
+	return buf.Bytes()
+}
+
+func (h *UDPHandler) announce(addr *net.UDPAddr, txID []byte, packet []byte) []byte {
+	req, code := newUDPAnnounce(addr, packet)
+	if code != msgOk {
+		return udpError(txID, newTrackerErr(code))
+	}
+	var usr model.User
+	if err := authenticate(h.tracker, &usr, req.Passkey); err != nil {
+		return udpError(txID, err)
+	}
+	res, err := handleAnnounce(h.tracker, usr, req)
+	if err != nil {
+		return udpError(txID, err)
+	}
+	var buf bytes.Buffer
+	writeUDPHeader(&buf, udpActionAnnounce, txID)
+	_ = binary.Write(&buf, binary.BigEndian, uint32(h.tracker.AnnInterval.Seconds()))
+	_ = binary.Write(&buf, binary.BigEndian, uint32(res.leechers))
+	_ = binary.Write(&buf, binary.BigEndian, uint32(res.seeders))
+	// BEP 15 responses use the address family of the request for the peer list
+	if addr.IP.To4() != nil {
+		buf.Write(makeCompactPeers(res.peers, res.peer.PeerID))
+	} else {
+		buf.Write(makeCompactPeers6(res.peers, res.peer.PeerID))
+	}
+	return buf.Bytes()
+}
+
+// scrape responds with the swarm stats for each info hash requested. Unknown torrents are
+// returned with zero values to maintain the ordering of the response.
+//
+// NOTE BEP 41 options are not available for scrape requests so there is no passkey to authenticate
+// with. Only a valid connection id is required.
+func (h *UDPHandler) scrape(ip net.IP, txID []byte, packet []byte) []byte {
+	if err := checkBan(h.tracker, normalizeIP(ip)); err != nil {
+		return udpError(txID, err)
+	}
+	if err := checkRateLimit(h.tracker, "", normalizeIP(ip), model.InfoHash{}); err != nil {
+		return udpError(txID, err)
+	}
+	hashData := packet[16:]
+	if len(hashData) == 0 || len(hashData)%20 != 0 {
+		return udpError(txID, newTrackerErr(msgMalformedRequest))
+	}
+	count := util.MinInt(len(hashData)/20, udpMaxScrapeHashes)
+	if h.tracker.ScrapeMaxHashes > 0 {
+		count = util.MinInt(count, h.tracker.ScrapeMaxHashes)
+	}
+	var buf bytes.Buffer
+	writeUDPHeader(&buf, udpActionScrape, txID)
+	for i := 0; i < count; i++ {
+		var ih model.InfoHash
+		copy(ih[:], hashData[i*20:(i+1)*20])
+		stats, _ := getScrapeStats(h.tracker, h.scrapeCache, ih)
+		_ = binary.Write(&buf, binary.BigEndian, uint32(stats.seeders))
+		_ = binary.Write(&buf, binary.BigEndian, uint32(stats.downloaded))
+		_ = binary.Write(&buf, binary.BigEndian, uint32(stats.leechers))
+	}
+	return buf.Bytes()
+}
+
+// newUDPAnnounce parses a UDP announce packet into a announceRequest. The passkey is parsed
+// from the BEP 41 URL data option.
+func newUDPAnnounce(addr *net.UDPAddr, packet []byte) (*announceRequest, trackerErrCode) {
+	if len(packet) < udpAnnounceSize {
+		return nil, msgMalformedRequest
+	}
+	var req announceRequest
+	copy(req.InfoHash[:], packet[16:36])
+	copy(req.PeerID[:], packet[36:56])
+	req.Downloaded = binary.BigEndian.Uint64(packet[56:64])
+	req.Left = uint32(math.MaxUint32)
+	if left := binary.BigEndian.Uint64(packet[64:72]); left < math.MaxUint32 {
+		req.Left = uint32(left)
+	}
+	req.Uploaded = binary.BigEndian.Uint64(packet[72:80])
+	switch binary.BigEndian.Uint32(packet[80:84]) {
+	case 1:
+		req.Event = consts.COMPLETED
+	case 2:
+		req.Event = consts.STARTED
+	case 3:
+		req.Event = consts.STOPPED
+	default:
+		req.Event = consts.ANNOUNCE
+	}
+	// The IP field (84:88) is ignored, we always use the source address of the packet
+	req.RemoteIP = normalizeIP(addr.IP)
+	if req.RemoteIP.To4() != nil {
+		req.IP = req.RemoteIP
+	} else {
+		req.IPv6 = req.RemoteIP
+	}
+	// The key is formatted as 8 hex chars to match the value sent by clients over HTTP. A zero
+	// key is treated as the client not sending one.
+	if key := binary.BigEndian.Uint32(packet[88:92]); key != 0 {
+		req.Key = fmt.Sprintf("%08X", key)
+	}
+	numWant := int32(binary.BigEndian.Uint32(packet[92:96]))
+	if numWant < 0 {
+		req.NumWant = 30
+	} else {
+		req.NumWant = uint(numWant)
+	}
+	req.Port = binary.BigEndian.Uint16(packet[96:98])
+	if req.Port < 1024 {
+		return nil, msgInvalidPort
+	}
+	req.Compact = true
+	req.Passkey = passkeyFromURLData(parseURLData(packet[udpAnnounceSize:]))
+	return &req, msgOk
+}
+
+// parseURLData concatenates all the BEP 41 URLData options found in the options
+// section of a announce request
+func parseURLData(opts []byte) string {
+	var urlData []byte
+	for i := 0; i < len(opts); {
+		switch udpOption(opts[i]) {
+		case udpOptionEndOfOptions:
+			return string(urlData)
+		case udpOptionNOP:
+			i++
+		case udpOptionURLData:
+			if i+1 >= len(opts) {
+				return string(urlData)
+			}
+			size := int(opts[i+1])
+			start := i + 2
+			end := util.MinInt(start+size, len(opts))
+			urlData = append(urlData, opts[start:end]...)
+			i = end
+		default:
+			// Unknown options are length prefixed like URLData, skip over them
+			if i+1 >= len(opts) {
+				return string(urlData)
+			}
+			i += 2 + int(opts[i+1])
+		}
+	}
+	return string(urlData)
+}
+
+// passkeyFromURLData extracts the passkey from the first path segment of the URL data
+// eg: /12345678901234567890/announce?foo=bar
+func passkeyFromURLData(urlData string) string {
+	if idx := strings.IndexByte(urlData, '?'); idx >= 0 {
+		urlData = urlData[:idx]
+	}
+	for _, segment := range strings.Split(urlData, "/") {
+		if segment != "" {
+			return segment
+		}
+	}
+	return ""
+}
+
+func writeUDPHeader(buf *bytes.Buffer, action udpAction, txID []byte) {
+	_ = binary.Write(buf, binary.BigEndian, uint32(action))
+	buf.Write(txID)
+}
+
+// udpError generates a error response using the error message as the reason
+func udpError(txID []byte, err error) []byte {
+	var buf bytes.Buffer
+	writeUDPHeader(&buf, udpActionError, txID)
+	buf.WriteString(err.Error())
+	return buf.Bytes()
+}
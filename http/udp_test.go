@@ -0,0 +1,164 @@
+package http
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/leighmacdonald/mika/model"
+	"github.com/leighmacdonald/mika/tracker"
+	"github.com/stretchr/testify/require"
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestUDPServer(t *testing.T) (*tracker.Tracker, model.Torrents, model.Users, model.Swarm, net.Conn) {
+	tkr, torrents, users, peers := tracker.NewTestTracker()
+	h, err := NewUDPHandler(tkr)
+	require.NoError(t, err)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = h.Serve(pc) }()
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+		_ = h.Close()
+	})
+	return tkr, torrents, users, peers, conn
+}
+
+func udpExchange(t *testing.T, conn net.Conn, req []byte) []byte {
+	require.NoError(t, conn.SetDeadline(time.Now().Add(2*time.Second)))
+	_, err := conn.Write(req)
+	require.NoError(t, err)
+	buf := make([]byte, udpMaxPacketSize)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	return buf[:n]
+}
+
+func udpConnect(t *testing.T, conn net.Conn) uint64 {
+	var req bytes.Buffer
+	_ = binary.Write(&req, binary.BigEndian, udpProtocolID)
+	_ = binary.Write(&req, binary.BigEndian, uint32(udpActionConnect))
+	req.Write([]byte{1, 2, 3, 4})
+	resp := udpExchange(t, conn, req.Bytes())
+	require.Equal(t, 16, len(resp))
+	require.Equal(t, udpActionConnect, udpAction(binary.BigEndian.Uint32(resp[0:4])))
+	require.Equal(t, []byte{1, 2, 3, 4}, resp[4:8])
+	return binary.BigEndian.Uint64(resp[8:16])
+}
+
+func udpAnnounceReq(connID uint64, ih model.InfoHash, pid model.PeerID, urlData string) []byte {
+	var req bytes.Buffer
+	_ = binary.Write(&req, binary.BigEndian, connID)
+	_ = binary.Write(&req, binary.BigEndian, uint32(udpActionAnnounce))
+	req.Write([]byte{5, 6, 7, 8})
+	req.Write(ih.Bytes())
+	req.Write(pid.Bytes())
+	_ = binary.Write(&req, binary.BigEndian, uint64(1000)) // downloaded
+	_ = binary.Write(&req, binary.BigEndian, uint64(5000)) // left
+	_ = binary.Write(&req, binary.BigEndian, uint64(2000)) // uploaded
+	_ = binary.Write(&req, binary.BigEndian, uint32(2))    // started
+	_ = binary.Write(&req, binary.BigEndian, uint32(0))    // ip
+	_ = binary.Write(&req, binary.BigEndian, uint32(1234)) // key
+	_ = binary.Write(&req, binary.BigEndian, int32(-1))    // num_want
+	_ = binary.Write(&req, binary.BigEndian, uint16(6881))
+	// Split the url data across multiple options as allowed by BEP 41
+	for len(urlData) > 0 {
+		size := 10
+		if len(urlData) < size {
+			size = len(urlData)
+		}
+		req.Write([]byte{byte(udpOptionURLData), byte(size)})
+		req.WriteString(urlData[:size])
+		urlData = urlData[size:]
+		req.WriteByte(byte(udpOptionNOP))
+	}
+	req.WriteByte(byte(udpOptionEndOfOptions))
+	return req.Bytes()
+}
+
+func TestUDPHandler_Connect(t *testing.T) {
+	_, _, _, _, conn := newTestUDPServer(t)
+	require.NotZero(t, udpConnect(t, conn))
+}
+
+func TestUDPHandler_InvalidConnectionID(t *testing.T) {
+	_, torrents, users, peers, conn := newTestUDPServer(t)
+	req := udpAnnounceReq(12345, torrents[0].InfoHash, peers[0].PeerID, "/"+users[0].Passkey+"/announce")
+	resp := udpExchange(t, conn, req)
+	require.Equal(t, udpActionError, udpAction(binary.BigEndian.Uint32(resp[0:4])))
+	require.Equal(t, []byte{5, 6, 7, 8}, resp[4:8])
+}
+
+func TestUDPHandler_Announce(t *testing.T) {
+	tkr, torrents, users, peers, conn := newTestUDPServer(t)
+	connID := udpConnect(t, conn)
+	req := udpAnnounceReq(connID, torrents[0].InfoHash, peers[0].PeerID, "/"+users[0].Passkey+"/announce")
+	resp := udpExchange(t, conn, req)
+	require.Equal(t, udpActionAnnounce, udpAction(binary.BigEndian.Uint32(resp[0:4])), string(resp[8:]))
+	require.Equal(t, []byte{5, 6, 7, 8}, resp[4:8])
+	require.Equal(t, uint32(tkr.AnnInterval.Seconds()), binary.BigEndian.Uint32(resp[8:12]))
+	leechers := binary.BigEndian.Uint32(resp[12:16])
+	seeders := binary.BigEndian.Uint32(resp[16:20])
+	require.True(t, leechers+seeders > 0)
+	require.Equal(t, 0, len(resp[20:])%6)
+	select {
+	case u := <-tkr.StateUpdateChan:
+		require.Equal(t, users[0].Passkey, u.Passkey)
+		require.Equal(t, uint64(2000), u.Uploaded)
+		require.Equal(t, uint64(1000), u.Downloaded)
+	case <-time.After(time.Second):
+		t.Fatalf("No state update received")
+	}
+}
+
+func TestNewUDPAnnounce_Left(t *testing.T) {
+	_, torrents, users, peers := tracker.NewTestTracker()
+	packet := udpAnnounceReq(12345, torrents[0].InfoHash, peers[0].PeerID, "/"+users[0].Passkey+"/announce")
+	// Values which do not fit into 32 bits are clamped rather than truncated
+	binary.BigEndian.PutUint64(packet[64:72], math.MaxUint32+1)
+	req, code := newUDPAnnounce(&net.UDPAddr{IP: net.ParseIP("12.34.56.78"), Port: 6881}, packet)
+	require.Equal(t, msgOk, code)
+	require.Equal(t, uint32(math.MaxUint32), req.Left)
+}
+
+func TestUDPHandler_AnnounceInvalidPasskey(t *testing.T) {
+	_, torrents, _, peers, conn := newTestUDPServer(t)
+	connID := udpConnect(t, conn)
+	for _, urlData := range []string{"", "/xxxxxxxxxxxxxxxxxxxx/announce"} {
+		req := udpAnnounceReq(connID, torrents[0].InfoHash, peers[0].PeerID, urlData)
+		resp := udpExchange(t, conn, req)
+		require.Equal(t, udpActionError, udpAction(binary.BigEndian.Uint32(resp[0:4])))
+		require.Equal(t, responseStringMap[msgInvalidAuth].Error(), string(resp[8:]))
+	}
+}
+
+func TestUDPHandler_Scrape(t *testing.T) {
+	_, torrents, _, _, conn := newTestUDPServer(t)
+	connID := udpConnect(t, conn)
+	var req bytes.Buffer
+	_ = binary.Write(&req, binary.BigEndian, connID)
+	_ = binary.Write(&req, binary.BigEndian, uint32(udpActionScrape))
+	req.Write([]byte{9, 9, 9, 9})
+	req.Write(torrents[0].InfoHash.Bytes())
+	req.Write(torrents[1].InfoHash.Bytes())
+	resp := udpExchange(t, conn, req.Bytes())
+	require.Equal(t, udpActionScrape, udpAction(binary.BigEndian.Uint32(resp[0:4])))
+	require.Equal(t, 8+(2*12), len(resp))
+	for i := 0; i < 2; i++ {
+		offset := 8 + (i * 12)
+		seeders := binary.BigEndian.Uint32(resp[offset : offset+4])
+		leechers := binary.BigEndian.Uint32(resp[offset+8 : offset+12])
+		require.True(t, seeders+leechers > 0)
+	}
+}
+
+func TestPasskeyFromURLData(t *testing.T) {
+	require.Equal(t, "12345678901234567890", passkeyFromURLData("/12345678901234567890/announce"))
+	require.Equal(t, "12345678901234567890", passkeyFromURLData("/12345678901234567890/announce?a=b"))
+	require.Equal(t, "", passkeyFromURLData("/?a=b"))
+	require.Equal(t, "", passkeyFromURLData(""))
+}
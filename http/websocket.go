@@ -0,0 +1,436 @@
+package http
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/leighmacdonald/mika/consts"
+	"github.com/leighmacdonald/mika/model"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// wsMaxMessageSize is the largest message we will accept from a client. Announces can
+	// contain multiple SDP offers so this is much larger than a normal announce.
+	wsMaxMessageSize = 1 << 16
+	// wsWriteTimeout is how long we wait for a write to a client to complete
+	wsWriteTimeout = time.Second * 10
+	// wsMaxOffers is the most offers we will relay from a single announce
+	wsMaxOffers = 10
+
+	wsActionAnnounce = "announce"
+	wsActionScrape   = "scrape"
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	// Browser peers will be connecting from any number of origins
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// wsOffer is a WebRTC offer sent by a browser peer to be relayed to other members of the swarm
+type wsOffer struct {
+	Offer   json.RawMessage `json:"offer"`
+	OfferID string          `json:"offer_id"`
+}
+
+// wsRequest represents a message received from a WebTorrent client. Binary values such as the
+// info_hash and peer_id are sent as strings where each character represents a single byte.
+//
+// https://github.com/webtorrent/bittorrent-tracker
+type wsRequest struct {
+	Action string `json:"action"`
+	// InfoHash is a string for announces, scrapes may also send a list of info hashes
+	InfoHash   json.RawMessage `json:"info_hash"`
+	PeerID     string          `json:"peer_id"`
+	Event      string          `json:"event"`
+	Uploaded   uint64          `json:"uploaded"`
+	Downloaded uint64          `json:"downloaded"`
+	// Left is sent as null when the client does not yet have the torrents metadata
+	Left    *uint64         `json:"left"`
+	NumWant int             `json:"numwant"`
+	Offers  []wsOffer       `json:"offers"`
+	Answer  json.RawMessage `json:"answer"`
+	OfferID string          `json:"offer_id"`
+	// ToPeerID is the peer the answer should be relayed to
+	ToPeerID string `json:"to_peer_id"`
+}
+
+// wsPeer is a connected browser peer. A single connection is shared between all the
+// torrents the client is participating in.
+type wsPeer struct {
+	conn    *websocket.Conn
+	writeMu *sync.Mutex
+	// states holds the last announced state of the peer in each swarm. This is the set of peer ids
+	// the connection is allowed to send answers from and is used to stop the peer when the connection
+	// closes. It is only accessed by the connections read loop.
+	states map[model.InfoHash]model.UpdateState
+}
+
+// send writes the message to the peer as JSON. It is safe to call from multiple goroutines.
+func (p *wsPeer) send(msg gin.H) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	if err := p.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+		return err
+	}
+	return p.conn.WriteJSON(msg)
+}
+
+// webSocketHub tracks the connections of browser peers so that WebRTC offers and answers
+// can be relayed between members of the same swarm. Swarms are keyed by the v1 info hash.
+type webSocketHub struct {
+	*sync.RWMutex
+	swarms map[model.InfoHash]map[model.PeerID]*wsPeer
+}
+
+func newWebSocketHub() *webSocketHub {
+	return &webSocketHub{
+		RWMutex: &sync.RWMutex{},
+		swarms:  make(map[model.InfoHash]map[model.PeerID]*wsPeer),
+	}
+}
+
+// join registers the peer as a member of the swarm
+func (hub *webSocketHub) join(ih model.InfoHash, pid model.PeerID, p *wsPeer) {
+	hub.Lock()
+	defer hub.Unlock()
+	swarm, found := hub.swarms[ih]
+	if !found {
+		swarm = make(map[model.PeerID]*wsPeer)
+		hub.swarms[ih] = swarm
+	}
+	swarm[pid] = p
+}
+
+// leave removes the peer from the swarm. Nothing is removed if another connection has since
+// announced using the same peer id.
+func (hub *webSocketHub) leave(ih model.InfoHash, pid model.PeerID, p *wsPeer) {
+	hub.Lock()
+	defer hub.Unlock()
+	if swarm, found := hub.swarms[ih]; found && swarm[pid] == p {
+		delete(swarm, pid)
+		if len(swarm) == 0 {
+			delete(hub.swarms, ih)
+		}
+	}
+}
+
+// get returns the connected peer in the swarm
+func (hub *webSocketHub) get(ih model.InfoHash, pid model.PeerID) (*wsPeer, bool) {
+	hub.RLock()
+	defer hub.RUnlock()
+	p, found := hub.swarms[ih][pid]
+	return p, found
+}
+
+// getN returns up to limit connected peers in the swarm, excluding the peer id provided
+func (hub *webSocketHub) getN(ih model.InfoHash, skipID model.PeerID, limit int) []*wsPeer {
+	hub.RLock()
+	defer hub.RUnlock()
+	var peers []*wsPeer
+	for pid, p := range hub.swarms[ih] {
+		if len(peers) >= limit {
+			break
+		}
+		if pid == skipID {
+			continue
+		}
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+// fromBinaryString converts the strings used by WebTorrent for binary values, where each
+// character represents a single byte, into their raw form.
+func fromBinaryString(s string) (string, bool) {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			return "", false
+		}
+		b = append(b, byte(r))
+	}
+	return string(b), true
+}
+
+// wsFailure generates a failure response for the request
+func wsFailure(action string, err error) gin.H {
+	te, ok := err.(trackerError)
+	if !ok {
+		te = newTrackerErr(msgGenericError)
+	}
+	return gin.H{
+		"action":         action,
+		"failure reason": te.Error(),
+	}
+}
+
+// webSocket handles the WebTorrent websocket tracker protocol used by browser peers. Peers are
+// authorized using the passkey in the path before the connection is upgraded.
+//
+// Announces are processed using the same pipeline as the HTTP and UDP transports so that browser
+// peers are included in the normal swarm counts and stats accounting. As browser peers can only
+// connect to each other using WebRTC, the tracker relays the offers and answers between them.
+func (h *BitTorrentHandler) webSocket(c *gin.Context) {
+	pk := c.Param("passkey")
+	var usr model.User
+	if !preFlightChecks(&usr, pk, c, h.tracker) {
+		return
+	}
+	remoteIP, err := getRemoteIP(c)
+	if err != nil {
+		oops(c, msgMalformedRequest)
+		return
+	}
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Debugf("Failed to upgrade websocket connection: %s", err.Error())
+		return
+	}
+	conn.SetReadLimit(wsMaxMessageSize)
+	peer := &wsPeer{
+		conn:    conn,
+		writeMu: &sync.Mutex{},
+		states:  make(map[model.InfoHash]model.UpdateState),
+	}
+	defer h.wsClose(peer)
+	for {
+		if h.tracker.AnnInterval > 0 {
+			// Clients re-announce every interval, anything idle for longer has gone away
+			_ = conn.SetReadDeadline(time.Now().Add(h.tracker.AnnInterval * 2))
+		}
+		var req wsRequest
+		if err := conn.ReadJSON(&req); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Debugf("Closing websocket connection: %s", err.Error())
+			}
+			return
+		}
+		var resp gin.H
+		switch req.Action {
+		case wsActionAnnounce:
+			resp, err = h.wsAnnounce(usr, pk, remoteIP, peer, &req)
+		case wsActionScrape:
+			resp, err = h.wsScrape(pk, remoteIP, &req)
+		default:
+			err = newTrackerErr(msgInvalidReqType)
+		}
+		if err != nil {
+			resp = wsFailure(req.Action, err)
+		}
+		if resp == nil {
+			continue
+		}
+		if err := peer.send(resp); err != nil {
+			log.Debugf("Failed to write websocket response: %s", err.Error())
+			return
+		}
+	}
+}
+
+// wsClose removes the peer from all the swarms it has joined. The peer is stopped using the
+// last state it announced so that the swarm counts are updated by the stat worker.
+func (h *BitTorrentHandler) wsClose(p *wsPeer) {
+	for ih, state := range p.states {
+		h.wsHub.leave(ih, state.PeerID, p)
+		state.Event = consts.STOPPED
+		state.Timestamp = time.Now()
+		h.tracker.StateUpdateChan <- state
+	}
+	_ = p.conn.Close()
+}
+
+// wsAnnounce processes a announce from a browser peer. Any offers included are relayed to other
+// browser peers in the swarm and answers are relayed back to the peer that made the offer.
+func (h *BitTorrentHandler) wsAnnounce(usr model.User, pk string, remoteIP net.IP, p *wsPeer, req *wsRequest) (gin.H, error) {
+	var ihStr string
+	if err := json.Unmarshal(req.InfoHash, &ihStr); err != nil {
+		return nil, newTrackerErr(msgInvalidInfoHash)
+	}
+	rawIH, ok := fromBinaryString(ihStr)
+	if !ok {
+		return nil, newTrackerErr(msgInvalidInfoHash)
+	}
+	var ih model.InfoHash
+	if err := model.InfoHashFromString(&ih, rawIH); err != nil {
+		return nil, newTrackerErr(msgInvalidInfoHash)
+	}
+	rawPID, ok := fromBinaryString(req.PeerID)
+	if !ok || len(rawPID) != 20 {
+		return nil, newTrackerErr(msgInvalidPeerID)
+	}
+	peerID := model.PeerIDFromString(rawPID)
+	if req.Answer != nil {
+		// Answers are only relayed, they are not a announce themselves
+		return nil, h.wsRelayAnswer(p, ih, peerID, ihStr, req)
+	}
+	left := uint32(math.MaxUint32)
+	if req.Left != nil && *req.Left < math.MaxUint32 {
+		left = uint32(*req.Left)
+	}
+	ann := &announceRequest{
+		Compact:    true,
+		Downloaded: req.Downloaded,
+		Uploaded:   req.Uploaded,
+		Left:       left,
+		Event:      consts.ParseAnnounceType(req.Event),
+		InfoHash:   ih,
+		PeerID:     peerID,
+		Passkey:    pk,
+		RemoteIP:   remoteIP,
+		NumWant:    uint(req.NumWant),
+		// WebRTC peers have no listen port
+		Port: 0,
+	}
+	if ip4 := remoteIP.To4(); ip4 != nil {
+		ann.IP = ip4
+	} else {
+		ann.IPv6 = remoteIP
+	}
+	res, err := handleAnnounce(h.tracker, usr, ann)
+	if err != nil {
+		return nil, err
+	}
+	if ann.Event == consts.STOPPED {
+		// The stat worker removes the peer from the swarm
+		h.wsHub.leave(res.infoHash, peerID, p)
+		delete(p.states, res.infoHash)
+	} else {
+		h.wsHub.join(res.infoHash, peerID, p)
+		p.states[res.infoHash] = model.UpdateState{
+			Passkey:        pk,
+			UserID:         usr.UserID,
+			IP:             remoteIP,
+			InfoHash:       res.infoHash,
+			PeerID:         peerID,
+			Uploaded:       ann.Uploaded,
+			Downloaded:     ann.Downloaded,
+			PrevUploaded:   ann.Uploaded,
+			PrevDownloaded: ann.Downloaded,
+			Size:           res.size,
+			Seeders:        res.seeders,
+			Left:           ann.Left,
+		}
+		h.wsRelayOffers(res.infoHash, peerID, ihStr, req)
+	}
+	resp := gin.H{
+		"action":       wsActionAnnounce,
+		"info_hash":    ihStr,
+		"complete":     res.seeders,
+		"incomplete":   res.leechers,
+		"interval":     int(h.tracker.AnnInterval.Seconds()),
+		"min interval": int(h.tracker.AnnIntervalMin.Seconds()),
+	}
+	if res.warning != "" {
+		resp["warning message"] = res.warning
+	}
+	return resp, nil
+}
+
+// wsRelayOffers sends each offer to a different browser peer in the swarm
+func (h *BitTorrentHandler) wsRelayOffers(ih model.InfoHash, from model.PeerID, ihStr string, req *wsRequest) {
+	offers := req.Offers
+	if len(offers) > wsMaxOffers {
+		offers = offers[:wsMaxOffers]
+	}
+	if len(offers) == 0 {
+		return
+	}
+	for i, target := range h.wsHub.getN(ih, from, len(offers)) {
+		if err := target.send(gin.H{
+			"action":    wsActionAnnounce,
+			"info_hash": ihStr,
+			"peer_id":   req.PeerID,
+			"offer":     offers[i].Offer,
+			"offer_id":  offers[i].OfferID,
+		}); err != nil {
+			log.Debugf("Failed to relay websocket offer: %s", err.Error())
+		}
+	}
+}
+
+// wsRelayAnswer sends the answer back to the peer that made the offer. Answers are only accepted
+// from peer ids which the connection has announced to the swarm with.
+func (h *BitTorrentHandler) wsRelayAnswer(p *wsPeer, ih model.InfoHash, from model.PeerID, ihStr string, req *wsRequest) error {
+	var tor model.Torrent
+	if err := h.tracker.Torrents.Get(&tor, ih); err != nil {
+		return newTrackerErr(msgInvalidInfoHash)
+	}
+	if state, found := p.states[tor.InfoHash]; !found || state.PeerID != from {
+		return newTrackerErr(msgInvalidPeerID)
+	}
+	rawTo, ok := fromBinaryString(req.ToPeerID)
+	if !ok || len(rawTo) != 20 {
+		return newTrackerErr(msgInvalidPeerID)
+	}
+	target, found := h.wsHub.get(tor.InfoHash, model.PeerIDFromString(rawTo))
+	if !found {
+		// The peer has gone away since making the offer
+		return nil
+	}
+	if err := target.send(gin.H{
+		"action":    wsActionAnnounce,
+		"info_hash": ihStr,
+		"peer_id":   req.PeerID,
+		"answer":    req.Answer,
+		"offer_id":  req.OfferID,
+	}); err != nil {
+		return errors.Wrap(err, "Failed to relay websocket answer")
+	}
+	return nil
+}
+
+// wsScrape responds with the swarm stats for each info hash requested
+func (h *BitTorrentHandler) wsScrape(pk string, remoteIP net.IP, req *wsRequest) (gin.H, error) {
+	if err := checkBan(h.tracker, remoteIP); err != nil {
+		return nil, err
+	}
+	if err := checkRateLimit(h.tracker, pk, remoteIP, model.InfoHash{}); err != nil {
+		return nil, err
+	}
+	var hashes []string
+	if err := json.Unmarshal(req.InfoHash, &hashes); err != nil {
+		var ihStr string
+		if err := json.Unmarshal(req.InfoHash, &ihStr); err != nil {
+			return nil, newTrackerErr(msgInvalidInfoHash)
+		}
+		hashes = []string{ihStr}
+	}
+	if h.tracker.ScrapeMaxHashes > 0 && len(hashes) > h.tracker.ScrapeMaxHashes {
+		hashes = hashes[:h.tracker.ScrapeMaxHashes]
+	}
+	files := gin.H{}
+	for _, ihStr := range hashes {
+		rawIH, ok := fromBinaryString(ihStr)
+		if !ok {
+			continue
+		}
+		var ih model.InfoHash
+		if err := model.InfoHashFromString(&ih, rawIH); err != nil {
+			continue
+		}
+		stats, err := getScrapeStats(h.tracker, h.scrapeCache, ih)
+		if err != nil {
+			continue
+		}
+		files[ihStr] = gin.H{
+			"complete":   stats.seeders,
+			"incomplete": stats.leechers,
+			"downloaded": stats.downloaded,
+		}
+	}
+	return gin.H{
+		"action": wsActionScrape,
+		"files":  files,
+	}, nil
+}
@@ -0,0 +1,144 @@
+package http
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/leighmacdonald/mika/consts"
+	"github.com/leighmacdonald/mika/model"
+	"github.com/leighmacdonald/mika/tracker"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// toBinaryString converts raw bytes into the string form used by WebTorrent for binary values
+func toBinaryString(b []byte) string {
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+func TestBinaryString(t *testing.T) {
+	raw := string([]byte{0x00, 0x7f, 0x80, 0xff})
+	s, ok := fromBinaryString(toBinaryString([]byte(raw)))
+	require.True(t, ok)
+	require.Equal(t, raw, s)
+	_, ok = fromBinaryString("Ā")
+	require.False(t, ok)
+}
+
+func TestBitTorrentHandler_WebSocket(t *testing.T) {
+	tkr, torrents, users, _ := tracker.NewTestTracker()
+	tkr.WebSocket = true
+	srv := httptest.NewServer(NewBitTorrentHandler(tkr))
+	defer srv.Close()
+	u := fmt.Sprintf("ws%s/%s/ws", strings.TrimPrefix(srv.URL, "http"), users[0].Passkey)
+	ih := toBinaryString(torrents[0].InfoHash.Bytes())
+	peerA := "-WW0100-aaaaaaaaaaaa"
+	peerB := "-WW0100-bbbbbbbbbbbb"
+
+	connA, _, err := websocket.DefaultDialer.Dial(u, nil)
+	require.NoError(t, err)
+	defer func() { _ = connA.Close() }()
+	connB, _, err := websocket.DefaultDialer.Dial(u, nil)
+	require.NoError(t, err)
+	defer func() { _ = connB.Close() }()
+
+	var resp gin.H
+	require.NoError(t, connB.WriteJSON(gin.H{
+		"action": "announce", "info_hash": ih, "peer_id": peerB, "event": "started", "left": 0,
+	}))
+	require.NoError(t, connB.ReadJSON(&resp))
+	require.Equal(t, "announce", resp["action"])
+	_, failed := resp["failure reason"]
+	require.False(t, failed)
+
+	// Offers from A are relayed to B
+	offer := gin.H{"type": "offer", "sdp": "fake-sdp"}
+	require.NoError(t, connA.WriteJSON(gin.H{
+		"action": "announce", "info_hash": ih, "peer_id": peerA, "event": "started", "left": 100,
+		"numwant": 1, "offers": []gin.H{{"offer": offer, "offer_id": "offer-1"}},
+	}))
+	require.NoError(t, connA.ReadJSON(&resp))
+	// The test swarm peers are all seeders, A is the only leecher
+	require.EqualValues(t, 1, resp["incomplete"])
+	resp = gin.H{}
+	require.NoError(t, connB.ReadJSON(&resp))
+	require.Equal(t, peerA, resp["peer_id"])
+	require.Equal(t, "offer-1", resp["offer_id"])
+	require.Equal(t, "fake-sdp", resp["offer"].(map[string]interface{})["sdp"])
+
+	// Answers from B are relayed back to A
+	require.NoError(t, connB.WriteJSON(gin.H{
+		"action": "announce", "info_hash": ih, "peer_id": peerB, "to_peer_id": peerA,
+		"offer_id": "offer-1", "answer": gin.H{"type": "answer", "sdp": "fake-answer"},
+	}))
+	resp = gin.H{}
+	require.NoError(t, connA.ReadJSON(&resp))
+	require.Equal(t, peerB, resp["peer_id"])
+	require.Equal(t, "fake-answer", resp["answer"].(map[string]interface{})["sdp"])
+
+	// Answers can only be sent from a peer id the connection has announced with
+	require.NoError(t, connB.WriteJSON(gin.H{
+		"action": "announce", "info_hash": ih, "peer_id": "-WW0100-cccccccccccc", "to_peer_id": peerA,
+		"offer_id": "offer-1", "answer": gin.H{"type": "answer", "sdp": "fake-answer"},
+	}))
+	resp = gin.H{}
+	require.NoError(t, connB.ReadJSON(&resp))
+	require.Equal(t, TrackerErr(msgInvalidPeerID).Error(), resp["failure reason"])
+
+	// Browser peers are counted in the normal swarm but never sent to regular clients
+	seeders, leechers, err := tkr.Peers.Counts(torrents[0].InfoHash)
+	require.NoError(t, err)
+	require.True(t, seeders >= 1 && leechers >= 1)
+
+	// Closing the connection stops the peer
+	require.NoError(t, connA.Close())
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case u := <-tkr.StateUpdateChan:
+			if u.Event == consts.STOPPED {
+				require.Equal(t, peerA, u.PeerID.RawString())
+				require.EqualValues(t, 100, u.Left)
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for stopped state")
+		}
+	}
+}
+
+func TestBitTorrentHandler_WebSocketScrape(t *testing.T) {
+	tkr, torrents, users, _ := tracker.NewTestTracker()
+	tkr.WebSocket = true
+	srv := httptest.NewServer(NewBitTorrentHandler(tkr))
+	defer srv.Close()
+	u := fmt.Sprintf("ws%s/%s/ws", strings.TrimPrefix(srv.URL, "http"), users[0].Passkey)
+	ih := toBinaryString(torrents[0].InfoHash.Bytes())
+	conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	var resp gin.H
+	require.NoError(t, conn.WriteJSON(gin.H{"action": "scrape", "info_hash": []string{ih}}))
+	require.NoError(t, conn.ReadJSON(&resp))
+	require.Equal(t, "scrape", resp["action"])
+	require.Contains(t, resp["files"], ih)
+
+	// Banned addresses cannot scrape
+	ban, err := model.NewBan("127.0.0.1", "Banned", time.Now(), time.Time{})
+	require.NoError(t, err)
+	require.NoError(t, tkr.BanAdd([]model.Ban{ban}))
+	resp = gin.H{}
+	require.NoError(t, conn.WriteJSON(gin.H{"action": "scrape", "info_hash": []string{ih}}))
+	require.NoError(t, conn.ReadJSON(&resp))
+	require.Equal(t, "IP is banned: Banned", resp["failure reason"])
+	_, found := resp["files"]
+	require.False(t, found)
+}
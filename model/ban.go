@@ -0,0 +1,173 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Ban blocks a single address or a CIDR range of IPv4 or IPv6 addresses from announcing or scraping
+type Ban struct {
+	// CIDR is the banned range in its normalized form. Single addresses are stored as /32 or /128 ranges.
+	CIDR        string    `db:"cidr" json:"cidr"`
+	Reason      string    `db:"reason" json:"reason"`
+	TimeCreated time.Time `db:"time_created" json:"time_created"`
+	// TimeExpire is when the ban is lifted, bans with a zero value never expire
+	TimeExpire time.Time `db:"time_expire" json:"time_expire"`
+}
+
+// ParseBanNetwork parses a single address or CIDR range. Single addresses are returned as /32
+// or /128 networks and IPv4 mapped IPv6 addresses are treated as IPv4.
+func ParseBanNetwork(s string) (*net.IPNet, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid ip address: %s", s)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cidr: %s", s)
+	}
+	return n, nil
+}
+
+// NewBan returns a ban for the single address or CIDR range provided. A zero expire time creates
+// a permanent ban.
+func NewBan(addr string, reason string, now time.Time, expire time.Time) (Ban, error) {
+	n, err := ParseBanNetwork(addr)
+	if err != nil {
+		return Ban{}, err
+	}
+	b := Ban{
+		CIDR:        n.String(),
+		Reason:      reason,
+		TimeCreated: now,
+		TimeExpire:  expire,
+	}
+	return b, b.Validate()
+}
+
+// Validate ensures the ban has a normalized range, a reason and expires after it was created
+func (b Ban) Validate() error {
+	n, err := ParseBanNetwork(b.CIDR)
+	if err != nil {
+		return err
+	}
+	if n.String() != b.CIDR {
+		return fmt.Errorf("cidr is not normalized, expected: %s", n.String())
+	}
+	if b.Reason == "" {
+		return fmt.Errorf("ban reason cannot be empty")
+	}
+	if !b.TimeExpire.IsZero() && !b.TimeExpire.After(b.TimeCreated) {
+		return fmt.Errorf("ban must expire after it was created")
+	}
+	return nil
+}
+
+// Permanent returns true if the ban never expires
+func (b Ban) Permanent() bool {
+	return b.TimeExpire.IsZero()
+}
+
+// Expired returns true if the ban has been lifted by the time provided
+func (b Ban) Expired(now time.Time) bool {
+	return !b.Permanent() && !now.Before(b.TimeExpire)
+}
+
+// banRange is a ban with its first and last address in their 16 byte form
+type banRange struct {
+	start net.IP
+	end   net.IP
+	// maxEnd is the highest end address of this and all the preceding ranges
+	maxEnd net.IP
+	ban    Ban
+}
+
+// BanList is a read only index used to find the ban containing an address. The ranges are sorted
+// so lookups remain fast with the hundreds of thousands of ranges found in P2P blocklists.
+type BanList struct {
+	ranges []banRange
+}
+
+// NewBanList builds the index from the bans provided. Bans with an invalid CIDR are ignored.
+func NewBanList(bans []Ban) BanList {
+	ranges := make([]banRange, 0, len(bans))
+	for _, b := range bans {
+		n, err := ParseBanNetwork(b.CIDR)
+		if err != nil {
+			continue
+		}
+		start, end := networkRange(n)
+		ranges = append(ranges, banRange{start: start, end: end, ban: b})
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return bytes.Compare(ranges[i].start, ranges[j].start) < 0
+	})
+	var maxEnd net.IP
+	for i := range ranges {
+		if maxEnd == nil || bytes.Compare(ranges[i].end, maxEnd) > 0 {
+			maxEnd = ranges[i].end
+		}
+		ranges[i].maxEnd = maxEnd
+	}
+	return BanList{ranges: ranges}
+}
+
+// Len returns the number of bans in the index
+func (l BanList) Len() int {
+	return len(l.ranges)
+}
+
+// Bans returns the bans in the index ordered by their first address
+func (l BanList) Bans() []Ban {
+	bans := make([]Ban, len(l.ranges))
+	for i, r := range l.ranges {
+		bans[i] = r.ban
+	}
+	return bans
+}
+
+// Find returns the ban containing the address which has not expired by the time provided
+func (l BanList) Find(ip net.IP, now time.Time) (Ban, bool) {
+	key := ip.To16()
+	if key == nil {
+		return Ban{}, false
+	}
+	// Walk back from the last range starting at or before the address until no preceding
+	// range can reach it
+	i := sort.Search(len(l.ranges), func(i int) bool {
+		return bytes.Compare(l.ranges[i].start, key) > 0
+	})
+	for i--; i >= 0 && bytes.Compare(l.ranges[i].maxEnd, key) >= 0; i-- {
+		r := l.ranges[i]
+		if bytes.Compare(r.end, key) >= 0 && !r.ban.Expired(now) {
+			return r.ban, true
+		}
+	}
+	return Ban{}, false
+}
+
+// networkRange returns the first and last address of the network in their 16 byte form
+func networkRange(n *net.IPNet) (net.IP, net.IP) {
+	ip := n.IP
+	if ip4 := ip.To4(); ip4 != nil && len(n.Mask) == net.IPv4len {
+		ip = ip4
+	}
+	start := make(net.IP, len(ip))
+	end := make(net.IP, len(ip))
+	for i := range ip {
+		start[i] = ip[i] & n.Mask[i]
+		end[i] = ip[i] | ^n.Mask[i]
+	}
+	return start.To16(), end.To16()
+}
@@ -0,0 +1,125 @@
+package model
+
+import (
+	"github.com/stretchr/testify/require"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewBan(t *testing.T) {
+	now := time.Now()
+	for addr, expected := range map[string]string{
+		"10.0.0.1":         "10.0.0.1/32",
+		"::ffff:10.0.0.1":  "10.0.0.1/32",
+		"10.0.0.1/24":      "10.0.0.0/24",
+		"2001:db8::1":      "2001:db8::1/128",
+		"2001:db8::1/32":   "2001:db8::/32",
+		" 192.168.1.0/16 ": "192.168.0.0/16",
+	} {
+		b, err := NewBan(addr, "test", now, time.Time{})
+		require.NoError(t, err, addr)
+		require.Equal(t, expected, b.CIDR)
+		require.True(t, b.Permanent())
+	}
+	for _, addr := range []string{"", "10.0.0", "10.0.0.1/33", "example.com"} {
+		_, err := NewBan(addr, "test", now, time.Time{})
+		require.Error(t, err, addr)
+	}
+	_, err := NewBan("10.0.0.1", "", now, time.Time{})
+	require.Error(t, err)
+	_, err = NewBan("10.0.0.1", "test", now, now.Add(-time.Hour))
+	require.Error(t, err)
+	require.Error(t, Ban{CIDR: "10.0.0.1/24", Reason: "test"}.Validate())
+	b, err := NewBan("10.0.0.1", "test", now, now.Add(time.Hour))
+	require.NoError(t, err)
+	require.False(t, b.Expired(now))
+	require.True(t, b.Expired(now.Add(time.Hour)))
+}
+
+func TestBanList(t *testing.T) {
+	now := time.Now()
+	var bans []Ban
+	for _, addr := range []string{"10.0.0.0/8", "10.1.2.3", "192.168.1.0/24", "2001:db8::/32", "172.16.0.0/12"} {
+		b, err := NewBan(addr, addr, now, time.Time{})
+		require.NoError(t, err)
+		bans = append(bans, b)
+	}
+	expiring, err := NewBan("8.8.8.8", "expiring", now, now.Add(time.Hour))
+	require.NoError(t, err)
+	bans = append(bans, expiring)
+	l := NewBanList(bans)
+	require.Equal(t, len(bans), l.Len())
+	for ip, expected := range map[string]string{
+		"10.200.0.1":        "10.0.0.0/8",
+		"10.1.2.3":          "10.1.2.3",
+		"10.1.2.4":          "10.0.0.0/8",
+		"::ffff:10.1.1.1":   "10.0.0.0/8",
+		"192.168.1.255":     "192.168.1.0/24",
+		"172.31.255.255":    "172.16.0.0/12",
+		"2001:db8:ffff::1":  "2001:db8::/32",
+		"8.8.8.8":           "expiring",
+		"192.168.2.1":       "",
+		"11.0.0.0":          "",
+		"2001:db9::1":       "",
+		"::1":               "",
+		"172.32.0.0":        "",
+		"9.255.255.255":     "",
+		"255.255.255.255":   "",
+		"0.0.0.0":           "",
+		"ffff:ffff:ffff::1": "",
+	} {
+		b, found := l.Find(net.ParseIP(ip), now)
+		require.Equal(t, expected != "", found, ip)
+		require.Equal(t, expected, b.Reason, ip)
+	}
+	_, found := l.Find(net.ParseIP("8.8.8.8"), now.Add(time.Hour))
+	require.False(t, found)
+	_, found = NewBanList(nil).Find(net.ParseIP("8.8.8.8"), now)
+	require.False(t, found)
+}
+
+func TestParseBlocklist(t *testing.T) {
+	const list = `# PeerGuardian
+Some Network:1.2.3.0-1.2.3.255
+Odd: Range, Inc:10.0.0.1-10.0.0.6
+
+// eMule
+001.002.004.000 - 001.002.004.255 , 000 , Another Network
+005.000.000.000 - 005.000.000.255 , 200 , Allowed Network
+006.000.000.000 - 006.000.000.000 , 100 ,
+`
+	now := time.Now()
+	bans, err := ParseBlocklist(strings.NewReader(list), now, time.Time{})
+	require.NoError(t, err)
+	var cidrs []string
+	for _, b := range bans {
+		require.NoError(t, b.Validate())
+		cidrs = append(cidrs, b.CIDR)
+	}
+	require.Equal(t, []string{"1.2.3.0/24", "10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/31",
+		"10.0.0.6/32", "1.2.4.0/24", "6.0.0.0/32"}, cidrs)
+	require.Equal(t, "Some Network", bans[0].Reason)
+	require.Equal(t, "Odd: Range, Inc", bans[1].Reason)
+	require.Equal(t, "Another Network", bans[5].Reason)
+	require.Equal(t, blocklistReason, bans[6].Reason)
+
+	for _, line := range []string{"garbage", "name:1.2.3.4", "name:1.2.3.4-1.2.3.0", "name:1.2.3.4-::1",
+		"1.2.3.0 - 1.2.3.255 , abc , name"} {
+		_, err := ParseBlocklist(strings.NewReader(line), now, time.Time{})
+		require.Error(t, err, line)
+	}
+}
+
+func TestRangeToNetworks(t *testing.T) {
+	networks, err := rangeToNetworks(net.ParseIP("0.0.0.0"), net.ParseIP("255.255.255.255"))
+	require.NoError(t, err)
+	require.Len(t, networks, 1)
+	require.Equal(t, "0.0.0.0/0", networks[0].String())
+	networks, err = rangeToNetworks(net.ParseIP("2001:db8::"), net.ParseIP("2001:db8::2"))
+	require.NoError(t, err)
+	require.Len(t, networks, 2)
+	require.Equal(t, "2001:db8::/127", networks[0].String())
+	require.Equal(t, "2001:db8::2/128", networks[1].String())
+}
@@ -0,0 +1,174 @@
+package model
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// blocklistReason is used for blocklist ranges without a description
+	blocklistReason = "Blocklist"
+	// datBlockLevel is the eMule access level below which ranges are blocked
+	datBlockLevel = 127
+)
+
+// ParseBlocklist reads a PeerGuardian .p2p or eMule .dat blocklist, returning the bans for each
+// blocked range using its description as the reason. Ranges which do not align to a single CIDR
+// are split into multiple bans. Blank lines and comments starting with # or // are ignored.
+//
+// The .p2p format uses lines of:
+//
+//	description:1.2.3.0-1.2.3.255
+//
+// while the .dat format uses lines of:
+//
+//	001.002.003.000 - 001.002.003.255 , 000 , description
+func ParseBlocklist(r io.Reader, now time.Time, expire time.Time) ([]Ban, error) {
+	var bans []Ban
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		start, end, reason, blocked, err := parseBlocklistLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blocklist entry on line %d: %s", lineNum, err.Error())
+		}
+		if !blocked {
+			continue
+		}
+		if reason == "" {
+			reason = blocklistReason
+		}
+		networks, err := rangeToNetworks(start, end)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blocklist entry on line %d: %s", lineNum, err.Error())
+		}
+		for _, n := range networks {
+			bans = append(bans, Ban{
+				CIDR:        n.String(),
+				Reason:      reason,
+				TimeCreated: now,
+				TimeExpire:  expire,
+			})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return bans, nil
+}
+
+// parseBlocklistLine parses a single .dat or .p2p entry. Entries from .dat files with an access
+// level of datBlockLevel or higher are allowed ranges and are not blocked.
+func parseBlocklistLine(line string) (net.IP, net.IP, string, bool, error) {
+	if fields := strings.SplitN(line, ",", 3); len(fields) == 3 {
+		if start, end, err := parseBlocklistRange(fields[0]); err == nil {
+			level, err := strconv.Atoi(strings.TrimSpace(fields[1]))
+			if err != nil {
+				return nil, nil, "", false, fmt.Errorf("invalid access level: %s", fields[1])
+			}
+			return start, end, strings.TrimSpace(fields[2]), level < datBlockLevel, nil
+		}
+	}
+	idx := strings.LastIndex(line, ":")
+	if idx < 0 {
+		return nil, nil, "", false, fmt.Errorf("unknown format")
+	}
+	start, end, err := parseBlocklistRange(line[idx+1:])
+	if err != nil {
+		return nil, nil, "", false, err
+	}
+	return start, end, strings.TrimSpace(line[:idx]), true, nil
+}
+
+// parseBlocklistRange parses a range of start-end addresses
+func parseBlocklistRange(s string) (net.IP, net.IP, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return nil, nil, fmt.Errorf("invalid range: %s", strings.TrimSpace(s))
+	}
+	start := parseBlocklistIP(parts[0])
+	end := parseBlocklistIP(parts[1])
+	if start == nil || end == nil {
+		return nil, nil, fmt.Errorf("invalid range: %s", strings.TrimSpace(s))
+	}
+	return start, end, nil
+}
+
+// parseBlocklistIP parses an address, allowing the zero padded IPv4 octets used by .dat files
+func parseBlocklistIP(s string) net.IP {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, ":") {
+		return net.ParseIP(s)
+	}
+	octets := strings.Split(s, ".")
+	if len(octets) != net.IPv4len {
+		return nil
+	}
+	ip := make(net.IP, net.IPv4len)
+	for i, o := range octets {
+		v, err := strconv.ParseUint(o, 10, 8)
+		if err != nil {
+			return nil
+		}
+		ip[i] = byte(v)
+	}
+	return ip
+}
+
+// rangeToNetworks returns the smallest set of networks covering the addresses from start to end
+func rangeToNetworks(start net.IP, end net.IP) ([]*net.IPNet, error) {
+	size := net.IPv6len
+	if start.To4() != nil && end.To4() != nil {
+		size = net.IPv4len
+		start, end = start.To4(), end.To4()
+	} else if start.To4() != nil || end.To4() != nil {
+		return nil, fmt.Errorf("range cannot mix ipv4 and ipv6 addresses")
+	}
+	bits := uint(size * 8)
+	first := new(big.Int).SetBytes(start)
+	last := new(big.Int).SetBytes(end)
+	if first.Cmp(last) > 0 {
+		return nil, fmt.Errorf("range start is after its end")
+	}
+	var networks []*net.IPNet
+	one := big.NewInt(1)
+	for first.Cmp(last) <= 0 {
+		// Use the largest block aligned to the start address which does not pass the end
+		hostBits := first.TrailingZeroBits()
+		if first.Sign() == 0 {
+			hostBits = bits
+		}
+		for ; hostBits > 0; hostBits-- {
+			blockEnd := new(big.Int).Lsh(one, hostBits)
+			blockEnd.Add(blockEnd, first).Sub(blockEnd, one)
+			if blockEnd.Cmp(last) <= 0 {
+				break
+			}
+		}
+		networks = append(networks, &net.IPNet{
+			IP:   bigToIP(first, size),
+			Mask: net.CIDRMask(int(bits-hostBits), int(bits)),
+		})
+		first.Add(first, new(big.Int).Lsh(one, hostBits))
+	}
+	return networks, nil
+}
+
+// bigToIP converts the integer form of an address back to an IP of the size provided
+func bigToIP(v *big.Int, size int) net.IP {
+	b := v.Bytes()
+	ip := make(net.IP, size)
+	copy(ip[size-len(b):], b)
+	return ip
+}
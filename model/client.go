@@ -0,0 +1,194 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ClientStyle is the peer_id encoding convention used by a client
+type ClientStyle int
+
+const (
+	// ClientStyleUnknown is used for peer ids which could not be decoded
+	ClientStyleUnknown ClientStyle = iota
+	// ClientStyleAzureus peer ids look like -qB4520-xxxxxxxxxxxx
+	ClientStyleAzureus
+	// ClientStyleShadow peer ids look like S58B-----xxxxxxxxxxx
+	ClientStyleShadow
+)
+
+// azureusClients maps the 2 character Azureus style client ids to their names
+var azureusClients = map[string]string{
+	"AZ": "Vuze",
+	"BI": "BiglyBT",
+	"BT": "BitTorrent",
+	"DE": "Deluge",
+	"FD": "Free Download Manager",
+	"KT": "KTorrent",
+	"LT": "libtorrent (Rasterbar)",
+	"lt": "libTorrent (rakshasa)",
+	"qB": "qBittorrent",
+	"TR": "Transmission",
+	"UT": "µTorrent",
+	"UM": "µTorrent Mac",
+	"WD": "WebTorrent Desktop",
+	"WW": "WebTorrent",
+}
+
+// shadowClients maps the single character Shadow style client ids to their names
+var shadowClients = map[string]string{
+	"A": "ABC",
+	"O": "Osprey Permaseed",
+	"Q": "BTQueue",
+	"R": "Tribler",
+	"S": "Shadow",
+	"T": "BitTornado",
+	"U": "UPnP NAT Bit Torrent",
+}
+
+// Version is a dotted version number split into its numeric components
+type Version []int
+
+// ParseVersion parses a dotted version string such as 4.5.2
+func ParseVersion(s string) (Version, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty version")
+	}
+	var v Version
+	for _, part := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version: %s", s)
+		}
+		v = append(v, n)
+	}
+	return v, nil
+}
+
+// Compare returns -1, 0 or 1 if v is less than, equal to or greater than o. Missing
+// components are treated as 0 so 4.5 is equal to 4.5.0.0
+func (v Version) Compare(o Version) int {
+	for i := 0; i < len(v) || i < len(o); i++ {
+		var a, b int
+		if i < len(v) {
+			a = v[i]
+		}
+		if i < len(o) {
+			b = o[i]
+		}
+		if a < b {
+			return -1
+		}
+		if a > b {
+			return 1
+		}
+	}
+	return 0
+}
+
+// String returns the dotted version string
+func (v Version) String() string {
+	parts := make([]string, len(v))
+	for i, n := range v {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Client is the client software and version decoded from a peer_id
+type Client struct {
+	// ID is the 2 character Azureus style or 1 character Shadow style client identifier
+	ID      string
+	Style   ClientStyle
+	Version Version
+}
+
+// Name returns the human readable name of the client, falling back to its ID if
+// the client is unknown
+func (c Client) Name() string {
+	names := azureusClients
+	if c.Style == ClientStyleShadow {
+		names = shadowClients
+	}
+	if name, found := names[c.ID]; found {
+		return name
+	}
+	return c.ID
+}
+
+// String returns the client name and version, eg: qBittorrent 4.5.2.0
+func (c Client) String() string {
+	if len(c.Version) == 0 {
+		return c.Name()
+	}
+	return fmt.Sprintf("%s %s", c.Name(), c.Version.String())
+}
+
+// ParseClient decodes the client and version from a Azureus or Shadow style peer_id.
+// See https://wiki.theory.org/BitTorrentSpecification#peer_id
+func ParseClient(peerID PeerID) (Client, bool) {
+	if c, ok := parseAzureus(peerID); ok {
+		return c, true
+	}
+	return parseShadow(peerID)
+}
+
+// parseAzureus decodes peer ids in the form -XXvvvv- where XX is the client id and
+// vvvv is the version. Versions digits of 0-9 and A-Z (10-35) are supported.
+func parseAzureus(peerID PeerID) (Client, bool) {
+	if peerID[0] != '-' || peerID[7] != '-' || !isAlnum(peerID[1]) || !isAlnum(peerID[2]) {
+		return Client{}, false
+	}
+	c := Client{ID: string(peerID[1:3]), Style: ClientStyleAzureus}
+	for _, b := range peerID[3:7] {
+		switch {
+		case b >= '0' && b <= '9':
+			c.Version = append(c.Version, int(b-'0'))
+		case b >= 'A' && b <= 'Z':
+			c.Version = append(c.Version, int(b-'A')+10)
+		default:
+			// Any other character ends the version
+			return c, true
+		}
+	}
+	return c, true
+}
+
+// parseShadow decodes peer ids in the form Xvvvvv--- where X is the client id and up to
+// 5 version characters follow terminated by dashes. Version characters use 0-9, A-Z (10-35),
+// a-z (36-61) and . (62).
+func parseShadow(peerID PeerID) (Client, bool) {
+	if !isAlnum(peerID[0]) {
+		return Client{}, false
+	}
+	c := Client{ID: string(peerID[0:1]), Style: ClientStyleShadow}
+	for i := 1; i < 7; i++ {
+		b := peerID[i]
+		switch {
+		case i == 6 && b != '-':
+			return Client{}, false
+		case b == '-':
+			// The version must be followed by at least 3 dashes to be considered valid
+			if i == 1 || peerID[i+1] != '-' || peerID[i+2] != '-' {
+				return Client{}, false
+			}
+			return c, true
+		case b >= '0' && b <= '9':
+			c.Version = append(c.Version, int(b-'0'))
+		case b >= 'A' && b <= 'Z':
+			c.Version = append(c.Version, int(b-'A')+10)
+		case b >= 'a' && b <= 'z':
+			c.Version = append(c.Version, int(b-'a')+36)
+		case b == '.':
+			c.Version = append(c.Version, 62)
+		default:
+			return Client{}, false
+		}
+	}
+	return Client{}, false
+}
+
+func isAlnum(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
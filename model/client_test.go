@@ -0,0 +1,53 @@
+package model
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseClient(t *testing.T) {
+	cases := []struct {
+		peerID  string
+		ok      bool
+		id      string
+		style   ClientStyle
+		version string
+	}{
+		{"-qB4520-aaaaaaaaaaaa", true, "qB", ClientStyleAzureus, "4.5.2.0"},
+		{"-TR294Z-aaaaaaaaaaaa", true, "TR", ClientStyleAzureus, "2.9.4.35"},
+		{"-DE13F0-aaaaaaaaaaaa", true, "DE", ClientStyleAzureus, "1.3.15.0"},
+		{"-UT35.a-aaaaaaaaaaaa", true, "UT", ClientStyleAzureus, "3.5"},
+		{"S58B-----aaaaaaaaaaa", true, "S", ClientStyleShadow, "5.8.11"},
+		{"T03I---aaaaaaaaaaaaa", true, "T", ClientStyleShadow, "0.3.18"},
+		{"S58B-aaaaaaaaaaaaaaa", false, "", ClientStyleUnknown, ""},
+		{"\x00\x01\x02aaaaaaaaaaaaaaaaa", false, "", ClientStyleUnknown, ""},
+	}
+	for _, c := range cases {
+		client, ok := ParseClient(PeerIDFromString(c.peerID))
+		require.Equal(t, c.ok, ok, c.peerID)
+		require.Equal(t, c.id, client.ID, c.peerID)
+		require.Equal(t, c.style, client.Style, c.peerID)
+		require.Equal(t, c.version, client.Version.String(), c.peerID)
+	}
+}
+
+func TestWhiteListClient_VersionAllowed(t *testing.T) {
+	wl := WhiteListClient{ClientPrefix: "-qB", MinVersion: "4.2", MaxVersion: "4.5.2", BannedVersions: "4.3.0, 4.3.1"}
+	require.NoError(t, wl.Validate())
+	for v, allowed := range map[string]bool{
+		"4.1.9": false,
+		"4.2.0": true,
+		"4.3.0": false,
+		"4.3.1": false,
+		"4.4.0": true,
+		"4.5.2": true,
+		"4.5.3": false,
+	} {
+		version, err := ParseVersion(v)
+		require.NoError(t, err)
+		client := Client{ID: "qB", Style: ClientStyleAzureus, Version: version}
+		require.True(t, wl.Match(client))
+		require.Equal(t, allowed, wl.VersionAllowed(client), v)
+	}
+	require.Error(t, WhiteListClient{MinVersion: "4.x"}.Validate())
+}
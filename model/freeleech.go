@@ -0,0 +1,31 @@
+package model
+
+import (
+	"time"
+)
+
+// FreeleechToken grants a user personal freeleech on a single torrent. While the token is active
+// the users downloads of the torrent are not credited against them.
+type FreeleechToken struct {
+	UserID   uint32   `db:"user_id" json:"user_id"`
+	InfoHash InfoHash `db:"info_hash" json:"info_hash"`
+	// TimeCreated is when the token was granted
+	TimeCreated time.Time `db:"time_created" json:"time_created"`
+	// TimeExpire is when the token stops applying to the torrent
+	TimeExpire time.Time `db:"time_expire" json:"time_expire"`
+}
+
+// Key returns the unique key for the token
+func (f FreeleechToken) Key() UserTorrentKey {
+	return UserTorrentKey{UserID: f.UserID, InfoHash: f.InfoHash}
+}
+
+// Active returns true if the token applies at the time provided
+func (f FreeleechToken) Active(now time.Time) bool {
+	return !now.Before(f.TimeCreated) && now.Before(f.TimeExpire)
+}
+
+// Expired returns true if the token no longer applies at the time provided
+func (f FreeleechToken) Expired(now time.Time) bool {
+	return !now.Before(f.TimeExpire)
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestFreeleechToken_Active(t *testing.T) {
+	now := time.Now()
+	token := FreeleechToken{UserID: 1, TimeCreated: now, TimeExpire: now.Add(time.Hour)}
+	require.False(t, token.Active(now.Add(-time.Second)))
+	require.True(t, token.Active(now))
+	require.False(t, token.Expired(now))
+	require.False(t, token.Active(now.Add(time.Hour)))
+	require.True(t, token.Expired(now.Add(time.Hour)))
+	require.Equal(t, UserTorrentKey{UserID: 1}, token.Key())
+}
@@ -0,0 +1,67 @@
+package model
+
+import (
+	"time"
+)
+
+// HitAndRunStatus is the current state of a users obligation to seed a torrent they have completed
+type HitAndRunStatus string
+
+const (
+	// HNRPending is used while the user has not yet seeded for the required time
+	HNRPending HitAndRunStatus = "pending"
+	// HNRSatisfied is used once the user has seeded for the required time
+	HNRSatisfied HitAndRunStatus = "satisfied"
+	// HNRFlagged is used when the user stopped seeding for longer than the grace window before
+	// seeding for the required time. Flagged users can still clear the hit and run by seeding.
+	HNRFlagged HitAndRunStatus = "hnr"
+)
+
+// HitAndRun tracks the seeding time of a user for a torrent after they completed downloading it
+type HitAndRun struct {
+	UserID   uint32          `db:"user_id" json:"user_id"`
+	InfoHash InfoHash        `db:"info_hash" json:"info_hash"`
+	Status   HitAndRunStatus `db:"status" json:"status"`
+	// SeedTime is the total number of seconds seeded since completing the torrent
+	SeedTime uint32 `db:"seed_time" json:"seed_time"`
+	// TimeCompleted is when the completed event was received
+	TimeCompleted time.Time `db:"time_completed" json:"time_completed"`
+	// TimeLastSeed is the last time the user announced as a seeder
+	TimeLastSeed time.Time `db:"time_last_seed" json:"time_last_seed"`
+}
+
+// NewHitAndRun creates a new pending record for a torrent completed at the time provided
+func NewHitAndRun(userID uint32, ih InfoHash, completed time.Time) HitAndRun {
+	return HitAndRun{
+		UserID:        userID,
+		InfoHash:      ih,
+		Status:        HNRPending,
+		TimeCompleted: completed,
+		TimeLastSeed:  completed,
+	}
+}
+
+// Key returns the unique key for the record
+func (h HitAndRun) Key() UserTorrentKey {
+	return UserTorrentKey{UserID: h.UserID, InfoHash: h.InfoHash}
+}
+
+// Seed credits the user with the time seeded since their last seeding announce. Gaps longer than
+// maxGap are not counted as the user was not seeding during that time.
+func (h *HitAndRun) Seed(now time.Time, maxGap time.Duration, threshold time.Duration) {
+	elapsed := now.Sub(h.TimeLastSeed)
+	if elapsed > 0 && elapsed <= maxGap {
+		h.SeedTime += uint32(elapsed.Seconds())
+	}
+	if now.After(h.TimeLastSeed) {
+		h.TimeLastSeed = now
+	}
+	if time.Duration(h.SeedTime)*time.Second >= threshold {
+		h.Status = HNRSatisfied
+	}
+}
+
+// Expired returns true if the record is still pending and the user has not seeded within the grace window
+func (h HitAndRun) Expired(now time.Time, grace time.Duration) bool {
+	return h.Status == HNRPending && now.Sub(h.TimeLastSeed) > grace
+}
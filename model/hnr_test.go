@@ -0,0 +1,25 @@
+package model
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestHitAndRun_Seed(t *testing.T) {
+	now := time.Now()
+	h := NewHitAndRun(1, InfoHash{}, now)
+	require.Equal(t, HNRPending, h.Status)
+	h.Seed(now.Add(30*time.Minute), time.Hour, 2*time.Hour)
+	require.Equal(t, uint32(1800), h.SeedTime)
+	require.False(t, h.Expired(now.Add(time.Hour), time.Hour))
+	require.True(t, h.Expired(now.Add(2*time.Hour), time.Hour))
+	// Gaps longer than the max gap are not counted
+	h.Seed(now.Add(3*time.Hour), time.Hour, 2*time.Hour)
+	require.Equal(t, uint32(1800), h.SeedTime)
+	require.Equal(t, now.Add(3*time.Hour), h.TimeLastSeed)
+	h.Seed(now.Add(4*time.Hour), 2*time.Hour, 90*time.Minute)
+	require.Equal(t, uint32(5400), h.SeedTime)
+	require.Equal(t, HNRSatisfied, h.Status)
+	require.False(t, h.Expired(now.Add(24*time.Hour), time.Hour))
+}
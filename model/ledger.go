@@ -0,0 +1,48 @@
+package model
+
+import (
+	"time"
+)
+
+// LedgerSource identifies what caused a change to a users stats
+type LedgerSource string
+
+const (
+	// LedgerSync is used for the stats credited to a user by a batch update from the tracker
+	LedgerSync LedgerSource = "sync"
+	// LedgerAdjustment is used for manual corrections made by staff
+	LedgerAdjustment LedgerSource = "adjustment"
+)
+
+// LedgerEntry is a single change to a users credited stats. Entries are append only so the
+// ledger forms an audit trail of how the users totals were reached.
+type LedgerEntry struct {
+	LedgerID uint64       `db:"ledger_id" json:"ledger_id"`
+	UserID   uint32       `db:"user_id" json:"user_id"`
+	Source   LedgerSource `db:"source" json:"source"`
+	// Uploaded & Downloaded are the changes to the users credited totals, negative values remove credit
+	Uploaded    int64   `db:"uploaded" json:"uploaded"`
+	Downloaded  int64   `db:"downloaded" json:"downloaded"`
+	BonusPoints float64 `db:"bonus_points" json:"bonus_points"`
+	// Reason & Actor describe why and by whom a manual adjustment was made
+	Reason      string    `db:"reason" json:"reason"`
+	Actor       string    `db:"actor" json:"actor"`
+	TimeCreated time.Time `db:"time_created" json:"time_created"`
+}
+
+// NewSyncLedgerEntry creates the ledger entry for the stats credited to a user by a batch update
+func NewSyncLedgerEntry(userID uint32, stats UserStats, now time.Time) LedgerEntry {
+	return LedgerEntry{
+		UserID:      userID,
+		Source:      LedgerSync,
+		Uploaded:    int64(stats.Uploaded),
+		Downloaded:  int64(stats.Downloaded),
+		BonusPoints: stats.BonusPoints,
+		TimeCreated: now,
+	}
+}
+
+// Empty returns true if the entry does not change any of the users stats
+func (l LedgerEntry) Empty() bool {
+	return l.Uploaded == 0 && l.Downloaded == 0 && l.BonusPoints == 0
+}
@@ -0,0 +1,94 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// PasskeyLabelPrevious is the label of a users previous passkey kept working after it was rotated
+	PasskeyLabelPrevious = "previous"
+	// passkeyLabelMaxLen is the longest label which can be stored
+	passkeyLabelMaxLen = 64
+	// PasskeyDigestLen is the length of the hex encoded digest stored in place of a hashed passkey
+	PasskeyDigestLen = sha256.Size * 2
+)
+
+// HashPasskey returns the hex encoded HMAC-SHA256 digest of the passkey keyed with the secret
+func HashPasskey(secret []byte, passkey string) string {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write([]byte(passkey))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IsPasskeyDigest returns true if the value is a digest created by HashPasskey
+func IsPasskeyDigest(s string) bool {
+	if len(s) != PasskeyDigestLen {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// Passkey is an additional passkey which also resolves to a user. These let users give each of their
+// devices or seedboxes their own passkey, and keep a users previous passkey working for a grace period
+// after it has been rotated.
+type Passkey struct {
+	Passkey string `db:"passkey" json:"passkey"`
+	UserID  uint32 `db:"user_id" json:"user_id"`
+	// Label identifies the device or client using the passkey, eg: seedbox
+	Label       string    `db:"label" json:"label"`
+	TimeCreated time.Time `db:"time_created" json:"time_created"`
+	// TimeExpire is when the passkey stops working, passkeys with a zero value never expire
+	TimeExpire time.Time `db:"time_expire" json:"time_expire"`
+	// TimeLastUsed and IP are when and where the passkey was last announced with
+	TimeLastUsed time.Time `db:"time_last_used" json:"time_last_used"`
+	IP           net.IP    `db:"addr_ip" json:"addr_ip"`
+}
+
+// PasskeyUsage is the most recent announce made with a passkey, used for batch updates
+type PasskeyUsage struct {
+	IP           net.IP
+	TimeLastUsed time.Time
+}
+
+// Validate ensures the passkey is well formed and expires after it was created
+func (p Passkey) Validate() error {
+	if len(p.Passkey) != 20 {
+		return fmt.Errorf("passkey must be 20 characters")
+	}
+	if p.UserID == 0 {
+		return fmt.Errorf("passkey must belong to a user")
+	}
+	if len(p.Label) > passkeyLabelMaxLen {
+		return fmt.Errorf("passkey label cannot be longer than %d characters", passkeyLabelMaxLen)
+	}
+	if !p.TimeExpire.IsZero() && !p.TimeExpire.After(p.TimeCreated) {
+		return fmt.Errorf("passkey must expire after it was created")
+	}
+	return nil
+}
+
+// Expired returns true if the passkey no longer works at the time provided
+func (p Passkey) Expired(now time.Time) bool {
+	return !p.TimeExpire.IsZero() && !now.Before(p.TimeExpire)
+}
+
+// Warning returns the message sent to users announcing with their previous passkey, telling them to
+// replace their .torrent files before it stops working. Passkeys which never expire and the passkeys
+// of the users devices have no warning.
+func (p Passkey) Warning(now time.Time) string {
+	if p.TimeExpire.IsZero() || (p.Label != "" && p.Label != PasskeyLabelPrevious) {
+		return ""
+	}
+	remaining := p.TimeExpire.Sub(now).Truncate(time.Minute)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return fmt.Sprintf("Your passkey has changed, redownload your .torrent files. The old passkey stops working in %s",
+		remaining.String())
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPasskey(t *testing.T) {
+	now := time.Now()
+	pk := Passkey{Passkey: "12345678901234567890", UserID: 1, TimeCreated: now, TimeExpire: now.Add(time.Hour)}
+	require.NoError(t, pk.Validate())
+	require.False(t, pk.Expired(now))
+	require.True(t, pk.Expired(now.Add(time.Hour)))
+	require.Contains(t, pk.Warning(now), "1h0m0s")
+	require.Contains(t, pk.Warning(now.Add(2*time.Hour)), "0s")
+	require.Error(t, Passkey{Passkey: "short", UserID: 1, TimeCreated: now}.Validate())
+	require.Error(t, Passkey{Passkey: pk.Passkey, TimeCreated: now}.Validate())
+	require.Error(t, Passkey{Passkey: pk.Passkey, UserID: 1, TimeCreated: now, TimeExpire: now}.Validate())
+	permanent := Passkey{Passkey: pk.Passkey, UserID: 1, TimeCreated: now}
+	require.NoError(t, permanent.Validate())
+	require.False(t, permanent.Expired(now.Add(time.Hour*24*365)))
+	require.Empty(t, permanent.Warning(now))
+	device := Passkey{Passkey: pk.Passkey, UserID: 1, Label: "seedbox", TimeCreated: now, TimeExpire: now.Add(time.Hour)}
+	require.Empty(t, device.Warning(now))
+	device.Label = PasskeyLabelPrevious
+	require.NotEmpty(t, device.Warning(now))
+	permanent.Label = strings.Repeat("a", passkeyLabelMaxLen+1)
+	require.Error(t, permanent.Validate())
+}
+
+func TestHashPasskey(t *testing.T) {
+	secret := []byte("secret")
+	digest := HashPasskey(secret, "12345678901234567890")
+	require.Len(t, digest, PasskeyDigestLen)
+	require.True(t, IsPasskeyDigest(digest))
+	require.False(t, IsPasskeyDigest("12345678901234567890"))
+	require.Equal(t, digest, HashPasskey(secret, "12345678901234567890"))
+	// Digests are hashed again so they cannot be used in place of the passkey
+	require.NotEqual(t, digest, HashPasskey(secret, digest))
+	require.NotEqual(t, digest, HashPasskey([]byte("other"), "12345678901234567890"))
+	require.False(t, User{UserID: 1, Passkey: digest}.Valid())
+	require.True(t, User{UserID: 1, Passkey: digest}.ValidDigest())
+	require.False(t, User{UserID: 1, Passkey: "12345678901234567890"}.ValidDigest())
+	require.False(t, User{UserID: 1, Passkey: strings.Repeat("z", PasskeyDigestLen)}.ValidDigest())
+}
@@ -64,6 +64,11 @@ type Peer struct {
 	Downloaded uint64 `db:"total_downloaded" redis:"total_downloaded" json:"total_downloaded"`
 	// Clients reported bytes left of the download
 	Left uint32 `db:"total_left" redis:"total_left" json:"total_left"`
+	// SessionUploaded is the last uploaded counter reported by the client. Clients report cumulative
+	// totals since their started event, so this is used to only account for the change between announces.
+	SessionUploaded uint64 `db:"session_uploaded" redis:"session_uploaded" json:"session_uploaded"`
+	// SessionDownloaded is the last downloaded counter reported by the client
+	SessionDownloaded uint64 `db:"session_downloaded" redis:"session_downloaded" json:"session_downloaded"`
 	// Total active swarm participation time
 	TotalTime uint32 `db:"total_time" redis:"total_time" json:"total_time"`
 	// Current speed up, bytes/sec
@@ -74,10 +79,18 @@ type Peer struct {
 	SpeedUPMax uint32 `db:"speed_up_max"  redis:"speed_up_max" json:"speed_up_max"`
 	// Max recorded dn speed, bytes/sec
 	SpeedDNMax uint32 `db:"speed_dn_max" redis:"speed_dn_max" json:"speed_dn_max"`
-	// Clients IPv4 Address detected automatically, does not use client supplied value
+	// Clients IPv4 Address. This is nil for peers which have not supplied a IPv4 address
 	IP net.IP `db:"addr_ip" redis:"addr_ip" json:"addr_ip"`
+	// Clients IPv6 Address. This is nil for peers which have not supplied a IPv6 address
+	IPv6 net.IP `db:"addr_ipv6" redis:"addr_ipv6" json:"addr_ipv6"`
 	// Clients reported port
 	Port uint16 `db:"addr_port" redis:"addr_port" json:"addr_port"`
+	// Key is the optional announce key sent by the client. When set, it must be supplied by any
+	// further announces for the peer_id, allowing the peer to change its address.
+	Key string `db:"peer_key" redis:"peer_key" json:"peer_key"`
+	// PasskeyLabel is the label of the additional passkey the peer announced with, empty for peers
+	// using the users own passkey
+	PasskeyLabel string `db:"passkey_label" redis:"passkey_label" json:"passkey_label"`
 	// Total number of announces the peer has made
 	Announces uint32 `db:"total_announces" redis:"total_announces" json:"total_announces"`
 	// Last announce timestamp
@@ -109,7 +122,22 @@ func (peer *Peer) IsNew() bool {
 
 // Valid returns true if the peer data meets the minimum requirements to participate in swarms
 func (peer *Peer) Valid() bool {
-	return peer.UserID > 0 && peer.Port >= 1024 && util.IsPrivateIP(peer.IP)
+	return peer.UserID > 0 && peer.Port >= 1024 && util.IsPrivateIP(peer.Addr())
+}
+
+// WebRTC returns true for browser peers connected through the websocket tracker. These peers
+// have no listen port and can only be reached by relaying WebRTC offers.
+func (peer *Peer) WebRTC() bool {
+	return peer.Port == 0
+}
+
+// Addr returns the preferred address of the peer, the IPv4 address is returned if known,
+// falling back to the IPv6 address otherwise
+func (peer *Peer) Addr() net.IP {
+	if peer.IP != nil {
+		return peer.IP
+	}
+	return peer.IPv6
 }
 
 // Swarm is a set of users participating in a torrent
@@ -138,10 +166,18 @@ func (peers Swarm) Counts() (seeders uint, leechers uint) {
 	return
 }
 
-// NewPeer create a new peer instance for inserting into a swarm
+// NewPeer create a new peer instance for inserting into a swarm. The address is
+// assigned to either IP or IPv6 depending on its family.
 func NewPeer(userID uint32, peerID PeerID, ip net.IP, port uint16) Peer {
+	var ipv4, ipv6 net.IP
+	if ip4 := ip.To4(); ip4 != nil {
+		ipv4 = ip4
+	} else {
+		ipv6 = ip
+	}
 	return Peer{
-		IP:            ip,
+		IP:            ipv4,
+		IPv6:          ipv6,
 		Port:          port,
 		AnnounceLast:  time.Now(),
 		AnnounceFirst: time.Now(),
@@ -157,13 +193,33 @@ type UpdateState struct {
 	InfoHash InfoHash
 	PeerID   PeerID
 	Passkey  string
+	UserID   uint32
+	// AltPasskey is true when the announce used one of the users additional passkeys
+	AltPasskey bool
+	// IP is the address the announce was received from
+	IP net.IP
 	// Total amount uploaded as reported by client
 	Uploaded uint64
 	// Total amount downloaded as reported by client
 	Downloaded uint64
+	// PrevUploaded is the previous uploaded counter for the peer known by the PeerStore. This is
+	// used when the tracker is not already tracking the peers session, eg: after a restart.
+	PrevUploaded uint64
+	// PrevDownloaded is the previous downloaded counter for the peer known by the PeerStore
+	PrevDownloaded uint64
+	// MultiUp & MultiDn are the multipliers of the torrent applied to the users credited totals
+	MultiUp float64
+	MultiDn float64
+	// Size is the total size of the torrent in bytes
+	Size uint64
+	// Seeders is the number of seeders in the swarm at the time of the announce
+	Seeders uint
 	// Clients reported bytes left of the download
 	Left uint32
 	// Timestamp is the time the new stats were announced
 	Timestamp time.Time
 	Event     consts.AnnounceType
+	// LeechDenied is set when the announce was rejected because downloading is disabled for the
+	// user. Only the users denied counter is updated for these announces.
+	LeechDenied bool
 }
@@ -0,0 +1,229 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Tags is a list of tags, such as categories, attached to a torrent. They are stored as
+// a comma separated string in the backing stores.
+type Tags []string
+
+// ParseTags splits a comma separated list of tags, ignoring empty values
+func ParseTags(s string) Tags {
+	var tags Tags
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Has returns true if the tag is set. Tags are case insensitive.
+func (t Tags) Has(tag string) bool {
+	for _, v := range t {
+		if strings.EqualFold(v, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the comma separated list of tags
+func (t Tags) String() string {
+	return strings.Join(t, ",")
+}
+
+// Value implements the database.Valuer interface
+func (t Tags) Value() (driver.Value, error) {
+	return t.String(), nil
+}
+
+// Scan implements the sql.Scanner interface for conversion to our custom type
+func (t *Tags) Scan(v interface{}) error {
+	switch vt := v.(type) {
+	case nil:
+		*t = nil
+	case []byte:
+		*t = ParseTags(string(vt))
+	case string:
+		*t = ParseTags(vt)
+	default:
+		return fmt.Errorf("failed to convert value to tags")
+	}
+	return nil
+}
+
+// InfoHashes is a list of info hashes. They are encoded as base16 strings in JSON and stored as
+// a comma separated list of base16 strings in the backing stores.
+type InfoHashes []InfoHash
+
+// ParseInfoHashes decodes a comma separated list of base16 encoded info hashes
+func ParseInfoHashes(s string) (InfoHashes, error) {
+	var hashes InfoHashes
+	for _, hashStr := range strings.Split(s, ",") {
+		hashStr = strings.TrimSpace(hashStr)
+		if hashStr == "" {
+			continue
+		}
+		var ih InfoHash
+		if err := InfoHashFromHex(&ih, hashStr); err != nil {
+			return nil, fmt.Errorf("invalid info_hash: %s", hashStr)
+		}
+		hashes = append(hashes, ih)
+	}
+	return hashes, nil
+}
+
+// Has returns true if the info hash is in the list
+func (h InfoHashes) Has(ih InfoHash) bool {
+	for _, v := range h {
+		if v == ih {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the comma separated list of base16 encoded info hashes
+func (h InfoHashes) String() string {
+	parts := make([]string, len(h))
+	for i, ih := range h {
+		parts[i] = ih.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// MarshalJSON encodes the info hashes as a list of base16 strings
+func (h InfoHashes) MarshalJSON() ([]byte, error) {
+	parts := make([]string, len(h))
+	for i, ih := range h {
+		parts[i] = ih.String()
+	}
+	return json.Marshal(parts)
+}
+
+// UnmarshalJSON decodes a list of base16 encoded info hashes
+func (h *InfoHashes) UnmarshalJSON(b []byte) error {
+	var parts []string
+	if err := json.Unmarshal(b, &parts); err != nil {
+		return err
+	}
+	hashes, err := ParseInfoHashes(strings.Join(parts, ","))
+	if err != nil {
+		return err
+	}
+	*h = hashes
+	return nil
+}
+
+// Value implements the database.Valuer interface
+func (h InfoHashes) Value() (driver.Value, error) {
+	return h.String(), nil
+}
+
+// Scan implements the sql.Scanner interface for conversion to our custom type
+func (h *InfoHashes) Scan(v interface{}) error {
+	var s string
+	switch vt := v.(type) {
+	case nil:
+	case []byte:
+		s = string(vt)
+	case string:
+		s = vt
+	default:
+		return fmt.Errorf("failed to convert value to info hashes")
+	}
+	hashes, err := ParseInfoHashes(s)
+	if err != nil {
+		return err
+	}
+	*h = hashes
+	return nil
+}
+
+// PromotionScope defines which torrents a promotion applies to
+type PromotionScope string
+
+const (
+	// PromotionGlobal applies to every torrent on the tracker
+	PromotionGlobal PromotionScope = "global"
+	// PromotionTag applies to torrents which have the promotions tag
+	PromotionTag PromotionScope = "tag"
+	// PromotionTorrent applies to the set of info hashes attached to the promotion
+	PromotionTorrent PromotionScope = "torrent"
+)
+
+// Promotion is a time windowed multiplier applied to torrents, eg: a weekend freeleech event.
+// When multiple promotions are active for a torrent the most generous multipliers are used.
+type Promotion struct {
+	// Name uniquely identifies the promotion
+	Name  string         `db:"name" json:"name"`
+	Scope PromotionScope `db:"scope" json:"scope"`
+	// Tag is the torrent tag the promotion applies to when using the PromotionTag scope
+	Tag string `db:"tag" json:"tag"`
+	// InfoHashes are the torrents the promotion applies to when using the PromotionTorrent scope
+	InfoHashes InfoHashes `db:"info_hashes" json:"info_hashes"`
+	// MultiUp is the upload multiplier, eg: 2.0 for double upload
+	MultiUp float64 `db:"multi_up" json:"multi_up"`
+	// MultiDn is the download multiplier, 0 denotes freeleech
+	MultiDn   float64   `db:"multi_dn" json:"multi_dn"`
+	TimeStart time.Time `db:"time_start" json:"time_start"`
+	TimeEnd   time.Time `db:"time_end" json:"time_end"`
+}
+
+// Validate ensures the promotion has a usable scope, multipliers and time window
+func (p Promotion) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("promotion name cannot be empty")
+	}
+	switch p.Scope {
+	case PromotionGlobal:
+	case PromotionTag:
+		if p.Tag == "" {
+			return fmt.Errorf("tag scoped promotions require a tag")
+		}
+	case PromotionTorrent:
+		if len(p.InfoHashes) == 0 {
+			return fmt.Errorf("torrent scoped promotions require at least 1 info_hash")
+		}
+	default:
+		return fmt.Errorf("invalid promotion scope: %s", p.Scope)
+	}
+	if p.MultiUp < 0 || p.MultiDn < 0 {
+		return fmt.Errorf("multipliers cannot be negative")
+	}
+	if !p.TimeEnd.After(p.TimeStart) {
+		return fmt.Errorf("promotion must end after it starts")
+	}
+	return nil
+}
+
+// Active returns true if the promotion is running at the time provided
+func (p Promotion) Active(now time.Time) bool {
+	return !now.Before(p.TimeStart) && now.Before(p.TimeEnd)
+}
+
+// Expired returns true if the promotion has ended by the time provided
+func (p Promotion) Expired(now time.Time) bool {
+	return !now.Before(p.TimeEnd)
+}
+
+// Applies returns true if the torrent is within the scope of the promotion
+func (p Promotion) Applies(t Torrent) bool {
+	switch p.Scope {
+	case PromotionGlobal:
+		return true
+	case PromotionTag:
+		return t.Tags.Has(p.Tag)
+	case PromotionTorrent:
+		return p.InfoHashes.Has(t.InfoHash)
+	default:
+		return false
+	}
+}
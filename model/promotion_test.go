@@ -0,0 +1,52 @@
+package model
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestPromotion(t *testing.T) {
+	now := time.Now()
+	var ih InfoHash
+	require.NoError(t, InfoHashFromString(&ih, "ff503e9ca036f1647c2dfc1337b163e2c54f13f8"))
+	p := Promotion{Name: "p", Scope: PromotionTorrent, InfoHashes: InfoHashes{ih}, MultiUp: 2, MultiDn: 1,
+		TimeStart: now, TimeEnd: now.Add(time.Hour)}
+	require.NoError(t, p.Validate())
+	require.True(t, p.Active(now))
+	require.False(t, p.Active(now.Add(-time.Second)))
+	require.False(t, p.Active(now.Add(time.Hour)))
+	require.True(t, p.Expired(now.Add(time.Hour)))
+	require.True(t, p.Applies(Torrent{InfoHash: ih}))
+	require.False(t, p.Applies(Torrent{}))
+
+	tag := Promotion{Name: "t", Scope: PromotionTag, Tag: "TV", TimeStart: now, TimeEnd: now.Add(time.Hour)}
+	require.True(t, tag.Applies(Torrent{Tags: ParseTags("movies, tv")}))
+	require.False(t, tag.Applies(Torrent{Tags: ParseTags("movies")}))
+
+	for _, invalid := range []Promotion{
+		{Scope: PromotionGlobal, TimeStart: now, TimeEnd: now.Add(time.Hour)},
+		{Name: "x", Scope: "site", TimeStart: now, TimeEnd: now.Add(time.Hour)},
+		{Name: "x", Scope: PromotionTag, TimeStart: now, TimeEnd: now.Add(time.Hour)},
+		{Name: "x", Scope: PromotionTorrent, TimeStart: now, TimeEnd: now.Add(time.Hour)},
+		{Name: "x", Scope: PromotionGlobal, MultiDn: -1, TimeStart: now, TimeEnd: now.Add(time.Hour)},
+		{Name: "x", Scope: PromotionGlobal, TimeStart: now, TimeEnd: now},
+	} {
+		require.Error(t, invalid.Validate())
+	}
+}
+
+func TestInfoHashes_JSON(t *testing.T) {
+	hashes, err := ParseInfoHashes("ff503e9ca036f1647c2dfc1337b163e2c54f13f8, 0f503e9ca036f1647c2dfc1337b163e2c54f13f8")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(hashes))
+	b, err := json.Marshal(hashes)
+	require.NoError(t, err)
+	require.Equal(t, `["ff503e9ca036f1647c2dfc1337b163e2c54f13f8","0f503e9ca036f1647c2dfc1337b163e2c54f13f8"]`, string(b))
+	var decoded InfoHashes
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	require.Equal(t, hashes, decoded)
+	_, err = ParseInfoHashes("invalid")
+	require.Error(t, err)
+}
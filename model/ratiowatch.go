@@ -0,0 +1,84 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// RatioWatchStatus is the current state of a user who has fallen below the required ratio
+type RatioWatchStatus string
+
+const (
+	// RatioWatchWarned is used during the warning period, the user can still download but is
+	// warned in announce responses
+	RatioWatchWarned RatioWatchStatus = "warned"
+	// RatioWatchDisabled is used once the warning period expired without the ratio recovering.
+	// Downloading is disabled for the user while seeding continues to work.
+	RatioWatchDisabled RatioWatchStatus = "disabled"
+	// RatioWatchCleared is used once the users ratio has recovered or staff cleared the watch
+	RatioWatchCleared RatioWatchStatus = "cleared"
+)
+
+// RatioWatch tracks a user who has fallen below the required ratio
+type RatioWatch struct {
+	UserID uint32           `db:"user_id" json:"user_id"`
+	Status RatioWatchStatus `db:"status" json:"status"`
+	// RequiredRatio is the ratio the user must reach, as configured when the watch started
+	RequiredRatio float64 `db:"required_ratio" json:"required_ratio"`
+	// Ratio is the users ratio when the status last changed
+	Ratio float64 `db:"ratio" json:"ratio"`
+	// TimeWarned is when the warning period started
+	TimeWarned time.Time `db:"time_warned" json:"time_warned"`
+	// TimeDeadline is when downloading is disabled unless the ratio recovers
+	TimeDeadline time.Time `db:"time_deadline" json:"time_deadline"`
+	// TimeUpdated is when the status last changed
+	TimeUpdated time.Time `db:"time_updated" json:"time_updated"`
+}
+
+// NewRatioWatch starts the warning period for a user with the ratio provided
+func NewRatioWatch(userID uint32, ratio float64, required float64, now time.Time, period time.Duration) RatioWatch {
+	return RatioWatch{
+		UserID:        userID,
+		Status:        RatioWatchWarned,
+		RequiredRatio: required,
+		Ratio:         ratio,
+		TimeWarned:    now,
+		TimeDeadline:  now.Add(period),
+		TimeUpdated:   now,
+	}
+}
+
+// Active returns true if the user is still being watched
+func (r RatioWatch) Active() bool {
+	return r.Status == RatioWatchWarned || r.Status == RatioWatchDisabled
+}
+
+// Expired returns true if the warning period has ended by the time provided
+func (r RatioWatch) Expired(now time.Time) bool {
+	return r.Status == RatioWatchWarned && now.After(r.TimeDeadline)
+}
+
+// Transition changes the status of the watch, recording the users ratio at the time of the change
+func (r *RatioWatch) Transition(status RatioWatchStatus, ratio float64, now time.Time) {
+	r.Status = status
+	r.Ratio = ratio
+	r.TimeUpdated = now
+}
+
+// Warning returns the message sent to the user in announce responses
+func (r RatioWatch) Warning(now time.Time) string {
+	switch r.Status {
+	case RatioWatchWarned:
+		remaining := r.TimeDeadline.Sub(now).Truncate(time.Minute)
+		if remaining < 0 {
+			remaining = 0
+		}
+		return fmt.Sprintf("Ratio watch: your ratio is below %.2f, downloading will be disabled in %s",
+			r.RequiredRatio, remaining.String())
+	case RatioWatchDisabled:
+		return fmt.Sprintf("Ratio watch: downloading is disabled until your ratio reaches %.2f",
+			r.RequiredRatio)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,29 @@
+package model
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRatioWatch(t *testing.T) {
+	now := time.Now()
+	rw := NewRatioWatch(1, 0.25, 0.5, now, time.Hour)
+	require.True(t, rw.Active())
+	require.False(t, rw.Expired(now.Add(time.Hour)))
+	require.True(t, rw.Expired(now.Add(time.Hour+time.Second)))
+	require.Contains(t, rw.Warning(now), "1h0m0s")
+	rw.Transition(RatioWatchDisabled, 0.3, now.Add(2*time.Hour))
+	require.True(t, rw.Active())
+	require.False(t, rw.Expired(now.Add(2*time.Hour)))
+	require.Equal(t, 0.3, rw.Ratio)
+	require.NotEmpty(t, rw.Warning(now))
+	rw.Transition(RatioWatchCleared, 0.6, now.Add(3*time.Hour))
+	require.False(t, rw.Active())
+	require.Empty(t, rw.Warning(now))
+}
+
+func TestUser_Ratio(t *testing.T) {
+	require.Equal(t, 0.0, User{Uploaded: 100}.Ratio())
+	require.Equal(t, 0.5, User{Uploaded: 100, Downloaded: 200}.Ratio())
+}
@@ -0,0 +1,63 @@
+package model
+
+// SlotLimits are the maximum number of peers a user may have active at once. The tracker wide
+// limits treat 0 as unlimited. When set on a user, 0 uses the tracker wide limit while negative
+// values remove the limit for the user.
+type SlotLimits struct {
+	// Leech is the number of peers which may be downloading at once
+	Leech int `db:"slots_leech" json:"slots_leech"`
+	// Seed is the number of peers which may be seeding at once
+	Seed int `db:"slots_seed" json:"slots_seed"`
+	// PerTorrent is the number of peers, eg: separate clients, which may be active in a single swarm
+	PerTorrent int `db:"slots_torrent" json:"slots_torrent"`
+}
+
+// Override returns the limits with the per user limits provided applied
+func (l SlotLimits) Override(user SlotLimits) SlotLimits {
+	return SlotLimits{
+		Leech:      overrideSlot(l.Leech, user.Leech),
+		Seed:       overrideSlot(l.Seed, user.Seed),
+		PerTorrent: overrideSlot(l.PerTorrent, user.PerTorrent),
+	}
+}
+
+// Enabled returns true if any of the limits apply
+func (l SlotLimits) Enabled() bool {
+	return l.Leech > 0 || l.Seed > 0 || l.PerTorrent > 0
+}
+
+func overrideSlot(limit int, user int) int {
+	switch {
+	case user < 0:
+		return 0
+	case user > 0:
+		return user
+	default:
+		return limit
+	}
+}
+
+// SlotUsage is the number of peers a user currently has active
+type SlotUsage struct {
+	Leeching int
+	Seeding  int
+	// Torrent is the number of peers active in the swarm of a single torrent
+	Torrent int
+}
+
+// SlotUsage counts the users active peers in the swarm, which must only contain the peers of a
+// single user. Peers in the swarm of the info hash provided are also counted towards Torrent.
+func (peers Swarm) SlotUsage(ih InfoHash) SlotUsage {
+	var usage SlotUsage
+	for _, p := range peers {
+		if p.Left == 0 {
+			usage.Seeding++
+		} else {
+			usage.Leeching++
+		}
+		if p.InfoHash == ih {
+			usage.Torrent++
+		}
+	}
+	return usage
+}
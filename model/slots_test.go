@@ -0,0 +1,27 @@
+package model
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSlotLimits_Override(t *testing.T) {
+	limits := SlotLimits{Leech: 5, Seed: 0, PerTorrent: 1}
+	require.Equal(t, limits, limits.Override(SlotLimits{}))
+	require.Equal(t, SlotLimits{Leech: 10, Seed: 2, PerTorrent: 0},
+		limits.Override(SlotLimits{Leech: 10, Seed: 2, PerTorrent: -1}))
+	require.True(t, limits.Enabled())
+	require.False(t, limits.Override(SlotLimits{Leech: -1, PerTorrent: -1}).Enabled())
+}
+
+func TestSwarm_SlotUsage(t *testing.T) {
+	ihA := InfoHash{1}
+	ihB := InfoHash{2}
+	peers := Swarm{
+		{InfoHash: ihA, Left: 100},
+		{InfoHash: ihA, Left: 0},
+		{InfoHash: ihB, Left: 100},
+	}
+	require.Equal(t, SlotUsage{Leeching: 2, Seeding: 1, Torrent: 2}, peers.SlotUsage(ihA))
+	require.Equal(t, SlotUsage{Leeching: 2, Seeding: 1, Torrent: 1}, peers.SlotUsage(ihB))
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"net"
+	"time"
+)
+
+// Snatch records a user completing the download of a torrent
+type Snatch struct {
+	UserID   uint32   `db:"user_id" json:"user_id"`
+	InfoHash InfoHash `db:"info_hash" json:"info_hash"`
+	// TimeCompleted is when the completed event was received
+	TimeCompleted time.Time `db:"time_completed" json:"time_completed"`
+	// IP is the address the completed event was announced from
+	IP net.IP `db:"addr_ip" json:"addr_ip"`
+	// Client is the client software and version decoded from the peer_id of the completed event
+	Client string `db:"client" json:"client"`
+	// Uploaded & Downloaded are the cumulative amounts actually transferred by the user for the torrent.
+	// These include the transfers of the session the torrent was completed in and continue to be updated
+	// after completion.
+	Uploaded   uint64 `db:"uploaded" json:"uploaded"`
+	Downloaded uint64 `db:"downloaded" json:"downloaded"`
+}
+
+// Key returns the unique key for the snatch
+func (s Snatch) Key() UserTorrentKey {
+	return UserTorrentKey{UserID: s.UserID, InfoHash: s.InfoHash}
+}
+
+// SnatchStats is the amount actually transferred by a user for a torrent since the previous sync
+type SnatchStats struct {
+	Uploaded   uint64
+	Downloaded uint64
+}
@@ -2,8 +2,10 @@ package model
 
 import (
 	"database/sql/driver"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"github.com/leighmacdonald/mika/consts"
 	"strings"
 	"time"
 )
@@ -34,24 +36,74 @@ func (ph PeerHash) PeerID() PeerID {
 }
 
 // InfoHash is a unique 20byte identifier for a torrent
+//
+// BitTorrent v2 (BEP 52) torrents use a 32 byte SHA-256 info hash which is truncated to 20 bytes
+// when announcing to trackers, so the same type is used to store both versions.
 type InfoHash [20]byte
 
-// InfoHashFromString returns a binary infohash from the info string
+const (
+	infoHashV1Size = 20
+	infoHashV2Size = 32
+)
+
+// InfoHashFromString returns a binary infohash from the info string. The string may be either
+// the raw bytes of the hash or its base16 encoded form. v2 SHA-256 hashes are truncated to 20 bytes
+// as described in BEP 52.
 func InfoHashFromString(infoHash *InfoHash, s string) error {
-	//if len(s) != 40 {
-	//	return consts.ErrInvalidInfoHash
-	//}
-	copy(infoHash[:], s)
+	switch len(s) {
+	case infoHashV1Size, infoHashV2Size:
+		return infoHashFromBytes(infoHash, []byte(s))
+	case infoHashV1Size * 2, infoHashV2Size * 2:
+		return InfoHashFromHex(infoHash, s)
+	default:
+		return consts.ErrInvalidInfoHash
+	}
+}
+
+// InfoHashFromHex decodes a base16 encoded info hash string. This is either 40 characters for v1
+// hashes or 64 characters for v2 hashes, which are truncated.
+func InfoHashFromHex(infoHash *InfoHash, s string) error {
+	if len(s) != infoHashV1Size*2 && len(s) != infoHashV2Size*2 {
+		return consts.ErrInvalidInfoHash
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return consts.ErrInvalidInfoHash
+	}
+	return infoHashFromBytes(infoHash, b)
+}
+
+// infoHashFromBytes copies either a 20 byte v1 info hash or the first 20 bytes of a 32 byte v2
+// info hash
+func infoHashFromBytes(infoHash *InfoHash, b []byte) error {
+	if len(b) != infoHashV1Size && len(b) != infoHashV2Size {
+		return consts.ErrInvalidInfoHash
+	}
+	copy(infoHash[:], b[:infoHashV1Size])
 	return nil
 }
 
-// Value implements the database.Valuer interface
+// IsZero returns true when the info hash has not been set
+func (ih InfoHash) IsZero() bool {
+	return ih == InfoHash{}
+}
+
+// Value implements the database.Valuer interface. Unset hashes are stored as NULL so that
+// the optional v2 hash can have a unique constraint.
 func (ih *InfoHash) Value() (driver.Value, error) {
+	if ih.IsZero() {
+		return nil, nil
+	}
 	return ih.Bytes(), nil
 }
 
 // Scan implements the sql.Scanner interface for conversion to our custom type
 func (ih *InfoHash) Scan(v interface{}) error {
+	if v == nil {
+		// NULL optional v2 hash
+		*ih = InfoHash{}
+		return nil
+	}
 	// Should be more strictly to check this type.
 	vt, ok := v.([]byte)
 	if !ok {
@@ -82,8 +134,11 @@ func (ih *InfoHash) RawString() string {
 
 // Torrent is the core struct for our torrent being tracked
 type Torrent struct {
-	ReleaseName    string   `db:"release_name" redis:"release_name" json:"release_name"`
-	InfoHash       InfoHash `db:"info_hash" redis:"info_hash" json:"info_hash"`
+	ReleaseName string   `db:"release_name" redis:"release_name" json:"release_name"`
+	InfoHash    InfoHash `db:"info_hash" redis:"info_hash" json:"info_hash"`
+	// InfoHashV2 is the truncated BEP 52 v2 info hash for hybrid torrents. Announces using either
+	// hash are aliased to the same swarm which is always keyed by InfoHash.
+	InfoHashV2     InfoHash `db:"info_hash_v2" redis:"info_hash_v2" json:"info_hash_v2"`
 	TotalCompleted uint16   `db:"total_completed" redis:"total_completed" json:"total_completed"`
 	// This is stored as MB to reduce storage costs
 	TotalUploaded uint64 `db:"total_uploaded" redis:"total_uploaded" json:"total_uploaded"`
@@ -101,6 +156,10 @@ type Torrent struct {
 	// 0 denotes freeleech status
 	MultiDn   float64 `db:"multi_dn"  redis:"multi_dn" json:"multi_dn"`
 	Announces uint32  `db:"announces"`
+	// Tags such as categories used to scope promotions
+	Tags Tags `db:"tags" redis:"tags" json:"tags"`
+	// Size is the total size of the torrents files in bytes
+	Size uint64 `db:"size" redis:"size" json:"size"`
 }
 
 // TorrentStats is used to relay info stats for a torrent around. It contains rolled up stats
@@ -116,9 +175,17 @@ type TorrentStats struct {
 
 // UserStats is any info we want to batch update for a user
 type UserStats struct {
+	// Uploaded & Downloaded are the amounts credited to the user with the torrents multipliers applied
 	Uploaded   uint64
 	Downloaded uint64
-	Announces  uint32
+	// UploadedRaw & DownloadedRaw are the amounts transferred before any multipliers are applied
+	UploadedRaw   uint64
+	DownloadedRaw uint64
+	Announces     uint32
+	// BonusPoints is the change in bonus points, this can be negative for adjustments
+	BonusPoints float64
+	// LeechDenied is the number of announces rejected while downloading was disabled
+	LeechDenied uint32
 }
 
 // PeerStats is any info to batch peer updates
@@ -127,6 +194,12 @@ type PeerStats struct {
 	Downloaded   uint64
 	LastAnnounce time.Time
 	Announces    uint32
+	// SessionUploaded & SessionDownloaded are the latest counters reported by the client. These
+	// replace the stored values instead of being added to them.
+	SessionUploaded   uint64
+	SessionDownloaded uint64
+	// Left is the latest bytes left reported by the client
+	Left uint32
 }
 
 // NewTorrent allocates and returns a new Torrent instance pointer with all
@@ -149,12 +222,68 @@ type Torrents []Torrent
 // WhiteListClient defines a whitelisted bittorrent client allowed to participate
 // in swarms. This is not a foolproof solution as its fairly trivial for a motivated
 // attacker to fake this.
+//
+// ClientPrefix is the Azureus (qB) or Shadow (S) style client id. A leading dash is ignored
+// so -qB is also accepted. Peer ids which cannot be decoded fall back to matching
+// the raw peer id prefix.
 type WhiteListClient struct {
 	ClientPrefix string `db:"client_prefix" json:"client_prefix"`
 	ClientName   string `db:"client_name" json:"client_name"`
+	// MinVersion is the optional lowest version allowed, eg: 4.2.0
+	MinVersion string `db:"min_version" json:"min_version"`
+	// MaxVersion is the optional highest version allowed
+	MaxVersion string `db:"max_version" json:"max_version"`
+	// BannedVersions is an optional comma separated list of versions which are not allowed
+	BannedVersions string `db:"banned_versions" json:"banned_versions"`
 }
 
-// Match returns true if the client matches this prefix
-func (wl WhiteListClient) Match(client string) bool {
-	return strings.HasPrefix(client, wl.ClientPrefix)
+// Validate checks that all of the version values can be parsed
+func (wl WhiteListClient) Validate() error {
+	for _, v := range append([]string{wl.MinVersion, wl.MaxVersion}, wl.bannedVersions()...) {
+		if v == "" {
+			continue
+		}
+		if _, err := ParseVersion(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (wl WhiteListClient) bannedVersions() []string {
+	var versions []string
+	for _, v := range strings.Split(wl.BannedVersions, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
+
+// Match returns true if the decoded client id matches this entry. Versions are not checked.
+func (wl WhiteListClient) Match(client Client) bool {
+	return client.ID == strings.TrimPrefix(wl.ClientPrefix, "-")
+}
+
+// MatchPrefix returns true if the raw peer id starts with the client prefix. This is
+// used for peer ids which cannot be decoded.
+func (wl WhiteListClient) MatchPrefix(peerID PeerID) bool {
+	return wl.ClientPrefix != "" && strings.HasPrefix(peerID.RawString(), wl.ClientPrefix)
+}
+
+// VersionAllowed returns true if the client version is within the min/max version range
+// and is not one of the banned versions. Invalid version values are ignored.
+func (wl WhiteListClient) VersionAllowed(client Client) bool {
+	if min, err := ParseVersion(wl.MinVersion); err == nil && client.Version.Compare(min) < 0 {
+		return false
+	}
+	if max, err := ParseVersion(wl.MaxVersion); err == nil && client.Version.Compare(max) > 0 {
+		return false
+	}
+	for _, bannedStr := range wl.bannedVersions() {
+		if banned, err := ParseVersion(bannedStr); err == nil && client.Version.Compare(banned) == 0 {
+			return false
+		}
+	}
+	return true
 }
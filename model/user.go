@@ -8,9 +8,21 @@ type User struct {
 	Passkey         string `db:"passkey" json:"passkey"`
 	IsDeleted       bool   `db:"is_deleted" json:"is_deleted"`
 	DownloadEnabled bool   `db:"download_enabled" json:"download_enabled"`
-	Downloaded      uint64
-	Uploaded        uint64
-	Announces       uint32
+	// IsAdmin grants access to privileged tracker functionality such as full scrapes
+	IsAdmin bool `db:"is_admin" json:"is_admin"`
+	// Downloaded & Uploaded are the totals credited to the user after torrent multipliers are applied
+	Downloaded uint64
+	Uploaded   uint64
+	// DownloadedRaw & UploadedRaw are the totals actually transferred as reported by the users clients
+	DownloadedRaw uint64 `db:"downloaded_raw" json:"downloaded_raw"`
+	UploadedRaw   uint64 `db:"uploaded_raw" json:"uploaded_raw"`
+	Announces     uint32
+	// BonusPoints are earned by seeding and can be spent or adjusted by the site
+	BonusPoints float64 `db:"bonus_points" json:"bonus_points"`
+	// LeechDenied counts the announces rejected while downloading was disabled for the user
+	LeechDenied uint32 `db:"leech_denied" json:"leech_denied"`
+	// SlotLimits override the tracker wide peer slot limits for the user
+	SlotLimits
 }
 
 // Valid performs basic validation of the user info ensuring we have the minimum required
@@ -19,6 +31,27 @@ func (u User) Valid() bool {
 	return u.UserID > 0 && len(u.Passkey) == 20 && !u.IsDeleted
 }
 
+// ValidDigest performs the same validation as Valid for users read from a store which persists
+// the digest of each passkey rather than the passkey itself
+func (u User) ValidDigest() bool {
+	return u.UserID > 0 && IsPasskeyDigest(u.Passkey) && !u.IsDeleted
+}
+
+// Ratio returns the users ratio of credited upload to download. Users who have not downloaded
+// anything have a ratio of 0.
+func (u User) Ratio() float64 {
+	if u.Downloaded == 0 {
+		return 0
+	}
+	return float64(u.Uploaded) / float64(u.Downloaded)
+}
+
+// UserTorrentKey uniquely identifies a user and torrent pair, eg: a users hit and run record for a torrent
+type UserTorrentKey struct {
+	UserID   uint32
+	InfoHash InfoHash
+}
+
 // Users is a slice of known users
 type Users []User
 
@@ -11,7 +11,9 @@ import (
 type TorrentCache struct {
 	*sync.RWMutex
 	torrents map[model.InfoHash]model.Torrent
-	enabled  bool
+	// aliases maps v2 info hashes to the v1 info hash used as the torrents key
+	aliases map[model.InfoHash]model.InfoHash
+	enabled bool
 }
 
 // NewTorrentCache configures and returns a new instance of TorrentCache
@@ -19,6 +21,7 @@ func NewTorrentCache(enabled bool) *TorrentCache {
 	return &TorrentCache{
 		RWMutex:  &sync.RWMutex{},
 		torrents: make(map[model.InfoHash]model.Torrent),
+		aliases:  make(map[model.InfoHash]model.InfoHash),
 		enabled:  enabled,
 	}
 }
@@ -30,6 +33,9 @@ func (cache *TorrentCache) Add(t model.Torrent) {
 	}
 	cache.Lock()
 	cache.torrents[t.InfoHash] = t
+	if !t.InfoHashV2.IsZero() {
+		cache.aliases[t.InfoHashV2] = t.InfoHash
+	}
 	cache.Unlock()
 }
 
@@ -42,6 +48,9 @@ func (cache *TorrentCache) Delete(ih model.InfoHash, dropRow bool) {
 	cache.Lock()
 	defer cache.Unlock()
 	if dropRow {
+		if t, found := cache.torrents[ih]; found && !t.InfoHashV2.IsZero() {
+			delete(cache.aliases, t.InfoHashV2)
+		}
 		delete(cache.torrents, ih)
 	} else {
 		t, found := cache.torrents[ih]
@@ -53,13 +62,19 @@ func (cache *TorrentCache) Delete(ih model.InfoHash, dropRow bool) {
 	}
 }
 
-// Get returns the Torrent matching the infohash.
+// Get returns the Torrent matching the infohash. v2 info hashes are resolved to their
+// hybrid torrent.
 // consts.ErrInvalidInfoHash is returned on failed lookup
 func (cache *TorrentCache) Get(torrent *model.Torrent, hash model.InfoHash) error {
 	if !cache.enabled {
 		return consts.ErrInvalidInfoHash
 	}
+	cache.RLock()
+	if ih, found := cache.aliases[hash]; found {
+		hash = ih
+	}
 	t, found := cache.torrents[hash]
+	cache.RUnlock()
 	if !found {
 		return consts.ErrInvalidInfoHash
 	}
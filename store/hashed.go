@@ -0,0 +1,91 @@
+package store
+
+import (
+	"github.com/leighmacdonald/mika/model"
+)
+
+// PasskeyHasher is implemented by UserStores which persist a digest of each passkey rather than
+// the passkey itself
+type PasskeyHasher interface {
+	// HashPasskey returns the passkey in the form it is persisted by the store
+	HashPasskey(passkey string) string
+	// DigestStore returns the UserStore which takes passkeys in the form they are persisted. This
+	// must be used for passkeys read back from the store, which are already digests.
+	DigestStore() UserStore
+}
+
+// HashedUserStore wraps a UserStore so that only the keyed digests of passkeys are persisted. Leaking
+// the backing store does not reveal the passkeys used in announce URLs. Every passkey given to the
+// store is hashed, including those which look like a digest, so a leaked digest cannot be used in
+// place of the passkey. Users and passkeys read back from the store hold the digest.
+type HashedUserStore struct {
+	UserStore
+	secret []byte
+}
+
+// NewHashedUserStore returns the UserStore wrapped so passkeys are hashed with the secret provided
+func NewHashedUserStore(us UserStore, secret string) *HashedUserStore {
+	return &HashedUserStore{UserStore: us, secret: []byte(secret)}
+}
+
+// HashPasskey returns the digest of the passkey
+func (h *HashedUserStore) HashPasskey(passkey string) string {
+	return model.HashPasskey(h.secret, passkey)
+}
+
+// DigestStore returns the wrapped UserStore
+func (h *HashedUserStore) DigestStore() UserStore {
+	return h.UserStore
+}
+
+// Add will add a new user to the backing store
+func (h *HashedUserStore) Add(u model.User) error {
+	u.Passkey = h.HashPasskey(u.Passkey)
+	return h.UserStore.Add(u)
+}
+
+// GetByPasskey returns a user matching the passkey
+func (h *HashedUserStore) GetByPasskey(user *model.User, passkey string) error {
+	return h.UserStore.GetByPasskey(user, h.HashPasskey(passkey))
+}
+
+// SetPasskey replaces the primary passkey of the user
+func (h *HashedUserStore) SetPasskey(userID uint32, passkey string) error {
+	return h.UserStore.SetPasskey(userID, h.HashPasskey(passkey))
+}
+
+// PasskeyAdd inserts or replaces an additional passkey of a user
+func (h *HashedUserStore) PasskeyAdd(pk model.Passkey) error {
+	pk.Passkey = h.HashPasskey(pk.Passkey)
+	return h.UserStore.PasskeyAdd(pk)
+}
+
+// PasskeyGet returns the additional passkey matching the passkey provided
+func (h *HashedUserStore) PasskeyGet(pk *model.Passkey, passkey string) error {
+	return h.UserStore.PasskeyGet(pk, h.HashPasskey(passkey))
+}
+
+// PasskeyDelete removes an additional passkey
+func (h *HashedUserStore) PasskeyDelete(passkey string) error {
+	return h.UserStore.PasskeyDelete(h.HashPasskey(passkey))
+}
+
+// PasskeySync batch updates when and where existing additional passkeys were last used
+func (h *HashedUserStore) PasskeySync(b map[string]model.PasskeyUsage) error {
+	hashed := make(map[string]model.PasskeyUsage, len(b))
+	for passkey, usage := range b {
+		hashed[h.HashPasskey(passkey)] = usage
+	}
+	return h.UserStore.PasskeySync(hashed)
+}
+
+// Migrate replaces the plain passkeys of existing users with their digest. Passkeys which have
+// already been hashed are left unchanged so it is safe to run more than once.
+func (h *HashedUserStore) Migrate() (int, error) {
+	return h.UserStore.PasskeyMigrate(func(passkey string) string {
+		if model.IsPasskeyDigest(passkey) {
+			return passkey
+		}
+		return h.HashPasskey(passkey)
+	})
+}
@@ -94,6 +94,92 @@ func (ts TorrentStore) WhiteListGetAll() ([]model.WhiteListClient, error) {
 	return wl, nil
 }
 
+// PromotionAdd will insert a new promotion, replacing any existing promotion with the same name
+func (ts TorrentStore) PromotionAdd(promo model.Promotion) error {
+	resp, err := h.DoRequest(ts.client, "POST", fmt.Sprintf("%s/promotion", ts.baseURL), promo, nil)
+	if err != nil {
+		return err
+	}
+	return checkResponse(resp, http.StatusCreated)
+}
+
+// PromotionDelete removes a promotion
+func (ts TorrentStore) PromotionDelete(promo model.Promotion) error {
+	url := fmt.Sprintf("%s/promotion/%s", ts.baseURL, promo.Name)
+	resp, err := h.DoRequest(ts.client, "DELETE", url, nil, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return consts.ErrInvalidPromotion
+	}
+	return checkResponse(resp, http.StatusOK)
+}
+
+// PromotionGetAll fetches all known promotions
+func (ts TorrentStore) PromotionGetAll() ([]model.Promotion, error) {
+	resp, err := h.DoRequest(ts.client, "GET", fmt.Sprintf("%s/promotions", ts.baseURL), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var promos []model.Promotion
+	if err := json.Unmarshal(b, &promos); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal promotions")
+	}
+	return promos, nil
+}
+
+// BanAdd inserts the bans provided, replacing any existing bans with the same CIDR
+func (ts TorrentStore) BanAdd(bans []model.Ban) error {
+	resp, err := h.DoRequest(ts.client, "POST", fmt.Sprintf("%s/bans", ts.baseURL), bans, nil)
+	if err != nil {
+		return err
+	}
+	return checkResponse(resp, http.StatusCreated)
+}
+
+// BanDelete removes the ban matching the CIDR
+func (ts TorrentStore) BanDelete(cidr string) error {
+	url := fmt.Sprintf("%s/ban/%s", ts.baseURL, cidr)
+	resp, err := h.DoRequest(ts.client, "DELETE", url, nil, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return consts.ErrInvalidBan
+	}
+	return checkResponse(resp, http.StatusOK)
+}
+
+// BanGetAll fetches all known bans
+func (ts TorrentStore) BanGetAll() ([]model.Ban, error) {
+	resp, err := h.DoRequest(ts.client, "GET", fmt.Sprintf("%s/bans", ts.baseURL), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var bans []model.Ban
+	if err := json.Unmarshal(b, &bans); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal bans")
+	}
+	return bans, nil
+}
+
 func checkResponse(resp *http.Response, code int) error {
 	switch resp.StatusCode {
 	case code:
@@ -152,6 +238,28 @@ func (ts TorrentStore) Get(t *model.Torrent, hash model.InfoHash) error {
 	return json.Unmarshal(b, t)
 }
 
+// GetAll returns all the torrents known to the store which are not deleted
+func (ts TorrentStore) GetAll() (model.Torrents, error) {
+	url := fmt.Sprintf("%s/torrents", ts.baseURL)
+	resp, err := h.DoRequest(ts.client, "GET", url, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var torrents model.Torrents
+	if err := json.Unmarshal(b, &torrents); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal torrents")
+	}
+	return torrents, nil
+}
+
 // Close will close all the remaining http connections
 func (ts TorrentStore) Close() error {
 	ts.client.CloseIdleConnections()
@@ -188,6 +296,16 @@ func (ps PeerStore) Get(_ *model.Peer, _ model.InfoHash, _ model.PeerID) error {
 	panic("implement me")
 }
 
+// UpdateAddr will update the addresses, port and key of an existing peer in the swarm
+func (ps PeerStore) UpdateAddr(ih model.InfoHash, p model.Peer) error {
+	reqURL := fmt.Sprintf("%s/torrent/%s/peer/%s", ps.baseURL, ih.String(), p.PeerID.String())
+	resp, err := h.DoRequest(ps.client, "PATCH", reqURL, p, nil)
+	if err != nil {
+		return err
+	}
+	return checkResponse(resp, http.StatusOK)
+}
+
 // Delete will remove a user from a torrents swarm
 func (ps PeerStore) Delete(ih model.InfoHash, p model.PeerID) error {
 	reqURL := fmt.Sprintf(ps.baseURL, "/torrent/%s/peer/%s", ih, p)
@@ -226,6 +344,54 @@ func (ps PeerStore) GetN(ih model.InfoHash, limit int) (model.Swarm, error) {
 	return peers, nil
 }
 
+// GetByUser returns the active peers of the user across all swarms
+func (ps PeerStore) GetByUser(userID uint32) (model.Swarm, error) {
+	var peers model.Swarm
+	resp, err := h.DoRequest(ps.client, "GET", fmt.Sprintf("%s/user/%d/peers", ps.baseURL, userID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if err := json.Unmarshal(b, &peers); err != nil {
+		return nil, err
+	}
+	return peers, nil
+}
+
+// Counts returns the total number of seeders and leechers in a torrents active swarm
+func (ps PeerStore) Counts(ih model.InfoHash) (uint, uint, error) {
+	url := fmt.Sprintf("%s/torrent/%s/counts", ps.baseURL, ih.String())
+	resp, err := h.DoRequest(ps.client, "GET", url, nil, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return 0, 0, err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var counts struct {
+		Seeders  uint `json:"seeders"`
+		Leechers uint `json:"leechers"`
+	}
+	if err := json.Unmarshal(b, &counts); err != nil {
+		return 0, 0, errors.Wrap(err, "Failed to unmarshal peer counts")
+	}
+	return counts.Seeders, counts.Leechers, nil
+}
+
 // Close will close all the remaining http connections
 func (ps PeerStore) Close() error {
 	ps.client.CloseIdleConnections()
@@ -262,11 +428,406 @@ func (p peerDriver) NewPeerStore(cfg interface{}) (store.PeerStore, error) {
 type UserStore struct {
 	client  *http.Client
 	baseURL string
+	// hashed is true when the tracker sends the digest of passkeys rather than the passkeys, which
+	// happens when store_users_passkey_secret is set
+	hashed bool
 }
 
 // Sync batch updates the backing store with the new UserStats provided
-func (u *UserStore) Sync(_ map[string]model.UserStats) error {
-	panic("implement me")
+func (u *UserStore) Sync(b map[uint32]model.UserStats) error {
+	resp, err := h.DoRequest(u.client, "POST", fmt.Sprintf("%s/api/user/sync", u.baseURL), b, nil)
+	if err != nil {
+		return err
+	}
+	return checkResponse(resp, http.StatusOK)
+}
+
+// HNRSync inserts or replaces the hit and run records provided
+func (u *UserStore) HNRSync(records []model.HitAndRun) error {
+	resp, err := h.DoRequest(u.client, "POST", fmt.Sprintf("%s/api/hnr/sync", u.baseURL), records, nil)
+	if err != nil {
+		return err
+	}
+	return checkResponse(resp, http.StatusOK)
+}
+
+// hnrGet fetches the hit and run records from the path provided
+func (u *UserStore) hnrGet(path string) ([]model.HitAndRun, error) {
+	resp, err := h.DoRequest(u.client, "GET", path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var records []model.HitAndRun
+	if err := json.Unmarshal(b, &records); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal hit and runs")
+	}
+	return records, nil
+}
+
+// HNRGetByUser returns all the hit and run records for a user
+func (u *UserStore) HNRGetByUser(userID uint32) ([]model.HitAndRun, error) {
+	return u.hnrGet(fmt.Sprintf("%s/api/hnr/user/%d", u.baseURL, userID))
+}
+
+// HNRGetActive returns all the hit and run records which are pending or flagged
+func (u *UserStore) HNRGetActive() ([]model.HitAndRun, error) {
+	return u.hnrGet(fmt.Sprintf("%s/api/hnr/active", u.baseURL))
+}
+
+// HNRDelete removes the hit and run record for the user and torrent
+func (u *UserStore) HNRDelete(userID uint32, ih model.InfoHash) error {
+	url := fmt.Sprintf("%s/api/hnr/%d/%s", u.baseURL, userID, ih.String())
+	resp, err := h.DoRequest(u.client, "DELETE", url, nil, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return consts.ErrInvalidHNR
+	}
+	return checkResponse(resp, http.StatusOK)
+}
+
+// FreeleechAdd inserts or replaces the freeleech token for the user and torrent
+func (u *UserStore) FreeleechAdd(token model.FreeleechToken) error {
+	resp, err := h.DoRequest(u.client, "POST", fmt.Sprintf("%s/api/freeleech", u.baseURL), token, nil)
+	if err != nil {
+		return err
+	}
+	return checkResponse(resp, http.StatusOK)
+}
+
+// freeleechGet fetches the freeleech tokens from the path provided
+func (u *UserStore) freeleechGet(path string) ([]model.FreeleechToken, error) {
+	resp, err := h.DoRequest(u.client, "GET", path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var tokens []model.FreeleechToken
+	if err := json.Unmarshal(b, &tokens); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal freeleech tokens")
+	}
+	return tokens, nil
+}
+
+// FreeleechGetByUser returns all the freeleech tokens of a user
+func (u *UserStore) FreeleechGetByUser(userID uint32) ([]model.FreeleechToken, error) {
+	return u.freeleechGet(fmt.Sprintf("%s/api/freeleech/user/%d", u.baseURL, userID))
+}
+
+// FreeleechGetAll returns all the freeleech tokens
+func (u *UserStore) FreeleechGetAll() ([]model.FreeleechToken, error) {
+	return u.freeleechGet(fmt.Sprintf("%s/api/freeleech", u.baseURL))
+}
+
+// FreeleechDelete removes the freeleech token for the user and torrent
+func (u *UserStore) FreeleechDelete(userID uint32, ih model.InfoHash) error {
+	url := fmt.Sprintf("%s/api/freeleech/%d/%s", u.baseURL, userID, ih.String())
+	resp, err := h.DoRequest(u.client, "DELETE", url, nil, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return consts.ErrInvalidFreeleech
+	}
+	return checkResponse(resp, http.StatusOK)
+}
+
+// SnatchAdd inserts the snatches provided. Existing snatches for the same user and torrent are kept.
+func (u *UserStore) SnatchAdd(snatches []model.Snatch) error {
+	resp, err := h.DoRequest(u.client, "POST", fmt.Sprintf("%s/api/snatch", u.baseURL), snatches, nil)
+	if err != nil {
+		return err
+	}
+	return checkResponse(resp, http.StatusOK)
+}
+
+// snatchSyncRequest is the transfer totals of a snatch sent to the backing http api. Struct
+// keys cannot be used in JSON objects so a list of these is sent instead.
+type snatchSyncRequest struct {
+	UserID     uint32         `json:"user_id"`
+	InfoHash   model.InfoHash `json:"info_hash"`
+	Uploaded   uint64         `json:"uploaded"`
+	Downloaded uint64         `json:"downloaded"`
+}
+
+// SnatchSync batch updates the transfer totals of existing snatches with the new SnatchStats provided
+func (u *UserStore) SnatchSync(b map[model.UserTorrentKey]model.SnatchStats) error {
+	var req []snatchSyncRequest
+	for key, stats := range b {
+		req = append(req, snatchSyncRequest{
+			UserID:     key.UserID,
+			InfoHash:   key.InfoHash,
+			Uploaded:   stats.Uploaded,
+			Downloaded: stats.Downloaded,
+		})
+	}
+	resp, err := h.DoRequest(u.client, "POST", fmt.Sprintf("%s/api/snatch/sync", u.baseURL), req, nil)
+	if err != nil {
+		return err
+	}
+	return checkResponse(resp, http.StatusOK)
+}
+
+// snatchGet fetches the snatches from the path provided
+func (u *UserStore) snatchGet(path string) ([]model.Snatch, error) {
+	resp, err := h.DoRequest(u.client, "GET", path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var snatches []model.Snatch
+	if err := json.Unmarshal(b, &snatches); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal snatches")
+	}
+	return snatches, nil
+}
+
+// SnatchGetByUser returns up to limit snatches of a user starting from offset, newest first
+func (u *UserStore) SnatchGetByUser(userID uint32, offset int, limit int) ([]model.Snatch, error) {
+	return u.snatchGet(fmt.Sprintf("%s/api/snatch/user/%d?offset=%d&limit=%d", u.baseURL, userID, offset, limit))
+}
+
+// SnatchGetByTorrent returns up to limit snatches of a torrent starting from offset, newest first
+func (u *UserStore) SnatchGetByTorrent(ih model.InfoHash, offset int, limit int) ([]model.Snatch, error) {
+	return u.snatchGet(fmt.Sprintf("%s/api/snatch/torrent/%s?offset=%d&limit=%d", u.baseURL, ih.String(), offset, limit))
+}
+
+// downloadEnabledRequest is the payload used to enable or disable downloading for a user
+type downloadEnabledRequest struct {
+	DownloadEnabled bool `json:"download_enabled"`
+}
+
+// SetDownloadEnabled enables or disables downloading for the user
+func (u *UserStore) SetDownloadEnabled(userID uint32, enabled bool) error {
+	resp, err := h.DoRequest(u.client, "PATCH", fmt.Sprintf("%s/api/user/%d", u.baseURL, userID),
+		downloadEnabledRequest{DownloadEnabled: enabled}, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return consts.ErrInvalidUser
+	}
+	return checkResponse(resp, http.StatusOK)
+}
+
+// SetSlotLimits replaces the peer slot limits of the user
+func (u *UserStore) SetSlotLimits(userID uint32, limits model.SlotLimits) error {
+	resp, err := h.DoRequest(u.client, "PATCH", fmt.Sprintf("%s/api/user/%d", u.baseURL, userID), limits, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return consts.ErrInvalidUser
+	}
+	return checkResponse(resp, http.StatusOK)
+}
+
+// passkeyRequest is the payload used to replace the passkey of a user
+type passkeyRequest struct {
+	Passkey string `json:"passkey"`
+}
+
+// SetPasskey replaces the primary passkey of the user
+func (u *UserStore) SetPasskey(userID uint32, passkey string) error {
+	resp, err := h.DoRequest(u.client, "PATCH", fmt.Sprintf("%s/api/user/%d", u.baseURL, userID),
+		passkeyRequest{Passkey: passkey}, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return consts.ErrInvalidUser
+	}
+	return checkResponse(resp, http.StatusOK)
+}
+
+// PasskeyAdd inserts or replaces an additional passkey of a user
+func (u *UserStore) PasskeyAdd(pk model.Passkey) error {
+	resp, err := h.DoRequest(u.client, "POST", fmt.Sprintf("%s/api/passkey", u.baseURL), pk, nil)
+	if err != nil {
+		return err
+	}
+	return checkResponse(resp, http.StatusOK)
+}
+
+// PasskeyGet returns the additional passkey matching the passkey provided
+func (u *UserStore) PasskeyGet(pk *model.Passkey, passkey string) error {
+	resp, err := h.DoRequest(u.client, "GET", fmt.Sprintf("%s/api/passkey/pk/%s", u.baseURL, passkey), nil, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return consts.ErrInvalidPasskey
+	}
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if err := json.Unmarshal(b, pk); err != nil {
+		return errors.Wrap(err, "Failed to unmarshal passkey")
+	}
+	return nil
+}
+
+// PasskeyGetByUser returns the additional passkeys of a user, including those which have expired
+func (u *UserStore) PasskeyGetByUser(userID uint32) ([]model.Passkey, error) {
+	resp, err := h.DoRequest(u.client, "GET", fmt.Sprintf("%s/api/passkey/user/%d", u.baseURL, userID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var passkeys []model.Passkey
+	if err := json.Unmarshal(b, &passkeys); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal passkeys")
+	}
+	return passkeys, nil
+}
+
+// PasskeyDelete removes an additional passkey
+func (u *UserStore) PasskeyDelete(passkey string) error {
+	resp, err := h.DoRequest(u.client, "DELETE", fmt.Sprintf("%s/api/passkey/%s", u.baseURL, passkey), nil, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return consts.ErrInvalidPasskey
+	}
+	return checkResponse(resp, http.StatusOK)
+}
+
+// PasskeySync batch updates when and where existing additional passkeys were last used
+func (u *UserStore) PasskeySync(b map[string]model.PasskeyUsage) error {
+	resp, err := h.DoRequest(u.client, "POST", fmt.Sprintf("%s/api/passkey/sync", u.baseURL), b, nil)
+	if err != nil {
+		return err
+	}
+	return checkResponse(resp, http.StatusOK)
+}
+
+// PasskeyMigrate is not supported as the users are not accessible to the tracker. Existing passkeys
+// must be converted by the http store API itself using the same secret.
+func (u *UserStore) PasskeyMigrate(_ func(passkey string) string) (int, error) {
+	return 0, errors.New("Passkeys must be migrated by the http store API")
+}
+
+// RatioWatchAdd inserts or replaces the ratio watch record of the user
+func (u *UserStore) RatioWatchAdd(rw model.RatioWatch) error {
+	resp, err := h.DoRequest(u.client, "POST", fmt.Sprintf("%s/api/ratio_watch", u.baseURL), rw, nil)
+	if err != nil {
+		return err
+	}
+	return checkResponse(resp, http.StatusOK)
+}
+
+// RatioWatchGet returns the ratio watch record of the user
+func (u *UserStore) RatioWatchGet(rw *model.RatioWatch, userID uint32) error {
+	resp, err := h.DoRequest(u.client, "GET", fmt.Sprintf("%s/api/ratio_watch/%d", u.baseURL, userID), nil, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return consts.ErrInvalidRatioWatch
+	}
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if err := json.Unmarshal(b, rw); err != nil {
+		return errors.Wrap(err, "Failed to unmarshal ratio watch")
+	}
+	return nil
+}
+
+// RatioWatchGetActive returns all the ratio watch records which are warned or disabled
+func (u *UserStore) RatioWatchGetActive() ([]model.RatioWatch, error) {
+	resp, err := h.DoRequest(u.client, "GET", fmt.Sprintf("%s/api/ratio_watch/active", u.baseURL), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var records []model.RatioWatch
+	if err := json.Unmarshal(b, &records); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal ratio watches")
+	}
+	return records, nil
+}
+
+// LedgerAdjust applies the manual adjustment to the users stats and records it in the ledger
+func (u *UserStore) LedgerAdjust(entry model.LedgerEntry) error {
+	resp, err := h.DoRequest(u.client, "POST", fmt.Sprintf("%s/api/ledger/adjust", u.baseURL), entry, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return consts.ErrInvalidUser
+	}
+	return checkResponse(resp, http.StatusOK)
+}
+
+// LedgerGetByUser returns up to limit ledger entries of a user starting from offset, newest first
+func (u *UserStore) LedgerGetByUser(userID uint32, offset int, limit int) ([]model.LedgerEntry, error) {
+	url := fmt.Sprintf("%s/api/ledger/user/%d?offset=%d&limit=%d", u.baseURL, userID, offset, limit)
+	resp, err := h.DoRequest(u.client, "GET", url, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var entries []model.LedgerEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal ledger entries")
+	}
+	return entries, nil
 }
 
 // Add will add a new user to the backing store
@@ -279,7 +840,7 @@ func (u *UserStore) Add(_ model.User) error {
 // that could possibly help attackers gain any insight. All error cases MUST
 // return ErrUnauthorized.
 func (u *UserStore) GetByPasskey(usr *model.User, passkey string) error {
-	if len(passkey) != 20 {
+	if (u.hashed && !model.IsPasskeyDigest(passkey)) || (!u.hashed && len(passkey) != 20) {
 		return consts.ErrUnauthorized
 	}
 	path := fmt.Sprintf("%s/api/user/pk/%s", u.baseURL, passkey)
@@ -303,7 +864,7 @@ func (u *UserStore) GetByPasskey(usr *model.User, passkey string) error {
 		log.Warnf("Failed to decode user data from backing http api: %s", err.Error())
 		return consts.ErrUnauthorized
 	}
-	if !usr.Valid() {
+	if (u.hashed && !usr.ValidDigest()) || (!u.hashed && !usr.Valid()) {
 		log.Warnf("Received invalid user data from backing http api")
 		return consts.ErrUnauthorized
 	}
@@ -341,6 +902,7 @@ func (p userDriver) NewUserStore(cfg interface{}) (store.UserStore, error) {
 	return &UserStore{
 		client:  h.NewClient(c),
 		baseURL: c.Host,
+		hashed:  config.GetString(config.StoreUsersPasskeySecret) != "",
 	}, nil
 }
 
@@ -73,16 +73,72 @@ func AddUserDriver(name string, driver UserDriver) {
 type UserStore interface {
 	// Add will add a new user to the backing store
 	Add(u model.User) error
-	// GetByPasskey returns a user matching the passkey
+	// GetByPasskey returns a user matching the passkey. Additional passkeys of the user which have
+	// not expired must also resolve to the user.
 	GetByPasskey(user *model.User, passkey string) error
 	// GetByID returns a user matching the userId
 	GetByID(user *model.User, userID uint32) error
 	// Delete removes a user from the backing store
 	Delete(user model.User) error
+	// SetDownloadEnabled enables or disables downloading for the user. Seeding is not affected.
+	SetDownloadEnabled(userID uint32, enabled bool) error
+	// SetSlotLimits replaces the peer slot limits of the user overriding the tracker wide limits
+	SetSlotLimits(userID uint32, limits model.SlotLimits) error
+	// SetPasskey replaces the primary passkey of the user
+	SetPasskey(userID uint32, passkey string) error
+	// PasskeyAdd inserts or replaces an additional passkey of a user
+	PasskeyAdd(pk model.Passkey) error
+	// PasskeyGet returns the additional passkey matching the passkey provided
+	PasskeyGet(pk *model.Passkey, passkey string) error
+	// PasskeyGetByUser returns the additional passkeys of a user, including those which have expired
+	PasskeyGetByUser(userID uint32) ([]model.Passkey, error)
+	// PasskeyDelete removes an additional passkey
+	PasskeyDelete(passkey string) error
+	// PasskeySync batch updates when and where existing additional passkeys were last used
+	PasskeySync(b map[string]model.PasskeyUsage) error
+	// PasskeyMigrate replaces every stored passkey, including additional passkeys, with the value
+	// returned by hash. The number of passkeys which were changed is returned.
+	PasskeyMigrate(hash func(passkey string) string) (int, error)
 	// Close will cleanup and close the underlying storage driver if necessary
 	Close() error
-	// Sync batch updates the backing store with the new UserStats provided
-	Sync(b map[string]model.UserStats) error
+	// Sync batch updates the backing store with the new UserStats provided, keyed by user id. The
+	// credited stats of each user are recorded in the ledger along with the update.
+	Sync(b map[uint32]model.UserStats) error
+	// LedgerAdjust applies the manual adjustment to the users stats and records it in the ledger. Both
+	// must be applied atomically so adjustments cannot race with Sync.
+	LedgerAdjust(entry model.LedgerEntry) error
+	// LedgerGetByUser returns up to limit ledger entries of a user starting from offset, newest first
+	LedgerGetByUser(userID uint32, offset int, limit int) ([]model.LedgerEntry, error)
+	// HNRSync inserts or replaces the hit and run records provided
+	HNRSync(records []model.HitAndRun) error
+	// HNRGetByUser returns all the hit and run records for a user
+	HNRGetByUser(userID uint32) ([]model.HitAndRun, error)
+	// HNRGetActive returns all the hit and run records which are pending or flagged
+	HNRGetActive() ([]model.HitAndRun, error)
+	// HNRDelete removes the hit and run record for the user and torrent
+	HNRDelete(userID uint32, ih model.InfoHash) error
+	// SnatchAdd inserts the snatches provided. Existing snatches for the same user and torrent are kept.
+	SnatchAdd(snatches []model.Snatch) error
+	// SnatchSync batch updates the transfer totals of existing snatches with the new SnatchStats provided
+	SnatchSync(b map[model.UserTorrentKey]model.SnatchStats) error
+	// SnatchGetByUser returns up to limit snatches of a user starting from offset, newest first
+	SnatchGetByUser(userID uint32, offset int, limit int) ([]model.Snatch, error)
+	// SnatchGetByTorrent returns up to limit snatches of a torrent starting from offset, newest first
+	SnatchGetByTorrent(ih model.InfoHash, offset int, limit int) ([]model.Snatch, error)
+	// FreeleechAdd inserts or replaces the freeleech token for the user and torrent
+	FreeleechAdd(token model.FreeleechToken) error
+	// FreeleechGetByUser returns all the freeleech tokens of a user
+	FreeleechGetByUser(userID uint32) ([]model.FreeleechToken, error)
+	// FreeleechGetAll returns all the freeleech tokens
+	FreeleechGetAll() ([]model.FreeleechToken, error)
+	// FreeleechDelete removes the freeleech token for the user and torrent
+	FreeleechDelete(userID uint32, ih model.InfoHash) error
+	// RatioWatchAdd inserts or replaces the ratio watch record of the user
+	RatioWatchAdd(rw model.RatioWatch) error
+	// RatioWatchGet returns the ratio watch record of the user
+	RatioWatchGet(rw *model.RatioWatch, userID uint32) error
+	// RatioWatchGetActive returns all the ratio watch records which are warned or disabled
+	RatioWatchGetActive() ([]model.RatioWatch, error)
 }
 
 // TorrentStore defines where we can store permanent torrent data
@@ -95,6 +151,8 @@ type TorrentStore interface {
 	Delete(ih model.InfoHash, dropRow bool) error
 	// Get returns the Torrent matching the infohash
 	Get(torrent *model.Torrent, hash model.InfoHash) error
+	// GetAll returns all the torrents known to the store which are not deleted
+	GetAll() (model.Torrents, error)
 	// Close will cleanup and close the underlying storage driver if necessary
 	Close() error
 	// WhiteListDelete removes a client from the global whitelist
@@ -103,6 +161,19 @@ type TorrentStore interface {
 	WhiteListAdd(client model.WhiteListClient) error
 	// WhiteListGetAll fetches all known whitelisted clients
 	WhiteListGetAll() ([]model.WhiteListClient, error)
+	// PromotionAdd will insert a new promotion, replacing any existing promotion with the same name
+	PromotionAdd(promo model.Promotion) error
+	// PromotionDelete removes a promotion
+	PromotionDelete(promo model.Promotion) error
+	// PromotionGetAll fetches all known promotions, including any expired promotions which
+	// have not been removed yet
+	PromotionGetAll() ([]model.Promotion, error)
+	// BanAdd inserts the bans provided, replacing any existing bans with the same CIDR
+	BanAdd(bans []model.Ban) error
+	// BanDelete removes the ban matching the CIDR
+	BanDelete(cidr string) error
+	// BanGetAll fetches all known bans, including any expired bans which have not been removed yet
+	BanGetAll() ([]model.Ban, error)
 	// Sync batch updates the backing store with the new TorrentStats provided
 	Sync(b map[model.InfoHash]model.TorrentStats) error
 	// Conn returns the underlying connection, if any
@@ -121,6 +192,13 @@ type PeerStore interface {
 	GetN(ih model.InfoHash, limit int) (model.Swarm, error)
 	// Get will fetch the peer from the swarm if it exists
 	Get(peer *model.Peer, ih model.InfoHash, id model.PeerID) error
+	// GetByUser returns the active peers of the user across all swarms. This is used on announce
+	// so must not need to scan every swarm.
+	GetByUser(userID uint32) (model.Swarm, error)
+	// UpdateAddr will update the addresses, port and key of an existing peer in the swarm
+	UpdateAddr(ih model.InfoHash, p model.Peer) error
+	// Counts returns the total number of seeders and leechers in a torrents active swarm
+	Counts(ih model.InfoHash) (seeders uint, leechers uint, err error)
 	// Close will cleanup and close the underlying storage driver if necessary
 	Close() error
 	// Reap will loop through the peers removing any stale entries from active swarms
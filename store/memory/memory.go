@@ -5,7 +5,9 @@ import (
 	"github.com/leighmacdonald/mika/model"
 	"github.com/leighmacdonald/mika/store"
 	"github.com/leighmacdonald/mika/util"
+	"math"
 	"sync"
+	"time"
 )
 
 const (
@@ -15,15 +17,22 @@ const (
 // TorrentStore is the memory backed store.TorrentStore implementation
 type TorrentStore struct {
 	sync.RWMutex
-	torrents  map[model.InfoHash]model.Torrent
-	whitelist []model.WhiteListClient
+	torrents map[model.InfoHash]model.Torrent
+	// aliases maps v2 info hashes to the v1 info hash used as the torrents key
+	aliases    map[model.InfoHash]model.InfoHash
+	whitelist  []model.WhiteListClient
+	promotions []model.Promotion
+	bans       map[string]model.Ban
 }
 
 func NewTorrentStore() *TorrentStore {
 	return &TorrentStore{
-		RWMutex:   sync.RWMutex{},
-		torrents:  map[model.InfoHash]model.Torrent{},
-		whitelist: []model.WhiteListClient{},
+		RWMutex:    sync.RWMutex{},
+		torrents:   map[model.InfoHash]model.Torrent{},
+		aliases:    map[model.InfoHash]model.InfoHash{},
+		whitelist:  []model.WhiteListClient{},
+		promotions: []model.Promotion{},
+		bans:       map[string]model.Ban{},
 	}
 }
 
@@ -81,17 +90,90 @@ func (ts *TorrentStore) WhiteListGetAll() ([]model.WhiteListClient, error) {
 	return wl, nil
 }
 
+// PromotionAdd will insert a new promotion, replacing any existing promotion with the same name
+func (ts *TorrentStore) PromotionAdd(promo model.Promotion) error {
+	ts.Lock()
+	defer ts.Unlock()
+	for i, p := range ts.promotions {
+		if p.Name == promo.Name {
+			ts.promotions[i] = promo
+			return nil
+		}
+	}
+	ts.promotions = append(ts.promotions, promo)
+	return nil
+}
+
+// PromotionDelete removes a promotion
+func (ts *TorrentStore) PromotionDelete(promo model.Promotion) error {
+	ts.Lock()
+	defer ts.Unlock()
+	for i := len(ts.promotions) - 1; i >= 0; i-- {
+		if ts.promotions[i].Name == promo.Name {
+			ts.promotions = append(ts.promotions[:i], ts.promotions[i+1:]...)
+			return nil
+		}
+	}
+	return consts.ErrInvalidPromotion
+}
+
+// PromotionGetAll fetches all known promotions
+func (ts *TorrentStore) PromotionGetAll() ([]model.Promotion, error) {
+	ts.RLock()
+	promos := make([]model.Promotion, len(ts.promotions))
+	copy(promos, ts.promotions)
+	ts.RUnlock()
+	return promos, nil
+}
+
+// BanAdd inserts the bans provided, replacing any existing bans with the same CIDR
+func (ts *TorrentStore) BanAdd(bans []model.Ban) error {
+	ts.Lock()
+	for _, b := range bans {
+		ts.bans[b.CIDR] = b
+	}
+	ts.Unlock()
+	return nil
+}
+
+// BanDelete removes the ban matching the CIDR
+func (ts *TorrentStore) BanDelete(cidr string) error {
+	ts.Lock()
+	defer ts.Unlock()
+	if _, found := ts.bans[cidr]; !found {
+		return consts.ErrInvalidBan
+	}
+	delete(ts.bans, cidr)
+	return nil
+}
+
+// BanGetAll fetches all known bans
+func (ts *TorrentStore) BanGetAll() ([]model.Ban, error) {
+	ts.RLock()
+	bans := make([]model.Ban, 0, len(ts.bans))
+	for _, b := range ts.bans {
+		bans = append(bans, b)
+	}
+	ts.RUnlock()
+	return bans, nil
+}
+
 // Close will delete/free all the underlying torrent data
 func (ts *TorrentStore) Close() error {
 	ts.Lock()
 	defer ts.Unlock()
 	ts.torrents = make(map[model.InfoHash]model.Torrent)
+	ts.aliases = make(map[model.InfoHash]model.InfoHash)
 	return nil
 }
 
-// Get returns the Torrent matching the infohash
+// Get returns the Torrent matching the infohash. v2 info hashes are resolved to their
+// hybrid torrent.
 func (ts *TorrentStore) Get(torrent *model.Torrent, hash model.InfoHash) error {
 	ts.RLock()
+	if ih, found := ts.aliases[hash]; found {
+		hash = ih
+	}
 	t, found := ts.torrents[hash]
 	ts.RUnlock()
 	if !found || t.IsDeleted {
@@ -101,20 +183,54 @@ func (ts *TorrentStore) Get(torrent *model.Torrent, hash model.InfoHash) error {
 	return nil
 }
 
+// GetAll returns all the torrents known to the store which are not deleted
+func (ts *TorrentStore) GetAll() (model.Torrents, error) {
+	ts.RLock()
+	defer ts.RUnlock()
+	var torrents model.Torrents
+	for _, t := range ts.torrents {
+		if t.IsDeleted {
+			continue
+		}
+		torrents = append(torrents, t)
+	}
+	return torrents, nil
+}
+
 // PeerStore is a memory backed store.PeerStore implementation
 // TODO shard peer storage?
 type PeerStore struct {
 	sync.RWMutex
 	peers map[model.InfoHash]model.Swarm
+	// users indexes the peers of each user
+	users map[uint32]map[model.PeerHash]bool
 }
 
 func NewPeerStore() *PeerStore {
 	return &PeerStore{
 		RWMutex: sync.RWMutex{},
 		peers:   map[model.InfoHash]model.Swarm{},
+		users:   map[uint32]map[model.PeerHash]bool{},
 	}
 }
 
+// remove deletes the peer from the swarm and the user index. The caller must hold the lock.
+func (ps *PeerStore) remove(ih model.InfoHash, peerID model.PeerID) {
+	for _, peer := range ps.peers[ih] {
+		if peer.PeerID != peerID {
+			continue
+		}
+		if userPeers, found := ps.users[peer.UserID]; found {
+			delete(userPeers, model.NewPeerHash(ih, peerID))
+			if len(userPeers) == 0 {
+				delete(ps.users, peer.UserID)
+			}
+		}
+		break
+	}
+	ps.peers[ih] = ps.peers[ih].Remove(peerID)
+}
+
 // Sync batch updates the backing store with the new PeerStats provided
 func (ps *PeerStore) Sync(b map[model.PeerHash]model.PeerStats) error {
 	ps.Lock()
@@ -129,6 +245,9 @@ func (ps *PeerStore) Sync(b map[model.PeerHash]model.PeerStats) error {
 				peer.Downloaded += stats.Downloaded
 				peer.Announces += stats.Announces
 				peer.AnnounceLast = stats.LastAnnounce
+				peer.SessionUploaded = stats.SessionUploaded
+				peer.SessionDownloaded = stats.SessionDownloaded
+				peer.Left = stats.Left
 				ps.peers[ih][idx] = peer
 				break
 			}
@@ -141,12 +260,16 @@ func (ps *PeerStore) Sync(b map[model.PeerHash]model.PeerStats) error {
 func (ps *PeerStore) Reap() {
 	ps.Lock()
 	defer ps.Unlock()
-	for _, swarm := range ps.peers {
+	for ih, swarm := range ps.peers {
+		var expired []model.PeerID
 		for _, peer := range swarm {
 			if peer.Expired() {
-				swarm.Remove(peer.PeerID)
+				expired = append(expired, peer.PeerID)
 			}
 		}
+		for _, peerID := range expired {
+			ps.remove(ih, peerID)
+		}
 	}
 }
 
@@ -163,11 +286,20 @@ func (ps *PeerStore) Get(p *model.Peer, ih model.InfoHash, peerID model.PeerID)
 	return consts.ErrInvalidPeerID
 }
 
+// Counts returns the total number of seeders and leechers in a torrents active swarm
+func (ps *PeerStore) Counts(ih model.InfoHash) (uint, uint, error) {
+	ps.RLock()
+	seeders, leechers := ps.peers[ih].Counts()
+	ps.RUnlock()
+	return seeders, leechers, nil
+}
+
 // Close flushes allocated memory
 // TODO flush mem
 func (ps *PeerStore) Close() error {
 	ps.Lock()
 	ps.peers = make(map[model.InfoHash]model.Swarm)
+	ps.users = make(map[uint32]map[model.PeerHash]bool)
 	ps.Unlock()
 	return nil
 }
@@ -176,7 +308,12 @@ func (ps *PeerStore) Close() error {
 func (ps *PeerStore) Add(ih model.InfoHash, p model.Peer) error {
 	ps.Lock()
 	defer ps.Unlock()
+	p.InfoHash = ih
 	ps.peers[ih] = append(ps.peers[ih], p)
+	if _, found := ps.users[p.UserID]; !found {
+		ps.users[p.UserID] = make(map[model.PeerHash]bool)
+	}
+	ps.users[p.UserID][model.NewPeerHash(ih, p.PeerID)] = true
 	return nil
 }
 
@@ -186,14 +323,48 @@ func (ps *PeerStore) Update(_ model.InfoHash, _ model.Peer) error {
 	return nil
 }
 
+// UpdateAddr will update the addresses, port and key of an existing peer in the swarm
+func (ps *PeerStore) UpdateAddr(ih model.InfoHash, p model.Peer) error {
+	ps.Lock()
+	defer ps.Unlock()
+	for idx, peer := range ps.peers[ih] {
+		if peer.PeerID == p.PeerID {
+			peer.IP = p.IP
+			peer.IPv6 = p.IPv6
+			peer.Port = p.Port
+			peer.Key = p.Key
+			ps.peers[ih][idx] = peer
+			return nil
+		}
+	}
+	return consts.ErrInvalidPeerID
+}
+
 // Delete will remove a user from a torrents swarm
 func (ps *PeerStore) Delete(ih model.InfoHash, p model.PeerID) error {
 	ps.Lock()
-	ps.peers[ih].Remove(p)
+	ps.remove(ih, p)
 	ps.Unlock()
 	return nil
 }
 
+// GetByUser returns the active peers of the user across all swarms
+func (ps *PeerStore) GetByUser(userID uint32) (model.Swarm, error) {
+	ps.RLock()
+	defer ps.RUnlock()
+	var peers model.Swarm
+	for ph := range ps.users[userID] {
+		pid := ph.PeerID()
+		for _, peer := range ps.peers[ph.InfoHash()] {
+			if peer.PeerID == pid {
+				peers = append(peers, peer)
+				break
+			}
+		}
+	}
+	return peers, nil
+}
+
 // GetN will fetch peers for a torrents active swarm up to N users
 func (ps *PeerStore) GetN(ih model.InfoHash, limit int) (model.Swarm, error) {
 	ps.RLock()
@@ -207,15 +378,18 @@ func (ps *PeerStore) GetN(ih model.InfoHash, limit int) (model.Swarm, error) {
 
 // Add adds a new torrent to the memory store
 func (ts *TorrentStore) Add(t model.Torrent) error {
-	ts.RLock()
-	_, found := ts.torrents[t.InfoHash]
-	ts.RUnlock()
-	if found {
+	ts.Lock()
+	defer ts.Unlock()
+	if _, found := ts.torrents[t.InfoHash]; found {
 		return consts.ErrDuplicate
 	}
-	ts.Lock()
+	if !t.InfoHashV2.IsZero() {
+		if _, found := ts.aliases[t.InfoHashV2]; found {
+			return consts.ErrDuplicate
+		}
+		ts.aliases[t.InfoHashV2] = t.InfoHash
+	}
 	ts.torrents[t.InfoHash] = t
-	ts.Unlock()
 	return nil
 }
 
@@ -223,6 +397,9 @@ func (ts *TorrentStore) Add(t model.Torrent) error {
 // NOTE the memory store always permanently deletes the torrent
 func (ts *TorrentStore) Delete(ih model.InfoHash, _ bool) error {
 	ts.Lock()
+	if t, found := ts.torrents[ih]; found && !t.InfoHashV2.IsZero() {
+		delete(ts.aliases, t.InfoHashV2)
+	}
 	delete(ts.torrents, ih)
 	ts.Unlock()
 	return nil
@@ -245,22 +422,227 @@ func (pd peerDriver) NewPeerStore(_ interface{}) (store.PeerStore, error) {
 // UserStore is the memory backed store.UserStore implementation
 type UserStore struct {
 	sync.RWMutex
-	users map[string]model.User
+	users map[uint32]model.User
+	// userIDs maps the primary passkey of each user to their user id
+	userIDs map[string]uint32
+	// passkeys are the additional passkeys of the users
+	passkeys map[string]model.Passkey
+	hnr      map[model.UserTorrentKey]model.HitAndRun
+	// snatches are the snatches and the order they were added in
+	snatches    map[model.UserTorrentKey]model.Snatch
+	snatchOrder []model.UserTorrentKey
+	freeleech   map[model.UserTorrentKey]model.FreeleechToken
+	// ledger holds the ledger entries in the order they were added
+	ledger     []model.LedgerEntry
+	ratioWatch map[uint32]model.RatioWatch
 }
 
 func NewUserStore() *UserStore {
 	return &UserStore{
-		RWMutex: sync.RWMutex{},
-		users:   map[string]model.User{},
+		RWMutex:    sync.RWMutex{},
+		users:      map[uint32]model.User{},
+		userIDs:    map[string]uint32{},
+		passkeys:   map[string]model.Passkey{},
+		hnr:        map[model.UserTorrentKey]model.HitAndRun{},
+		snatches:   map[model.UserTorrentKey]model.Snatch{},
+		freeleech:  map[model.UserTorrentKey]model.FreeleechToken{},
+		ratioWatch: map[uint32]model.RatioWatch{},
+	}
+}
+
+// SnatchAdd inserts the snatches provided. Existing snatches for the same user and torrent are kept.
+func (u *UserStore) SnatchAdd(snatches []model.Snatch) error {
+	u.Lock()
+	defer u.Unlock()
+	for _, s := range snatches {
+		if _, found := u.snatches[s.Key()]; found {
+			continue
+		}
+		u.snatches[s.Key()] = s
+		u.snatchOrder = append(u.snatchOrder, s.Key())
+	}
+	return nil
+}
+
+// SnatchSync batch updates the transfer totals of existing snatches with the new SnatchStats provided
+func (u *UserStore) SnatchSync(b map[model.UserTorrentKey]model.SnatchStats) error {
+	u.Lock()
+	defer u.Unlock()
+	for key, stats := range b {
+		s, found := u.snatches[key]
+		if !found {
+			continue
+		}
+		s.Uploaded += stats.Uploaded
+		s.Downloaded += stats.Downloaded
+		u.snatches[key] = s
+	}
+	return nil
+}
+
+// snatchFind returns up to limit snatches matching the filter starting from offset, newest first
+func (u *UserStore) snatchFind(match func(key model.UserTorrentKey) bool, offset int, limit int) []model.Snatch {
+	u.RLock()
+	defer u.RUnlock()
+	var snatches []model.Snatch
+	for i := len(u.snatchOrder) - 1; i >= 0 && len(snatches) < limit; i-- {
+		if !match(u.snatchOrder[i]) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		snatches = append(snatches, u.snatches[u.snatchOrder[i]])
+	}
+	return snatches
+}
+
+// SnatchGetByUser returns up to limit snatches of a user starting from offset, newest first
+func (u *UserStore) SnatchGetByUser(userID uint32, offset int, limit int) ([]model.Snatch, error) {
+	return u.snatchFind(func(key model.UserTorrentKey) bool {
+		return key.UserID == userID
+	}, offset, limit), nil
+}
+
+// SnatchGetByTorrent returns up to limit snatches of a torrent starting from offset, newest first
+func (u *UserStore) SnatchGetByTorrent(ih model.InfoHash, offset int, limit int) ([]model.Snatch, error) {
+	return u.snatchFind(func(key model.UserTorrentKey) bool {
+		return key.InfoHash == ih
+	}, offset, limit), nil
+}
+
+// HNRSync inserts or replaces the hit and run records provided
+func (u *UserStore) HNRSync(records []model.HitAndRun) error {
+	u.Lock()
+	defer u.Unlock()
+	for _, h := range records {
+		u.hnr[h.Key()] = h
+	}
+	return nil
+}
+
+// HNRGetByUser returns all the hit and run records for a user
+func (u *UserStore) HNRGetByUser(userID uint32) ([]model.HitAndRun, error) {
+	u.RLock()
+	defer u.RUnlock()
+	var records []model.HitAndRun
+	for _, h := range u.hnr {
+		if h.UserID == userID {
+			records = append(records, h)
+		}
+	}
+	return records, nil
+}
+
+// HNRGetActive returns all the hit and run records which are pending or flagged
+func (u *UserStore) HNRGetActive() ([]model.HitAndRun, error) {
+	u.RLock()
+	defer u.RUnlock()
+	var records []model.HitAndRun
+	for _, h := range u.hnr {
+		if h.Status != model.HNRSatisfied {
+			records = append(records, h)
+		}
+	}
+	return records, nil
+}
+
+// HNRDelete removes the hit and run record for the user and torrent
+func (u *UserStore) HNRDelete(userID uint32, ih model.InfoHash) error {
+	u.Lock()
+	defer u.Unlock()
+	key := model.UserTorrentKey{UserID: userID, InfoHash: ih}
+	if _, found := u.hnr[key]; !found {
+		return consts.ErrInvalidHNR
+	}
+	delete(u.hnr, key)
+	return nil
+}
+
+// FreeleechAdd inserts or replaces the freeleech token for the user and torrent
+func (u *UserStore) FreeleechAdd(token model.FreeleechToken) error {
+	u.Lock()
+	defer u.Unlock()
+	u.freeleech[token.Key()] = token
+	return nil
+}
+
+// FreeleechGetByUser returns all the freeleech tokens of a user
+func (u *UserStore) FreeleechGetByUser(userID uint32) ([]model.FreeleechToken, error) {
+	u.RLock()
+	defer u.RUnlock()
+	var tokens []model.FreeleechToken
+	for _, f := range u.freeleech {
+		if f.UserID == userID {
+			tokens = append(tokens, f)
+		}
 	}
+	return tokens, nil
+}
+
+// FreeleechGetAll returns all the freeleech tokens
+func (u *UserStore) FreeleechGetAll() ([]model.FreeleechToken, error) {
+	u.RLock()
+	defer u.RUnlock()
+	var tokens []model.FreeleechToken
+	for _, f := range u.freeleech {
+		tokens = append(tokens, f)
+	}
+	return tokens, nil
+}
+
+// FreeleechDelete removes the freeleech token for the user and torrent
+func (u *UserStore) FreeleechDelete(userID uint32, ih model.InfoHash) error {
+	u.Lock()
+	defer u.Unlock()
+	key := model.UserTorrentKey{UserID: userID, InfoHash: ih}
+	if _, found := u.freeleech[key]; !found {
+		return consts.ErrInvalidFreeleech
+	}
+	delete(u.freeleech, key)
+	return nil
+}
+
+// RatioWatchAdd inserts or replaces the ratio watch record of the user
+func (u *UserStore) RatioWatchAdd(rw model.RatioWatch) error {
+	u.Lock()
+	defer u.Unlock()
+	u.ratioWatch[rw.UserID] = rw
+	return nil
+}
+
+// RatioWatchGet returns the ratio watch record of the user
+func (u *UserStore) RatioWatchGet(rw *model.RatioWatch, userID uint32) error {
+	u.RLock()
+	defer u.RUnlock()
+	r, found := u.ratioWatch[userID]
+	if !found {
+		return consts.ErrInvalidRatioWatch
+	}
+	*rw = r
+	return nil
+}
+
+// RatioWatchGetActive returns all the ratio watch records which are warned or disabled
+func (u *UserStore) RatioWatchGetActive() ([]model.RatioWatch, error) {
+	u.RLock()
+	defer u.RUnlock()
+	var records []model.RatioWatch
+	for _, rw := range u.ratioWatch {
+		if rw.Active() {
+			records = append(records, rw)
+		}
+	}
+	return records, nil
 }
 
 // Sync batch updates the backing store with the new UserStats provided
-func (u *UserStore) Sync(b map[string]model.UserStats) error {
+func (u *UserStore) Sync(b map[uint32]model.UserStats) error {
 	u.Lock()
 	defer u.Unlock()
-	for passkey, stats := range b {
-		user, found := u.users[passkey]
+	for userID, stats := range b {
+		user, found := u.users[userID]
 		if !found {
 			// Deleted user
 			continue
@@ -268,15 +650,74 @@ func (u *UserStore) Sync(b map[string]model.UserStats) error {
 		user.Announces += stats.Announces
 		user.Downloaded += stats.Downloaded
 		user.Uploaded += stats.Uploaded
-		u.users[passkey] = user
+		user.DownloadedRaw += stats.DownloadedRaw
+		user.UploadedRaw += stats.UploadedRaw
+		user.BonusPoints += stats.BonusPoints
+		user.LeechDenied += stats.LeechDenied
+		u.users[userID] = user
+		if entry := model.NewSyncLedgerEntry(user.UserID, stats, time.Now()); !entry.Empty() {
+			u.ledgerAppend(entry)
+		}
+	}
+	return nil
+}
+
+// applyDelta adds the signed change to the total without going below zero
+func applyDelta(total uint64, delta int64) uint64 {
+	if delta < 0 && uint64(-delta) > total {
+		return 0
+	}
+	return uint64(int64(total) + delta)
+}
+
+// ledgerAppend assigns the next id to the entry and adds it to the ledger. The caller must hold the lock.
+func (u *UserStore) ledgerAppend(entry model.LedgerEntry) {
+	entry.LedgerID = uint64(len(u.ledger) + 1)
+	u.ledger = append(u.ledger, entry)
+}
+
+// LedgerAdjust applies the manual adjustment to the users stats and records it in the ledger
+func (u *UserStore) LedgerAdjust(entry model.LedgerEntry) error {
+	u.Lock()
+	defer u.Unlock()
+	user, found := u.users[entry.UserID]
+	if !found {
+		return consts.ErrInvalidUser
 	}
+	user.Uploaded = applyDelta(user.Uploaded, entry.Uploaded)
+	user.Downloaded = applyDelta(user.Downloaded, entry.Downloaded)
+	user.BonusPoints += entry.BonusPoints
+	u.users[entry.UserID] = user
+	u.ledgerAppend(entry)
 	return nil
 }
 
+// LedgerGetByUser returns up to limit ledger entries of a user starting from offset, newest first
+func (u *UserStore) LedgerGetByUser(userID uint32, offset int, limit int) ([]model.LedgerEntry, error) {
+	u.RLock()
+	defer u.RUnlock()
+	var entries []model.LedgerEntry
+	for i := len(u.ledger) - 1; i >= 0 && len(entries) < limit; i-- {
+		if u.ledger[i].UserID != userID {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		entries = append(entries, u.ledger[i])
+	}
+	return entries, nil
+}
+
 // Add will add a new user to the backing store
 func (u *UserStore) Add(usr model.User) error {
 	u.Lock()
-	u.users[usr.Passkey] = usr
+	if existing, found := u.users[usr.UserID]; found {
+		delete(u.userIDs, existing.Passkey)
+	}
+	u.users[usr.UserID] = usr
+	u.userIDs[usr.Passkey] = usr.UserID
 	u.Unlock()
 	return nil
 }
@@ -287,8 +728,16 @@ func (u *UserStore) Add(usr model.User) error {
 // return ErrUnauthorized.
 func (u *UserStore) GetByPasskey(usr *model.User, passkey string) error {
 	u.RLock()
-	user, found := u.users[passkey]
-	u.RUnlock()
+	defer u.RUnlock()
+	userID, found := u.userIDs[passkey]
+	if !found {
+		pk, pkFound := u.passkeys[passkey]
+		if !pkFound || pk.Expired(time.Now()) {
+			return consts.ErrUnauthorized
+		}
+		userID = pk.UserID
+	}
+	user, found := u.users[userID]
 	if !found {
 		return consts.ErrUnauthorized
 	}
@@ -300,28 +749,175 @@ func (u *UserStore) GetByPasskey(usr *model.User, passkey string) error {
 func (u *UserStore) GetByID(user *model.User, userID uint32) error {
 	u.RLock()
 	defer u.RUnlock()
-	for _, usr := range u.users {
-		if usr.UserID == userID {
-			*user = usr
-			return nil
-		}
+	usr, found := u.users[userID]
+	if !found {
+		return consts.ErrUnauthorized
 	}
-	return consts.ErrUnauthorized
+	*user = usr
+	return nil
 }
 
 // Delete removes a user from the backing store
 func (u *UserStore) Delete(user model.User) error {
 	u.Lock()
-	delete(u.users, user.Passkey)
+	if userID, found := u.userIDs[user.Passkey]; found {
+		delete(u.users, userID)
+		delete(u.userIDs, user.Passkey)
+		for passkey, pk := range u.passkeys {
+			if pk.UserID == userID {
+				delete(u.passkeys, passkey)
+			}
+		}
+	}
+	u.Unlock()
+	return nil
+}
+
+// SetDownloadEnabled enables or disables downloading for the user
+func (u *UserStore) SetDownloadEnabled(userID uint32, enabled bool) error {
+	u.Lock()
+	defer u.Unlock()
+	usr, found := u.users[userID]
+	if !found {
+		return consts.ErrInvalidUser
+	}
+	usr.DownloadEnabled = enabled
+	u.users[userID] = usr
+	return nil
+}
+
+// SetSlotLimits replaces the peer slot limits of the user
+func (u *UserStore) SetSlotLimits(userID uint32, limits model.SlotLimits) error {
+	u.Lock()
+	defer u.Unlock()
+	usr, found := u.users[userID]
+	if !found {
+		return consts.ErrInvalidUser
+	}
+	usr.SlotLimits = limits
+	u.users[userID] = usr
+	return nil
+}
+
+// SetPasskey replaces the primary passkey of the user
+func (u *UserStore) SetPasskey(userID uint32, passkey string) error {
+	u.Lock()
+	defer u.Unlock()
+	usr, found := u.users[userID]
+	if !found {
+		return consts.ErrInvalidUser
+	}
+	delete(u.userIDs, usr.Passkey)
+	usr.Passkey = passkey
+	u.users[userID] = usr
+	u.userIDs[passkey] = userID
+	return nil
+}
+
+// PasskeyAdd inserts or replaces an additional passkey of a user
+func (u *UserStore) PasskeyAdd(pk model.Passkey) error {
+	u.Lock()
+	u.passkeys[pk.Passkey] = pk
 	u.Unlock()
 	return nil
 }
 
+// PasskeyGet returns the additional passkey matching the passkey provided
+func (u *UserStore) PasskeyGet(pk *model.Passkey, passkey string) error {
+	u.RLock()
+	defer u.RUnlock()
+	p, found := u.passkeys[passkey]
+	if !found {
+		return consts.ErrInvalidPasskey
+	}
+	*pk = p
+	return nil
+}
+
+// PasskeyGetByUser returns the additional passkeys of a user, including those which have expired
+func (u *UserStore) PasskeyGetByUser(userID uint32) ([]model.Passkey, error) {
+	u.RLock()
+	defer u.RUnlock()
+	var passkeys []model.Passkey
+	for _, pk := range u.passkeys {
+		if pk.UserID == userID {
+			passkeys = append(passkeys, pk)
+		}
+	}
+	return passkeys, nil
+}
+
+// PasskeyDelete removes an additional passkey
+func (u *UserStore) PasskeyDelete(passkey string) error {
+	u.Lock()
+	defer u.Unlock()
+	if _, found := u.passkeys[passkey]; !found {
+		return consts.ErrInvalidPasskey
+	}
+	delete(u.passkeys, passkey)
+	return nil
+}
+
+// PasskeySync batch updates when and where existing additional passkeys were last used
+func (u *UserStore) PasskeySync(b map[string]model.PasskeyUsage) error {
+	u.Lock()
+	defer u.Unlock()
+	for passkey, usage := range b {
+		pk, found := u.passkeys[passkey]
+		if !found {
+			// Revoked passkey
+			continue
+		}
+		pk.TimeLastUsed = usage.TimeLastUsed
+		pk.IP = usage.IP
+		u.passkeys[passkey] = pk
+	}
+	return nil
+}
+
+// PasskeyMigrate replaces every stored passkey, including additional passkeys, with the value
+// returned by hash. The number of passkeys which were changed is returned.
+func (u *UserStore) PasskeyMigrate(hash func(passkey string) string) (int, error) {
+	u.Lock()
+	defer u.Unlock()
+	changed := 0
+	userIDs := make(map[string]uint32, len(u.userIDs))
+	for userID, usr := range u.users {
+		passkey := hash(usr.Passkey)
+		if passkey != usr.Passkey {
+			usr.Passkey = passkey
+			u.users[userID] = usr
+			changed++
+		}
+		userIDs[passkey] = userID
+	}
+	u.userIDs = userIDs
+	passkeys := make(map[string]model.Passkey, len(u.passkeys))
+	for _, pk := range u.passkeys {
+		passkey := hash(pk.Passkey)
+		if passkey != pk.Passkey {
+			pk.Passkey = passkey
+			changed++
+		}
+		passkeys[passkey] = pk
+	}
+	u.passkeys = passkeys
+	return changed, nil
+}
+
 // Close will delete/free the underlying memory store
 func (u *UserStore) Close() error {
 	u.Lock()
 	defer u.Unlock()
-	u.users = make(map[string]model.User)
+	u.users = make(map[uint32]model.User)
+	u.userIDs = make(map[string]uint32)
+	u.passkeys = make(map[string]model.Passkey)
+	u.hnr = make(map[model.UserTorrentKey]model.HitAndRun)
+	u.snatches = make(map[model.UserTorrentKey]model.Snatch)
+	u.snatchOrder = nil
+	u.freeleech = make(map[model.UserTorrentKey]model.FreeleechToken)
+	u.ledger = nil
+	u.ratioWatch = make(map[uint32]model.RatioWatch)
 	return nil
 }
 
@@ -332,8 +928,80 @@ func (pd userDriver) NewUserStore(_ interface{}) (store.UserStore, error) {
 	return NewUserStore(), nil
 }
 
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	period  time.Duration
+}
+
+// RateLimiter is the memory backed store.RateLimiter implementation. Limits are only
+// enforced for the local tracker instance.
+type RateLimiter struct {
+	sync.Mutex
+	buckets   map[string]*bucket
+	lastPurge time.Time
+}
+
+// NewRateLimiter returns a new, empty, memory backed RateLimiter
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		Mutex:     sync.Mutex{},
+		buckets:   map[string]*bucket{},
+		lastPurge: time.Now(),
+	}
+}
+
+// Allow consumes a token from the bucket for the key, returning false if the bucket is empty
+func (rl *RateLimiter) Allow(key string, rate store.Rate) (bool, error) {
+	if !rate.Enabled() {
+		return true, nil
+	}
+	now := time.Now()
+	rl.Lock()
+	defer rl.Unlock()
+	b, found := rl.buckets[key]
+	if !found {
+		b = &bucket{tokens: float64(rate.Count), updated: now}
+		rl.buckets[key] = b
+	}
+	b.period = rate.Period
+	refill := now.Sub(b.updated).Seconds() * float64(rate.Count) / rate.Period.Seconds()
+	b.tokens = math.Min(float64(rate.Count), b.tokens+refill)
+	b.updated = now
+	// Buckets idle for a full period are full again so they can be dropped
+	if now.Sub(rl.lastPurge) > time.Minute {
+		for k, v := range rl.buckets {
+			if now.Sub(v.updated) > v.period {
+				delete(rl.buckets, k)
+			}
+		}
+		rl.lastPurge = now
+	}
+	if b.tokens < 1 {
+		return false, nil
+	}
+	b.tokens--
+	return true, nil
+}
+
+// Close will delete/free all the underlying bucket data
+func (rl *RateLimiter) Close() error {
+	rl.Lock()
+	rl.buckets = map[string]*bucket{}
+	rl.Unlock()
+	return nil
+}
+
+type rateLimitDriver struct{}
+
+// NewRateLimiter creates a new memory backed rate limiter.
+func (rd rateLimitDriver) NewRateLimiter(_ interface{}) (store.RateLimiter, error) {
+	return NewRateLimiter(), nil
+}
+
 func init() {
 	store.AddUserDriver(driverName, userDriver{})
 	store.AddPeerDriver(driverName, peerDriver{})
 	store.AddTorrentDriver(driverName, torrentDriver{})
+	store.AddRateLimitDriver(driverName, rateLimitDriver{})
 }
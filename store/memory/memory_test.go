@@ -16,3 +16,11 @@ func TestMemoryPeerStore(t *testing.T) {
 func TestMemoryUserStore(t *testing.T) {
 	store.TestUserStore(t, NewUserStore())
 }
+
+func TestMemoryHashedUserStore(t *testing.T) {
+	store.TestHashedUserStore(t, NewUserStore())
+}
+
+func TestMemoryRateLimiter(t *testing.T) {
+	store.TestRateLimiter(t, NewRateLimiter())
+}
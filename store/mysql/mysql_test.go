@@ -31,6 +31,19 @@ func TestUserDriver(t *testing.T) {
 	})
 }
 
+func TestHashedUserDriver(t *testing.T) {
+	db := sqlx.MustConnect(driverName, config.GetStoreConfig(config.Users).DSN())
+	setupDB(t, db)
+	// Databases created before passkeys could be hashed are widened by the migration
+	db.MustExec(`alter table users modify passkey varchar(20) not null;`)
+	db.MustExec(`alter table passkey modify passkey varchar(20) not null;`)
+	store.TestHashedUserStore(t, &UserStore{
+		db:      db,
+		users:   map[string]model.User{},
+		usersMx: sync.RWMutex{},
+	})
+}
+
 func TestPeerStore(t *testing.T) {
 	db := sqlx.MustConnect(driverName, config.GetStoreConfig(config.Peers).DSN())
 	setupDB(t, db)
@@ -40,7 +53,7 @@ func TestPeerStore(t *testing.T) {
 }
 
 func clearDB(db *sqlx.DB) {
-	for _, table := range []string{"peers", "torrent", "users", "whitelist"} {
+	for _, table := range []string{"peers", "torrent", "users", "whitelist", "promotion", "hnr", "snatch", "freeleech", "ledger", "ratio_watch", "ban", "passkey"} {
 		if _, err := db.Exec(fmt.Sprintf(`drop table if exists %s cascade;`, table)); err != nil {
 			log.Panicf("Failed to prep database: %s", err.Error())
 		}
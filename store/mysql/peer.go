@@ -9,6 +9,7 @@ import (
 	"github.com/leighmacdonald/mika/store"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"net"
 )
 
 // PeerStore is the mysql backed implementation of store.PeerStore
@@ -25,6 +26,9 @@ func (ps *PeerStore) Sync(b map[model.PeerHash]model.PeerStats) error {
 			total_announces = (total_announces + ?),
 		    total_downloaded = (total_downloaded + ?),
 		    total_uploaded = (total_uploaded + ?),
+		    session_downloaded = ?,
+		    session_uploaded = ?,
+		    total_left = ?,
 		    announce_last = ?
 		WHERE
 			info_hash = ? AND peer_id = ?
@@ -44,6 +48,9 @@ func (ps *PeerStore) Sync(b map[model.PeerHash]model.PeerStats) error {
 			stats.Announces,
 			stats.Downloaded,
 			stats.Uploaded,
+			stats.SessionDownloaded,
+			stats.SessionUploaded,
+			stats.Left,
 			stats.LastAnnounce,
 			ih.Bytes(),
 			pid.Bytes())
@@ -84,19 +91,43 @@ func (ps *PeerStore) Close() error {
 func (ps *PeerStore) Add(ih model.InfoHash, p model.Peer) error {
 	const q = `
 	INSERT INTO peers 
-	    (peer_id, info_hash, addr_ip, addr_port, location, user_id, announce_first, announce_last)
+	    (peer_id, info_hash, addr_ip, addr_ipv6, addr_port, peer_key, passkey_label, location, user_id, announce_first, 
+	     announce_last, session_downloaded, session_uploaded, total_left)
 	VALUES 
-	    (?, ?, INET_ATON(?), ?, ST_PointFromText(?), ?, ?, ?)
+	    (?, ?, INET_ATON(?), INET6_ATON(?), ?, ?, ?, ST_PointFromText(?), ?, ?, ?, ?, ?, ?)
 	`
 	point := fmt.Sprintf("POINT(%s)", p.Location.String())
-	_, err := ps.db.Exec(q, p.PeerID.Bytes(), ih.Bytes(), p.IP.String(), p.Port, point, p.UserID,
-		p.AnnounceFirst, p.AnnounceLast)
+	_, err := ps.db.Exec(q, p.PeerID.Bytes(), ih.Bytes(), nullIP(p.IP), nullIP(p.IPv6), p.Port, p.Key, p.PasskeyLabel,
+		point, p.UserID, p.AnnounceFirst, p.AnnounceLast, p.SessionDownloaded, p.SessionUploaded, p.Left)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// nullIP returns the string form of the ip, or nil so that it is stored as a NULL value
+func nullIP(ip net.IP) interface{} {
+	if ip == nil {
+		return nil
+	}
+	return ip.String()
+}
+
+// UpdateAddr will update the addresses, port and key of an existing peer in the swarm
+func (ps *PeerStore) UpdateAddr(ih model.InfoHash, p model.Peer) error {
+	const q = `
+		UPDATE 
+			peers 
+		SET 
+			addr_ip = INET_ATON(?), addr_ipv6 = INET6_ATON(?), addr_port = ?, peer_key = ? 
+		WHERE 
+			info_hash = ? AND peer_id = ?`
+	if _, err := ps.db.Exec(q, nullIP(p.IP), nullIP(p.IPv6), p.Port, p.Key, ih.Bytes(), p.PeerID.Bytes()); err != nil {
+		return errors.Wrap(err, "Failed to update peer address")
+	}
+	return nil
+}
+
 // Delete will remove a peer from the swarm of the torrent provided
 func (ps *PeerStore) Delete(ih model.InfoHash, p model.PeerID) error {
 	const q = `DELETE FROM peers WHERE info_hash = ? AND peer_id = ?`
@@ -108,8 +139,9 @@ func (ps *PeerStore) Delete(ih model.InfoHash, p model.PeerID) error {
 func (ps *PeerStore) Get(peer *model.Peer, ih model.InfoHash, peerID model.PeerID) error {
 	const q = `
 		SELECT 
-		    peer_id, info_hash, user_id, INET_NTOA(addr_ip) as addr_ip, addr_port, 
-		    total_downloaded, total_uploaded, total_left, total_time, total_announces, 
+		    peer_id, info_hash, user_id, INET_NTOA(addr_ip) as addr_ip, INET6_NTOA(addr_ipv6) as addr_ipv6, addr_port, peer_key, 
+		    passkey_label, total_downloaded, total_uploaded, total_left, total_time, total_announces, 
+		    session_downloaded, session_uploaded, 
 		    speed_up, speed_dn, speed_up_max, speed_dn_max, ST_AsText(location) as location, 
 		    announce_last, announce_first 
 		FROM peers WHERE info_hash = ? AND peer_id = ? LIMIT 1`
@@ -120,12 +152,30 @@ func (ps *PeerStore) Get(peer *model.Peer, ih model.InfoHash, peerID model.PeerI
 	return nil
 }
 
+// Counts returns the total number of seeders and leechers in a torrents active swarm
+func (ps *PeerStore) Counts(ih model.InfoHash) (uint, uint, error) {
+	const q = `
+		SELECT 
+			COALESCE(SUM(total_left = 0), 0) AS seeders, 
+			COALESCE(SUM(total_left > 0), 0) AS leechers 
+		FROM 
+		    peers 
+		WHERE 
+		    info_hash = ?`
+	var seeders, leechers uint
+	if err := ps.db.QueryRow(q, ih.Bytes()).Scan(&seeders, &leechers); err != nil {
+		return 0, 0, errors.Wrap(err, "Failed to query peer counts")
+	}
+	return seeders, leechers, nil
+}
+
 // GetN will fetch the torrents swarm member peers
 func (ps *PeerStore) GetN(ih model.InfoHash, limit int) (model.Swarm, error) {
 	const q = `
 		SELECT 
-			peer_id, info_hash, user_id, INET_NTOA(addr_ip) as addr_ip, addr_port, 
-		    total_downloaded, total_uploaded, total_left, total_time, total_announces, 
+			peer_id, info_hash, user_id, INET_NTOA(addr_ip) as addr_ip, INET6_NTOA(addr_ipv6) as addr_ipv6, addr_port, peer_key, 
+		    passkey_label, total_downloaded, total_uploaded, total_left, total_time, total_announces, 
+		    session_downloaded, session_uploaded, 
 		    speed_up, speed_dn, speed_up_max, speed_dn_max,  ST_AsText(location) as location, 
 		    announce_last, announce_first 
 		FROM 
@@ -141,6 +191,26 @@ func (ps *PeerStore) GetN(ih model.InfoHash, limit int) (model.Swarm, error) {
 	return peers, nil
 }
 
+// GetByUser returns the active peers of the user across all swarms
+func (ps *PeerStore) GetByUser(userID uint32) (model.Swarm, error) {
+	const q = `
+		SELECT 
+			peer_id, info_hash, user_id, INET_NTOA(addr_ip) as addr_ip, INET6_NTOA(addr_ipv6) as addr_ipv6, addr_port, peer_key, 
+		    passkey_label, total_downloaded, total_uploaded, total_left, total_time, total_announces, 
+		    session_downloaded, session_uploaded, 
+		    speed_up, speed_dn, speed_up_max, speed_dn_max,  ST_AsText(location) as location, 
+		    announce_last, announce_first 
+		FROM 
+		    peers 
+		WHERE 
+		    user_id = ?`
+	var peers model.Swarm
+	if err := ps.db.Select(&peers, q, userID); err != nil {
+		return nil, errors.Wrap(err, "Failed to select user peers")
+	}
+	return peers, nil
+}
+
 type peerDriver struct{}
 
 // NewPeerStore returns a mysql backed store.PeerStore driver
@@ -4,6 +4,7 @@ const schema = `
 create table torrent
 (
     info_hash binary(20) not null,
+    info_hash_v2 binary(20) null,
     release_name varchar(255) not null,
     total_uploaded int unsigned default 0 not null,
     total_downloaded int unsigned default 0 not null,
@@ -13,7 +14,10 @@ create table torrent
     reason varchar(255) default '' not null,
     multi_up decimal(5,2) default 1.00 not null,
     multi_dn decimal(5,2) default 1.00 not null,
+    tags varchar(255) default '' not null,
+    size bigint unsigned default 0 not null,
     constraint pk_torrent  primary key (info_hash),
+    constraint uq_info_hash_v2  unique (info_hash_v2),
     constraint uq_release_name  unique (release_name)
 );
 
@@ -22,12 +26,20 @@ create table users
 (
 	user_id int unsigned auto_increment
 		primary key,
-	passkey varchar(20) not null,
+	passkey varchar(64) not null,
 	download_enabled tinyint(1) default 1 not null,
 	is_deleted tinyint(1) default 0 not null,
+	is_admin tinyint(1) default 0 not null,
 	downloaded bigint default 0 not null,
 	uploaded bigint default 0 not null,
+	downloaded_raw bigint default 0 not null,
+	uploaded_raw bigint default 0 not null,
 	announces int default 0 not null,
+	bonus_points double default 0 not null,
+	leech_denied int unsigned default 0 not null,
+	slots_leech int default 0 not null,
+	slots_seed int default 0 not null,
+	slots_torrent int default 0 not null,
 	constraint user_passkey_uindex unique (passkey)
 );
 
@@ -36,11 +48,16 @@ create table peers
 	peer_id binary(20) not null,
 	info_hash binary(20) not null,
 	user_id int unsigned not null,
-	addr_ip int unsigned not null,
+	addr_ip int unsigned null,
+	addr_ipv6 varbinary(16) null,
 	addr_port smallint unsigned not null,
-	total_downloaded int unsigned default 0 not null,
-	total_uploaded int unsigned default 0 not null,
+	peer_key varchar(64) default '' not null,
+	passkey_label varchar(64) default '' not null,
+	total_downloaded bigint unsigned default 0 not null,
+	total_uploaded bigint unsigned default 0 not null,
 	total_left int unsigned default 0 not null,
+	session_downloaded bigint unsigned default 0 not null,
+	session_uploaded bigint unsigned default 0 not null,
 	total_time int unsigned default 0 not null,
 	total_announces int unsigned default 0 not null,
 	speed_up int unsigned default 0 not null,
@@ -50,13 +67,115 @@ create table peers
 	announce_first datetime not null,
 	announce_last datetime not null,
 	location point not null,
-	constraint peers_pk primary key (info_hash, peer_id)
+	constraint peers_pk primary key (info_hash, peer_id),
+	index idx_peers_user (user_id)
 );
 
 
 create table whitelist
 (
 	client_prefix varchar(10) not null primary key,
-	client_name varchar(20) not null
+	client_name varchar(20) not null,
+	min_version varchar(20) default '' not null,
+	max_version varchar(20) default '' not null,
+	banned_versions varchar(255) default '' not null
+);
+
+create table promotion
+(
+	name varchar(64) not null primary key,
+	scope varchar(10) not null,
+	tag varchar(64) default '' not null,
+	info_hashes text not null,
+	multi_up decimal(5,2) default 1.00 not null,
+	multi_dn decimal(5,2) default 1.00 not null,
+	time_start datetime not null,
+	time_end datetime not null
+);
+
+create table ban
+(
+	cidr varchar(43) not null primary key,
+	reason varchar(255) not null,
+	time_created datetime not null,
+	time_expire datetime null
+);
+
+create table hnr
+(
+	user_id int unsigned not null,
+	info_hash binary(20) not null,
+	status varchar(10) not null,
+	seed_time int unsigned default 0 not null,
+	time_completed datetime not null,
+	time_last_seed datetime not null,
+	constraint pk_hnr primary key (user_id, info_hash)
+);
+
+create table snatch
+(
+	user_id int unsigned not null,
+	info_hash binary(20) not null,
+	time_completed datetime not null,
+	addr_ip varbinary(16) null,
+	client varchar(64) default '' not null,
+	uploaded bigint unsigned default 0 not null,
+	downloaded bigint unsigned default 0 not null,
+	constraint pk_snatch primary key (user_id, info_hash),
+	index idx_snatch_info_hash (info_hash, time_completed),
+	index idx_snatch_user (user_id, time_completed)
+);
+
+create table freeleech
+(
+	user_id int unsigned not null,
+	info_hash binary(20) not null,
+	time_created datetime not null,
+	time_expire datetime not null,
+	constraint pk_freeleech primary key (user_id, info_hash)
+);
+
+create table ledger
+(
+	ledger_id bigint unsigned auto_increment primary key,
+	user_id int unsigned not null,
+	source varchar(16) not null,
+	uploaded bigint default 0 not null,
+	downloaded bigint default 0 not null,
+	bonus_points double default 0 not null,
+	reason varchar(255) default '' not null,
+	actor varchar(64) default '' not null,
+	time_created datetime not null,
+	index idx_ledger_user (user_id, ledger_id)
+);
+
+create table ratio_watch
+(
+	user_id int unsigned not null primary key,
+	status varchar(10) not null,
+	required_ratio double not null,
+	ratio double not null,
+	time_warned datetime not null,
+	time_deadline datetime not null,
+	time_updated datetime not null
+);
+
+create table passkey
+(
+	passkey varchar(64) not null primary key,
+	user_id int unsigned not null,
+	label varchar(64) default '' not null,
+	time_created datetime not null,
+	time_expire datetime null,
+	time_last_used datetime null,
+	addr_ip varbinary(16) null,
+	index idx_passkey_user (user_id)
 );
 `
+
+// passkeyDigestMigration widens the passkey columns of databases created before passkeys could be
+// stored as digests. It is applied by PasskeyMigrate before any digests are written.
+var passkeyDigestMigration = []string{
+	`alter table users modify passkey varchar(64) not null;`,
+	`alter table passkey modify passkey varchar(64) not null;`,
+}
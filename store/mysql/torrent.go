@@ -4,6 +4,7 @@
 package mysql
 
 import (
+	"database/sql"
 	// imported for side-effects
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
@@ -13,6 +14,7 @@ import (
 	"github.com/leighmacdonald/mika/store"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"time"
 )
 
 const (
@@ -82,7 +84,11 @@ func (s *TorrentStore) WhiteListDelete(client model.WhiteListClient) error {
 
 // WhiteListAdd will insert a new client prefix into the allowed clients list
 func (s *TorrentStore) WhiteListAdd(client model.WhiteListClient) error {
-	const q = `INSERT INTO whitelist (client_prefix, client_name) VALUES (:client_prefix, :client_name)`
+	const q = `
+		INSERT INTO whitelist 
+		    (client_prefix, client_name, min_version, max_version, banned_versions) 
+		VALUES 
+		    (:client_prefix, :client_name, :min_version, :max_version, :banned_versions)`
 	if _, err := s.db.NamedExec(q, client); err != nil {
 		return errors.Wrap(err, "Failed to insert new whitelist entry")
 	}
@@ -99,19 +105,145 @@ func (s *TorrentStore) WhiteListGetAll() ([]model.WhiteListClient, error) {
 	return wl, nil
 }
 
+// PromotionAdd will insert a new promotion, replacing any existing promotion with the same name
+func (s *TorrentStore) PromotionAdd(promo model.Promotion) error {
+	const q = `
+		INSERT INTO promotion 
+		    (name, scope, tag, info_hashes, multi_up, multi_dn, time_start, time_end) 
+		VALUES 
+		    (:name, :scope, :tag, :info_hashes, :multi_up, :multi_dn, :time_start, :time_end)
+		ON DUPLICATE KEY UPDATE 
+		    scope = VALUES(scope), tag = VALUES(tag), info_hashes = VALUES(info_hashes), 
+		    multi_up = VALUES(multi_up), multi_dn = VALUES(multi_dn), 
+		    time_start = VALUES(time_start), time_end = VALUES(time_end)`
+	if _, err := s.db.NamedExec(q, promo); err != nil {
+		return errors.Wrap(err, "Failed to insert new promotion")
+	}
+	return nil
+}
+
+// PromotionDelete removes a promotion
+func (s *TorrentStore) PromotionDelete(promo model.Promotion) error {
+	const q = `DELETE FROM promotion WHERE name = ?`
+	res, err := s.db.Exec(q, promo.Name)
+	if err != nil {
+		return errors.Wrap(err, "Failed to delete promotion")
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Failed to read deleted promotion count")
+	}
+	if rows != 1 {
+		return consts.ErrInvalidPromotion
+	}
+	return nil
+}
+
+// PromotionGetAll fetches all known promotions
+func (s *TorrentStore) PromotionGetAll() ([]model.Promotion, error) {
+	var promos []model.Promotion
+	const q = `SELECT * FROM promotion`
+	if err := s.db.Select(&promos, q); err != nil {
+		return nil, errors.Wrap(err, "Failed to select promotions")
+	}
+	return promos, nil
+}
+
+// BanAdd inserts the bans provided, replacing any existing bans with the same CIDR
+func (s *TorrentStore) BanAdd(bans []model.Ban) error {
+	const q = `
+		INSERT INTO ban 
+		    (cidr, reason, time_created, time_expire) 
+		VALUES 
+		    (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE 
+		    reason = VALUES(reason), time_created = VALUES(time_created), time_expire = VALUES(time_expire)`
+	tx, err := s.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "Failed to begin ban BanAdd() tx")
+	}
+	stmt, err := tx.Prepare(q)
+	if err != nil {
+		return errors.Wrap(err, "Failed to prepare ban BanAdd() tx")
+	}
+	for _, b := range bans {
+		if _, err := stmt.Exec(b.CIDR, b.Reason, b.TimeCreated, nullTime(b.TimeExpire)); err != nil {
+			if err := tx.Rollback(); err != nil {
+				log.Errorf("Failed to roll back ban BanAdd() tx")
+			}
+			return errors.Wrap(err, "Failed to exec ban BanAdd() tx")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "Failed to commit ban BanAdd() tx")
+	}
+	return nil
+}
+
+// BanDelete removes the ban matching the CIDR
+func (s *TorrentStore) BanDelete(cidr string) error {
+	const q = `DELETE FROM ban WHERE cidr = ?`
+	res, err := s.db.Exec(q, cidr)
+	if err != nil {
+		return errors.Wrap(err, "Failed to delete ban")
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Failed to read deleted ban count")
+	}
+	if rows != 1 {
+		return consts.ErrInvalidBan
+	}
+	return nil
+}
+
+// BanGetAll fetches all known bans
+func (s *TorrentStore) BanGetAll() ([]model.Ban, error) {
+	var bans []model.Ban
+	const q = `SELECT cidr, reason, time_created, time_expire FROM ban`
+	rows, err := s.db.Query(q)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to select bans")
+	}
+	for rows.Next() {
+		var b model.Ban
+		var expire sql.NullTime
+		if err := rows.Scan(&b.CIDR, &b.Reason, &b.TimeCreated, &expire); err != nil {
+			_ = rows.Close()
+			return nil, errors.Wrap(err, "Failed to fetch ban")
+		}
+		if expire.Valid {
+			b.TimeExpire = expire.Time
+		}
+		bans = append(bans, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "Failed to fetch bans")
+	}
+	return bans, nil
+}
+
+// nullTime returns the time, or nil so that zero times are stored as a NULL value
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
 // Close will close the underlying mysql database connection
 func (s *TorrentStore) Close() error {
 	return s.db.Close()
 }
 
-// Get returns a torrent for the hash provided
+// Get returns a torrent for the hash provided. v2 info hashes are resolved to their hybrid torrent.
 func (s *TorrentStore) Get(t *model.Torrent, hash model.InfoHash) error {
-	const q = `SELECT * FROM torrent WHERE info_hash = ? AND is_deleted = false`
+	const q = `SELECT * FROM torrent WHERE (info_hash = ? OR info_hash_v2 = ?) AND is_deleted = false`
 	if err := s.cache.Get(t, hash); err == nil {
 		log.Debugf("Got cached torrent: %s", t.InfoHash.String())
 		return nil
 	}
-	err := s.db.Get(t, q, hash.Bytes())
+	err := s.db.Get(t, q, hash.Bytes(), hash.Bytes())
 	if err != nil {
 		if err.Error() == "sql: no rows in result set" {
 			return consts.ErrInvalidInfoHash
@@ -123,10 +255,20 @@ func (s *TorrentStore) Get(t *model.Torrent, hash model.InfoHash) error {
 	return nil
 }
 
+// GetAll returns all the torrents known to the store which are not deleted
+func (s *TorrentStore) GetAll() (model.Torrents, error) {
+	const q = `SELECT * FROM torrent WHERE is_deleted = false`
+	var torrents model.Torrents
+	if err := s.db.Select(&torrents, q); err != nil {
+		return nil, errors.Wrap(err, "Failed to select torrents")
+	}
+	return torrents, nil
+}
+
 // Add inserts a new torrent into the backing store
 func (s *TorrentStore) Add(t model.Torrent) error {
-	const q = `INSERT INTO torrent (info_hash, release_name) VALUES(?, ?)`
-	_, err := s.db.Exec(q, t.InfoHash.Bytes(), t.ReleaseName)
+	const q = `INSERT INTO torrent (info_hash, info_hash_v2, release_name, tags, size) VALUES(?, ?, ?, ?, ?)`
+	_, err := s.db.Exec(q, t.InfoHash.Bytes(), &t.InfoHashV2, t.ReleaseName, t.Tags, t.Size)
 	if err != nil {
 		return err
 	}
@@ -2,6 +2,8 @@ package mysql
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	"github.com/jmoiron/sqlx"
 	"github.com/leighmacdonald/mika/config"
 	"github.com/leighmacdonald/mika/consts"
@@ -10,6 +12,7 @@ import (
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"sync"
+	"time"
 )
 
 // ErrNoResults is the string returned from the driver when no rows are returned
@@ -23,16 +26,29 @@ type UserStore struct {
 }
 
 // Sync batch updates the backing store with the new UserStats provided
-func (u *UserStore) Sync(b map[string]model.UserStats) error {
+func (u *UserStore) Sync(b map[uint32]model.UserStats) error {
 	const q = `
 		UPDATE 
 			users 
 		SET 
 		    announces = (announces + ?), 
 		    uploaded = (uploaded + ?),
-		    downloaded = (downloaded + ?)
+		    downloaded = (downloaded + ?),
+		    uploaded_raw = (uploaded_raw + ?),
+		    downloaded_raw = (downloaded_raw + ?),
+		    bonus_points = (bonus_points + ?),
+		    leech_denied = (leech_denied + ?)
 		WHERE
-			passkey = ?`
+			user_id = ?`
+	const ledgerQ = `
+		INSERT INTO ledger 
+		    (user_id, source, uploaded, downloaded, bonus_points, time_created)
+		SELECT 
+		    user_id, ?, ?, ?, ?, ? 
+		FROM 
+		    users 
+		WHERE 
+		    user_id = ?`
 	// TODO use ctx for timeout
 	ctx := context.Background()
 	tx, err := u.db.BeginTx(ctx, nil)
@@ -43,8 +59,20 @@ func (u *UserStore) Sync(b map[string]model.UserStats) error {
 	if err != nil {
 		return errors.Wrap(err, "Failed to prepare user Sync() tx")
 	}
-	for passkey, stats := range b {
-		_, err := stmt.Exec(stats.Announces, stats.Uploaded, stats.Downloaded, passkey)
+	ledgerStmt, err := tx.Prepare(ledgerQ)
+	if err != nil {
+		return errors.Wrap(err, "Failed to prepare user ledger Sync() tx")
+	}
+	now := time.Now()
+	for userID, stats := range b {
+		_, err := stmt.Exec(stats.Announces, stats.Uploaded, stats.Downloaded,
+			stats.UploadedRaw, stats.DownloadedRaw, stats.BonusPoints, stats.LeechDenied, userID)
+		if err == nil {
+			if entry := model.NewSyncLedgerEntry(0, stats, now); !entry.Empty() {
+				_, err = ledgerStmt.Exec(string(entry.Source), entry.Uploaded, entry.Downloaded,
+					entry.BonusPoints, entry.TimeCreated, userID)
+			}
+		}
 		if err != nil {
 			if err := tx.Rollback(); err != nil {
 				log.Errorf("Failed to roll back user Sync() tx")
@@ -58,15 +86,323 @@ func (u *UserStore) Sync(b map[string]model.UserStats) error {
 	return nil
 }
 
+// HNRSync inserts or replaces the hit and run records provided
+func (u *UserStore) HNRSync(records []model.HitAndRun) error {
+	const q = `
+		INSERT INTO hnr 
+		    (user_id, info_hash, status, seed_time, time_completed, time_last_seed) 
+		VALUES 
+		    (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE 
+		    status = VALUES(status), seed_time = VALUES(seed_time), 
+		    time_completed = VALUES(time_completed), time_last_seed = VALUES(time_last_seed)`
+	tx, err := u.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "Failed to begin hnr HNRSync() tx")
+	}
+	stmt, err := tx.Prepare(q)
+	if err != nil {
+		return errors.Wrap(err, "Failed to prepare hnr HNRSync() tx")
+	}
+	for _, h := range records {
+		_, err := stmt.Exec(h.UserID, h.InfoHash.Bytes(), string(h.Status), h.SeedTime,
+			h.TimeCompleted, h.TimeLastSeed)
+		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				log.Errorf("Failed to roll back hnr HNRSync() tx")
+			}
+			return errors.Wrap(err, "Failed to exec hnr HNRSync() tx")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "Failed to commit hnr HNRSync() tx")
+	}
+	return nil
+}
+
+// HNRGetByUser returns all the hit and run records for a user
+func (u *UserStore) HNRGetByUser(userID uint32) ([]model.HitAndRun, error) {
+	var records []model.HitAndRun
+	const q = `SELECT * FROM hnr WHERE user_id = ?`
+	if err := u.db.Select(&records, q, userID); err != nil {
+		return nil, errors.Wrap(err, "Failed to select user hit and runs")
+	}
+	return records, nil
+}
+
+// HNRGetActive returns all the hit and run records which are pending or flagged
+func (u *UserStore) HNRGetActive() ([]model.HitAndRun, error) {
+	var records []model.HitAndRun
+	const q = `SELECT * FROM hnr WHERE status != ?`
+	if err := u.db.Select(&records, q, string(model.HNRSatisfied)); err != nil {
+		return nil, errors.Wrap(err, "Failed to select active hit and runs")
+	}
+	return records, nil
+}
+
+// HNRDelete removes the hit and run record for the user and torrent
+func (u *UserStore) HNRDelete(userID uint32, ih model.InfoHash) error {
+	const q = `DELETE FROM hnr WHERE user_id = ? AND info_hash = ?`
+	res, err := u.db.Exec(q, userID, ih.Bytes())
+	if err != nil {
+		return errors.Wrap(err, "Failed to delete hit and run")
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Failed to read deleted hit and run count")
+	}
+	if rows != 1 {
+		return consts.ErrInvalidHNR
+	}
+	return nil
+}
+
+// LedgerAdjust applies the manual adjustment to the users stats and records it in the ledger
+func (u *UserStore) LedgerAdjust(entry model.LedgerEntry) error {
+	const userQ = `SELECT user_id FROM users WHERE user_id = ? FOR UPDATE`
+	const q = `
+		UPDATE 
+			users 
+		SET 
+		    uploaded = GREATEST(0, uploaded + ?),
+		    downloaded = GREATEST(0, downloaded + ?),
+		    bonus_points = (bonus_points + ?)
+		WHERE
+			user_id = ?`
+	const ledgerQ = `
+		INSERT INTO ledger 
+		    (user_id, source, uploaded, downloaded, bonus_points, reason, actor, time_created)
+		VALUES 
+		    (?, ?, ?, ?, ?, ?, ?, ?)`
+	tx, err := u.db.Beginx()
+	if err != nil {
+		return errors.Wrap(err, "Failed to begin ledger LedgerAdjust() tx")
+	}
+	rollback := func() {
+		if err := tx.Rollback(); err != nil {
+			log.Errorf("Failed to roll back ledger LedgerAdjust() tx")
+		}
+	}
+	var userID uint32
+	if err := tx.Get(&userID, userQ, entry.UserID); err != nil {
+		rollback()
+		if err.Error() == ErrNoResults {
+			return consts.ErrInvalidUser
+		}
+		return errors.Wrap(err, "Failed to lock user for LedgerAdjust() tx")
+	}
+	if _, err := tx.Exec(q, entry.Uploaded, entry.Downloaded, entry.BonusPoints, entry.UserID); err != nil {
+		rollback()
+		return errors.Wrap(err, "Failed to exec user LedgerAdjust() tx")
+	}
+	if _, err := tx.Exec(ledgerQ, entry.UserID, string(entry.Source), entry.Uploaded, entry.Downloaded,
+		entry.BonusPoints, entry.Reason, entry.Actor, entry.TimeCreated); err != nil {
+		rollback()
+		return errors.Wrap(err, "Failed to exec ledger LedgerAdjust() tx")
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "Failed to commit ledger LedgerAdjust() tx")
+	}
+	return nil
+}
+
+// LedgerGetByUser returns up to limit ledger entries of a user starting from offset, newest first
+func (u *UserStore) LedgerGetByUser(userID uint32, offset int, limit int) ([]model.LedgerEntry, error) {
+	var entries []model.LedgerEntry
+	const q = `SELECT * FROM ledger WHERE user_id = ? ORDER BY ledger_id DESC LIMIT ? OFFSET ?`
+	if err := u.db.Select(&entries, q, userID, limit, offset); err != nil {
+		return nil, errors.Wrap(err, "Failed to select user ledger")
+	}
+	return entries, nil
+}
+
+// FreeleechAdd inserts or replaces the freeleech token for the user and torrent
+func (u *UserStore) FreeleechAdd(token model.FreeleechToken) error {
+	const q = `
+		INSERT INTO freeleech 
+		    (user_id, info_hash, time_created, time_expire) 
+		VALUES 
+		    (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE 
+		    time_created = VALUES(time_created), time_expire = VALUES(time_expire)`
+	if _, err := u.db.Exec(q, token.UserID, token.InfoHash.Bytes(), token.TimeCreated, token.TimeExpire); err != nil {
+		return errors.Wrap(err, "Failed to add freeleech token")
+	}
+	return nil
+}
+
+// FreeleechGetByUser returns all the freeleech tokens of a user
+func (u *UserStore) FreeleechGetByUser(userID uint32) ([]model.FreeleechToken, error) {
+	var tokens []model.FreeleechToken
+	const q = `SELECT * FROM freeleech WHERE user_id = ?`
+	if err := u.db.Select(&tokens, q, userID); err != nil {
+		return nil, errors.Wrap(err, "Failed to select user freeleech tokens")
+	}
+	return tokens, nil
+}
+
+// FreeleechGetAll returns all the freeleech tokens
+func (u *UserStore) FreeleechGetAll() ([]model.FreeleechToken, error) {
+	var tokens []model.FreeleechToken
+	const q = `SELECT * FROM freeleech`
+	if err := u.db.Select(&tokens, q); err != nil {
+		return nil, errors.Wrap(err, "Failed to select freeleech tokens")
+	}
+	return tokens, nil
+}
+
+// FreeleechDelete removes the freeleech token for the user and torrent
+func (u *UserStore) FreeleechDelete(userID uint32, ih model.InfoHash) error {
+	const q = `DELETE FROM freeleech WHERE user_id = ? AND info_hash = ?`
+	res, err := u.db.Exec(q, userID, ih.Bytes())
+	if err != nil {
+		return errors.Wrap(err, "Failed to delete freeleech token")
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Failed to read deleted freeleech token count")
+	}
+	if rows != 1 {
+		return consts.ErrInvalidFreeleech
+	}
+	return nil
+}
+
+// RatioWatchAdd inserts or replaces the ratio watch record of the user
+func (u *UserStore) RatioWatchAdd(rw model.RatioWatch) error {
+	const q = `
+		INSERT INTO ratio_watch 
+		    (user_id, status, required_ratio, ratio, time_warned, time_deadline, time_updated) 
+		VALUES 
+		    (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE 
+		    status = VALUES(status), required_ratio = VALUES(required_ratio), ratio = VALUES(ratio),
+		    time_warned = VALUES(time_warned), time_deadline = VALUES(time_deadline), 
+		    time_updated = VALUES(time_updated)`
+	if _, err := u.db.Exec(q, rw.UserID, string(rw.Status), rw.RequiredRatio, rw.Ratio,
+		rw.TimeWarned, rw.TimeDeadline, rw.TimeUpdated); err != nil {
+		return errors.Wrap(err, "Failed to add ratio watch")
+	}
+	return nil
+}
+
+// RatioWatchGet returns the ratio watch record of the user
+func (u *UserStore) RatioWatchGet(rw *model.RatioWatch, userID uint32) error {
+	const q = `SELECT * FROM ratio_watch WHERE user_id = ?`
+	if err := u.db.Get(rw, q, userID); err != nil {
+		if err.Error() == ErrNoResults {
+			return consts.ErrInvalidRatioWatch
+		}
+		return errors.Wrap(err, "Could not query ratio watch")
+	}
+	return nil
+}
+
+// RatioWatchGetActive returns all the ratio watch records which are warned or disabled
+func (u *UserStore) RatioWatchGetActive() ([]model.RatioWatch, error) {
+	var records []model.RatioWatch
+	const q = `SELECT * FROM ratio_watch WHERE status != ?`
+	if err := u.db.Select(&records, q, string(model.RatioWatchCleared)); err != nil {
+		return nil, errors.Wrap(err, "Failed to select active ratio watches")
+	}
+	return records, nil
+}
+
+// SnatchAdd inserts the snatches provided. Existing snatches for the same user and torrent are kept.
+func (u *UserStore) SnatchAdd(snatches []model.Snatch) error {
+	const q = `
+		INSERT IGNORE INTO snatch 
+		    (user_id, info_hash, time_completed, addr_ip, client, uploaded, downloaded) 
+		VALUES 
+		    (?, ?, ?, ?, ?, ?, ?)`
+	tx, err := u.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "Failed to begin snatch SnatchAdd() tx")
+	}
+	stmt, err := tx.Prepare(q)
+	if err != nil {
+		return errors.Wrap(err, "Failed to prepare snatch SnatchAdd() tx")
+	}
+	for _, s := range snatches {
+		_, err := stmt.Exec(s.UserID, s.InfoHash.Bytes(), s.TimeCompleted, []byte(s.IP), s.Client,
+			s.Uploaded, s.Downloaded)
+		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				log.Errorf("Failed to roll back snatch SnatchAdd() tx")
+			}
+			return errors.Wrap(err, "Failed to exec snatch SnatchAdd() tx")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "Failed to commit snatch SnatchAdd() tx")
+	}
+	return nil
+}
+
+// SnatchSync batch updates the transfer totals of existing snatches with the new SnatchStats provided
+func (u *UserStore) SnatchSync(b map[model.UserTorrentKey]model.SnatchStats) error {
+	const q = `
+		UPDATE 
+			snatch 
+		SET 
+		    uploaded = (uploaded + ?),
+		    downloaded = (downloaded + ?)
+		WHERE
+			user_id = ? AND info_hash = ?`
+	tx, err := u.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "Failed to begin snatch SnatchSync() tx")
+	}
+	stmt, err := tx.Prepare(q)
+	if err != nil {
+		return errors.Wrap(err, "Failed to prepare snatch SnatchSync() tx")
+	}
+	for key, stats := range b {
+		_, err := stmt.Exec(stats.Uploaded, stats.Downloaded, key.UserID, key.InfoHash.Bytes())
+		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				log.Errorf("Failed to roll back snatch SnatchSync() tx")
+			}
+			return errors.Wrap(err, "Failed to exec snatch SnatchSync() tx")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "Failed to commit snatch SnatchSync() tx")
+	}
+	return nil
+}
+
+// SnatchGetByUser returns up to limit snatches of a user starting from offset, newest first
+func (u *UserStore) SnatchGetByUser(userID uint32, offset int, limit int) ([]model.Snatch, error) {
+	var snatches []model.Snatch
+	const q = `SELECT * FROM snatch WHERE user_id = ? ORDER BY time_completed DESC LIMIT ? OFFSET ?`
+	if err := u.db.Select(&snatches, q, userID, limit, offset); err != nil {
+		return nil, errors.Wrap(err, "Failed to select user snatches")
+	}
+	return snatches, nil
+}
+
+// SnatchGetByTorrent returns up to limit snatches of a torrent starting from offset, newest first
+func (u *UserStore) SnatchGetByTorrent(ih model.InfoHash, offset int, limit int) ([]model.Snatch, error) {
+	var snatches []model.Snatch
+	const q = `SELECT * FROM snatch WHERE info_hash = ? ORDER BY time_completed DESC LIMIT ? OFFSET ?`
+	if err := u.db.Select(&snatches, q, ih.Bytes(), limit, offset); err != nil {
+		return nil, errors.Wrap(err, "Failed to select torrent snatches")
+	}
+	return snatches, nil
+}
+
 // Add will add a new user to the backing store
 func (u *UserStore) Add(user model.User) error {
 	const q = `
 		INSERT INTO users 
-		    (user_id, passkey, download_enabled, is_deleted, downloaded, uploaded) 
+		    (user_id, passkey, download_enabled, is_deleted, is_admin, downloaded, uploaded, 
+		     downloaded_raw, uploaded_raw, bonus_points, slots_leech, slots_seed, slots_torrent) 
 		VALUES
-		    (?, ?, ?, ?, ?, ?)`
+		    (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	res, err := u.db.Exec(q, user.UserID, user.Passkey, user.DownloadEnabled,
-		user.IsDeleted, user.Downloaded, user.Uploaded)
+		user.IsDeleted, user.IsAdmin, user.Downloaded, user.Uploaded, user.DownloadedRaw, user.UploadedRaw,
+		user.BonusPoints, user.Leech, user.Seed, user.PerTorrent)
 	if err != nil {
 		return errors.Wrap(err, "Failed to add user to store")
 	}
@@ -83,8 +419,16 @@ func (u *UserStore) Add(user model.User) error {
 // that could possibly help attackers gain any insight. All error cases MUST
 // return ErrUnauthorized.
 func (u *UserStore) GetByPasskey(user *model.User, passkey string) error {
-	const q = `SELECT * FROM users WHERE passkey = ?`
-	if err := u.db.Get(user, q, passkey); err != nil {
+	const q = `
+		SELECT 
+		    * 
+		FROM 
+		    users 
+		WHERE 
+		    passkey = ? OR user_id = (
+		        SELECT user_id FROM passkey WHERE passkey = ? AND (time_expire IS NULL OR time_expire > ?)
+		    )`
+	if err := u.db.Get(user, q, passkey, passkey, time.Now()); err != nil {
 		if err.Error() == ErrNoResults {
 			return consts.ErrInvalidUser
 		}
@@ -114,10 +458,249 @@ func (u *UserStore) Delete(user model.User) error {
 	if _, err := u.db.Exec(q, user.UserID); err != nil {
 		return errors.Wrap(err, "Failed to delete user")
 	}
+	const qPasskeys = `DELETE FROM passkey WHERE user_id = ?`
+	if _, err := u.db.Exec(qPasskeys, user.UserID); err != nil {
+		return errors.Wrap(err, "Failed to delete user passkeys")
+	}
 	user.UserID = 0
 	return nil
 }
 
+// SetDownloadEnabled enables or disables downloading for the user
+func (u *UserStore) SetDownloadEnabled(userID uint32, enabled bool) error {
+	const q = `UPDATE users SET download_enabled = ? WHERE user_id = ?`
+	res, err := u.db.Exec(q, enabled, userID)
+	if err != nil {
+		return errors.Wrap(err, "Failed to update download enabled")
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Failed to read updated user count")
+	}
+	if rows == 0 {
+		// Rows which already have the value are not counted as affected
+		var user model.User
+		return u.GetByID(&user, userID)
+	}
+	return nil
+}
+
+// SetSlotLimits replaces the peer slot limits of the user
+func (u *UserStore) SetSlotLimits(userID uint32, limits model.SlotLimits) error {
+	const q = `UPDATE users SET slots_leech = ?, slots_seed = ?, slots_torrent = ? WHERE user_id = ?`
+	res, err := u.db.Exec(q, limits.Leech, limits.Seed, limits.PerTorrent, userID)
+	if err != nil {
+		return errors.Wrap(err, "Failed to update slot limits")
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Failed to read updated user count")
+	}
+	if rows == 0 {
+		// Rows which already have the value are not counted as affected
+		var user model.User
+		return u.GetByID(&user, userID)
+	}
+	return nil
+}
+
+// SetPasskey replaces the primary passkey of the user
+func (u *UserStore) SetPasskey(userID uint32, passkey string) error {
+	const q = `UPDATE users SET passkey = ? WHERE user_id = ?`
+	res, err := u.db.Exec(q, passkey, userID)
+	if err != nil {
+		return errors.Wrap(err, "Failed to update passkey")
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Failed to read updated user count")
+	}
+	if rows == 0 {
+		// Rows which already have the value are not counted as affected
+		var user model.User
+		return u.GetByID(&user, userID)
+	}
+	return nil
+}
+
+// PasskeyAdd inserts or replaces an additional passkey of a user
+func (u *UserStore) PasskeyAdd(pk model.Passkey) error {
+	const q = `
+		INSERT INTO passkey 
+		    (passkey, user_id, label, time_created, time_expire, time_last_used, addr_ip) 
+		VALUES 
+		    (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE 
+		    user_id = VALUES(user_id), label = VALUES(label), time_created = VALUES(time_created), 
+		    time_expire = VALUES(time_expire), time_last_used = VALUES(time_last_used), 
+		    addr_ip = VALUES(addr_ip)`
+	if _, err := u.db.Exec(q, pk.Passkey, pk.UserID, pk.Label, pk.TimeCreated, nullTime(pk.TimeExpire),
+		nullTime(pk.TimeLastUsed), []byte(pk.IP)); err != nil {
+		return errors.Wrap(err, "Failed to add passkey")
+	}
+	return nil
+}
+
+// PasskeyGet returns the additional passkey matching the passkey provided
+func (u *UserStore) PasskeyGet(pk *model.Passkey, passkey string) error {
+	q := `SELECT ` + passkeyColumns + ` FROM passkey WHERE passkey = ?`
+	if err := scanPasskey(u.db.QueryRow(q, passkey), pk); err != nil {
+		if err == sql.ErrNoRows {
+			return consts.ErrInvalidPasskey
+		}
+		return errors.Wrap(err, "Could not query passkey")
+	}
+	return nil
+}
+
+// PasskeyGetByUser returns the additional passkeys of a user, including those which have expired
+func (u *UserStore) PasskeyGetByUser(userID uint32) ([]model.Passkey, error) {
+	var passkeys []model.Passkey
+	q := `SELECT ` + passkeyColumns + ` FROM passkey WHERE user_id = ?`
+	rows, err := u.db.Query(q, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to select passkeys")
+	}
+	for rows.Next() {
+		var pk model.Passkey
+		if err := scanPasskey(rows, &pk); err != nil {
+			_ = rows.Close()
+			return nil, errors.Wrap(err, "Failed to fetch passkey")
+		}
+		passkeys = append(passkeys, pk)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "Failed to fetch passkeys")
+	}
+	return passkeys, nil
+}
+
+// PasskeyDelete removes an additional passkey
+func (u *UserStore) PasskeyDelete(passkey string) error {
+	const q = `DELETE FROM passkey WHERE passkey = ?`
+	res, err := u.db.Exec(q, passkey)
+	if err != nil {
+		return errors.Wrap(err, "Failed to delete passkey")
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Failed to read deleted passkey count")
+	}
+	if rows != 1 {
+		return consts.ErrInvalidPasskey
+	}
+	return nil
+}
+
+// PasskeySync batch updates when and where existing additional passkeys were last used
+func (u *UserStore) PasskeySync(b map[string]model.PasskeyUsage) error {
+	const q = `UPDATE passkey SET time_last_used = ?, addr_ip = ? WHERE passkey = ?`
+	tx, err := u.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "Failed to begin passkey PasskeySync() tx")
+	}
+	stmt, err := tx.Prepare(q)
+	if err != nil {
+		return errors.Wrap(err, "Failed to prepare passkey PasskeySync() tx")
+	}
+	for passkey, usage := range b {
+		if _, err := stmt.Exec(usage.TimeLastUsed, []byte(usage.IP), passkey); err != nil {
+			if err := tx.Rollback(); err != nil {
+				log.Errorf("Failed to roll back passkey PasskeySync() tx")
+			}
+			return errors.Wrap(err, "Failed to exec passkey PasskeySync() tx")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "Failed to commit passkey PasskeySync() tx")
+	}
+	return nil
+}
+
+// PasskeyMigrate replaces every stored passkey, including additional passkeys, with the value
+// returned by hash. The number of passkeys which were changed is returned.
+func (u *UserStore) PasskeyMigrate(hash func(passkey string) string) (int, error) {
+	// Schema changes implicitly commit so they cannot be part of the tx
+	for _, q := range passkeyDigestMigration {
+		if _, err := u.db.Exec(q); err != nil {
+			return 0, errors.Wrap(err, "Failed to widen passkey columns")
+		}
+	}
+	tx, err := u.db.Begin()
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to begin passkey PasskeyMigrate() tx")
+	}
+	changed := 0
+	for _, table := range []string{"users", "passkey"} {
+		n, err := migratePasskeyColumn(tx, table, hash)
+		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				log.Errorf("Failed to roll back passkey PasskeyMigrate() tx")
+			}
+			return 0, err
+		}
+		changed += n
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "Failed to commit passkey PasskeyMigrate() tx")
+	}
+	return changed, nil
+}
+
+// migratePasskeyColumn replaces the passkey column of every row in the table with the value
+// returned by hash
+func migratePasskeyColumn(tx *sql.Tx, table string, hash func(passkey string) string) (int, error) {
+	rows, err := tx.Query(fmt.Sprintf(`SELECT passkey FROM %s`, table))
+	if err != nil {
+		return 0, errors.Wrapf(err, "Failed to select %s passkeys", table)
+	}
+	var passkeys []string
+	for rows.Next() {
+		var passkey string
+		if err := rows.Scan(&passkey); err != nil {
+			_ = rows.Close()
+			return 0, errors.Wrapf(err, "Failed to fetch %s passkey", table)
+		}
+		passkeys = append(passkeys, passkey)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, errors.Wrapf(err, "Failed to fetch %s passkeys", table)
+	}
+	q := fmt.Sprintf(`UPDATE %s SET passkey = ? WHERE passkey = ?`, table)
+	changed := 0
+	for _, passkey := range passkeys {
+		hashed := hash(passkey)
+		if hashed == passkey {
+			continue
+		}
+		if _, err := tx.Exec(q, hashed, passkey); err != nil {
+			return 0, errors.Wrapf(err, "Failed to update %s passkey", table)
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// passkeyColumns are the passkey table columns in the order read by scanPasskey
+const passkeyColumns = `passkey, user_id, label, time_created, time_expire, time_last_used, addr_ip`
+
+// scanPasskey reads a passkey row, converting the nullable columns to their zero values
+func scanPasskey(row interface{ Scan(...interface{}) error }, pk *model.Passkey) error {
+	var expire, lastUsed sql.NullTime
+	var ip []byte
+	if err := row.Scan(&pk.Passkey, &pk.UserID, &pk.Label, &pk.TimeCreated, &expire, &lastUsed, &ip); err != nil {
+		return err
+	}
+	if expire.Valid {
+		pk.TimeExpire = expire.Time
+	}
+	if lastUsed.Valid {
+		pk.TimeLastUsed = lastUsed.Time
+	}
+	pk.IP = ip
+	return nil
+}
+
 // Close will close the underlying database connection and clear the local caches
 func (u *UserStore) Close() error {
 	return u.db.Close()
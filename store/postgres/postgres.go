@@ -26,18 +26,32 @@ type UserStore struct {
 }
 
 // Sync batch updates the backing store with the new UserStats provided
-func (us UserStore) Sync(batch map[string]model.UserStats) error {
+func (us UserStore) Sync(batch map[uint32]model.UserStats) error {
 	const txName = "userSync"
+	const ledgerTxName = "userSyncLedger"
 	const q = `
 		UPDATE 
 			users
 		SET
 			downloaded = (downloaded + $1),
 		    uploaded = (uploaded + $2),
-		    announces = (announces + $3)
+		    announces = (announces + $3),
+		    downloaded_raw = (downloaded_raw + $4),
+		    uploaded_raw = (uploaded_raw + $5),
+		    bonus_points = (bonus_points + $6),
+		    leech_denied = (leech_denied + $7)
 		WHERE
-			passkey = $4
+			user_id = $8
 `
+	const ledgerQ = `
+		INSERT INTO ledger 
+		    (user_id, source, uploaded, downloaded, bonus_points, time_created)
+		SELECT 
+		    user_id, $1, $2, $3, $4, $5 
+		FROM 
+		    users 
+		WHERE 
+		    user_id = $6`
 	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(time.Second*10))
 	defer cancel()
 	tx, err := us.db.Begin(c)
@@ -49,11 +63,23 @@ func (us UserStore) Sync(batch map[string]model.UserStats) error {
 	if err != nil {
 		return errors.Wrap(err, "postgres.UserStore.Sync Failed to being transaction")
 	}
-
-	for passkey, stats := range batch {
-		if _, err := tx.Exec(c, txName, stats.Downloaded, stats.Uploaded, stats.Announces, passkey); err != nil {
+	if _, err := tx.Prepare(c, ledgerTxName, ledgerQ); err != nil {
+		return errors.Wrap(err, "postgres.UserStore.Sync Failed to prepare ledger transaction")
+	}
+	now := time.Now()
+	for userID, stats := range batch {
+		if _, err := tx.Exec(c, txName, stats.Downloaded, stats.Uploaded, stats.Announces,
+			stats.DownloadedRaw, stats.UploadedRaw, stats.BonusPoints, stats.LeechDenied, userID); err != nil {
 			return errors.Wrapf(err, "postgres.UserStore.Sync failed to Exec tx")
 		}
+		entry := model.NewSyncLedgerEntry(0, stats, now)
+		if entry.Empty() {
+			continue
+		}
+		if _, err := tx.Exec(c, ledgerTxName, string(entry.Source), entry.Uploaded, entry.Downloaded,
+			entry.BonusPoints, entry.TimeCreated, userID); err != nil {
+			return errors.Wrapf(err, "postgres.UserStore.Sync failed to Exec ledger tx")
+		}
 	}
 	if err := tx.Commit(c); err != nil {
 		return errors.Wrapf(err, "postgres.UserStore.Sync failed to commit tx")
@@ -67,11 +93,13 @@ func (us UserStore) Add(user model.User) error {
 	defer cancel()
 	const q = `
 		INSERT INTO users 
-		    (user_id, passkey, download_enabled, is_deleted, downloaded, uploaded, announces) 
+		    (user_id, passkey, download_enabled, is_deleted, is_admin, downloaded, uploaded, announces,
+		     downloaded_raw, uploaded_raw, bonus_points, leech_denied, slots_leech, slots_seed, slots_torrent) 
 		VALUES
-		    ($1, $2, $3, $4, $5, $6, $7)`
-	_, err := us.db.Exec(c, q, user.UserID, user.Passkey, user.DownloadEnabled, user.IsDeleted,
-		user.Downloaded, user.Uploaded, user.Announces)
+		    ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`
+	_, err := us.db.Exec(c, q, user.UserID, user.Passkey, user.DownloadEnabled, user.IsDeleted, user.IsAdmin,
+		user.Downloaded, user.Uploaded, user.Announces, user.DownloadedRaw, user.UploadedRaw, user.BonusPoints,
+		user.LeechDenied, user.Leech, user.Seed, user.PerTorrent)
 	if err != nil {
 		return errors.Wrap(err, "Failed to add user to store")
 	}
@@ -85,15 +113,19 @@ func (us UserStore) Add(user model.User) error {
 func (us UserStore) GetByPasskey(user *model.User, passkey string) error {
 	const q = `
 		SELECT 
-		    user_id, passkey, download_enabled, is_deleted, downloaded, uploaded, announces 
+		    user_id, passkey, download_enabled, is_deleted, is_admin, downloaded, uploaded, announces,
+		    downloaded_raw, uploaded_raw, bonus_points, leech_denied, slots_leech, slots_seed, slots_torrent
 		FROM 
 		    users 
 		WHERE 
-		    passkey = $1`
+		    passkey = $1 OR user_id = (
+		        SELECT user_id FROM passkey WHERE passkey = $1 AND (time_expire IS NULL OR time_expire > $2)
+		    )`
 	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(5*time.Second))
 	defer cancel()
-	err := us.db.QueryRow(c, q, passkey).Scan(&user.UserID, &user.Passkey, &user.DownloadEnabled, &user.IsDeleted,
-		&user.Downloaded, &user.Uploaded, &user.Announces)
+	err := us.db.QueryRow(c, q, passkey, time.Now()).Scan(&user.UserID, &user.Passkey, &user.DownloadEnabled, &user.IsDeleted, &user.IsAdmin,
+		&user.Downloaded, &user.Uploaded, &user.Announces, &user.DownloadedRaw, &user.UploadedRaw, &user.BonusPoints,
+		&user.LeechDenied, &user.Leech, &user.Seed, &user.PerTorrent)
 	if err != nil {
 		return errors.Wrap(err, "Failed to fetch user by passkey")
 	}
@@ -104,15 +136,17 @@ func (us UserStore) GetByPasskey(user *model.User, passkey string) error {
 func (us UserStore) GetByID(user *model.User, userID uint32) error {
 	const q = `
 		SELECT 
-		    user_id, passkey, download_enabled, is_deleted, downloaded, uploaded, announces 
+		    user_id, passkey, download_enabled, is_deleted, is_admin, downloaded, uploaded, announces,
+		    downloaded_raw, uploaded_raw, bonus_points, leech_denied, slots_leech, slots_seed, slots_torrent
 		FROM 
 		    users 
 		WHERE 
 		    user_id = $1`
 	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(5*time.Second))
 	defer cancel()
-	err := us.db.QueryRow(c, q, userID).Scan(&user.UserID, &user.Passkey, &user.DownloadEnabled, &user.IsDeleted,
-		&user.Downloaded, &user.Uploaded, &user.Announces)
+	err := us.db.QueryRow(c, q, userID).Scan(&user.UserID, &user.Passkey, &user.DownloadEnabled, &user.IsDeleted, &user.IsAdmin,
+		&user.Downloaded, &user.Uploaded, &user.Announces, &user.DownloadedRaw, &user.UploadedRaw, &user.BonusPoints,
+		&user.LeechDenied, &user.Leech, &user.Seed, &user.PerTorrent)
 	if err != nil {
 		return errors.Wrap(err, "Failed to fetch user by user_id")
 	}
@@ -125,15 +159,676 @@ func (us UserStore) Delete(user model.User) error {
 		return errors.New("User doesnt have a user_id")
 	}
 	const q = `DELETE FROM users WHERE user_id = $1`
+	const qPasskeys = `DELETE FROM passkey WHERE user_id = $1`
 	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(5*time.Second))
 	defer cancel()
 	if _, err := us.db.Exec(c, q, user.UserID); err != nil {
 		return errors.Wrap(err, "Failed to delete user")
 	}
+	if _, err := us.db.Exec(c, qPasskeys, user.UserID); err != nil {
+		return errors.Wrap(err, "Failed to delete user passkeys")
+	}
 	user.UserID = 0
 	return nil
 }
 
+// SetDownloadEnabled enables or disables downloading for the user
+func (us UserStore) SetDownloadEnabled(userID uint32, enabled bool) error {
+	const q = `UPDATE users SET download_enabled = $1 WHERE user_id = $2`
+	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	commandTag, err := us.db.Exec(c, q, enabled, userID)
+	if err != nil {
+		return errors.Wrap(err, "Failed to update download enabled")
+	}
+	if commandTag.RowsAffected() != 1 {
+		return consts.ErrInvalidUser
+	}
+	return nil
+}
+
+// SetSlotLimits replaces the peer slot limits of the user
+func (us UserStore) SetSlotLimits(userID uint32, limits model.SlotLimits) error {
+	const q = `UPDATE users SET slots_leech = $1, slots_seed = $2, slots_torrent = $3 WHERE user_id = $4`
+	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	commandTag, err := us.db.Exec(c, q, limits.Leech, limits.Seed, limits.PerTorrent, userID)
+	if err != nil {
+		return errors.Wrap(err, "Failed to update slot limits")
+	}
+	if commandTag.RowsAffected() != 1 {
+		return consts.ErrInvalidUser
+	}
+	return nil
+}
+
+// SetPasskey replaces the primary passkey of the user
+func (us UserStore) SetPasskey(userID uint32, passkey string) error {
+	const q = `UPDATE users SET passkey = $1 WHERE user_id = $2`
+	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	commandTag, err := us.db.Exec(c, q, passkey, userID)
+	if err != nil {
+		return errors.Wrap(err, "Failed to update passkey")
+	}
+	if commandTag.RowsAffected() != 1 {
+		return consts.ErrInvalidUser
+	}
+	return nil
+}
+
+// PasskeyAdd inserts or replaces an additional passkey of a user
+func (us UserStore) PasskeyAdd(pk model.Passkey) error {
+	const q = `
+		INSERT INTO passkey 
+		    (passkey, user_id, label, time_created, time_expire, time_last_used, addr_ip) 
+		VALUES 
+		    ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (passkey) DO UPDATE SET 
+		    user_id = excluded.user_id, label = excluded.label, time_created = excluded.time_created, 
+		    time_expire = excluded.time_expire, time_last_used = excluded.time_last_used, 
+		    addr_ip = excluded.addr_ip`
+	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	var expire, lastUsed *time.Time
+	if !pk.TimeExpire.IsZero() {
+		expire = &pk.TimeExpire
+	}
+	if !pk.TimeLastUsed.IsZero() {
+		lastUsed = &pk.TimeLastUsed
+	}
+	if _, err := us.db.Exec(c, q, pk.Passkey, pk.UserID, pk.Label, pk.TimeCreated, expire, lastUsed,
+		pk.IP); err != nil {
+		return errors.Wrap(err, "Failed to add passkey")
+	}
+	return nil
+}
+
+// PasskeyGet returns the additional passkey matching the passkey provided
+func (us UserStore) PasskeyGet(pk *model.Passkey, passkey string) error {
+	const q = `SELECT ` + passkeyColumns + ` FROM passkey WHERE passkey = $1`
+	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	if err := scanPasskey(us.db.QueryRow(c, q, passkey), pk); err != nil {
+		if err.Error() == "no rows in result set" {
+			return consts.ErrInvalidPasskey
+		}
+		return errors.Wrap(err, "Failed to fetch passkey")
+	}
+	return nil
+}
+
+// PasskeyGetByUser returns the additional passkeys of a user, including those which have expired
+func (us UserStore) PasskeyGetByUser(userID uint32) ([]model.Passkey, error) {
+	var passkeys []model.Passkey
+	const q = `SELECT ` + passkeyColumns + ` FROM passkey WHERE user_id = $1`
+	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	rows, err := us.db.Query(c, q, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to select passkeys")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pk model.Passkey
+		if err := scanPasskey(rows, &pk); err != nil {
+			return nil, errors.Wrap(err, "Failed to fetch passkey")
+		}
+		passkeys = append(passkeys, pk)
+	}
+	return passkeys, nil
+}
+
+// PasskeyDelete removes an additional passkey
+func (us UserStore) PasskeyDelete(passkey string) error {
+	const q = `DELETE FROM passkey WHERE passkey = $1`
+	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	commandTag, err := us.db.Exec(c, q, passkey)
+	if err != nil {
+		return errors.Wrap(err, "Failed to delete passkey")
+	}
+	if commandTag.RowsAffected() != 1 {
+		return consts.ErrInvalidPasskey
+	}
+	return nil
+}
+
+// PasskeySync batch updates when and where existing additional passkeys were last used
+func (us UserStore) PasskeySync(b map[string]model.PasskeyUsage) error {
+	const txName = "passkeySync"
+	const q = `UPDATE passkey SET time_last_used = $1, addr_ip = $2 WHERE passkey = $3`
+	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(time.Second*10))
+	defer cancel()
+	tx, err := us.db.Begin(c)
+	if err != nil {
+		return errors.Wrap(err, "postgres.UserStore.PasskeySync Failed to begin transaction")
+	}
+	defer func() { _ = tx.Rollback(c) }()
+	if _, err := tx.Prepare(c, txName, q); err != nil {
+		return errors.Wrap(err, "postgres.UserStore.PasskeySync Failed to prepare transaction")
+	}
+	for passkey, usage := range b {
+		if _, err := tx.Exec(c, txName, usage.TimeLastUsed, usage.IP, passkey); err != nil {
+			return errors.Wrapf(err, "postgres.UserStore.PasskeySync failed to Exec tx")
+		}
+	}
+	if err := tx.Commit(c); err != nil {
+		return errors.Wrapf(err, "postgres.UserStore.PasskeySync failed to commit tx")
+	}
+	return nil
+}
+
+// PasskeyMigrate replaces every stored passkey, including additional passkeys, with the value
+// returned by hash. The number of passkeys which were changed is returned.
+func (us UserStore) PasskeyMigrate(hash func(passkey string) string) (int, error) {
+	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(time.Minute))
+	defer cancel()
+	tx, err := us.db.Begin(c)
+	if err != nil {
+		return 0, errors.Wrap(err, "postgres.UserStore.PasskeyMigrate Failed to begin transaction")
+	}
+	defer func() { _ = tx.Rollback(c) }()
+	for _, q := range passkeyDigestMigration {
+		if _, err := tx.Exec(c, q); err != nil {
+			return 0, errors.Wrap(err, "Failed to widen passkey columns")
+		}
+	}
+	changed := 0
+	for _, table := range []string{"users", "passkey"} {
+		n, err := migratePasskeyColumn(c, tx, table, hash)
+		if err != nil {
+			return 0, err
+		}
+		changed += n
+	}
+	if err := tx.Commit(c); err != nil {
+		return 0, errors.Wrap(err, "postgres.UserStore.PasskeyMigrate failed to commit tx")
+	}
+	return changed, nil
+}
+
+// migratePasskeyColumn replaces the passkey column of every row in the table with the value
+// returned by hash
+func migratePasskeyColumn(c context.Context, tx pgx.Tx, table string, hash func(passkey string) string) (int, error) {
+	rows, err := tx.Query(c, fmt.Sprintf(`SELECT passkey FROM %s`, table))
+	if err != nil {
+		return 0, errors.Wrapf(err, "Failed to select %s passkeys", table)
+	}
+	var passkeys []string
+	for rows.Next() {
+		var passkey string
+		if err := rows.Scan(&passkey); err != nil {
+			rows.Close()
+			return 0, errors.Wrapf(err, "Failed to fetch %s passkey", table)
+		}
+		passkeys = append(passkeys, passkey)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, errors.Wrapf(err, "Failed to fetch %s passkeys", table)
+	}
+	q := fmt.Sprintf(`UPDATE %s SET passkey = $1 WHERE passkey = $2`, table)
+	changed := 0
+	for _, passkey := range passkeys {
+		hashed := hash(passkey)
+		if hashed == passkey {
+			continue
+		}
+		if _, err := tx.Exec(c, q, hashed, passkey); err != nil {
+			return 0, errors.Wrapf(err, "Failed to update %s passkey", table)
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// passkeyColumns are the passkey table columns in the order read by scanPasskey
+const passkeyColumns = `passkey, user_id, label, time_created, time_expire, time_last_used, addr_ip`
+
+// scanPasskey reads a passkey row, converting the nullable columns to their zero values
+func scanPasskey(row pgx.Row, pk *model.Passkey) error {
+	var expire, lastUsed *time.Time
+	if err := row.Scan(&pk.Passkey, &pk.UserID, &pk.Label, &pk.TimeCreated, &expire, &lastUsed, &pk.IP); err != nil {
+		return err
+	}
+	if expire != nil {
+		pk.TimeExpire = *expire
+	}
+	if lastUsed != nil {
+		pk.TimeLastUsed = *lastUsed
+	}
+	return nil
+}
+
+// RatioWatchAdd inserts or replaces the ratio watch record of the user
+func (us UserStore) RatioWatchAdd(rw model.RatioWatch) error {
+	const q = `
+		INSERT INTO ratio_watch 
+		    (user_id, status, required_ratio, ratio, time_warned, time_deadline, time_updated) 
+		VALUES 
+		    ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id) DO UPDATE SET 
+		    status = excluded.status, required_ratio = excluded.required_ratio, ratio = excluded.ratio,
+		    time_warned = excluded.time_warned, time_deadline = excluded.time_deadline, 
+		    time_updated = excluded.time_updated`
+	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	if _, err := us.db.Exec(c, q, rw.UserID, string(rw.Status), rw.RequiredRatio, rw.Ratio,
+		rw.TimeWarned, rw.TimeDeadline, rw.TimeUpdated); err != nil {
+		return errors.Wrap(err, "Failed to add ratio watch")
+	}
+	return nil
+}
+
+// RatioWatchGet returns the ratio watch record of the user
+func (us UserStore) RatioWatchGet(rw *model.RatioWatch, userID uint32) error {
+	const q = `
+		SELECT 
+		    user_id, status, required_ratio, ratio, time_warned, time_deadline, time_updated 
+		FROM 
+		    ratio_watch 
+		WHERE 
+		    user_id = $1`
+	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	var status string
+	err := us.db.QueryRow(c, q, userID).Scan(&rw.UserID, &status, &rw.RequiredRatio, &rw.Ratio,
+		&rw.TimeWarned, &rw.TimeDeadline, &rw.TimeUpdated)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return consts.ErrInvalidRatioWatch
+		}
+		return errors.Wrap(err, "Failed to fetch ratio watch")
+	}
+	rw.Status = model.RatioWatchStatus(status)
+	return nil
+}
+
+// RatioWatchGetActive returns all the ratio watch records which are warned or disabled
+func (us UserStore) RatioWatchGetActive() ([]model.RatioWatch, error) {
+	const q = `
+		SELECT 
+		    user_id, status, required_ratio, ratio, time_warned, time_deadline, time_updated 
+		FROM 
+		    ratio_watch 
+		WHERE 
+		    status != $1`
+	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	rows, err := us.db.Query(c, q, string(model.RatioWatchCleared))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to select active ratio watches")
+	}
+	defer rows.Close()
+	var records []model.RatioWatch
+	for rows.Next() {
+		var rw model.RatioWatch
+		var status string
+		if err := rows.Scan(&rw.UserID, &status, &rw.RequiredRatio, &rw.Ratio,
+			&rw.TimeWarned, &rw.TimeDeadline, &rw.TimeUpdated); err != nil {
+			return nil, errors.Wrap(err, "Failed to fetch ratio watch")
+		}
+		rw.Status = model.RatioWatchStatus(status)
+		records = append(records, rw)
+	}
+	return records, nil
+}
+
+// HNRSync inserts or replaces the hit and run records provided
+func (us UserStore) HNRSync(records []model.HitAndRun) error {
+	const txName = "hnrSync"
+	const q = `
+		INSERT INTO hnr 
+		    (user_id, info_hash, status, seed_time, time_completed, time_last_seed) 
+		VALUES 
+		    ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, info_hash) DO UPDATE SET 
+		    status = excluded.status, seed_time = excluded.seed_time, 
+		    time_completed = excluded.time_completed, time_last_seed = excluded.time_last_seed`
+	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(time.Second*10))
+	defer cancel()
+	tx, err := us.db.Begin(c)
+	if err != nil {
+		return errors.Wrap(err, "postgres.UserStore.HNRSync Failed to begin transaction")
+	}
+	defer func() { _ = tx.Rollback(c) }()
+	if _, err := tx.Prepare(c, txName, q); err != nil {
+		return errors.Wrap(err, "postgres.UserStore.HNRSync Failed to prepare transaction")
+	}
+	for _, h := range records {
+		if _, err := tx.Exec(c, txName, h.UserID, h.InfoHash.Bytes(), string(h.Status), h.SeedTime,
+			h.TimeCompleted, h.TimeLastSeed); err != nil {
+			return errors.Wrapf(err, "postgres.UserStore.HNRSync failed to Exec tx")
+		}
+	}
+	if err := tx.Commit(c); err != nil {
+		return errors.Wrapf(err, "postgres.UserStore.HNRSync failed to commit tx")
+	}
+	return nil
+}
+
+// hnrQuery fetches the hit and run records matching the query
+func (us UserStore) hnrQuery(q string, args ...interface{}) ([]model.HitAndRun, error) {
+	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	rows, err := us.db.Query(c, q, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to select hit and runs")
+	}
+	defer rows.Close()
+	var records []model.HitAndRun
+	for rows.Next() {
+		var h model.HitAndRun
+		var b []byte
+		var status string
+		if err := rows.Scan(&h.UserID, &b, &status, &h.SeedTime, &h.TimeCompleted, &h.TimeLastSeed); err != nil {
+			return nil, errors.Wrap(err, "Failed to fetch hit and run")
+		}
+		copy(h.InfoHash[:], b)
+		h.Status = model.HitAndRunStatus(status)
+		records = append(records, h)
+	}
+	return records, nil
+}
+
+// HNRGetByUser returns all the hit and run records for a user
+func (us UserStore) HNRGetByUser(userID uint32) ([]model.HitAndRun, error) {
+	const q = `
+		SELECT 
+		    user_id, info_hash, status, seed_time, time_completed, time_last_seed 
+		FROM 
+		    hnr 
+		WHERE 
+		    user_id = $1`
+	return us.hnrQuery(q, userID)
+}
+
+// HNRGetActive returns all the hit and run records which are pending or flagged
+func (us UserStore) HNRGetActive() ([]model.HitAndRun, error) {
+	const q = `
+		SELECT 
+		    user_id, info_hash, status, seed_time, time_completed, time_last_seed 
+		FROM 
+		    hnr 
+		WHERE 
+		    status != $1`
+	return us.hnrQuery(q, string(model.HNRSatisfied))
+}
+
+// HNRDelete removes the hit and run record for the user and torrent
+func (us UserStore) HNRDelete(userID uint32, ih model.InfoHash) error {
+	const q = `DELETE FROM hnr WHERE user_id = $1 AND info_hash = $2`
+	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	commandTag, err := us.db.Exec(c, q, userID, ih.Bytes())
+	if err != nil {
+		return errors.Wrap(err, "Failed to delete hit and run")
+	}
+	if commandTag.RowsAffected() != 1 {
+		return consts.ErrInvalidHNR
+	}
+	return nil
+}
+
+// LedgerAdjust applies the manual adjustment to the users stats and records it in the ledger
+func (us UserStore) LedgerAdjust(entry model.LedgerEntry) error {
+	const q = `
+		UPDATE 
+			users
+		SET
+		    uploaded = GREATEST(0, uploaded + $1),
+		    downloaded = GREATEST(0, downloaded + $2),
+		    bonus_points = (bonus_points + $3)
+		WHERE
+			user_id = $4`
+	const ledgerQ = `
+		INSERT INTO ledger 
+		    (user_id, source, uploaded, downloaded, bonus_points, reason, actor, time_created)
+		VALUES 
+		    ($1, $2, $3, $4, $5, $6, $7, $8)`
+	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	tx, err := us.db.Begin(c)
+	if err != nil {
+		return errors.Wrap(err, "postgres.UserStore.LedgerAdjust Failed to begin transaction")
+	}
+	defer func() { _ = tx.Rollback(c) }()
+	commandTag, err := tx.Exec(c, q, entry.Uploaded, entry.Downloaded, entry.BonusPoints, entry.UserID)
+	if err != nil {
+		return errors.Wrap(err, "postgres.UserStore.LedgerAdjust failed to update user")
+	}
+	if commandTag.RowsAffected() != 1 {
+		return consts.ErrInvalidUser
+	}
+	if _, err := tx.Exec(c, ledgerQ, entry.UserID, string(entry.Source), entry.Uploaded, entry.Downloaded,
+		entry.BonusPoints, entry.Reason, entry.Actor, entry.TimeCreated); err != nil {
+		return errors.Wrap(err, "postgres.UserStore.LedgerAdjust failed to add ledger entry")
+	}
+	if err := tx.Commit(c); err != nil {
+		return errors.Wrap(err, "postgres.UserStore.LedgerAdjust failed to commit tx")
+	}
+	return nil
+}
+
+// LedgerGetByUser returns up to limit ledger entries of a user starting from offset, newest first
+func (us UserStore) LedgerGetByUser(userID uint32, offset int, limit int) ([]model.LedgerEntry, error) {
+	const q = `
+		SELECT 
+		    ledger_id, user_id, source, uploaded, downloaded, bonus_points, reason, actor, time_created 
+		FROM 
+		    ledger 
+		WHERE 
+		    user_id = $1 
+		ORDER BY 
+		    ledger_id DESC 
+		LIMIT $2 OFFSET $3`
+	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	rows, err := us.db.Query(c, q, userID, limit, offset)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to select user ledger")
+	}
+	defer rows.Close()
+	var entries []model.LedgerEntry
+	for rows.Next() {
+		var l model.LedgerEntry
+		var source string
+		if err := rows.Scan(&l.LedgerID, &l.UserID, &source, &l.Uploaded, &l.Downloaded, &l.BonusPoints,
+			&l.Reason, &l.Actor, &l.TimeCreated); err != nil {
+			return nil, errors.Wrap(err, "Failed to fetch ledger entry")
+		}
+		l.Source = model.LedgerSource(source)
+		entries = append(entries, l)
+	}
+	return entries, nil
+}
+
+// FreeleechAdd inserts or replaces the freeleech token for the user and torrent
+func (us UserStore) FreeleechAdd(token model.FreeleechToken) error {
+	const q = `
+		INSERT INTO freeleech 
+		    (user_id, info_hash, time_created, time_expire) 
+		VALUES 
+		    ($1, $2, $3, $4)
+		ON CONFLICT (user_id, info_hash) DO UPDATE SET 
+		    time_created = excluded.time_created, time_expire = excluded.time_expire`
+	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	if _, err := us.db.Exec(c, q, token.UserID, token.InfoHash.Bytes(), token.TimeCreated, token.TimeExpire); err != nil {
+		return errors.Wrap(err, "Failed to add freeleech token")
+	}
+	return nil
+}
+
+// freeleechQuery fetches the freeleech tokens matching the query
+func (us UserStore) freeleechQuery(q string, args ...interface{}) ([]model.FreeleechToken, error) {
+	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	rows, err := us.db.Query(c, q, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to select freeleech tokens")
+	}
+	defer rows.Close()
+	var tokens []model.FreeleechToken
+	for rows.Next() {
+		var f model.FreeleechToken
+		var b []byte
+		if err := rows.Scan(&f.UserID, &b, &f.TimeCreated, &f.TimeExpire); err != nil {
+			return nil, errors.Wrap(err, "Failed to fetch freeleech token")
+		}
+		copy(f.InfoHash[:], b)
+		tokens = append(tokens, f)
+	}
+	return tokens, nil
+}
+
+// FreeleechGetByUser returns all the freeleech tokens of a user
+func (us UserStore) FreeleechGetByUser(userID uint32) ([]model.FreeleechToken, error) {
+	const q = `
+		SELECT 
+		    user_id, info_hash, time_created, time_expire 
+		FROM 
+		    freeleech 
+		WHERE 
+		    user_id = $1`
+	return us.freeleechQuery(q, userID)
+}
+
+// FreeleechGetAll returns all the freeleech tokens
+func (us UserStore) FreeleechGetAll() ([]model.FreeleechToken, error) {
+	const q = `SELECT user_id, info_hash, time_created, time_expire FROM freeleech`
+	return us.freeleechQuery(q)
+}
+
+// FreeleechDelete removes the freeleech token for the user and torrent
+func (us UserStore) FreeleechDelete(userID uint32, ih model.InfoHash) error {
+	const q = `DELETE FROM freeleech WHERE user_id = $1 AND info_hash = $2`
+	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	commandTag, err := us.db.Exec(c, q, userID, ih.Bytes())
+	if err != nil {
+		return errors.Wrap(err, "Failed to delete freeleech token")
+	}
+	if commandTag.RowsAffected() != 1 {
+		return consts.ErrInvalidFreeleech
+	}
+	return nil
+}
+
+// SnatchAdd inserts the snatches provided. Existing snatches for the same user and torrent are kept.
+func (us UserStore) SnatchAdd(snatches []model.Snatch) error {
+	const txName = "snatchAdd"
+	const q = `
+		INSERT INTO snatch 
+		    (user_id, info_hash, time_completed, addr_ip, client, uploaded, downloaded) 
+		VALUES 
+		    ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id, info_hash) DO NOTHING`
+	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(time.Second*10))
+	defer cancel()
+	tx, err := us.db.Begin(c)
+	if err != nil {
+		return errors.Wrap(err, "postgres.UserStore.SnatchAdd Failed to begin transaction")
+	}
+	defer func() { _ = tx.Rollback(c) }()
+	if _, err := tx.Prepare(c, txName, q); err != nil {
+		return errors.Wrap(err, "postgres.UserStore.SnatchAdd Failed to prepare transaction")
+	}
+	for _, s := range snatches {
+		if _, err := tx.Exec(c, txName, s.UserID, s.InfoHash.Bytes(), s.TimeCompleted, s.IP, s.Client,
+			s.Uploaded, s.Downloaded); err != nil {
+			return errors.Wrapf(err, "postgres.UserStore.SnatchAdd failed to Exec tx")
+		}
+	}
+	if err := tx.Commit(c); err != nil {
+		return errors.Wrapf(err, "postgres.UserStore.SnatchAdd failed to commit tx")
+	}
+	return nil
+}
+
+// SnatchSync batch updates the transfer totals of existing snatches with the new SnatchStats provided
+func (us UserStore) SnatchSync(b map[model.UserTorrentKey]model.SnatchStats) error {
+	const txName = "snatchSync"
+	const q = `
+		UPDATE 
+			snatch
+		SET
+		    uploaded = (uploaded + $1),
+			downloaded = (downloaded + $2)
+		WHERE
+			user_id = $3 AND info_hash = $4`
+	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(time.Second*10))
+	defer cancel()
+	tx, err := us.db.Begin(c)
+	if err != nil {
+		return errors.Wrap(err, "postgres.UserStore.SnatchSync Failed to begin transaction")
+	}
+	defer func() { _ = tx.Rollback(c) }()
+	if _, err := tx.Prepare(c, txName, q); err != nil {
+		return errors.Wrap(err, "postgres.UserStore.SnatchSync Failed to prepare transaction")
+	}
+	for key, stats := range b {
+		if _, err := tx.Exec(c, txName, stats.Uploaded, stats.Downloaded, key.UserID, key.InfoHash.Bytes()); err != nil {
+			return errors.Wrapf(err, "postgres.UserStore.SnatchSync failed to Exec tx")
+		}
+	}
+	if err := tx.Commit(c); err != nil {
+		return errors.Wrapf(err, "postgres.UserStore.SnatchSync failed to commit tx")
+	}
+	return nil
+}
+
+// snatchQuery fetches the snatches matching the query
+func (us UserStore) snatchQuery(q string, args ...interface{}) ([]model.Snatch, error) {
+	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	rows, err := us.db.Query(c, q, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to select snatches")
+	}
+	defer rows.Close()
+	var snatches []model.Snatch
+	for rows.Next() {
+		var s model.Snatch
+		var b []byte
+		if err := rows.Scan(&s.UserID, &b, &s.TimeCompleted, &s.IP, &s.Client, &s.Uploaded, &s.Downloaded); err != nil {
+			return nil, errors.Wrap(err, "Failed to fetch snatch")
+		}
+		copy(s.InfoHash[:], b)
+		snatches = append(snatches, s)
+	}
+	return snatches, nil
+}
+
+// SnatchGetByUser returns up to limit snatches of a user starting from offset, newest first
+func (us UserStore) SnatchGetByUser(userID uint32, offset int, limit int) ([]model.Snatch, error) {
+	const q = `
+		SELECT 
+		    user_id, info_hash, time_completed, addr_ip, client, uploaded, downloaded 
+		FROM 
+		    snatch 
+		WHERE 
+		    user_id = $1 
+		ORDER BY time_completed DESC 
+		LIMIT $2 OFFSET $3`
+	return us.snatchQuery(q, userID, limit, offset)
+}
+
+// SnatchGetByTorrent returns up to limit snatches of a torrent starting from offset, newest first
+func (us UserStore) SnatchGetByTorrent(ih model.InfoHash, offset int, limit int) ([]model.Snatch, error) {
+	const q = `
+		SELECT 
+		    user_id, info_hash, time_completed, addr_ip, client, uploaded, downloaded 
+		FROM 
+		    snatch 
+		WHERE 
+		    info_hash = $1 
+		ORDER BY time_completed DESC 
+		LIMIT $2 OFFSET $3`
+	return us.snatchQuery(q, ih.Bytes(), limit, offset)
+}
+
 // Close will close the underlying database connection and clear the local caches
 func (us UserStore) Close() error {
 	c, cancel := context.WithDeadline(us.ctx, time.Now().Add(15*time.Second))
@@ -159,11 +854,11 @@ func (ts TorrentStore) Conn() interface{} {
 
 // Add inserts a new torrent into the backing store
 func (ts TorrentStore) Add(t model.Torrent) error {
-	const q = `INSERT INTO torrent (info_hash, release_name) VALUES($1::bytea, $2)`
+	const q = `INSERT INTO torrent (info_hash, info_hash_v2, release_name, tags, size) VALUES($1::bytea, $2::bytea, $3, $4, $5)`
 	//log.Println(t.InfoHash.Bytes())
 	c, cancel := context.WithDeadline(ts.ctx, time.Now().Add(5*time.Second))
 	defer cancel()
-	commandTag, err := ts.db.Exec(c, q, t.InfoHash.Bytes(), t.ReleaseName)
+	commandTag, err := ts.db.Exec(c, q, t.InfoHash.Bytes(), &t.InfoHashV2, t.ReleaseName, t.Tags.String(), t.Size)
 	if err != nil {
 		return err
 	}
@@ -196,21 +891,22 @@ func (ts TorrentStore) Delete(ih model.InfoHash, dropRow bool) error {
 	return nil
 }
 
-// Get returns a torrent for the hash provided
+// Get returns a torrent for the hash provided. v2 info hashes are resolved to their hybrid torrent.
 func (ts TorrentStore) Get(t *model.Torrent, ih model.InfoHash) error {
 	const q = `
 		SELECT 
-			info_hash::bytea, release_name, total_uploaded, total_downloaded, total_completed, 
-			is_deleted, is_enabled, reason, multi_up, multi_dn, announces
+			info_hash::bytea, info_hash_v2::bytea, release_name, total_uploaded, total_downloaded, 
+			total_completed, is_deleted, is_enabled, reason, multi_up, multi_dn, announces, tags, size
 		FROM 
 		    torrent 
 		WHERE 
-		    info_hash = $1 AND is_deleted = false`
+		    (info_hash = $1 OR info_hash_v2 = $1) AND is_deleted = false`
 	c, cancel := context.WithDeadline(ts.ctx, time.Now().Add(5*time.Second))
 	defer cancel()
-	var b []byte
+	var b, b2 []byte
 	err := ts.db.QueryRow(c, q, ih.Bytes()).Scan(
 		&b, // TODO implement pgx custom types to map automatically
+		&b2,
 		&t.ReleaseName,
 		&t.TotalUploaded,
 		&t.TotalDownloaded,
@@ -221,8 +917,11 @@ func (ts TorrentStore) Get(t *model.Torrent, ih model.InfoHash) error {
 		&t.MultiUp,
 		&t.MultiDn,
 		&t.Announces,
+		&t.Tags,
+		&t.Size,
 	)
 	copy(t.InfoHash[:], b)
+	copy(t.InfoHashV2[:], b2)
 	if err != nil {
 		if err.Error() == "no rows in result set" {
 			return consts.ErrInvalidInfoHash
@@ -232,6 +931,38 @@ func (ts TorrentStore) Get(t *model.Torrent, ih model.InfoHash) error {
 	return nil
 }
 
+// GetAll returns all the torrents known to the store which are not deleted
+func (ts TorrentStore) GetAll() (model.Torrents, error) {
+	const q = `
+		SELECT 
+			info_hash::bytea, info_hash_v2::bytea, release_name, total_uploaded, total_downloaded, 
+			total_completed, is_deleted, is_enabled, reason, multi_up, multi_dn, announces, tags, size
+		FROM 
+		    torrent 
+		WHERE 
+		    is_deleted = false`
+	c, cancel := context.WithDeadline(ts.ctx, time.Now().Add(15*time.Second))
+	defer cancel()
+	rows, err := ts.db.Query(c, q)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to select torrents")
+	}
+	defer rows.Close()
+	var torrents model.Torrents
+	for rows.Next() {
+		var t model.Torrent
+		var b, b2 []byte
+		if err := rows.Scan(&b, &b2, &t.ReleaseName, &t.TotalUploaded, &t.TotalDownloaded, &t.TotalCompleted,
+			&t.IsDeleted, &t.IsEnabled, &t.Reason, &t.MultiUp, &t.MultiDn, &t.Announces, &t.Tags, &t.Size); err != nil {
+			return nil, errors.Wrap(err, "Failed to fetch torrent")
+		}
+		copy(t.InfoHash[:], b)
+		copy(t.InfoHashV2[:], b2)
+		torrents = append(torrents, t)
+	}
+	return torrents, nil
+}
+
 // Close will close the underlying postgres database connection
 func (ts TorrentStore) Close() error {
 	c, cancel := context.WithDeadline(ts.ctx, time.Now().Add(15*time.Second))
@@ -256,10 +987,15 @@ func (ts TorrentStore) WhiteListDelete(client model.WhiteListClient) error {
 
 // WhiteListAdd will insert a new client prefix into the allowed clients list
 func (ts TorrentStore) WhiteListAdd(client model.WhiteListClient) error {
-	const q = `INSERT INTO whitelist (client_prefix, client_name) VALUES ($1, $2)`
+	const q = `
+		INSERT INTO whitelist 
+		    (client_prefix, client_name, min_version, max_version, banned_versions) 
+		VALUES 
+		    ($1, $2, $3, $4, $5)`
 	c, cancel := context.WithDeadline(ts.ctx, time.Now().Add(5*time.Second))
 	defer cancel()
-	commandTag, err := ts.db.Exec(c, q, client.ClientPrefix, client.ClientName)
+	commandTag, err := ts.db.Exec(c, q, client.ClientPrefix, client.ClientName,
+		client.MinVersion, client.MaxVersion, client.BannedVersions)
 	if err != nil {
 		return errors.Wrap(err, "Failed to insert new whitelist entry")
 	}
@@ -272,7 +1008,7 @@ func (ts TorrentStore) WhiteListAdd(client model.WhiteListClient) error {
 // WhiteListGetAll fetches all known whitelisted clients
 func (ts TorrentStore) WhiteListGetAll() ([]model.WhiteListClient, error) {
 	var wl []model.WhiteListClient
-	const q = `SELECT client_prefix, client_name FROM whitelist`
+	const q = `SELECT client_prefix, client_name, min_version, max_version, banned_versions FROM whitelist`
 	c, cancel := context.WithDeadline(ts.ctx, time.Now().Add(5*time.Second))
 	defer cancel()
 	rows, err := ts.db.Query(c, q)
@@ -282,7 +1018,8 @@ func (ts TorrentStore) WhiteListGetAll() ([]model.WhiteListClient, error) {
 	defer rows.Close()
 	for rows.Next() {
 		var client model.WhiteListClient
-		err = rows.Scan(&client.ClientPrefix, &client.ClientName)
+		err = rows.Scan(&client.ClientPrefix, &client.ClientName,
+			&client.MinVersion, &client.MaxVersion, &client.BannedVersions)
 		if err != nil {
 			return nil, errors.Wrap(err, "Failed to fetch client whitelist")
 		}
@@ -291,6 +1028,152 @@ func (ts TorrentStore) WhiteListGetAll() ([]model.WhiteListClient, error) {
 	return wl, nil
 }
 
+// PromotionAdd will insert a new promotion, replacing any existing promotion with the same name
+func (ts TorrentStore) PromotionAdd(promo model.Promotion) error {
+	const q = `
+		INSERT INTO promotion 
+		    (name, scope, tag, info_hashes, multi_up, multi_dn, time_start, time_end) 
+		VALUES 
+		    ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (name) DO UPDATE SET 
+		    scope = excluded.scope, tag = excluded.tag, info_hashes = excluded.info_hashes, 
+		    multi_up = excluded.multi_up, multi_dn = excluded.multi_dn, 
+		    time_start = excluded.time_start, time_end = excluded.time_end`
+	c, cancel := context.WithDeadline(ts.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	commandTag, err := ts.db.Exec(c, q, promo.Name, string(promo.Scope), promo.Tag, promo.InfoHashes.String(),
+		promo.MultiUp, promo.MultiDn, promo.TimeStart, promo.TimeEnd)
+	if err != nil {
+		return errors.Wrap(err, "Failed to insert new promotion")
+	}
+	if commandTag.RowsAffected() != 1 {
+		return errors.New("Failed to insert, but no error?")
+	}
+	return nil
+}
+
+// PromotionDelete removes a promotion
+func (ts TorrentStore) PromotionDelete(promo model.Promotion) error {
+	const q = `DELETE FROM promotion WHERE name = $1`
+	c, cancel := context.WithDeadline(ts.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	commandTag, err := ts.db.Exec(c, q, promo.Name)
+	if err != nil {
+		return errors.Wrap(err, "Failed to delete promotion")
+	}
+	if commandTag.RowsAffected() != 1 {
+		return consts.ErrInvalidPromotion
+	}
+	return nil
+}
+
+// PromotionGetAll fetches all known promotions
+func (ts TorrentStore) PromotionGetAll() ([]model.Promotion, error) {
+	var promos []model.Promotion
+	const q = `
+		SELECT 
+		    name, scope, tag, info_hashes, multi_up, multi_dn, time_start, time_end 
+		FROM 
+		    promotion`
+	c, cancel := context.WithDeadline(ts.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	rows, err := ts.db.Query(c, q)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to select promotions")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var promo model.Promotion
+		var scope, hashes string
+		err = rows.Scan(&promo.Name, &scope, &promo.Tag, &hashes,
+			&promo.MultiUp, &promo.MultiDn, &promo.TimeStart, &promo.TimeEnd)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to fetch promotion")
+		}
+		promo.Scope = model.PromotionScope(scope)
+		if promo.InfoHashes, err = model.ParseInfoHashes(hashes); err != nil {
+			return nil, errors.Wrap(err, "Failed to decode promotion info hashes")
+		}
+		promos = append(promos, promo)
+	}
+	return promos, nil
+}
+
+// BanAdd inserts the bans provided, replacing any existing bans with the same CIDR
+func (ts TorrentStore) BanAdd(bans []model.Ban) error {
+	const txName = "banAdd"
+	const q = `
+		INSERT INTO ban 
+		    (cidr, reason, time_created, time_expire) 
+		VALUES 
+		    ($1, $2, $3, $4)
+		ON CONFLICT (cidr) DO UPDATE SET 
+		    reason = excluded.reason, time_created = excluded.time_created, time_expire = excluded.time_expire`
+	c, cancel := context.WithDeadline(ts.ctx, time.Now().Add(time.Second*30))
+	defer cancel()
+	tx, err := ts.db.Begin(c)
+	if err != nil {
+		return errors.Wrap(err, "postgres.TorrentStore.BanAdd Failed to begin transaction")
+	}
+	defer func() { _ = tx.Rollback(c) }()
+	if _, err := tx.Prepare(c, txName, q); err != nil {
+		return errors.Wrap(err, "postgres.TorrentStore.BanAdd Failed to prepare transaction")
+	}
+	for _, b := range bans {
+		var expire *time.Time
+		if !b.Permanent() {
+			expire = &b.TimeExpire
+		}
+		if _, err := tx.Exec(c, txName, b.CIDR, b.Reason, b.TimeCreated, expire); err != nil {
+			return errors.Wrapf(err, "postgres.TorrentStore.BanAdd failed to Exec tx")
+		}
+	}
+	if err := tx.Commit(c); err != nil {
+		return errors.Wrapf(err, "postgres.TorrentStore.BanAdd failed to commit tx")
+	}
+	return nil
+}
+
+// BanDelete removes the ban matching the CIDR
+func (ts TorrentStore) BanDelete(cidr string) error {
+	const q = `DELETE FROM ban WHERE cidr = $1`
+	c, cancel := context.WithDeadline(ts.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	commandTag, err := ts.db.Exec(c, q, cidr)
+	if err != nil {
+		return errors.Wrap(err, "Failed to delete ban")
+	}
+	if commandTag.RowsAffected() != 1 {
+		return consts.ErrInvalidBan
+	}
+	return nil
+}
+
+// BanGetAll fetches all known bans
+func (ts TorrentStore) BanGetAll() ([]model.Ban, error) {
+	var bans []model.Ban
+	const q = `SELECT cidr, reason, time_created, time_expire FROM ban`
+	c, cancel := context.WithDeadline(ts.ctx, time.Now().Add(30*time.Second))
+	defer cancel()
+	rows, err := ts.db.Query(c, q)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to select bans")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var b model.Ban
+		var expire *time.Time
+		if err := rows.Scan(&b.CIDR, &b.Reason, &b.TimeCreated, &expire); err != nil {
+			return nil, errors.Wrap(err, "Failed to fetch ban")
+		}
+		if expire != nil {
+			b.TimeExpire = *expire
+		}
+		bans = append(bans, b)
+	}
+	return bans, nil
+}
+
 // PeerStore is the postgres backed implementation of store.PeerStore
 type PeerStore struct {
 	db  *pgx.Conn
@@ -307,9 +1190,12 @@ func (ps PeerStore) Sync(batch map[model.PeerHash]model.PeerStats) error {
 			downloaded = (downloaded + $1),
 		    uploaded = (uploaded + $2),
 		    announces = (announces + $3),
-		    announce_last = $4
+		    announce_last = $4,
+		    session_downloaded = $5,
+		    session_uploaded = $6,
+		    total_left = $7
 		WHERE
-			peer_id = $5 AND info_hash = $6
+			peer_id = $8 AND info_hash = $9
 `
 	c, cancel := context.WithDeadline(ps.ctx, time.Now().Add(time.Second*10))
 	defer cancel()
@@ -325,6 +1211,7 @@ func (ps PeerStore) Sync(batch map[model.PeerHash]model.PeerStats) error {
 
 	for peerHash, stats := range batch {
 		if _, err := tx.Exec(c, txName, stats.Downloaded, stats.Uploaded, stats.Announces, stats.LastAnnounce,
+			stats.SessionDownloaded, stats.SessionUploaded, stats.Left,
 			peerHash.PeerID().Bytes(), peerHash.InfoHash().Bytes()); err != nil {
 			return errors.Wrapf(err, "postgres.PeerStore.Sync failed to Exec tx")
 		}
@@ -355,15 +1242,16 @@ func (ps PeerStore) Reap() {
 func (ps PeerStore) Add(ih model.InfoHash, p model.Peer) error {
 	const q = `
 	INSERT INTO peers 
-	    (peer_id, info_hash, addr_ip, addr_port, location, user_id, announce_first, announce_last)
+	    (peer_id, info_hash, addr_ip, addr_ipv6, addr_port, location, user_id, announce_first, announce_last, peer_key,
+	     session_downloaded, session_uploaded, total_left, passkey_label)
 	VALUES 
-	    ($1, $2, $3, $4::int, ST_MakePoint($6, $5), $7, $8, $9)
+	    ($1, $2, $3, $4, $5::int, ST_MakePoint($7, $6), $8, $9, $10, $11, $12, $13, $14, $15)
 	`
 	c, cancel := context.WithDeadline(ps.ctx, time.Now().Add(5*time.Second))
 	defer cancel()
 	commandTag, err := ps.db.Exec(c, q,
-		p.PeerID.Bytes(), ih.Bytes(), p.IP, p.Port, p.Location.Latitude, p.Location.Longitude, p.UserID,
-		p.AnnounceFirst, p.AnnounceLast)
+		p.PeerID.Bytes(), ih.Bytes(), p.IP, p.IPv6, p.Port, p.Location.Latitude, p.Location.Longitude, p.UserID,
+		p.AnnounceFirst, p.AnnounceLast, p.Key, p.SessionDownloaded, p.SessionUploaded, p.Left, p.PasskeyLabel)
 	if err != nil {
 		return err
 	}
@@ -373,6 +1261,23 @@ func (ps PeerStore) Add(ih model.InfoHash, p model.Peer) error {
 	return nil
 }
 
+// UpdateAddr will update the addresses, port and key of an existing peer in the swarm
+func (ps PeerStore) UpdateAddr(ih model.InfoHash, p model.Peer) error {
+	const q = `
+		UPDATE 
+			peers 
+		SET 
+			addr_ip = $1, addr_ipv6 = $2, addr_port = $3::int, peer_key = $4 
+		WHERE 
+			info_hash = $5 AND peer_id = $6`
+	c, cancel := context.WithDeadline(ps.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	if _, err := ps.db.Exec(c, q, p.IP, p.IPv6, p.Port, p.Key, ih.Bytes(), p.PeerID.Bytes()); err != nil {
+		return errors.Wrap(err, "Failed to update peer address")
+	}
+	return nil
+}
+
 // Delete will remove a peer from the swarm of the torrent provided
 func (ps PeerStore) Delete(ih model.InfoHash, p model.PeerID) error {
 	const q = `DELETE FROM peers WHERE info_hash = $1 AND peer_id = $2`
@@ -382,12 +1287,32 @@ func (ps PeerStore) Delete(ih model.InfoHash, p model.PeerID) error {
 	return err
 }
 
+// Counts returns the total number of seeders and leechers in a torrents active swarm
+func (ps PeerStore) Counts(ih model.InfoHash) (uint, uint, error) {
+	const q = `
+		SELECT 
+			count(*) FILTER (WHERE total_left = 0), 
+			count(*) FILTER (WHERE total_left > 0)
+		FROM 
+		    peers 
+		WHERE 
+		    info_hash = $1`
+	c, cancel := context.WithDeadline(ps.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	var seeders, leechers int64
+	if err := ps.db.QueryRow(c, q, ih.Bytes()).Scan(&seeders, &leechers); err != nil {
+		return 0, 0, errors.Wrap(err, "Failed to query peer counts")
+	}
+	return uint(seeders), uint(leechers), nil
+}
+
 // GetN will fetch the torrents swarm member peers
 func (ps PeerStore) GetN(ih model.InfoHash, limit int) (model.Swarm, error) {
 	const q = `
 		SELECT 
-		    peer_id::bytea, info_hash::bytea, user_id, addr_ip, addr_port, downloaded, uploaded, 
-			announces, speed_up, speed_dn, speed_up_max, speed_dn_max, ST_x(location), ST_y(location)
+		    peer_id::bytea, info_hash::bytea, user_id, addr_ip, addr_ipv6, addr_port, peer_key, downloaded, uploaded, 
+			session_downloaded, session_uploaded, announces, speed_up, speed_dn, speed_up_max, speed_dn_max, 
+			ST_x(location), ST_y(location), passkey_label
 		FROM
 		    peers 
 		WHERE
@@ -404,8 +1329,9 @@ func (ps PeerStore) GetN(ih model.InfoHash, limit int) (model.Swarm, error) {
 	defer rows.Close()
 	for rows.Next() {
 		var p model.Peer
-		err = rows.Scan(&p.PeerID, &p.InfoHash, &p.UserID, &p.IP, &p.Port, &p.Downloaded, &p.Uploaded,
-			&p.Announces, &p.SpeedUP, &p.SpeedDN, &p.SpeedUPMax, &p.SpeedDNMax, &p.Location.Longitude, &p.Location.Latitude)
+		err = rows.Scan(&p.PeerID, &p.InfoHash, &p.UserID, &p.IP, &p.IPv6, &p.Port, &p.Key, &p.Downloaded, &p.Uploaded,
+			&p.SessionDownloaded, &p.SessionUploaded, &p.Announces, &p.SpeedUP, &p.SpeedDN, &p.SpeedUPMax, &p.SpeedDNMax, &p.Location.Longitude, &p.Location.Latitude,
+			&p.PasskeyLabel)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to fetch N peers from store")
 		}
@@ -417,21 +1343,58 @@ func (ps PeerStore) GetN(ih model.InfoHash, limit int) (model.Swarm, error) {
 	return peers, nil
 }
 
+// GetByUser returns the active peers of the user across all swarms
+func (ps PeerStore) GetByUser(userID uint32) (model.Swarm, error) {
+	const q = `
+		SELECT 
+		    peer_id::bytea, info_hash::bytea, user_id, addr_ip, addr_ipv6, addr_port, peer_key, downloaded, uploaded, 
+			total_left, session_downloaded, session_uploaded, announces, speed_up, speed_dn, speed_up_max, speed_dn_max, 
+			ST_x(location), ST_y(location), announce_last, announce_first, passkey_label
+		FROM
+		    peers 
+		WHERE
+		      user_id = $1`
+	var peers model.Swarm
+	c, cancel := context.WithDeadline(ps.ctx, time.Now().Add(5*time.Second))
+	defer cancel()
+	rows, err := ps.db.Query(c, q, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to query user peers")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p model.Peer
+		if err := rows.Scan(&p.PeerID, &p.InfoHash, &p.UserID, &p.IP, &p.IPv6, &p.Port, &p.Key, &p.Downloaded,
+			&p.Uploaded, &p.Left, &p.SessionDownloaded, &p.SessionUploaded, &p.Announces, &p.SpeedUP, &p.SpeedDN,
+			&p.SpeedUPMax, &p.SpeedDNMax, &p.Location.Longitude, &p.Location.Latitude, &p.AnnounceLast,
+			&p.AnnounceFirst, &p.PasskeyLabel); err != nil {
+			return nil, errors.Wrap(err, "Failed to scan user peer")
+		}
+		peers = append(peers, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "Error in user peer query")
+	}
+	return peers, nil
+}
+
 // Get will fetch the peer from the swarm if it exists
 func (ps PeerStore) Get(p *model.Peer, ih model.InfoHash, peerID model.PeerID) error {
 	const q = `
 		SELECT 
-		       peer_id, info_hash, user_id, addr_ip, addr_port, downloaded, uploaded, announces,
-		       speed_up, speed_dn, speed_up_max, speed_dn_max, location
+		       peer_id::bytea, info_hash::bytea, user_id, addr_ip, addr_ipv6, addr_port, peer_key, downloaded, 
+		       uploaded, session_downloaded, session_uploaded, announces, speed_up, speed_dn, speed_up_max, 
+		       speed_dn_max, ST_x(location), ST_y(location), announce_last, announce_first, passkey_label
 		FROM
 		    peers 
 		WHERE 
 			info_hash = $1 AND peer_id = $2`
 	c, cancel := context.WithDeadline(ps.ctx, time.Now().Add(5*time.Second))
 	defer cancel()
-	err := ps.db.QueryRow(c, q, ih, peerID).Scan(
-		p.PeerID, p.InfoHash, p.UserID, p.IP, p.Port, p.Downloaded, p.Uploaded,
-		p.Announces, p.SpeedUP, p.SpeedDN, p.SpeedUPMax, p.SpeedDNMax, p.Location)
+	err := ps.db.QueryRow(c, q, ih.Bytes(), peerID.Bytes()).Scan(
+		&p.PeerID, &p.InfoHash, &p.UserID, &p.IP, &p.IPv6, &p.Port, &p.Key, &p.Downloaded, &p.Uploaded,
+		&p.SessionDownloaded, &p.SessionUploaded, &p.Announces, &p.SpeedUP, &p.SpeedDN, &p.SpeedUPMax, &p.SpeedDNMax,
+		&p.Location.Longitude, &p.Location.Latitude, &p.AnnounceLast, &p.AnnounceFirst, &p.PasskeyLabel)
 	if err != nil {
 		return errors.Wrap(err, "Unknown peer")
 	}
@@ -37,6 +37,28 @@ func TestUserDriver(t *testing.T) {
 	})
 }
 
+func TestHashedUserDriver(t *testing.T) {
+	db, err := pgx.Connect(context.Background(), makeDSN(config.GetStoreConfig(config.Users)))
+	if err != nil {
+		t.Skipf("failed to connect to postgres user store: %s", err.Error())
+		return
+	}
+	setupDB(t, db)
+	// Databases created before passkeys could be hashed are widened by the migration
+	for _, q := range []string{
+		`alter table users alter column passkey type varchar(20);`,
+		`alter table passkey alter column passkey type varchar(20);`,
+	} {
+		if _, err := db.Exec(context.Background(), q); err != nil {
+			t.Fatalf("Failed to narrow passkey columns: %s", err.Error())
+		}
+	}
+	store.TestHashedUserStore(t, &UserStore{
+		db:  db,
+		ctx: context.Background(),
+	})
+}
+
 func TestPeerDriver(t *testing.T) {
 	db, err := pgx.Connect(context.Background(), makeDSN(config.GetStoreConfig(config.Peers)))
 	if err != nil {
@@ -49,7 +71,7 @@ func TestPeerDriver(t *testing.T) {
 
 func clearDB(db *pgx.Conn) {
 	ctx := context.Background()
-	for _, table := range []string{"peers", "torrent", "users", "whitelist"} {
+	for _, table := range []string{"peers", "torrent", "users", "whitelist", "promotion", "hnr", "snatch", "freeleech", "ledger", "ratio_watch", "ban", "passkey"} {
 		q := fmt.Sprintf(`drop table if exists %s cascade;`, table)
 		if _, err := db.Exec(ctx, q); err != nil {
 			log.Panicf("Failed to prep database: %s", err.Error())
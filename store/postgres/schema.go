@@ -14,6 +14,7 @@ END $$;
 create table torrent
 (
     info_hash bytea check (octet_length(info_hash) = 20) not null primary key,
+    info_hash_v2 bytea check (octet_length(info_hash_v2) = 20) null,
     release_name varchar(255) not null,
     total_uploaded int default 0 not null,
     total_downloaded int default 0 not null,
@@ -24,6 +25,10 @@ create table torrent
     multi_up decimal(5,2) default 1.00 not null,
     multi_dn decimal(5,2) default 1.00 not null,
 	announces int default 0 not null,
+    tags varchar(255) default '' not null,
+    size bigint default 0 not null,
+    constraint uq_info_hash_v2
+        unique (info_hash_v2),
     constraint uq_release_name
         unique (release_name)
 );
@@ -32,12 +37,20 @@ create table users
 (
     user_id SERIAL
         primary key,
-    passkey varchar(20) not null,
+    passkey varchar(64) not null,
     download_enabled bool default 't' not null,
     is_deleted bool default 'f' not null,
+    is_admin bool default 'f' not null,
     downloaded bigint default 0 not null,
     uploaded bigint default 0 not null,
+    downloaded_raw bigint default 0 not null,
+    uploaded_raw bigint default 0 not null,
     announces int default 0 not null,
+    bonus_points double precision default 0 not null,
+    leech_denied int default 0 not null,
+    slots_leech int default 0 not null,
+    slots_seed int default 0 not null,
+    slots_torrent int default 0 not null,
     constraint user_passkey_uindex
         unique (passkey)
 );
@@ -47,11 +60,16 @@ create table peers
     peer_id bytea  check (octet_length(peer_id) = 20) not null,
     info_hash bytea  check (octet_length(info_hash) = 20) not null,
     user_id int not null,
-    addr_ip inet not null,
+    addr_ip inet null,
+    addr_ipv6 inet null,
     addr_port uint2 not null,
-    downloaded int default 0 not null,
-    uploaded int default 0 not null,
+    peer_key varchar(64) default '' not null,
+    passkey_label varchar(64) default '' not null,
+    downloaded bigint default 0 not null,
+    uploaded bigint default 0 not null,
     total_left int default 0 not null,
+    session_downloaded bigint default 0 not null,
+    session_uploaded bigint default 0 not null,
     total_time int default 0 not null,
     announces int default 0 not null,
     speed_up int default 0 not null,
@@ -64,10 +82,118 @@ create table peers
     primary key (info_hash, peer_id)
 );
 
+create index idx_peers_user on peers (user_id);
+
 create table whitelist
 (
     client_prefix varchar(10) not null
         primary key,
-    client_name varchar(20) not null
+    client_name varchar(20) not null,
+    min_version varchar(20) default '' not null,
+    max_version varchar(20) default '' not null,
+    banned_versions varchar(255) default '' not null
+);
+
+create table promotion
+(
+    name varchar(64) not null
+        primary key,
+    scope varchar(10) not null,
+    tag varchar(64) default '' not null,
+    info_hashes text not null,
+    multi_up decimal(5,2) default 1.00 not null,
+    multi_dn decimal(5,2) default 1.00 not null,
+    time_start timestamp not null,
+    time_end timestamp not null
+);
+
+create table ban
+(
+    cidr varchar(43) not null
+        primary key,
+    reason varchar(255) not null,
+    time_created timestamp not null,
+    time_expire timestamp
+);
+
+create table hnr
+(
+    user_id int not null,
+    info_hash bytea check (octet_length(info_hash) = 20) not null,
+    status varchar(10) not null,
+    seed_time int default 0 not null,
+    time_completed timestamptz not null,
+    time_last_seed timestamptz not null,
+    primary key (user_id, info_hash)
+);
+
+create table snatch
+(
+    user_id int not null,
+    info_hash bytea check (octet_length(info_hash) = 20) not null,
+    time_completed timestamptz not null,
+    addr_ip inet null,
+    client varchar(64) default '' not null,
+    uploaded bigint default 0 not null,
+    downloaded bigint default 0 not null,
+    primary key (user_id, info_hash)
 );
+
+create index idx_snatch_info_hash on snatch (info_hash, time_completed);
+create index idx_snatch_user on snatch (user_id, time_completed);
+
+create table freeleech
+(
+    user_id int not null,
+    info_hash bytea check (octet_length(info_hash) = 20) not null,
+    time_created timestamptz not null,
+    time_expire timestamptz not null,
+    primary key (user_id, info_hash)
+);
+
+create table ledger
+(
+    ledger_id bigserial primary key,
+    user_id int not null,
+    source varchar(16) not null,
+    uploaded bigint default 0 not null,
+    downloaded bigint default 0 not null,
+    bonus_points double precision default 0 not null,
+    reason varchar(255) default '' not null,
+    actor varchar(64) default '' not null,
+    time_created timestamptz not null
+);
+
+create index idx_ledger_user on ledger (user_id, ledger_id);
+
+create table ratio_watch
+(
+    user_id int not null primary key,
+    status varchar(10) not null,
+    required_ratio double precision not null,
+    ratio double precision not null,
+    time_warned timestamptz not null,
+    time_deadline timestamptz not null,
+    time_updated timestamptz not null
+);
+
+create table passkey
+(
+    passkey varchar(64) not null primary key,
+    user_id int not null,
+    label varchar(64) default '' not null,
+    time_created timestamptz not null,
+    time_expire timestamptz,
+    time_last_used timestamptz,
+    addr_ip inet null
+);
+
+create index idx_passkey_user on passkey (user_id);
 `
+
+// passkeyDigestMigration widens the passkey columns of databases created before passkeys could be
+// stored as digests. It is applied by PasskeyMigrate before any digests are written.
+var passkeyDigestMigration = []string{
+	`alter table users alter column passkey type varchar(64);`,
+	`alter table passkey alter column passkey type varchar(64);`,
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"fmt"
+	"github.com/leighmacdonald/mika/consts"
+	log "github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	rateLimitDriversMutex = sync.RWMutex{}
+	rateLimitDrivers      = make(map[string]RateLimitDriver)
+)
+
+// Rate defines a token bucket which holds up to Count tokens and is refilled at a rate of
+// Count tokens per Period. A zero value Rate disables limiting.
+type Rate struct {
+	Count  int
+	Period time.Duration
+}
+
+// Enabled returns true if the rate has a usable count and period
+func (r Rate) Enabled() bool {
+	return r.Count > 0 && r.Period > 0
+}
+
+// String returns the rate in the same count/period format used by ParseRate
+func (r Rate) String() string {
+	return fmt.Sprintf("%d/%s", r.Count, r.Period)
+}
+
+// ParseRate parses a rate in the format count/period, eg: 10/1m. An empty string
+// returns a disabled Rate.
+func ParseRate(s string) (Rate, error) {
+	if s == "" {
+		return Rate{}, nil
+	}
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return Rate{}, fmt.Errorf("invalid rate: %s", s)
+	}
+	count, err := strconv.Atoi(parts[0])
+	if err != nil || count < 0 {
+		return Rate{}, fmt.Errorf("invalid rate count: %s", s)
+	}
+	period, err := time.ParseDuration(parts[1])
+	if err != nil || period < 0 {
+		return Rate{}, fmt.Errorf("invalid rate period: %s", s)
+	}
+	return Rate{Count: count, Period: period}, nil
+}
+
+// RateLimitDriver provides a interface to enable registration of RateLimiter drivers
+type RateLimitDriver interface {
+	// NewRateLimiter instantiates a new RateLimiter
+	NewRateLimiter(config interface{}) (RateLimiter, error)
+}
+
+// AddRateLimitDriver will register a new driver able to instantiate a RateLimiter
+func AddRateLimitDriver(name string, driver RateLimitDriver) {
+	rateLimitDriversMutex.Lock()
+	defer rateLimitDriversMutex.Unlock()
+	rateLimitDrivers[name] = driver
+	log.Debugf("Registered rate limit driver: %s", name)
+}
+
+// RateLimiter tracks token buckets used to limit how often clients can make requests. Shared
+// backends such as redis allow limits to be enforced across multiple tracker instances.
+type RateLimiter interface {
+	// Allow consumes a token from the bucket for the key, returning false if the bucket is empty
+	Allow(key string, rate Rate) (bool, error)
+	// Close will cleanup and close the underlying storage driver if necessary
+	Close() error
+}
+
+// NewRateLimiter will attempt to initialize a RateLimiter using the driver name provided
+func NewRateLimiter(limiterType string, config interface{}) (RateLimiter, error) {
+	rateLimitDriversMutex.RLock()
+	defer rateLimitDriversMutex.RUnlock()
+	driver, found := rateLimitDrivers[limiterType]
+	if !found {
+		return nil, consts.ErrInvalidDriver
+	}
+	return driver.NewRateLimiter(config)
+}
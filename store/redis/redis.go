@@ -13,6 +13,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"net"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -24,19 +25,88 @@ const (
 const (
 	prefixWhitelist = "whitelist"
 	prefixTorrent   = "t"
+	prefixTorrentV2 = "t2"
 	prefixPeer      = "p"
 	prefixUser      = "u"
 	prefixUserID    = "user_id_pk"
+	prefixRateLimit = "rl"
+	prefixPromotion = "promo"
+	prefixHNR       = "hnr"
+	prefixSnatch    = "snatch"
+	// prefixSnatchUser & prefixSnatchTorrent are the sorted sets of snatches scored by completion time
+	prefixSnatchUser    = "snatch_u"
+	prefixSnatchTorrent = "snatch_t"
+	prefixFreeleech     = "freeleech"
+	prefixLedger        = "ledger"
+	// prefixLedgerUser is the sorted set of a users ledger entries scored by the entry id
+	prefixLedgerUser = "ledger_u"
+	// prefixLedgerID is the counter used to allocate ledger entry ids
+	prefixLedgerID   = "ledger_id"
+	prefixRatioWatch = "ratio_watch"
+	// prefixPeerUser is the set of peer keys of a users active peers
+	prefixPeerUser = "p_u"
+	prefixBan      = "ban"
+	// prefixBanSet is the set of the CIDRs of every ban
+	prefixBanSet = "bans"
+	// prefixPasskey is the hash of an additional passkey of a user
+	prefixPasskey = "pk"
+	// prefixPasskeyUser is the set of a users additional passkeys
+	prefixPasskeyUser = "pk_u"
 )
 
 func whiteListKey(prefix string) string {
 	return fmt.Sprintf("%s%s", prefixWhitelist, prefix)
 }
 
+func banKey(cidr string) string {
+	return fmt.Sprintf("%s:%s", prefixBan, cidr)
+}
+
+func promotionKey(name string) string {
+	return fmt.Sprintf("%s:%s", prefixPromotion, name)
+}
+
+func hnrKey(userID uint32, ih model.InfoHash) string {
+	return fmt.Sprintf("%s:%d:%s", prefixHNR, userID, ih.String())
+}
+
+func freeleechKey(userID uint32, ih model.InfoHash) string {
+	return fmt.Sprintf("%s:%d:%s", prefixFreeleech, userID, ih.String())
+}
+
+func ratioWatchKey(userID uint32) string {
+	return fmt.Sprintf("%s:%d", prefixRatioWatch, userID)
+}
+
+func ledgerKey(ledgerID uint64) string {
+	return fmt.Sprintf("%s:%d", prefixLedger, ledgerID)
+}
+
+func ledgerUserKey(userID uint32) string {
+	return fmt.Sprintf("%s:%d", prefixLedgerUser, userID)
+}
+
+func snatchKey(userID uint32, ih model.InfoHash) string {
+	return fmt.Sprintf("%s:%d:%s", prefixSnatch, userID, ih.String())
+}
+
+func snatchUserKey(userID uint32) string {
+	return fmt.Sprintf("%s:%d", prefixSnatchUser, userID)
+}
+
+func snatchTorrentKey(ih model.InfoHash) string {
+	return fmt.Sprintf("%s:%s", prefixSnatchTorrent, ih.String())
+}
+
 func torrentKey(t model.InfoHash) string {
 	return fmt.Sprintf("%s:%s", prefixTorrent, t.String())
 }
 
+// torrentV2Key is the key of the alias from a v2 info hash to its hybrid torrents v1 info hash
+func torrentV2Key(t model.InfoHash) string {
+	return fmt.Sprintf("%s:%s", prefixTorrentV2, t.String())
+}
+
 func torrentPeersKey(t model.InfoHash) string {
 	return fmt.Sprintf("%s:%s:*", prefixPeer, t.String())
 }
@@ -45,51 +115,174 @@ func peerKey(t model.InfoHash, p model.PeerID) string {
 	return fmt.Sprintf("%s:%s:%s", prefixPeer, t.String(), p.String())
 }
 
+func peerUserKey(userID uint32) string {
+	return fmt.Sprintf("%s:%d", prefixPeerUser, userID)
+}
+
+// ipString returns the string form of the ip, or a empty string for nil values
+func ipString(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
 func userKey(passkey string) string {
 	return fmt.Sprintf("%s:%s", prefixUser, passkey)
 }
 
+func rateLimitKey(key string) string {
+	return fmt.Sprintf("%s:%s", prefixRateLimit, key)
+}
+
 func userIDKey(userID uint32) string {
 	return fmt.Sprintf("%s:%d", prefixUserID, userID)
 }
 
+func passkeyKey(passkey string) string {
+	return fmt.Sprintf("%s:%s", prefixPasskey, passkey)
+}
+
+func passkeyUserKey(userID uint32) string {
+	return fmt.Sprintf("%s:%d", prefixPasskeyUser, userID)
+}
+
 // UserStore is the redis backed store.TorrentStore implementation
 type UserStore struct {
 	client *redis.Client
 }
 
-// Sync batch updates the backing store with the new UserStats provided
-// TODO leverage cache layer so we can pipeline the updates w/o query first
-func (us UserStore) Sync(b map[string]model.UserStats) error {
-	for passkey, stats := range b {
-		old, err := us.client.HGetAll(userKey(passkey)).Result()
+// Sync batch updates the backing store with the new UserStats provided. The totals are
+// incremented within a transaction so they cannot race with ledger adjustments.
+func (us UserStore) Sync(b map[uint32]model.UserStats) error {
+	now := time.Now()
+	for userID, stats := range b {
+		passkey, err := us.client.Get(userIDKey(userID)).Result()
+		if err != nil {
+			if err == redis.Nil {
+				// Deleted user
+				continue
+			}
+			return errors.Wrap(err, "Failed to get user passkey from redis")
+		}
+		entry := model.NewSyncLedgerEntry(userID, stats, now)
+		if !entry.Empty() {
+			if entry.LedgerID, err = us.client.Incr(prefixLedgerID).Uint64(); err != nil {
+				return errors.Wrap(err, "Failed to allocate ledger id")
+			}
+		}
+		pipe := us.client.TxPipeline()
+		pipe.HIncrBy(userKey(passkey), "downloaded", int64(stats.Downloaded))
+		pipe.HIncrBy(userKey(passkey), "uploaded", int64(stats.Uploaded))
+		pipe.HIncrBy(userKey(passkey), "downloaded_raw", int64(stats.DownloadedRaw))
+		pipe.HIncrBy(userKey(passkey), "uploaded_raw", int64(stats.UploadedRaw))
+		pipe.HIncrBy(userKey(passkey), "announces", int64(stats.Announces))
+		pipe.HIncrByFloat(userKey(passkey), "bonus_points", stats.BonusPoints)
+		pipe.HIncrBy(userKey(passkey), "leech_denied", int64(stats.LeechDenied))
+		if !entry.Empty() {
+			ledgerAdd(pipe, entry)
+		}
+		if _, err := pipe.Exec(); err != nil {
+			return errors.Wrap(err, "Failed to sync user")
+		}
+	}
+	return nil
+}
+
+// ledgerAdd queues the commands to store the ledger entry and index it by the user
+func ledgerAdd(pipe redis.Pipeliner, entry model.LedgerEntry) {
+	pipe.HSet(ledgerKey(entry.LedgerID), map[string]interface{}{
+		"ledger_id":    entry.LedgerID,
+		"user_id":      entry.UserID,
+		"source":       string(entry.Source),
+		"uploaded":     entry.Uploaded,
+		"downloaded":   entry.Downloaded,
+		"bonus_points": entry.BonusPoints,
+		"reason":       entry.Reason,
+		"actor":        entry.Actor,
+		"time_created": util.TimeToString(entry.TimeCreated),
+	})
+	pipe.ZAdd(ledgerUserKey(entry.UserID), &redis.Z{
+		Score:  float64(entry.LedgerID),
+		Member: entry.LedgerID,
+	})
+}
+
+// clampDelta limits a negative change so the total does not go below zero
+func clampDelta(total int64, delta int64) int64 {
+	if total+delta < 0 {
+		return -total
+	}
+	return delta
+}
+
+// LedgerAdjust applies the manual adjustment to the users stats and records it in the ledger. The
+// users key is watched so the adjustment fails instead of racing with a concurrent Sync.
+func (us UserStore) LedgerAdjust(entry model.LedgerEntry) error {
+	passkey, err := us.client.Get(userIDKey(entry.UserID)).Result()
+	if err != nil || passkey == "" {
+		if err != nil && err != redis.Nil {
+			return errors.Wrap(err, "Failed to lookup user passkey")
+		}
+		return consts.ErrInvalidUser
+	}
+	if entry.LedgerID, err = us.client.Incr(prefixLedgerID).Uint64(); err != nil {
+		return errors.Wrap(err, "Failed to allocate ledger id")
+	}
+	key := userKey(passkey)
+	err = us.client.Watch(func(tx *redis.Tx) error {
+		v, err := tx.HMGet(key, "uploaded", "downloaded").Result()
 		if err != nil {
-			return errors.Wrap(err, "Failed to get user from redis")
-		}
-		var downloaded uint64
-		var uploaded uint64
-		var announces uint32
-		downloadedStr, found := old["downloaded"]
-		if found {
-			downloaded = util.StringToUInt64(downloadedStr, 0)
-		}
-		uploadedStr, found := old["uploaded"]
-		if found {
-			uploaded = util.StringToUInt64(uploadedStr, 0)
-		}
-		announcesStr, found := old["announces"]
-		if found {
-			announces = util.StringToUInt32(announcesStr, 0)
-		}
-		us.client.HSet(userKey(passkey), map[string]interface{}{
-			"downloaded": downloaded + stats.Downloaded,
-			"uploaded":   uploaded + stats.Uploaded,
-			"announces":  announces + stats.Announces,
+			return err
+		}
+		var totals [2]int64
+		for i, val := range v {
+			if s, ok := val.(string); ok {
+				totals[i] = util.StringToInt64(s, 0)
+			}
+		}
+		_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+			pipe.HIncrBy(key, "uploaded", clampDelta(totals[0], entry.Uploaded))
+			pipe.HIncrBy(key, "downloaded", clampDelta(totals[1], entry.Downloaded))
+			pipe.HIncrByFloat(key, "bonus_points", entry.BonusPoints)
+			ledgerAdd(pipe, entry)
+			return nil
 		})
+		return err
+	}, key)
+	if err != nil {
+		return errors.Wrap(err, "Failed to apply ledger adjustment")
 	}
 	return nil
 }
 
+// LedgerGetByUser returns up to limit ledger entries of a user starting from offset, newest first
+func (us UserStore) LedgerGetByUser(userID uint32, offset int, limit int) ([]model.LedgerEntry, error) {
+	ids, err := us.client.ZRevRange(ledgerUserKey(userID), int64(offset), int64(offset+limit-1)).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to fetch user ledger")
+	}
+	var entries []model.LedgerEntry
+	for _, id := range ids {
+		v, err := us.client.HGetAll(ledgerKey(util.StringToUInt64(id, 0))).Result()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to fetch ledger entry: %s", id)
+		}
+		entries = append(entries, model.LedgerEntry{
+			LedgerID:    util.StringToUInt64(v["ledger_id"], 0),
+			UserID:      util.StringToUInt32(v["user_id"], 0),
+			Source:      model.LedgerSource(v["source"]),
+			Uploaded:    util.StringToInt64(v["uploaded"], 0),
+			Downloaded:  util.StringToInt64(v["downloaded"], 0),
+			BonusPoints: util.StringToFloat64(v["bonus_points"], 0),
+			Reason:      v["reason"],
+			Actor:       v["actor"],
+			TimeCreated: util.StringToTime(v["time_created"]),
+		})
+	}
+	return entries, nil
+}
+
 // Add inserts a user into redis via at the string provided by the userKey function
 // This additionally sets the passkey->user_id mapping
 func (us UserStore) Add(u model.User) error {
@@ -99,9 +292,17 @@ func (us UserStore) Add(u model.User) error {
 		"passkey":          u.Passkey,
 		"download_enabled": u.DownloadEnabled,
 		"is_deleted":       u.IsDeleted,
+		"is_admin":         u.IsAdmin,
 		"downloaded":       u.Downloaded,
 		"uploaded":         u.Uploaded,
+		"downloaded_raw":   u.DownloadedRaw,
+		"uploaded_raw":     u.UploadedRaw,
 		"announces":        u.Announces,
+		"bonus_points":     u.BonusPoints,
+		"leech_denied":     u.LeechDenied,
+		"slots_leech":      u.Leech,
+		"slots_seed":       u.Seed,
+		"slots_torrent":    u.PerTorrent,
 	})
 	pipe.Set(userIDKey(u.UserID), u.Passkey, 0)
 	if _, err := pipe.Exec(); err != nil {
@@ -116,14 +317,35 @@ func (us UserStore) GetByPasskey(user *model.User, passkey string) error {
 	if err != nil {
 		return errors.Wrap(err, "Failed to retrieve user by passkey")
 	}
+	if len(v) == 0 {
+		// Fall back to the additional passkeys, resolving them to the users current passkey
+		var pk model.Passkey
+		if err := us.PasskeyGet(&pk, passkey); err != nil || pk.Expired(time.Now()) {
+			return consts.ErrUnauthorized
+		}
+		current, err := us.client.Get(userIDKey(pk.UserID)).Result()
+		if err != nil || current == passkey {
+			return consts.ErrUnauthorized
+		}
+		return us.GetByPasskey(user, current)
+	}
 	user.Passkey = v["passkey"]
 	user.UserID = util.StringToUInt32(v["user_id"], 0)
 	user.Downloaded = util.StringToUInt64(v["downloaded"], 0)
 	user.Uploaded = util.StringToUInt64(v["uploaded"], 0)
+	user.DownloadedRaw = util.StringToUInt64(v["downloaded_raw"], 0)
+	user.UploadedRaw = util.StringToUInt64(v["uploaded_raw"], 0)
 	user.Announces = util.StringToUInt32(v["announces"], 0)
+	user.BonusPoints = util.StringToFloat64(v["bonus_points"], 0)
+	user.LeechDenied = util.StringToUInt32(v["leech_denied"], 0)
+	user.Leech = int(util.StringToInt64(v["slots_leech"], 0))
+	user.Seed = int(util.StringToInt64(v["slots_seed"], 0))
+	user.PerTorrent = int(util.StringToInt64(v["slots_torrent"], 0))
 	user.DownloadEnabled = util.StringToBool(v["download_enabled"], false)
 	user.IsDeleted = util.StringToBool(v["is_deleted"], false)
-	if !user.Valid() {
+	user.IsAdmin = util.StringToBool(v["is_admin"], false)
+	// Users are stored with the digest of their passkey when wrapped by a store.HashedUserStore
+	if !user.Valid() && !user.ValidDigest() {
 		return consts.ErrInvalidState
 	}
 	return nil
@@ -150,9 +372,553 @@ func (us UserStore) Delete(user model.User) error {
 	if err := us.client.Del(userIDKey(user.UserID)).Err(); err != nil {
 		return errors.Wrap(err, "Could not remove user pk index from store")
 	}
+	passkeys, err := us.client.SMembers(passkeyUserKey(user.UserID)).Result()
+	if err != nil {
+		return errors.Wrap(err, "Could not fetch user passkeys")
+	}
+	keys := []string{passkeyUserKey(user.UserID)}
+	for _, passkey := range passkeys {
+		keys = append(keys, passkeyKey(passkey))
+	}
+	if err := us.client.Del(keys...).Err(); err != nil {
+		return errors.Wrap(err, "Could not remove user passkeys from store")
+	}
+	return nil
+}
+
+// SetDownloadEnabled enables or disables downloading for the user
+func (us UserStore) SetDownloadEnabled(userID uint32, enabled bool) error {
+	passkey, err := us.client.Get(userIDKey(userID)).Result()
+	if err != nil || passkey == "" {
+		if err != nil && err != redis.Nil {
+			return errors.Wrap(err, "Failed to lookup user passkey")
+		}
+		return consts.ErrInvalidUser
+	}
+	if err := us.client.HSet(userKey(passkey), "download_enabled", enabled).Err(); err != nil {
+		return errors.Wrap(err, "Failed to update download enabled")
+	}
+	return nil
+}
+
+// SetSlotLimits replaces the peer slot limits of the user
+func (us UserStore) SetSlotLimits(userID uint32, limits model.SlotLimits) error {
+	passkey, err := us.client.Get(userIDKey(userID)).Result()
+	if err != nil || passkey == "" {
+		if err != nil && err != redis.Nil {
+			return errors.Wrap(err, "Failed to lookup user passkey")
+		}
+		return consts.ErrInvalidUser
+	}
+	err = us.client.HSet(userKey(passkey), map[string]interface{}{
+		"slots_leech":   limits.Leech,
+		"slots_seed":    limits.Seed,
+		"slots_torrent": limits.PerTorrent,
+	}).Err()
+	if err != nil {
+		return errors.Wrap(err, "Failed to update slot limits")
+	}
+	return nil
+}
+
+// SetPasskey replaces the primary passkey of the user, moving the user hash to the new passkey
+func (us UserStore) SetPasskey(userID uint32, passkey string) error {
+	current, err := us.client.Get(userIDKey(userID)).Result()
+	if err != nil || current == "" {
+		if err != nil && err != redis.Nil {
+			return errors.Wrap(err, "Failed to lookup user passkey")
+		}
+		return consts.ErrInvalidUser
+	}
+	pipe := us.client.TxPipeline()
+	pipe.Rename(userKey(current), userKey(passkey))
+	pipe.HSet(userKey(passkey), "passkey", passkey)
+	pipe.Set(userIDKey(userID), passkey, 0)
+	if _, err := pipe.Exec(); err != nil {
+		return errors.Wrap(err, "Failed to update passkey")
+	}
+	return nil
+}
+
+// PasskeyAdd inserts or replaces an additional passkey of a user
+func (us UserStore) PasskeyAdd(pk model.Passkey) error {
+	expire := ""
+	if !pk.TimeExpire.IsZero() {
+		expire = util.TimeToString(pk.TimeExpire)
+	}
+	lastUsed := ""
+	if !pk.TimeLastUsed.IsZero() {
+		lastUsed = util.TimeToString(pk.TimeLastUsed)
+	}
+	pipe := us.client.TxPipeline()
+	pipe.HSet(passkeyKey(pk.Passkey), map[string]interface{}{
+		"passkey":        pk.Passkey,
+		"user_id":        pk.UserID,
+		"label":          pk.Label,
+		"time_created":   util.TimeToString(pk.TimeCreated),
+		"time_expire":    expire,
+		"time_last_used": lastUsed,
+		"addr_ip":        ipString(pk.IP),
+	})
+	pipe.SAdd(passkeyUserKey(pk.UserID), pk.Passkey)
+	if _, err := pipe.Exec(); err != nil {
+		return errors.Wrap(err, "Failed to add passkey")
+	}
+	return nil
+}
+
+// PasskeyGet returns the additional passkey matching the passkey provided
+func (us UserStore) PasskeyGet(pk *model.Passkey, passkey string) error {
+	v, err := us.client.HGetAll(passkeyKey(passkey)).Result()
+	if err != nil {
+		return errors.Wrap(err, "Failed to fetch passkey")
+	}
+	if len(v) == 0 {
+		return consts.ErrInvalidPasskey
+	}
+	*pk = model.Passkey{
+		Passkey:     v["passkey"],
+		UserID:      util.StringToUInt32(v["user_id"], 0),
+		Label:       v["label"],
+		TimeCreated: util.StringToTime(v["time_created"]),
+		IP:          net.ParseIP(v["addr_ip"]),
+	}
+	if v["time_expire"] != "" {
+		pk.TimeExpire = util.StringToTime(v["time_expire"])
+	}
+	if v["time_last_used"] != "" {
+		pk.TimeLastUsed = util.StringToTime(v["time_last_used"])
+	}
+	return nil
+}
+
+// PasskeyGetByUser returns the additional passkeys of a user, including those which have expired
+func (us UserStore) PasskeyGetByUser(userID uint32) ([]model.Passkey, error) {
+	keys, err := us.client.SMembers(passkeyUserKey(userID)).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to fetch user passkeys")
+	}
+	var passkeys []model.Passkey
+	for _, key := range keys {
+		var pk model.Passkey
+		if err := us.PasskeyGet(&pk, key); err != nil {
+			if err == consts.ErrInvalidPasskey {
+				continue
+			}
+			return nil, err
+		}
+		passkeys = append(passkeys, pk)
+	}
+	return passkeys, nil
+}
+
+// PasskeyDelete removes an additional passkey
+func (us UserStore) PasskeyDelete(passkey string) error {
+	var pk model.Passkey
+	if err := us.PasskeyGet(&pk, passkey); err != nil {
+		return err
+	}
+	pipe := us.client.TxPipeline()
+	pipe.Del(passkeyKey(passkey))
+	pipe.SRem(passkeyUserKey(pk.UserID), passkey)
+	if _, err := pipe.Exec(); err != nil {
+		return errors.Wrap(err, "Failed to remove passkey")
+	}
+	return nil
+}
+
+// PasskeySync batch updates when and where existing additional passkeys were last used
+func (us UserStore) PasskeySync(b map[string]model.PasskeyUsage) error {
+	pipe := us.client.TxPipeline()
+	for passkey, usage := range b {
+		// Revoked passkeys must not be recreated by the update
+		exists, err := us.client.Exists(passkeyKey(passkey)).Result()
+		if err != nil {
+			return errors.Wrap(err, "Failed to check passkey exists")
+		}
+		if exists == 0 {
+			continue
+		}
+		pipe.HSet(passkeyKey(passkey), map[string]interface{}{
+			"time_last_used": util.TimeToString(usage.TimeLastUsed),
+			"addr_ip":        ipString(usage.IP),
+		})
+	}
+	if _, err := pipe.Exec(); err != nil {
+		return errors.Wrap(err, "Failed to sync passkeys")
+	}
+	return nil
+}
+
+// PasskeyMigrate replaces every stored passkey, including additional passkeys, with the value
+// returned by hash. The number of passkeys which were changed is returned.
+func (us UserStore) PasskeyMigrate(hash func(passkey string) string) (int, error) {
+	changed := 0
+	userKeys, err := us.client.Keys(fmt.Sprintf("%s:*", prefixUserID)).Result()
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to fetch user keys")
+	}
+	for _, key := range userKeys {
+		current, err := us.client.Get(key).Result()
+		if err != nil {
+			return changed, errors.Wrap(err, "Failed to lookup user passkey")
+		}
+		hashed := hash(current)
+		if hashed == current {
+			continue
+		}
+		userID := util.StringToUInt32(strings.TrimPrefix(key, prefixUserID+":"), 0)
+		if err := us.SetPasskey(userID, hashed); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	passkeyKeys, err := us.client.Keys(fmt.Sprintf("%s:*", prefixPasskey)).Result()
+	if err != nil {
+		return changed, errors.Wrap(err, "Failed to fetch passkey keys")
+	}
+	for _, key := range passkeyKeys {
+		var pk model.Passkey
+		if err := us.PasskeyGet(&pk, strings.TrimPrefix(key, prefixPasskey+":")); err != nil {
+			return changed, err
+		}
+		hashed := hash(pk.Passkey)
+		if hashed == pk.Passkey {
+			continue
+		}
+		pipe := us.client.TxPipeline()
+		pipe.Rename(passkeyKey(pk.Passkey), passkeyKey(hashed))
+		pipe.HSet(passkeyKey(hashed), "passkey", hashed)
+		pipe.SRem(passkeyUserKey(pk.UserID), pk.Passkey)
+		pipe.SAdd(passkeyUserKey(pk.UserID), hashed)
+		if _, err := pipe.Exec(); err != nil {
+			return changed, errors.Wrap(err, "Failed to update passkey")
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// RatioWatchAdd inserts or replaces the ratio watch record of the user
+func (us UserStore) RatioWatchAdd(rw model.RatioWatch) error {
+	err := us.client.HSet(ratioWatchKey(rw.UserID), map[string]interface{}{
+		"user_id":        rw.UserID,
+		"status":         string(rw.Status),
+		"required_ratio": rw.RequiredRatio,
+		"ratio":          rw.Ratio,
+		"time_warned":    util.TimeToString(rw.TimeWarned),
+		"time_deadline":  util.TimeToString(rw.TimeDeadline),
+		"time_updated":   util.TimeToString(rw.TimeUpdated),
+	}).Err()
+	if err != nil {
+		return errors.Wrap(err, "Failed to add ratio watch")
+	}
+	return nil
+}
+
+// ratioWatchGet returns the ratio watch record stored at the key
+func (us UserStore) ratioWatchGet(rw *model.RatioWatch, key string) error {
+	v, err := us.client.HGetAll(key).Result()
+	if err != nil {
+		return errors.Wrapf(err, "Failed to fetch ratio watch value for: %s", key)
+	}
+	if len(v) == 0 {
+		return consts.ErrInvalidRatioWatch
+	}
+	rw.UserID = util.StringToUInt32(v["user_id"], 0)
+	rw.Status = model.RatioWatchStatus(v["status"])
+	rw.RequiredRatio = util.StringToFloat64(v["required_ratio"], 0)
+	rw.Ratio = util.StringToFloat64(v["ratio"], 0)
+	rw.TimeWarned = util.StringToTime(v["time_warned"])
+	rw.TimeDeadline = util.StringToTime(v["time_deadline"])
+	rw.TimeUpdated = util.StringToTime(v["time_updated"])
+	return nil
+}
+
+// RatioWatchGet returns the ratio watch record of the user
+func (us UserStore) RatioWatchGet(rw *model.RatioWatch, userID uint32) error {
+	return us.ratioWatchGet(rw, ratioWatchKey(userID))
+}
+
+// RatioWatchGetActive returns all the ratio watch records which are warned or disabled
+func (us UserStore) RatioWatchGetActive() ([]model.RatioWatch, error) {
+	keys, err := us.client.Keys(fmt.Sprintf("%s:*", prefixRatioWatch)).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to fetch ratio watch keys")
+	}
+	var records []model.RatioWatch
+	for _, key := range keys {
+		var rw model.RatioWatch
+		if err := us.ratioWatchGet(&rw, key); err != nil {
+			return nil, err
+		}
+		if rw.Active() {
+			records = append(records, rw)
+		}
+	}
+	return records, nil
+}
+
+// HNRSync inserts or replaces the hit and run records provided
+func (us UserStore) HNRSync(records []model.HitAndRun) error {
+	pipe := us.client.TxPipeline()
+	for _, h := range records {
+		pipe.HSet(hnrKey(h.UserID, h.InfoHash), map[string]interface{}{
+			"user_id":        h.UserID,
+			"info_hash":      h.InfoHash.String(),
+			"status":         string(h.Status),
+			"seed_time":      h.SeedTime,
+			"time_completed": util.TimeToString(h.TimeCompleted),
+			"time_last_seed": util.TimeToString(h.TimeLastSeed),
+		})
+	}
+	if _, err := pipe.Exec(); err != nil {
+		return errors.Wrap(err, "Failed to sync hit and runs")
+	}
+	return nil
+}
+
+// hnrGetAll returns the hit and run records for all the keys matching the pattern
+func (us UserStore) hnrGetAll(pattern string) ([]model.HitAndRun, error) {
+	keys, err := us.client.Keys(pattern).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to fetch hit and run keys")
+	}
+	var records []model.HitAndRun
+	for _, key := range keys {
+		v, err := us.client.HGetAll(key).Result()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to fetch hit and run value for: %s", key)
+		}
+		var ih model.InfoHash
+		if err := model.InfoHashFromHex(&ih, v["info_hash"]); err != nil {
+			return nil, errors.Wrapf(err, "Failed to decode hit and run info hash for: %s", key)
+		}
+		records = append(records, model.HitAndRun{
+			UserID:        util.StringToUInt32(v["user_id"], 0),
+			InfoHash:      ih,
+			Status:        model.HitAndRunStatus(v["status"]),
+			SeedTime:      util.StringToUInt32(v["seed_time"], 0),
+			TimeCompleted: util.StringToTime(v["time_completed"]),
+			TimeLastSeed:  util.StringToTime(v["time_last_seed"]),
+		})
+	}
+	return records, nil
+}
+
+// HNRGetByUser returns all the hit and run records for a user
+func (us UserStore) HNRGetByUser(userID uint32) ([]model.HitAndRun, error) {
+	return us.hnrGetAll(fmt.Sprintf("%s:%d:*", prefixHNR, userID))
+}
+
+// HNRGetActive returns all the hit and run records which are pending or flagged
+func (us UserStore) HNRGetActive() ([]model.HitAndRun, error) {
+	all, err := us.hnrGetAll(fmt.Sprintf("%s:*", prefixHNR))
+	if err != nil {
+		return nil, err
+	}
+	var records []model.HitAndRun
+	for _, h := range all {
+		if h.Status != model.HNRSatisfied {
+			records = append(records, h)
+		}
+	}
+	return records, nil
+}
+
+// HNRDelete removes the hit and run record for the user and torrent
+func (us UserStore) HNRDelete(userID uint32, ih model.InfoHash) error {
+	res, err := us.client.Del(hnrKey(userID, ih)).Result()
+	if err != nil {
+		return errors.Wrap(err, "Failed to remove hit and run")
+	}
+	if res != 1 {
+		return consts.ErrInvalidHNR
+	}
+	return nil
+}
+
+// FreeleechAdd inserts or replaces the freeleech token for the user and torrent. Tokens are
+// expired by redis once they no longer apply.
+func (us UserStore) FreeleechAdd(token model.FreeleechToken) error {
+	key := freeleechKey(token.UserID, token.InfoHash)
+	pipe := us.client.TxPipeline()
+	pipe.HSet(key, map[string]interface{}{
+		"user_id":      token.UserID,
+		"info_hash":    token.InfoHash.String(),
+		"time_created": util.TimeToString(token.TimeCreated),
+		"time_expire":  util.TimeToString(token.TimeExpire),
+	})
+	pipe.ExpireAt(key, token.TimeExpire)
+	if _, err := pipe.Exec(); err != nil {
+		return errors.Wrap(err, "Failed to add freeleech token")
+	}
 	return nil
 }
 
+// freeleechGetAll returns the freeleech tokens for all the keys matching the pattern
+func (us UserStore) freeleechGetAll(pattern string) ([]model.FreeleechToken, error) {
+	keys, err := us.client.Keys(pattern).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to fetch freeleech keys")
+	}
+	var tokens []model.FreeleechToken
+	for _, key := range keys {
+		v, err := us.client.HGetAll(key).Result()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to fetch freeleech value for: %s", key)
+		}
+		// The key expired after being listed
+		if len(v) == 0 {
+			continue
+		}
+		var ih model.InfoHash
+		if err := model.InfoHashFromHex(&ih, v["info_hash"]); err != nil {
+			return nil, errors.Wrapf(err, "Failed to decode freeleech info hash for: %s", key)
+		}
+		tokens = append(tokens, model.FreeleechToken{
+			UserID:      util.StringToUInt32(v["user_id"], 0),
+			InfoHash:    ih,
+			TimeCreated: util.StringToTime(v["time_created"]),
+			TimeExpire:  util.StringToTime(v["time_expire"]),
+		})
+	}
+	return tokens, nil
+}
+
+// FreeleechGetByUser returns all the freeleech tokens of a user
+func (us UserStore) FreeleechGetByUser(userID uint32) ([]model.FreeleechToken, error) {
+	return us.freeleechGetAll(fmt.Sprintf("%s:%d:*", prefixFreeleech, userID))
+}
+
+// FreeleechGetAll returns all the freeleech tokens
+func (us UserStore) FreeleechGetAll() ([]model.FreeleechToken, error) {
+	return us.freeleechGetAll(fmt.Sprintf("%s:*", prefixFreeleech))
+}
+
+// FreeleechDelete removes the freeleech token for the user and torrent
+func (us UserStore) FreeleechDelete(userID uint32, ih model.InfoHash) error {
+	res, err := us.client.Del(freeleechKey(userID, ih)).Result()
+	if err != nil {
+		return errors.Wrap(err, "Failed to remove freeleech token")
+	}
+	if res != 1 {
+		return consts.ErrInvalidFreeleech
+	}
+	return nil
+}
+
+// SnatchAdd inserts the snatches provided. Existing snatches for the same user and torrent are kept.
+func (us UserStore) SnatchAdd(snatches []model.Snatch) error {
+	for _, s := range snatches {
+		key := snatchKey(s.UserID, s.InfoHash)
+		exists, err := us.client.Exists(key).Result()
+		if err != nil {
+			return errors.Wrap(err, "Failed to check for existing snatch")
+		}
+		if exists == 1 {
+			continue
+		}
+		score := float64(s.TimeCompleted.Unix())
+		pipe := us.client.TxPipeline()
+		pipe.HSet(key, map[string]interface{}{
+			"user_id":        s.UserID,
+			"info_hash":      s.InfoHash.String(),
+			"time_completed": util.TimeToString(s.TimeCompleted),
+			"addr_ip":        ipString(s.IP),
+			"client":         s.Client,
+			"uploaded":       s.Uploaded,
+			"downloaded":     s.Downloaded,
+		})
+		pipe.ZAdd(snatchUserKey(s.UserID), &redis.Z{Score: score, Member: s.InfoHash.String()})
+		pipe.ZAdd(snatchTorrentKey(s.InfoHash), &redis.Z{Score: score, Member: s.UserID})
+		if _, err := pipe.Exec(); err != nil {
+			return errors.Wrap(err, "Failed to add snatch")
+		}
+	}
+	return nil
+}
+
+// SnatchSync batch updates the transfer totals of existing snatches with the new SnatchStats provided
+func (us UserStore) SnatchSync(b map[model.UserTorrentKey]model.SnatchStats) error {
+	for k, stats := range b {
+		key := snatchKey(k.UserID, k.InfoHash)
+		exists, err := us.client.Exists(key).Result()
+		if err != nil {
+			return errors.Wrap(err, "Failed to check for existing snatch")
+		}
+		if exists != 1 {
+			continue
+		}
+		pipe := us.client.TxPipeline()
+		pipe.HIncrBy(key, "uploaded", int64(stats.Uploaded))
+		pipe.HIncrBy(key, "downloaded", int64(stats.Downloaded))
+		if _, err := pipe.Exec(); err != nil {
+			return errors.Wrap(err, "Failed to sync snatch")
+		}
+	}
+	return nil
+}
+
+// snatchGet returns the snatch stored at the key
+func (us UserStore) snatchGet(key string) (model.Snatch, error) {
+	v, err := us.client.HGetAll(key).Result()
+	if err != nil {
+		return model.Snatch{}, errors.Wrapf(err, "Failed to fetch snatch value for: %s", key)
+	}
+	var ih model.InfoHash
+	if err := model.InfoHashFromHex(&ih, v["info_hash"]); err != nil {
+		return model.Snatch{}, errors.Wrapf(err, "Failed to decode snatch info hash for: %s", key)
+	}
+	return model.Snatch{
+		UserID:        util.StringToUInt32(v["user_id"], 0),
+		InfoHash:      ih,
+		TimeCompleted: util.StringToTime(v["time_completed"]),
+		IP:            net.ParseIP(v["addr_ip"]),
+		Client:        v["client"],
+		Uploaded:      util.StringToUInt64(v["uploaded"], 0),
+		Downloaded:    util.StringToUInt64(v["downloaded"], 0),
+	}, nil
+}
+
+// SnatchGetByUser returns up to limit snatches of a user starting from offset, newest first
+func (us UserStore) SnatchGetByUser(userID uint32, offset int, limit int) ([]model.Snatch, error) {
+	hashes, err := us.client.ZRevRange(snatchUserKey(userID), int64(offset), int64(offset+limit-1)).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to fetch user snatches")
+	}
+	var snatches []model.Snatch
+	for _, hash := range hashes {
+		var ih model.InfoHash
+		if err := model.InfoHashFromHex(&ih, hash); err != nil {
+			return nil, errors.Wrapf(err, "Failed to decode snatch info hash: %s", hash)
+		}
+		s, err := us.snatchGet(snatchKey(userID, ih))
+		if err != nil {
+			return nil, err
+		}
+		snatches = append(snatches, s)
+	}
+	return snatches, nil
+}
+
+// SnatchGetByTorrent returns up to limit snatches of a torrent starting from offset, newest first
+func (us UserStore) SnatchGetByTorrent(ih model.InfoHash, offset int, limit int) ([]model.Snatch, error) {
+	userIDs, err := us.client.ZRevRange(snatchTorrentKey(ih), int64(offset), int64(offset+limit-1)).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to fetch torrent snatches")
+	}
+	var snatches []model.Snatch
+	for _, userID := range userIDs {
+		s, err := us.snatchGet(snatchKey(util.StringToUInt32(userID, 0), ih))
+		if err != nil {
+			return nil, err
+		}
+		snatches = append(snatches, s)
+	}
+	return snatches, nil
+}
+
 // Close will shutdown the underlying redis connection
 func (us UserStore) Close() error {
 	return us.client.Close()
@@ -188,8 +954,11 @@ func (ts *TorrentStore) WhiteListDelete(client model.WhiteListClient) error {
 // WhiteListAdd will insert a new client prefix into the allowed clients list
 func (ts *TorrentStore) WhiteListAdd(client model.WhiteListClient) error {
 	valueMap := map[string]interface{}{
-		"client_prefix": client.ClientPrefix,
-		"client_name":   client.ClientName,
+		"client_prefix":   client.ClientPrefix,
+		"client_name":     client.ClientName,
+		"min_version":     client.MinVersion,
+		"max_version":     client.MaxVersion,
+		"banned_versions": client.BannedVersions,
 	}
 	err := ts.client.HSet(whiteListKey(client.ClientPrefix), valueMap).Err()
 	if err != nil {
@@ -211,13 +980,146 @@ func (ts *TorrentStore) WhiteListGetAll() ([]model.WhiteListClient, error) {
 			return nil, errors.Wrapf(err, "Failed to fetch whitelist value for: %s", whiteListKey(prefix))
 		}
 		wl = append(wl, model.WhiteListClient{
-			ClientPrefix: valueMap["client_prefix"],
-			ClientName:   valueMap["client_name"],
+			ClientPrefix:   valueMap["client_prefix"],
+			ClientName:     valueMap["client_name"],
+			MinVersion:     valueMap["min_version"],
+			MaxVersion:     valueMap["max_version"],
+			BannedVersions: valueMap["banned_versions"],
 		})
 	}
 	return wl, nil
 }
 
+// PromotionAdd will insert a new promotion, replacing any existing promotion with the same name
+func (ts *TorrentStore) PromotionAdd(promo model.Promotion) error {
+	valueMap := map[string]interface{}{
+		"name":        promo.Name,
+		"scope":       string(promo.Scope),
+		"tag":         promo.Tag,
+		"info_hashes": promo.InfoHashes.String(),
+		"multi_up":    promo.MultiUp,
+		"multi_dn":    promo.MultiDn,
+		"time_start":  util.TimeToString(promo.TimeStart),
+		"time_end":    util.TimeToString(promo.TimeEnd),
+	}
+	if err := ts.client.HSet(promotionKey(promo.Name), valueMap).Err(); err != nil {
+		return errors.Wrapf(err, "failed to add promotion: %s", promo.Name)
+	}
+	return nil
+}
+
+// PromotionDelete removes a promotion
+func (ts *TorrentStore) PromotionDelete(promo model.Promotion) error {
+	res, err := ts.client.Del(promotionKey(promo.Name)).Result()
+	if err != nil {
+		return errors.Wrap(err, "Failed to remove promotion")
+	}
+	if res != 1 {
+		return consts.ErrInvalidPromotion
+	}
+	return nil
+}
+
+// PromotionGetAll fetches all known promotions
+func (ts *TorrentStore) PromotionGetAll() ([]model.Promotion, error) {
+	keys, err := ts.client.Keys(fmt.Sprintf("%s:*", prefixPromotion)).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to fetch promotion keys")
+	}
+	var promos []model.Promotion
+	for _, key := range keys {
+		v, err := ts.client.HGetAll(key).Result()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to fetch promotion value for: %s", key)
+		}
+		hashes, err := model.ParseInfoHashes(v["info_hashes"])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to decode promotion info hashes for: %s", key)
+		}
+		promos = append(promos, model.Promotion{
+			Name:       v["name"],
+			Scope:      model.PromotionScope(v["scope"]),
+			Tag:        v["tag"],
+			InfoHashes: hashes,
+			MultiUp:    util.StringToFloat64(v["multi_up"], 1.0),
+			MultiDn:    util.StringToFloat64(v["multi_dn"], 1.0),
+			TimeStart:  util.StringToTime(v["time_start"]),
+			TimeEnd:    util.StringToTime(v["time_end"]),
+		})
+	}
+	return promos, nil
+}
+
+// BanAdd inserts the bans provided, replacing any existing bans with the same CIDR. Bans which
+// never expire are stored with an empty time_expire.
+func (ts *TorrentStore) BanAdd(bans []model.Ban) error {
+	pipe := ts.client.TxPipeline()
+	for _, b := range bans {
+		expire := ""
+		if !b.Permanent() {
+			expire = util.TimeToString(b.TimeExpire)
+		}
+		pipe.HSet(banKey(b.CIDR), map[string]interface{}{
+			"cidr":         b.CIDR,
+			"reason":       b.Reason,
+			"time_created": util.TimeToString(b.TimeCreated),
+			"time_expire":  expire,
+		})
+		pipe.SAdd(prefixBanSet, b.CIDR)
+	}
+	if _, err := pipe.Exec(); err != nil {
+		return errors.Wrap(err, "Failed to add bans")
+	}
+	return nil
+}
+
+// BanDelete removes the ban matching the CIDR
+func (ts *TorrentStore) BanDelete(cidr string) error {
+	pipe := ts.client.TxPipeline()
+	del := pipe.Del(banKey(cidr))
+	pipe.SRem(prefixBanSet, cidr)
+	if _, err := pipe.Exec(); err != nil {
+		return errors.Wrap(err, "Failed to remove ban")
+	}
+	if del.Val() != 1 {
+		return consts.ErrInvalidBan
+	}
+	return nil
+}
+
+// BanGetAll fetches all known bans
+func (ts *TorrentStore) BanGetAll() ([]model.Ban, error) {
+	cidrs, err := ts.client.SMembers(prefixBanSet).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to fetch ban cidrs")
+	}
+	pipe := ts.client.Pipeline()
+	results := make([]*redis.StringStringMapCmd, len(cidrs))
+	for i, cidr := range cidrs {
+		results[i] = pipe.HGetAll(banKey(cidr))
+	}
+	if _, err := pipe.Exec(); err != nil && err != redis.Nil {
+		return nil, errors.Wrap(err, "Failed to fetch bans")
+	}
+	var bans []model.Ban
+	for _, res := range results {
+		v := res.Val()
+		if len(v) == 0 {
+			continue
+		}
+		b := model.Ban{
+			CIDR:        v["cidr"],
+			Reason:      v["reason"],
+			TimeCreated: util.StringToTime(v["time_created"]),
+		}
+		if v["time_expire"] != "" {
+			b.TimeExpire = util.StringToTime(v["time_expire"])
+		}
+		bans = append(bans, b)
+	}
+	return bans, nil
+}
+
 // Add adds a new torrent to the redis backing store
 func (ts *TorrentStore) Add(t model.Torrent) error {
 	err := ts.client.HSet(torrentKey(t.InfoHash), map[string]interface{}{
@@ -229,12 +1131,20 @@ func (ts *TorrentStore) Add(t model.Torrent) error {
 		"multi_up":         t.MultiUp,
 		"multi_dn":         t.MultiDn,
 		"info_hash":        t.InfoHash.RawString(),
+		"info_hash_v2":     t.InfoHashV2.RawString(),
 		"is_deleted":       t.IsDeleted,
 		"is_enabled":       t.IsEnabled,
+		"tags":             t.Tags.String(),
+		"size":             t.Size,
 	}).Err()
 	if err != nil {
 		return err
 	}
+	if !t.InfoHashV2.IsZero() {
+		if err := ts.client.Set(torrentV2Key(t.InfoHashV2), t.InfoHash.String(), 0).Err(); err != nil {
+			return errors.Wrap(err, "Failed to add v2 info hash alias")
+		}
+	}
 	return nil
 }
 
@@ -242,6 +1152,16 @@ func (ts *TorrentStore) Add(t model.Torrent) error {
 // If dropRow is true, it will permanently remove the torrent from the store
 func (ts *TorrentStore) Delete(ih model.InfoHash, dropRow bool) error {
 	if dropRow {
+		v2, err := ts.client.HGet(torrentKey(ih), "info_hash_v2").Result()
+		if err != nil && err != redis.Nil {
+			return errors.Wrap(err, "Could not fetch torrent v2 info hash")
+		}
+		var v2Hash model.InfoHash
+		if model.InfoHashFromString(&v2Hash, v2) == nil && !v2Hash.IsZero() {
+			if err := ts.client.Del(torrentV2Key(v2Hash)).Err(); err != nil {
+				return errors.Wrap(err, "Could not remove v2 info hash alias from store")
+			}
+		}
 		if err := ts.client.Del(torrentKey(ih)).Err(); err != nil {
 			return errors.Wrap(err, "Could not remove torrent from store")
 		}
@@ -253,7 +1173,8 @@ func (ts *TorrentStore) Delete(ih model.InfoHash, dropRow bool) error {
 	return nil
 }
 
-// Get returns the Torrent matching the infohash
+// Get returns the Torrent matching the infohash. v2 info hashes are resolved to their
+// hybrid torrent.
 func (ts *TorrentStore) Get(t *model.Torrent, hash model.InfoHash) error {
 	v, err := ts.client.HGetAll(torrentKey(hash)).Result()
 	if err != nil {
@@ -261,7 +1182,25 @@ func (ts *TorrentStore) Get(t *model.Torrent, hash model.InfoHash) error {
 	}
 	ihStr, found := v["info_hash"]
 	if !found {
-		return consts.ErrInvalidInfoHash
+		v1, err := ts.client.Get(torrentV2Key(hash)).Result()
+		if err != nil {
+			if err == redis.Nil {
+				return consts.ErrInvalidInfoHash
+			}
+			return errors.Wrap(err, "Failed to fetch v2 info hash alias")
+		}
+		var v1Hash model.InfoHash
+		if err := model.InfoHashFromHex(&v1Hash, v1); err != nil {
+			return errors.Wrap(err, "Failed to decode v2 info hash alias")
+		}
+		v, err = ts.client.HGetAll(torrentKey(v1Hash)).Result()
+		if err != nil {
+			return err
+		}
+		ihStr, found = v["info_hash"]
+		if !found {
+			return consts.ErrInvalidInfoHash
+		}
 	}
 	var infoHash model.InfoHash
 	if err := model.InfoHashFromString(&infoHash, ihStr); err != nil {
@@ -269,6 +1208,12 @@ func (ts *TorrentStore) Get(t *model.Torrent, hash model.InfoHash) error {
 	}
 	t.ReleaseName = v["release_name"]
 	t.InfoHash = infoHash
+	if v2, found := v["info_hash_v2"]; found {
+		// Unset v2 hashes are stored as 20 zero bytes
+		if err := model.InfoHashFromString(&t.InfoHashV2, v2); err != nil {
+			return errors.Wrap(err, "Failed to decode info_hash_v2")
+		}
+	}
 	t.TotalCompleted = util.StringToUInt16(v["total_completed"], 0)
 	t.TotalUploaded = util.StringToUInt64(v["total_uploaded"], 0)
 	t.TotalDownloaded = util.StringToUInt64(v["total_downloaded"], 0)
@@ -277,10 +1222,37 @@ func (ts *TorrentStore) Get(t *model.Torrent, hash model.InfoHash) error {
 	t.Reason = v["reason"]
 	t.MultiUp = util.StringToFloat64(v["multi_up"], 1.0)
 	t.MultiDn = util.StringToFloat64(v["multi_dn"], 1.0)
+	t.Tags = model.ParseTags(v["tags"])
+	t.Size = util.StringToUInt64(v["size"], 0)
 
 	return nil
 }
 
+// GetAll returns all the torrents known to the store which are not deleted
+func (ts *TorrentStore) GetAll() (model.Torrents, error) {
+	keys, err := ts.client.Keys(fmt.Sprintf("%s:*", prefixTorrent)).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to fetch torrent keys")
+	}
+	var torrents model.Torrents
+	for _, key := range keys {
+		var ih model.InfoHash
+		if err := model.InfoHashFromHex(&ih, strings.TrimPrefix(key, prefixTorrent+":")); err != nil {
+			log.Warnf("Invalid torrent key found: %s", key)
+			continue
+		}
+		var t model.Torrent
+		if err := ts.Get(&t, ih); err != nil {
+			return nil, errors.Wrapf(err, "Failed to fetch torrent: %s", key)
+		}
+		if t.IsDeleted {
+			continue
+		}
+		torrents = append(torrents, t)
+	}
+	return torrents, nil
+}
+
 // Close will close the underlying redis client and clear the caches
 func (ts *TorrentStore) Close() error {
 	return ts.client.Close()
@@ -301,7 +1273,12 @@ func (ps *PeerStore) Sync(batch map[model.PeerHash]model.PeerStats) error {
 		pipe.HIncrBy(k, "announces", int64(stats.Announces))
 		pipe.HIncrBy(k, "downloaded", int64(stats.Downloaded))
 		pipe.HIncrBy(k, "uploaded", int64(stats.Uploaded))
-		pipe.HSet(k, "last_announce", util.TimeToString(stats.LastAnnounce))
+		pipe.HSet(k, map[string]interface{}{
+			"last_announce":      util.TimeToString(stats.LastAnnounce),
+			"session_uploaded":   stats.SessionUploaded,
+			"session_downloaded": stats.SessionDownloaded,
+			"total_left":         stats.Left,
+		})
 		pipe.Expire(k, ps.peerTTL)
 	}
 	if _, err := pipe.Exec(); err != nil {
@@ -315,27 +1292,36 @@ func (ps *PeerStore) Reap() {
 	log.Debugf("Implement reaping peers..")
 }
 
-// Add inserts a peer into the active swarm for the torrent provided
+// Add inserts a peer into the active swarm for the torrent provided. The peer is also added to
+// the set of the users peers.
 func (ps *PeerStore) Add(ih model.InfoHash, p model.Peer) error {
-	err := ps.client.HSet(peerKey(ih, p.PeerID), map[string]interface{}{
-		"speed_up":       p.SpeedUP,
-		"speed_dn":       p.SpeedDN,
-		"speed_up_max":   p.SpeedUPMax,
-		"speed_dn_max":   p.SpeedDNMax,
-		"uploaded":       p.Uploaded,
-		"downloaded":     p.Downloaded,
-		"total_left":     p.Left,
-		"total_time":     p.TotalTime,
-		"addr_ip":        p.IP.String(),
-		"addr_port":      p.Port,
-		"last_announce":  util.TimeToString(p.AnnounceLast),
-		"first_announce": util.TimeToString(p.AnnounceFirst),
-		"peer_id":        p.PeerID.RawString(),
-		"location":       p.Location.String(),
-		"user_id":        p.UserID,
-		"announces":      p.Announces,
-	}).Err()
-	if err != nil {
+	pipe := ps.client.TxPipeline()
+	pipe.HSet(peerKey(ih, p.PeerID), map[string]interface{}{
+		"speed_up":           p.SpeedUP,
+		"speed_dn":           p.SpeedDN,
+		"speed_up_max":       p.SpeedUPMax,
+		"speed_dn_max":       p.SpeedDNMax,
+		"uploaded":           p.Uploaded,
+		"downloaded":         p.Downloaded,
+		"total_left":         p.Left,
+		"total_time":         p.TotalTime,
+		"session_uploaded":   p.SessionUploaded,
+		"session_downloaded": p.SessionDownloaded,
+		"addr_ip":            ipString(p.IP),
+		"addr_ipv6":          ipString(p.IPv6),
+		"addr_port":          p.Port,
+		"peer_key":           p.Key,
+		"passkey_label":      p.PasskeyLabel,
+		"last_announce":      util.TimeToString(p.AnnounceLast),
+		"first_announce":     util.TimeToString(p.AnnounceFirst),
+		"peer_id":            p.PeerID.RawString(),
+		"location":           p.Location.String(),
+		"user_id":            p.UserID,
+		"announces":          p.Announces,
+		"info_hash":          ih.String(),
+	})
+	pipe.SAdd(peerUserKey(p.UserID), peerKey(ih, p.PeerID))
+	if _, err := pipe.Exec(); err != nil {
 		return errors.Wrap(err, "Failed to Add")
 	}
 	return nil
@@ -371,9 +1357,63 @@ func (ps *PeerStore) Update(ih model.InfoHash, p model.Peer) error {
 	return nil
 }
 
+// UpdateAddr will update the addresses, port and key of an existing peer in the swarm
+func (ps *PeerStore) UpdateAddr(ih model.InfoHash, p model.Peer) error {
+	err := ps.client.HSet(peerKey(ih, p.PeerID), map[string]interface{}{
+		"addr_ip":   ipString(p.IP),
+		"addr_ipv6": ipString(p.IPv6),
+		"addr_port": p.Port,
+		"peer_key":  p.Key,
+	}).Err()
+	if err != nil {
+		return errors.Wrap(err, "Failed to UpdateAddr")
+	}
+	return nil
+}
+
 // Delete will remove a user from a torrents swarm
 func (ps *PeerStore) Delete(ih model.InfoHash, p model.PeerID) error {
-	return ps.client.Del(peerKey(ih, p)).Err()
+	k := peerKey(ih, p)
+	userID, err := ps.client.HGet(k, "user_id").Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil
+		}
+		return errors.Wrap(err, "Failed to read peer user")
+	}
+	pipe := ps.client.TxPipeline()
+	pipe.Del(k)
+	pipe.SRem(peerUserKey(util.StringToUInt32(userID, 0)), k)
+	if _, err := pipe.Exec(); err != nil {
+		return errors.Wrap(err, "Failed to Delete")
+	}
+	return nil
+}
+
+// GetByUser returns the active peers of the user across all swarms. Peers which have expired
+// are removed from the set of the users peers as they are found.
+func (ps *PeerStore) GetByUser(userID uint32) (model.Swarm, error) {
+	keys, err := ps.client.SMembers(peerUserKey(userID)).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to fetch user peers")
+	}
+	var peers model.Swarm
+	for _, key := range keys {
+		v, err := ps.client.HGetAll(key).Result()
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to fetch user peer")
+		}
+		if len(v) == 0 {
+			if err := ps.client.SRem(peerUserKey(userID), key).Err(); err != nil {
+				log.Warnf("Failed to remove expired user peer: %s", err.Error())
+			}
+			continue
+		}
+		var p model.Peer
+		mapPeerValues(&p, v)
+		peers = append(peers, p)
+	}
+	return peers, nil
 }
 
 // Get will fetch the peer from the swarm if it exists
@@ -397,15 +1437,42 @@ func mapPeerValues(p *model.Peer, v map[string]string) {
 	p.Uploaded = util.StringToUInt64(v["uploaded"], 0)
 	p.Downloaded = util.StringToUInt64(v["downloaded"], 0)
 	p.Left = util.StringToUInt32(v["total_left"], 0)
+	p.SessionUploaded = util.StringToUInt64(v["session_uploaded"], 0)
+	p.SessionDownloaded = util.StringToUInt64(v["session_downloaded"], 0)
 	p.Announces = util.StringToUInt32(v["announces"], 0)
 	p.TotalTime = util.StringToUInt32(v["total_time"], 0)
-	p.IP = net.ParseIP(v["addr_ip"])
+	p.IP = net.ParseIP(v["addr_ip"]).To4()
+	p.IPv6 = net.ParseIP(v["addr_ipv6"])
 	p.Port = util.StringToUInt16(v["addr_port"], 0)
+	p.Key = v["peer_key"]
+	p.PasskeyLabel = v["passkey_label"]
 	p.AnnounceLast = util.StringToTime(v["last_announce"])
 	p.AnnounceFirst = util.StringToTime(v["first_announce"])
 	p.PeerID = model.PeerIDFromString(v["peer_id"])
 	p.Location = geo.LatLongFromString(v["location"])
 	p.UserID = util.StringToUInt32(v["user_id"], 0)
+	_ = model.InfoHashFromHex(&p.InfoHash, v["info_hash"])
+}
+
+// Counts returns the total number of seeders and leechers in a torrents active swarm
+func (ps *PeerStore) Counts(ih model.InfoHash) (uint, uint, error) {
+	var seeders, leechers uint
+	for _, key := range ps.findKeys(torrentPeersKey(ih)) {
+		left, err := ps.client.HGet(key, "total_left").Result()
+		if err != nil {
+			if err == redis.Nil {
+				// Expired between listing the keys and reading the value
+				continue
+			}
+			return 0, 0, errors.Wrap(err, "Error trying to get peer counts")
+		}
+		if util.StringToUInt32(left, 0) == 0 {
+			seeders++
+		} else {
+			leechers++
+		}
+	}
+	return seeders, leechers, nil
 }
 
 // GetN will fetch peers for a torrents active swarm up to N users
@@ -504,8 +1571,72 @@ func (pd userDriver) NewUserStore(cfg interface{}) (store.UserStore, error) {
 	}, nil
 }
 
+// tokenBucketScript atomically refills and consumes a token from the bucket stored in the hash
+// at KEYS[1]. The bucket expires once it would have been refilled completely.
+//
+// ARGV: capacity, period (ms), now (ms)
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(bucket[1])
+local updated = tonumber(bucket[2])
+if tokens == nil or updated == nil then
+	tokens = capacity
+	updated = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - updated) * capacity / period)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated", tostring(now))
+redis.call("PEXPIRE", KEYS[1], period)
+return allowed
+`)
+
+// RateLimiter is the redis backed store.RateLimiter implementation. This allows limits to
+// be shared between multiple tracker instances.
+type RateLimiter struct {
+	client *redis.Client
+}
+
+// Allow consumes a token from the bucket for the key, returning false if the bucket is empty
+func (rl *RateLimiter) Allow(key string, rate store.Rate) (bool, error) {
+	if !rate.Enabled() {
+		return true, nil
+	}
+	res, err := tokenBucketScript.Run(rl.client, []string{rateLimitKey(key)},
+		rate.Count, rate.Period.Milliseconds(), time.Now().UnixNano()/int64(time.Millisecond)).Int()
+	if err != nil {
+		return false, errors.Wrapf(err, "Failed to check rate limit: %s", key)
+	}
+	return res == 1, nil
+}
+
+// Close will close the underlying redis client
+func (rl *RateLimiter) Close() error {
+	return rl.client.Close()
+}
+
+type rateLimitDriver struct{}
+
+// NewRateLimiter initialize a RateLimiter implementation using the redis backing store
+func (rd rateLimitDriver) NewRateLimiter(cfg interface{}) (store.RateLimiter, error) {
+	c, ok := cfg.(*config.StoreConfig)
+	if !ok {
+		return nil, consts.ErrInvalidConfig
+	}
+	return &RateLimiter{
+		client: redis.NewClient(newRedisConfig(c)),
+	}, nil
+}
+
 func init() {
 	store.AddUserDriver(driverName, userDriver{})
 	store.AddPeerDriver(driverName, peerDriver{})
 	store.AddTorrentDriver(driverName, torrentDriver{})
+	store.AddRateLimitDriver(driverName, rateLimitDriver{})
 }
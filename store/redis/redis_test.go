@@ -24,6 +24,14 @@ func TestRedisUserStore(t *testing.T) {
 	store.TestUserStore(t, us)
 }
 
+func TestRedisHashedUserStore(t *testing.T) {
+	client := redis.NewClient(newRedisConfig(config.GetStoreConfig(config.Users)))
+	setupDB(t, client)
+	us, e := store.NewUserStore("redis", config.GetStoreConfig(config.Users))
+	require.NoError(t, e, e)
+	store.TestHashedUserStore(t, us)
+}
+
 func TestRedisPeerStore(t *testing.T) {
 	client := redis.NewClient(newRedisConfig(config.GetStoreConfig(config.Torrent)))
 	setupDB(t, client)
@@ -34,6 +42,14 @@ func TestRedisPeerStore(t *testing.T) {
 	store.TestPeerStore(t, ps, ts, memory.NewUserStore())
 }
 
+func TestRedisRateLimiter(t *testing.T) {
+	client := redis.NewClient(newRedisConfig(config.GetStoreConfig(config.RateLimit)))
+	setupDB(t, client)
+	rl, err := store.NewRateLimiter("redis", config.GetStoreConfig(config.RateLimit))
+	require.NoError(t, err)
+	store.TestRateLimiter(t, rl)
+}
+
 func clearDB(c *redis.Client) {
 	keys, err := c.Keys("*").Result()
 	if err != nil {
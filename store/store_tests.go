@@ -18,8 +18,9 @@ import (
 // GenerateTestUser creates a peer using fake data. Used for testing.
 func GenerateTestUser() model.User {
 	return model.User{
-		UserID:  uint32(rand.Intn(10000)),
-		Passkey: util.NewPasskey(),
+		UserID:          uint32(rand.Intn(10000)),
+		Passkey:         util.NewPasskey(),
+		DownloadEnabled: true,
 	}
 }
 
@@ -31,7 +32,9 @@ func GenerateTestTorrent() model.Torrent {
 	if err := model.InfoHashFromString(&ih, val); err != nil {
 		log.Panicf("Failed to generate info_hash: %s", err.Error())
 	}
-	return model.NewTorrent(ih, fmt.Sprintf("Show.Title.%d.S03E07.720p.WEB.h264-GRP", rand.Intn(1000000)))
+	t := model.NewTorrent(ih, fmt.Sprintf("Show.Title.%d.S03E07.720p.WEB.h264-GRP", rand.Intn(1000000)))
+	t.Size = uint64(rand.Int63n(50 << 30))
+	return t
 }
 
 // GenerateTestPeer creates a peer using fake data for the provided user. Used for testing.
@@ -64,11 +67,28 @@ func TestPeerStore(t *testing.T, ps PeerStore, ts TorrentStore, us UserStore) {
 	for i := 0; i < 5; i++ {
 		p := GenerateTestPeer()
 		p.InfoHash = torrentA.InfoHash
+		if i < 2 {
+			p.Left = 1000
+		}
 		peers = append(peers, p)
 	}
+	// The first two peers belong to the same user, one announcing with an additional passkey
+	peers[1].UserID = peers[0].UserID
+	peers[1].PasskeyLabel = "seedbox"
 	for _, peer := range peers {
 		require.NoError(t, ps.Add(torrentA.InfoHash, peer))
 	}
+	seeders, leechers, err := ps.Counts(torrentA.InfoHash)
+	require.NoError(t, err)
+	require.Equal(t, uint(3), seeders)
+	require.Equal(t, uint(2), leechers)
+	userPeers, err := ps.GetByUser(peers[0].UserID)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(userPeers))
+	require.Equal(t, model.SlotUsage{Leeching: 2, Torrent: 2}, userPeers.SlotUsage(torrentA.InfoHash))
+	var labelled model.Peer
+	require.NoError(t, ps.Get(&labelled, torrentA.InfoHash, peers[1].PeerID))
+	require.Equal(t, "seedbox", labelled.PasskeyLabel)
 	fetchedPeers, err := ps.GetN(torrentA.InfoHash, 5)
 	require.NoError(t, err)
 	require.Equal(t, len(peers), len(fetchedPeers))
@@ -88,10 +108,16 @@ func TestPeerStore(t *testing.T, ps PeerStore, ts TorrentStore, us UserStore) {
 	ph := model.NewPeerHash(p1.InfoHash, p1.PeerID)
 	require.NoError(t, ps.Sync(map[model.PeerHash]model.PeerStats{
 		ph: {
-			Uploaded:     10000,
-			Downloaded:   20000,
+			Uploaded:          10000,
+			Downloaded:        20000,
+			LastAnnounce:      time.Now(),
+			Announces:         5,
+			SessionUploaded:   30000,
+			SessionDownloaded: 40000,
+		},
+		model.NewPeerHash(torrentA.InfoHash, peers[0].PeerID): {
 			LastAnnounce: time.Now(),
-			Announces:    5,
+			Announces:    1,
 		},
 	}))
 	updatedPeers, err2 := ps.GetN(torrentA.InfoHash, 5)
@@ -101,26 +127,67 @@ func TestPeerStore(t *testing.T, ps PeerStore, ts TorrentStore, us UserStore) {
 	require.Equal(t, p1.TotalTime, p1Updated.TotalTime)
 	require.Equal(t, uint64(20000), p1Updated.Downloaded)
 	require.Equal(t, uint64(10000), p1Updated.Uploaded)
+	require.Equal(t, uint64(30000), p1Updated.SessionUploaded)
+	require.Equal(t, uint64(40000), p1Updated.SessionDownloaded)
+	p2 := peers[3]
+	p2.IP = net.ParseIP("5.6.7.8")
+	p2.Port = 6999
+	p2.Key = "ABCD1234"
+	require.NoError(t, ps.UpdateAddr(torrentA.InfoHash, p2))
+	var p2Updated model.Peer
+	require.NoError(t, ps.Get(&p2Updated, torrentA.InfoHash, p2.PeerID))
+	require.True(t, p2.IP.Equal(p2Updated.IP))
+	require.Equal(t, p2.Port, p2Updated.Port)
+	require.Equal(t, p2.Key, p2Updated.Key)
+	// Completing the download moves the peer to seeding
+	userPeers, err = ps.GetByUser(peers[0].UserID)
+	require.NoError(t, err)
+	require.Equal(t, model.SlotUsage{Leeching: 1, Seeding: 1, Torrent: 2}, userPeers.SlotUsage(torrentA.InfoHash))
 	for _, peer := range peers {
 		require.NoError(t, ps.Delete(torrentA.InfoHash, peer.PeerID))
 	}
+	userPeers, err = ps.GetByUser(peers[0].UserID)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(userPeers))
 }
 
 // TestTorrentStore tests the interface implementation
 func TestTorrentStore(t *testing.T, ts TorrentStore) {
 	torrentA := GenerateTestTorrent()
+	torrentA.Tags = model.Tags{"tv", "hd"}
 	require.NoError(t, ts.Add(torrentA))
 	var fetchedTorrent model.Torrent
 	require.NoError(t, ts.Get(&fetchedTorrent, torrentA.InfoHash))
 	require.Equal(t, torrentA.InfoHash, fetchedTorrent.InfoHash)
+	require.Equal(t, torrentA.Tags, fetchedTorrent.Tags)
+	require.Equal(t, torrentA.Size, fetchedTorrent.Size)
 	require.Equal(t, torrentA.IsDeleted, fetchedTorrent.IsDeleted)
 	require.Equal(t, torrentA.IsEnabled, fetchedTorrent.IsEnabled)
+	allTorrents, err := ts.GetAll()
+	require.NoError(t, err)
+	found := false
+	for _, tor := range allTorrents {
+		if tor.InfoHash == torrentA.InfoHash {
+			found = true
+		}
+	}
+	require.True(t, found)
 	require.NoError(t, ts.Delete(torrentA.InfoHash, true))
 	var deletedTorrent model.Torrent
 	require.Equal(t, consts.ErrInvalidInfoHash, ts.Get(&deletedTorrent, torrentA.InfoHash))
+	hybrid := GenerateTestTorrent()
+	hybrid.InfoHashV2 = GenerateTestTorrent().InfoHash
+	require.NoError(t, ts.Add(hybrid))
+	var fetchedHybrid model.Torrent
+	require.NoError(t, ts.Get(&fetchedHybrid, hybrid.InfoHashV2))
+	require.Equal(t, hybrid.InfoHash, fetchedHybrid.InfoHash)
+	require.Equal(t, hybrid.InfoHashV2, fetchedHybrid.InfoHashV2)
+	require.NoError(t, ts.Delete(hybrid.InfoHash, true))
+	require.Equal(t, consts.ErrInvalidInfoHash, ts.Get(&fetchedHybrid, hybrid.InfoHashV2))
 	wlClients := []model.WhiteListClient{
 		{ClientPrefix: "UT", ClientName: "uTorrent"},
-		{ClientPrefix: "qT", ClientName: "QBittorrent"},
+		{ClientPrefix: "qB", ClientName: "qBittorrent", MinVersion: "4.2.0", MaxVersion: "4.5.2",
+			BannedVersions: "4.3.0,4.3.1"},
 	}
 	for _, c := range wlClients {
 		require.NoError(t, ts.WhiteListAdd(c))
@@ -128,9 +195,111 @@ func TestTorrentStore(t *testing.T, ts TorrentStore) {
 	clients, err3 := ts.WhiteListGetAll()
 	require.NoError(t, err3)
 	require.Equal(t, len(wlClients), len(clients))
+	require.Contains(t, clients, wlClients[1])
 	require.NoError(t, ts.WhiteListDelete(wlClients[0]))
 	clientsUpdated, _ := ts.WhiteListGetAll()
 	require.Equal(t, len(wlClients)-1, len(clientsUpdated))
+
+	start := time.Now().Truncate(time.Second)
+	promos := []model.Promotion{
+		{Name: "weekend", Scope: model.PromotionGlobal, MultiUp: 1, MultiDn: 0,
+			TimeStart: start, TimeEnd: start.Add(48 * time.Hour)},
+		{Name: "double_up", Scope: model.PromotionTorrent, MultiUp: 2, MultiDn: 1,
+			InfoHashes: model.InfoHashes{torrentA.InfoHash, hybrid.InfoHash},
+			TimeStart:  start, TimeEnd: start.Add(time.Hour)},
+	}
+	for _, p := range promos {
+		require.NoError(t, ts.PromotionAdd(p))
+	}
+	// Adding a promotion with an existing name replaces it
+	replaced := promos[0]
+	replaced.Scope = model.PromotionTag
+	replaced.Tag = "hd"
+	replaced.MultiDn = 0.5
+	require.NoError(t, ts.PromotionAdd(replaced))
+	fetchedPromos, err := ts.PromotionGetAll()
+	require.NoError(t, err)
+	require.Equal(t, len(promos), len(fetchedPromos))
+	for _, p := range fetchedPromos {
+		switch p.Name {
+		case replaced.Name:
+			require.Equal(t, model.PromotionTag, p.Scope)
+			require.Equal(t, "hd", p.Tag)
+			require.Equal(t, 0.5, p.MultiDn)
+		case promos[1].Name:
+			require.Equal(t, model.PromotionTorrent, p.Scope)
+			require.Equal(t, promos[1].InfoHashes, p.InfoHashes)
+			require.Equal(t, 2.0, p.MultiUp)
+			require.True(t, promos[1].TimeStart.Equal(p.TimeStart))
+			require.True(t, promos[1].TimeEnd.Equal(p.TimeEnd))
+		default:
+			t.Fatalf("Unexpected promotion: %s", p.Name)
+		}
+	}
+	require.NoError(t, ts.PromotionDelete(promos[1]))
+	require.Equal(t, consts.ErrInvalidPromotion, ts.PromotionDelete(promos[1]))
+	fetchedPromos, err = ts.PromotionGetAll()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(fetchedPromos))
+	require.NoError(t, ts.PromotionDelete(replaced))
+
+	bans := []model.Ban{
+		{CIDR: "10.0.0.0/24", Reason: "network", TimeCreated: start},
+		{CIDR: "2001:db8::1/128", Reason: "address", TimeCreated: start, TimeExpire: start.Add(time.Hour)},
+	}
+	require.NoError(t, ts.BanAdd(bans))
+	// Adding a ban with an existing CIDR replaces it
+	replacedBan := bans[0]
+	replacedBan.Reason = "replaced"
+	require.NoError(t, ts.BanAdd([]model.Ban{replacedBan}))
+	fetchedBans, err := ts.BanGetAll()
+	require.NoError(t, err)
+	require.Equal(t, len(bans), len(fetchedBans))
+	for _, b := range fetchedBans {
+		switch b.CIDR {
+		case replacedBan.CIDR:
+			require.Equal(t, "replaced", b.Reason)
+			require.True(t, b.Permanent())
+		case bans[1].CIDR:
+			require.Equal(t, bans[1].Reason, b.Reason)
+			require.True(t, bans[1].TimeCreated.Equal(b.TimeCreated))
+			require.True(t, bans[1].TimeExpire.Equal(b.TimeExpire))
+		default:
+			t.Fatalf("Unexpected ban: %s", b.CIDR)
+		}
+	}
+	require.NoError(t, ts.BanDelete(bans[1].CIDR))
+	require.Equal(t, consts.ErrInvalidBan, ts.BanDelete(bans[1].CIDR))
+	fetchedBans, err = ts.BanGetAll()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(fetchedBans))
+	require.NoError(t, ts.BanDelete(replacedBan.CIDR))
+}
+
+// TestRateLimiter tests the interface implementation
+func TestRateLimiter(t *testing.T, rl RateLimiter) {
+	rate := Rate{Count: 3, Period: time.Second}
+	for i := 0; i < rate.Count; i++ {
+		allowed, err := rl.Allow("test_a", rate)
+		require.NoError(t, err)
+		require.True(t, allowed)
+	}
+	allowed, err := rl.Allow("test_a", rate)
+	require.NoError(t, err)
+	require.False(t, allowed)
+	// Buckets are independent of each other
+	allowed, err = rl.Allow("test_b", rate)
+	require.NoError(t, err)
+	require.True(t, allowed)
+	// Tokens are refilled over the period
+	time.Sleep(rate.Period / time.Duration(rate.Count))
+	allowed, err = rl.Allow("test_a", rate)
+	require.NoError(t, err)
+	require.True(t, allowed)
+	// Disabled rates always allow
+	allowed, err = rl.Allow("test_a", Rate{})
+	require.NoError(t, err)
+	require.True(t, allowed)
 }
 
 func TestUserStore(t *testing.T, s UserStore) {
@@ -141,6 +310,7 @@ func TestUserStore(t *testing.T, s UserStore) {
 	if users == nil {
 		t.Fatalf("Failed to setup users")
 	}
+	users[0].BonusPoints = 12.5
 	require.NoError(t, s.Add(users[0]))
 	var fetchedUserID model.User
 	var fetchedUserPasskey model.User
@@ -149,11 +319,15 @@ func TestUserStore(t *testing.T, s UserStore) {
 	require.NoError(t, s.GetByPasskey(&fetchedUserPasskey, users[0].Passkey))
 	require.Equal(t, users[0], fetchedUserPasskey)
 
-	batchUpdate := map[string]model.UserStats{
-		users[0].Passkey: {
-			Uploaded:   1000,
-			Downloaded: 2000,
-			Announces:  10,
+	batchUpdate := map[uint32]model.UserStats{
+		users[0].UserID: {
+			Uploaded:      1000,
+			Downloaded:    2000,
+			UploadedRaw:   500,
+			DownloadedRaw: 4000,
+			Announces:     10,
+			BonusPoints:   1.25,
+			LeechDenied:   2,
 		},
 	}
 	require.NoError(t, s.Sync(batchUpdate))
@@ -161,7 +335,326 @@ func TestUserStore(t *testing.T, s UserStore) {
 	require.NoError(t, s.GetByPasskey(&updatedUser, users[0].Passkey))
 	require.Equal(t, uint64(1000), updatedUser.Uploaded)
 	require.Equal(t, uint64(2000), updatedUser.Downloaded)
+	require.Equal(t, uint64(500), updatedUser.UploadedRaw)
+	require.Equal(t, uint64(4000), updatedUser.DownloadedRaw)
 	require.Equal(t, uint32(10), updatedUser.Announces)
+	require.Equal(t, 13.75, updatedUser.BonusPoints)
+	require.Equal(t, uint32(2), updatedUser.LeechDenied)
+	// Negative values remove points
+	require.NoError(t, s.Sync(map[uint32]model.UserStats{users[0].UserID: {BonusPoints: -3.75}}))
+	require.NoError(t, s.GetByPasskey(&updatedUser, users[0].Passkey))
+	require.Equal(t, 10.0, updatedUser.BonusPoints)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	torrent := GenerateTestTorrent()
+	pending := model.NewHitAndRun(users[0].UserID, torrent.InfoHash, now)
+	flagged := model.NewHitAndRun(users[0].UserID, GenerateTestTorrent().InfoHash, now.Add(-time.Hour))
+	flagged.Status = model.HNRFlagged
+	satisfied := model.NewHitAndRun(users[1].UserID, torrent.InfoHash, now.Add(-time.Hour))
+	satisfied.Status = model.HNRSatisfied
+	satisfied.SeedTime = 3600
+	satisfied.TimeLastSeed = now
+	require.NoError(t, s.HNRSync([]model.HitAndRun{pending, flagged, satisfied}))
+	userHNR, err := s.HNRGetByUser(users[0].UserID)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(userHNR))
+	active, err := s.HNRGetActive()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(active))
+	pending.SeedTime = 60
+	pending.TimeLastSeed = now.Add(time.Minute)
+	require.NoError(t, s.HNRSync([]model.HitAndRun{pending}))
+	userHNR, err = s.HNRGetByUser(users[0].UserID)
+	require.NoError(t, err)
+	for _, h := range userHNR {
+		if h.InfoHash == pending.InfoHash {
+			require.Equal(t, pending.SeedTime, h.SeedTime)
+			require.True(t, pending.TimeLastSeed.Equal(h.TimeLastSeed))
+		}
+	}
+	require.NoError(t, s.HNRDelete(users[0].UserID, pending.InfoHash))
+	require.Equal(t, consts.ErrInvalidHNR, s.HNRDelete(users[0].UserID, pending.InfoHash))
+	userHNR, err = s.HNRGetByUser(users[1].UserID)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(userHNR))
+	require.Equal(t, model.HNRSatisfied, userHNR[0].Status)
+
+	var snatches []model.Snatch
+	for i := 0; i < 3; i++ {
+		snatches = append(snatches, model.Snatch{
+			UserID:        users[0].UserID,
+			InfoHash:      GenerateTestTorrent().InfoHash,
+			TimeCompleted: now.Add(time.Duration(i) * time.Minute),
+			IP:            net.ParseIP("12.34.56.78").To4(),
+			Client:        "qBittorrent 4.2.5",
+			Downloaded:    1000,
+		})
+	}
+	otherUser := snatches[0]
+	otherUser.UserID = users[1].UserID
+	otherUser.TimeCompleted = now.Add(time.Hour)
+	snatches = append(snatches, otherUser)
+	require.NoError(t, s.SnatchAdd(snatches))
+	// Existing snatches are kept
+	duplicate := snatches[0]
+	duplicate.Downloaded = 5000
+	require.NoError(t, s.SnatchAdd([]model.Snatch{duplicate}))
+	require.NoError(t, s.SnatchSync(map[model.UserTorrentKey]model.SnatchStats{
+		snatches[0].Key(): {Uploaded: 500, Downloaded: 10},
+		// Unknown snatches are ignored
+		{UserID: users[2].UserID, InfoHash: snatches[0].InfoHash}: {Uploaded: 500},
+	}))
+	userSnatches, err := s.SnatchGetByUser(users[0].UserID, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(userSnatches))
+	require.Equal(t, snatches[2].InfoHash, userSnatches[0].InfoHash)
+	require.Equal(t, snatches[0].InfoHash, userSnatches[2].InfoHash)
+	require.Equal(t, uint64(500), userSnatches[2].Uploaded)
+	require.Equal(t, uint64(1010), userSnatches[2].Downloaded)
+	require.True(t, snatches[0].IP.Equal(userSnatches[2].IP))
+	require.Equal(t, snatches[0].Client, userSnatches[2].Client)
+	userSnatches, err = s.SnatchGetByUser(users[0].UserID, 1, 1)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(userSnatches))
+	require.Equal(t, snatches[1].InfoHash, userSnatches[0].InfoHash)
+	torrentSnatches, err := s.SnatchGetByTorrent(snatches[0].InfoHash, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(torrentSnatches))
+	require.Equal(t, users[1].UserID, torrentSnatches[0].UserID)
+	require.Equal(t, users[0].UserID, torrentSnatches[1].UserID)
+
+	token := model.FreeleechToken{UserID: users[0].UserID, InfoHash: GenerateTestTorrent().InfoHash,
+		TimeCreated: now, TimeExpire: now.Add(time.Hour)}
+	otherToken := token
+	otherToken.UserID = users[1].UserID
+	require.NoError(t, s.FreeleechAdd(token))
+	require.NoError(t, s.FreeleechAdd(otherToken))
+	// Existing tokens are replaced
+	token.TimeExpire = now.Add(2 * time.Hour)
+	require.NoError(t, s.FreeleechAdd(token))
+	userTokens, err := s.FreeleechGetByUser(users[0].UserID)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(userTokens))
+	require.Equal(t, token.InfoHash, userTokens[0].InfoHash)
+	require.True(t, token.TimeCreated.Equal(userTokens[0].TimeCreated))
+	require.True(t, token.TimeExpire.Equal(userTokens[0].TimeExpire))
+	allTokens, err := s.FreeleechGetAll()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(allTokens))
+	require.NoError(t, s.FreeleechDelete(token.UserID, token.InfoHash))
+	require.Equal(t, consts.ErrInvalidFreeleech, s.FreeleechDelete(token.UserID, token.InfoHash))
+	userTokens, err = s.FreeleechGetByUser(users[0].UserID)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(userTokens))
+
+	// Each sync above recorded a ledger entry
+	ledger, err := s.LedgerGetByUser(users[0].UserID, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(ledger))
+	require.Equal(t, model.LedgerSync, ledger[1].Source)
+	require.Equal(t, int64(1000), ledger[1].Uploaded)
+	require.Equal(t, int64(2000), ledger[1].Downloaded)
+	require.Equal(t, 1.25, ledger[1].BonusPoints)
+	require.Equal(t, -3.75, ledger[0].BonusPoints)
+	adjustment := model.LedgerEntry{
+		UserID:      users[0].UserID,
+		Source:      model.LedgerAdjustment,
+		Uploaded:    500,
+		Downloaded:  -5000,
+		BonusPoints: 2.5,
+		Reason:      "Compensation for tracker outage",
+		Actor:       "admin",
+		TimeCreated: now,
+	}
+	require.NoError(t, s.LedgerAdjust(adjustment))
+	require.NoError(t, s.GetByPasskey(&updatedUser, users[0].Passkey))
+	require.Equal(t, uint64(1500), updatedUser.Uploaded)
+	// Totals cannot go below zero
+	require.Equal(t, uint64(0), updatedUser.Downloaded)
+	require.Equal(t, 12.5, updatedUser.BonusPoints)
+	unknown := adjustment
+	unknown.UserID = users[4].UserID
+	require.Equal(t, consts.ErrInvalidUser, s.LedgerAdjust(unknown))
+	ledger, err = s.LedgerGetByUser(users[0].UserID, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(ledger))
+	require.NotEqual(t, uint64(0), ledger[0].LedgerID)
+	require.Equal(t, model.LedgerAdjustment, ledger[0].Source)
+	require.Equal(t, adjustment.Uploaded, ledger[0].Uploaded)
+	require.Equal(t, adjustment.Downloaded, ledger[0].Downloaded)
+	require.Equal(t, adjustment.Reason, ledger[0].Reason)
+	require.Equal(t, adjustment.Actor, ledger[0].Actor)
+	require.True(t, adjustment.TimeCreated.Equal(ledger[0].TimeCreated))
+	ledger, err = s.LedgerGetByUser(users[0].UserID, 1, 1)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(ledger))
+	require.Equal(t, -3.75, ledger[0].BonusPoints)
+
+	require.NoError(t, s.SetDownloadEnabled(users[0].UserID, false))
+	require.NoError(t, s.GetByPasskey(&updatedUser, users[0].Passkey))
+	require.False(t, updatedUser.DownloadEnabled)
+	require.NoError(t, s.SetDownloadEnabled(users[0].UserID, true))
+	require.NoError(t, s.SetDownloadEnabled(users[0].UserID, true))
+	require.NoError(t, s.GetByPasskey(&updatedUser, users[0].Passkey))
+	require.True(t, updatedUser.DownloadEnabled)
+	require.Equal(t, consts.ErrInvalidUser, s.SetDownloadEnabled(users[4].UserID, false))
+	limits := model.SlotLimits{Leech: 2, Seed: -1, PerTorrent: 1}
+	require.NoError(t, s.SetSlotLimits(users[0].UserID, limits))
+	require.NoError(t, s.SetSlotLimits(users[0].UserID, limits))
+	require.NoError(t, s.GetByID(&updatedUser, users[0].UserID))
+	require.Equal(t, limits, updatedUser.SlotLimits)
+	require.Equal(t, consts.ErrInvalidUser, s.SetSlotLimits(users[4].UserID, limits))
+
+	var rw model.RatioWatch
+	require.Equal(t, consts.ErrInvalidRatioWatch, s.RatioWatchGet(&rw, users[0].UserID))
+	warned := model.NewRatioWatch(users[0].UserID, 0.25, 0.5, now, 24*time.Hour)
+	cleared := model.NewRatioWatch(users[1].UserID, 0.25, 0.5, now, 24*time.Hour)
+	cleared.Transition(model.RatioWatchCleared, 0.75, now.Add(time.Hour))
+	require.NoError(t, s.RatioWatchAdd(warned))
+	require.NoError(t, s.RatioWatchAdd(cleared))
+	activeWatch, err := s.RatioWatchGetActive()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(activeWatch))
+	require.Equal(t, users[0].UserID, activeWatch[0].UserID)
+	// Existing records are replaced
+	warned.Transition(model.RatioWatchDisabled, 0.3, now.Add(25*time.Hour))
+	require.NoError(t, s.RatioWatchAdd(warned))
+	require.NoError(t, s.RatioWatchGet(&rw, users[0].UserID))
+	require.Equal(t, model.RatioWatchDisabled, rw.Status)
+	require.Equal(t, 0.3, rw.Ratio)
+	require.Equal(t, 0.5, rw.RequiredRatio)
+	require.True(t, warned.TimeWarned.Equal(rw.TimeWarned))
+	require.True(t, warned.TimeDeadline.Equal(rw.TimeDeadline))
+	require.True(t, warned.TimeUpdated.Equal(rw.TimeUpdated))
+	require.NoError(t, s.RatioWatchGet(&rw, users[1].UserID))
+	require.Equal(t, model.RatioWatchCleared, rw.Status)
+
+	// Replacing the passkey stops the previous passkey from resolving to the user
+	oldPasskey := users[0].Passkey
+	newPasskey := util.NewPasskey()
+	require.NoError(t, s.SetPasskey(users[0].UserID, newPasskey))
+	require.Equal(t, consts.ErrInvalidUser, s.SetPasskey(users[4].UserID, util.NewPasskey()))
+	require.NoError(t, s.GetByPasskey(&updatedUser, newPasskey))
+	require.Equal(t, newPasskey, updatedUser.Passkey)
+	require.Equal(t, limits, updatedUser.SlotLimits)
+	require.NoError(t, s.GetByID(&updatedUser, users[0].UserID))
+	require.Equal(t, newPasskey, updatedUser.Passkey)
+	require.Error(t, s.GetByPasskey(&updatedUser, oldPasskey))
+	// Additional passkeys resolve to the user until they expire
+	grace := model.Passkey{Passkey: oldPasskey, UserID: users[0].UserID, Label: model.PasskeyLabelPrevious,
+		TimeCreated: now, TimeExpire: now.Add(time.Hour)}
+	expired := model.Passkey{Passkey: util.NewPasskey(), UserID: users[0].UserID,
+		TimeCreated: now.Add(-2 * time.Hour), TimeExpire: now.Add(-time.Hour)}
+	seedbox := model.Passkey{Passkey: util.NewPasskey(), UserID: users[0].UserID, Label: "seedbox", TimeCreated: now}
+	require.NoError(t, s.PasskeyAdd(grace))
+	require.NoError(t, s.PasskeyAdd(expired))
+	require.NoError(t, s.PasskeyAdd(seedbox))
+	var altUser model.User
+	require.NoError(t, s.GetByPasskey(&altUser, oldPasskey))
+	require.Equal(t, users[0].UserID, altUser.UserID)
+	require.Equal(t, newPasskey, altUser.Passkey)
+	require.Error(t, s.GetByPasskey(&altUser, expired.Passkey))
+	require.NoError(t, s.GetByPasskey(&altUser, seedbox.Passkey))
+	require.Equal(t, users[0].UserID, altUser.UserID)
+	passkeys, err := s.PasskeyGetByUser(users[0].UserID)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(passkeys))
+	for _, pk := range passkeys {
+		switch pk.Passkey {
+		case oldPasskey:
+			require.Equal(t, model.PasskeyLabelPrevious, pk.Label)
+			require.True(t, grace.TimeExpire.Equal(pk.TimeExpire))
+		case seedbox.Passkey:
+			require.Equal(t, "seedbox", pk.Label)
+			require.True(t, pk.TimeExpire.IsZero())
+			require.True(t, pk.TimeLastUsed.IsZero())
+		default:
+			require.Equal(t, expired.Passkey, pk.Passkey)
+		}
+	}
+	// Usage is only recorded for passkeys which still exist
+	usedAt := now.Add(time.Minute).Truncate(time.Second)
+	unknownPasskey := util.NewPasskey()
+	require.NoError(t, s.PasskeySync(map[string]model.PasskeyUsage{
+		seedbox.Passkey: {IP: net.ParseIP("12.34.56.78"), TimeLastUsed: usedAt},
+		unknownPasskey:  {IP: net.ParseIP("12.34.56.78"), TimeLastUsed: usedAt},
+	}))
+	var pk model.Passkey
+	require.NoError(t, s.PasskeyGet(&pk, seedbox.Passkey))
+	require.Equal(t, users[0].UserID, pk.UserID)
+	require.Equal(t, "seedbox", pk.Label)
+	require.True(t, usedAt.Equal(pk.TimeLastUsed))
+	require.True(t, net.ParseIP("12.34.56.78").Equal(pk.IP))
+	require.Equal(t, consts.ErrInvalidPasskey, s.PasskeyGet(&pk, unknownPasskey))
+	// Each passkey is revoked on its own
+	require.NoError(t, s.PasskeyDelete(oldPasskey))
+	require.Equal(t, consts.ErrInvalidPasskey, s.PasskeyDelete(oldPasskey))
+	require.Error(t, s.GetByPasskey(&altUser, oldPasskey))
+	require.NoError(t, s.GetByPasskey(&altUser, seedbox.Passkey))
+}
+
+// TestHashedUserStore ensures the passkeys of existing users are migrated to digests and continue
+// to resolve when the store is wrapped in a HashedUserStore
+func TestHashedUserStore(t *testing.T, s UserStore) {
+	now := time.Now().UTC().Truncate(time.Second)
+	usr := GenerateTestUser()
+	require.NoError(t, s.Add(usr))
+	seedbox := model.Passkey{Passkey: util.NewPasskey(), UserID: usr.UserID, Label: "seedbox", TimeCreated: now}
+	require.NoError(t, s.PasskeyAdd(seedbox))
+
+	h := NewHashedUserStore(s, "secret")
+	changed, err := h.Migrate()
+	require.NoError(t, err)
+	require.Equal(t, 2, changed)
+	// Digests are left unchanged
+	changed, err = h.Migrate()
+	require.NoError(t, err)
+	require.Equal(t, 0, changed)
+
+	// Only the digest is persisted while the plain passkeys still resolve through the wrapper
+	var fetched model.User
+	require.Error(t, s.GetByPasskey(&fetched, usr.Passkey))
+	require.NoError(t, s.GetByPasskey(&fetched, h.HashPasskey(usr.Passkey)))
+	require.NoError(t, h.GetByPasskey(&fetched, usr.Passkey))
+	require.Equal(t, usr.UserID, fetched.UserID)
+	require.Equal(t, h.HashPasskey(usr.Passkey), fetched.Passkey)
+	// A leaked digest cannot be used in place of the passkey
+	require.Error(t, h.GetByPasskey(&fetched, h.HashPasskey(usr.Passkey)))
+	require.Error(t, h.GetByPasskey(&fetched, h.HashPasskey(seedbox.Passkey)))
+	require.NoError(t, h.GetByPasskey(&fetched, seedbox.Passkey))
+	require.Equal(t, usr.UserID, fetched.UserID)
+	var pk model.Passkey
+	require.Equal(t, consts.ErrInvalidPasskey, s.PasskeyGet(&pk, seedbox.Passkey))
+	require.NoError(t, h.PasskeyGet(&pk, seedbox.Passkey))
+	require.Equal(t, h.HashPasskey(seedbox.Passkey), pk.Passkey)
+
+	// New passkeys are hashed before they are persisted
+	newPasskey := util.NewPasskey()
+	require.NoError(t, h.SetPasskey(usr.UserID, newPasskey))
+	require.NoError(t, s.GetByID(&fetched, usr.UserID))
+	require.Equal(t, h.HashPasskey(newPasskey), fetched.Passkey)
+	require.NoError(t, h.GetByPasskey(&fetched, newPasskey))
+	require.Error(t, h.GetByPasskey(&fetched, usr.Passkey))
+	laptop := model.Passkey{Passkey: util.NewPasskey(), UserID: usr.UserID, Label: "laptop", TimeCreated: now}
+	require.NoError(t, h.PasskeyAdd(laptop))
+	usedAt := now.Add(time.Minute)
+	require.NoError(t, h.PasskeySync(map[string]model.PasskeyUsage{
+		laptop.Passkey: {IP: net.ParseIP("12.34.56.78"), TimeLastUsed: usedAt},
+	}))
+	require.NoError(t, h.PasskeyGet(&pk, laptop.Passkey))
+	require.True(t, usedAt.Equal(pk.TimeLastUsed))
+	passkeys, err := h.PasskeyGetByUser(usr.UserID)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(passkeys))
+	for _, p := range passkeys {
+		require.True(t, model.IsPasskeyDigest(p.Passkey))
+	}
+	// Plain passkeys are revoked through the wrapper while the digests listed above are revoked
+	// through the wrapped store
+	require.NoError(t, h.PasskeyDelete(laptop.Passkey))
+	require.Equal(t, consts.ErrInvalidPasskey, h.PasskeyDelete(h.HashPasskey(seedbox.Passkey)))
+	require.NoError(t, h.DigestStore().PasskeyDelete(h.HashPasskey(seedbox.Passkey)))
+	require.Equal(t, consts.ErrInvalidPasskey, h.PasskeyDelete(seedbox.Passkey))
 }
 
 func init() {
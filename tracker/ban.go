@@ -0,0 +1,127 @@
+package tracker
+
+import (
+	"github.com/leighmacdonald/mika/consts"
+	"github.com/leighmacdonald/mika/model"
+	"github.com/leighmacdonald/mika/store"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"time"
+)
+
+// loadBans reads the bans known to the TorrentStore
+func loadBans(ts store.TorrentStore) model.BanList {
+	bans, err := ts.BanGetAll()
+	if err != nil {
+		log.Warnf("Failed to read bans: %s", err.Error())
+		return model.NewBanList(nil)
+	}
+	return model.NewBanList(bans)
+}
+
+// BanCheck returns the ban containing the address if it is banned at the time provided
+func (t *Tracker) BanCheck(ip net.IP, now time.Time) (model.Ban, bool) {
+	t.BansMutex.RLock()
+	defer t.BansMutex.RUnlock()
+	return t.Bans.Find(ip, now)
+}
+
+// BanAdd adds the bans to the tracker and the TorrentStore. Existing bans with the same CIDR
+// are replaced.
+func (t *Tracker) BanAdd(bans []model.Ban) error {
+	t.BansMutex.Lock()
+	defer t.BansMutex.Unlock()
+	if err := t.Torrents.BanAdd(bans); err != nil {
+		return err
+	}
+	merged := make(map[string]model.Ban)
+	for _, b := range t.Bans.Bans() {
+		merged[b.CIDR] = b
+	}
+	for _, b := range bans {
+		merged[b.CIDR] = b
+	}
+	t.Bans = newBanList(merged)
+	return nil
+}
+
+// BanDelete removes the ban matching the CIDR from the tracker and the TorrentStore
+func (t *Tracker) BanDelete(cidr string) error {
+	t.BansMutex.Lock()
+	defer t.BansMutex.Unlock()
+	return t.banDelete(map[string]bool{cidr: true})
+}
+
+// banDelete removes the bans matching the CIDRs provided. Bans which are only known to the tracker
+// are removed even though they cannot be deleted from the TorrentStore. The caller must hold the lock.
+func (t *Tracker) banDelete(cidrs map[string]bool) error {
+	remaining := make(map[string]model.Ban)
+	var err error
+	for _, b := range t.Bans.Bans() {
+		if !cidrs[b.CIDR] {
+			remaining[b.CIDR] = b
+			continue
+		}
+		if delErr := t.Torrents.BanDelete(b.CIDR); delErr != nil && delErr != consts.ErrInvalidBan {
+			log.Errorf("Failed to remove ban %s: %s", b.CIDR, delErr.Error())
+			remaining[b.CIDR] = b
+			err = delErr
+			continue
+		}
+		delete(cidrs, b.CIDR)
+	}
+	t.Bans = newBanList(remaining)
+	if err != nil {
+		return err
+	}
+	if len(cidrs) > 0 {
+		return consts.ErrInvalidBan
+	}
+	return nil
+}
+
+// BanGetAll returns the bans ordered by their first address
+func (t *Tracker) BanGetAll() []model.Ban {
+	t.BansMutex.RLock()
+	defer t.BansMutex.RUnlock()
+	return t.Bans.Bans()
+}
+
+// BanReaper periodically removes bans which have expired from the tracker and backing store
+func (t *Tracker) BanReaper() {
+	banTicker := time.NewTicker(t.ReaperInterval)
+	for {
+		select {
+		case <-banTicker.C:
+			t.RetireBans(time.Now())
+		case <-t.ctx.Done():
+			return
+		}
+	}
+}
+
+// RetireBans removes any bans which have expired by the time provided
+func (t *Tracker) RetireBans(now time.Time) {
+	t.BansMutex.Lock()
+	defer t.BansMutex.Unlock()
+	expired := make(map[string]bool)
+	for _, b := range t.Bans.Bans() {
+		if b.Expired(now) {
+			expired[b.CIDR] = true
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+	if err := t.banDelete(expired); err == nil {
+		log.Debugf("Retired %d expired bans", len(expired))
+	}
+}
+
+func newBanList(bans map[string]model.Ban) model.BanList {
+	list := make([]model.Ban, 0, len(bans))
+	for _, b := range bans {
+		list = append(list, b)
+	}
+	return model.NewBanList(list)
+}
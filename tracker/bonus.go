@@ -0,0 +1,72 @@
+package tracker
+
+import (
+	"github.com/leighmacdonald/mika/config"
+	"github.com/leighmacdonald/mika/consts"
+	"github.com/leighmacdonald/mika/model"
+	"github.com/spf13/viper"
+	"math"
+	"time"
+)
+
+// bytesPerGiB is used to convert torrent sizes for the bonus formula
+const bytesPerGiB = 1 << 30
+
+// BonusFormula defines how many bonus points users earn for each hour spent seeding a torrent.
+// The hourly rate is calculated as:
+//
+//	(Base + Size * sqrt(size in GiB)) * (1 + Seeders / seeders)
+//
+// so larger torrents and swarms with fewer seeders earn points faster.
+type BonusFormula struct {
+	Base    float64
+	Size    float64
+	Seeders float64
+}
+
+// newBonusFormula returns the bonus formula using the configured weights
+func newBonusFormula() BonusFormula {
+	return BonusFormula{
+		Base:    viper.GetFloat64(string(config.TrackerBonusBase)),
+		Size:    viper.GetFloat64(string(config.TrackerBonusSize)),
+		Seeders: viper.GetFloat64(string(config.TrackerBonusSeeders)),
+	}
+}
+
+// Enabled returns true if the formula can award any points
+func (f BonusFormula) Enabled() bool {
+	return f.Base > 0 || f.Size > 0
+}
+
+// Points returns the bonus points earned for seeding a torrent of the size provided for the duration
+// provided. The announcing seeder is included in the swarms seeders so values below 1 are treated as 1.
+func (f BonusFormula) Points(size uint64, seeders uint, seeded time.Duration) float64 {
+	if !f.Enabled() || seeded <= 0 {
+		return 0
+	}
+	if seeders < 1 {
+		seeders = 1
+	}
+	rate := f.Base + f.Size*math.Sqrt(float64(size)/bytesPerGiB)
+	rate *= 1 + f.Seeders/float64(seeders)
+	return rate * seeded.Hours()
+}
+
+// seeded returns how long the peer has been seeding since its previous announce. Only seeding
+// announces which continue a known session are counted and announces more than maxGap apart are
+// not counted as the peer was not seeding during that time. This must be called before the
+// session is updated with the announce.
+func (s peerSessions) seeded(u model.UpdateState, maxGap time.Duration) time.Duration {
+	if u.Left > 0 || u.Event == consts.STARTED || u.Event == consts.COMPLETED {
+		return 0
+	}
+	sess, found := s[model.NewPeerHash(u.InfoHash, u.PeerID)]
+	if !found || sess.updated.IsZero() {
+		return 0
+	}
+	elapsed := u.Timestamp.Sub(sess.updated)
+	if elapsed <= 0 || elapsed > maxGap {
+		return 0
+	}
+	return elapsed
+}
@@ -0,0 +1,109 @@
+package tracker
+
+import (
+	"github.com/leighmacdonald/mika/consts"
+	"github.com/leighmacdonald/mika/model"
+	"github.com/leighmacdonald/mika/store"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// loadFreeleech reads the freeleech tokens known to the UserStore
+func loadFreeleech(us store.UserStore) map[model.UserTorrentKey]model.FreeleechToken {
+	tokens := make(map[model.UserTorrentKey]model.FreeleechToken)
+	fl, err := us.FreeleechGetAll()
+	if err != nil {
+		log.Warnf("Failed to read freeleech tokens: %s", err.Error())
+		return tokens
+	}
+	for _, f := range fl {
+		tokens[f.Key()] = f
+	}
+	return tokens
+}
+
+// FreeleechActive returns true if the user has an active freeleech token for the torrent at
+// the time provided
+func (t *Tracker) FreeleechActive(userID uint32, ih model.InfoHash, now time.Time) bool {
+	if userID == 0 {
+		return false
+	}
+	t.FreeleechMutex.RLock()
+	defer t.FreeleechMutex.RUnlock()
+	f, found := t.Freeleech[model.UserTorrentKey{UserID: userID, InfoHash: ih}]
+	return found && f.Active(now)
+}
+
+// FreeleechGrant adds the freeleech token to the tracker and the UserStore. Existing tokens for
+// the same user and torrent are replaced.
+func (t *Tracker) FreeleechGrant(token model.FreeleechToken) error {
+	t.FreeleechMutex.Lock()
+	defer t.FreeleechMutex.Unlock()
+	if err := t.Users.FreeleechAdd(token); err != nil {
+		return err
+	}
+	t.Freeleech[token.Key()] = token
+	return nil
+}
+
+// FreeleechConsume removes the freeleech token from the tracker and the UserStore
+func (t *Tracker) FreeleechConsume(userID uint32, ih model.InfoHash) error {
+	key := model.UserTorrentKey{UserID: userID, InfoHash: ih}
+	t.FreeleechMutex.Lock()
+	defer t.FreeleechMutex.Unlock()
+	_, tracked := t.Freeleech[key]
+	delete(t.Freeleech, key)
+	if err := t.Users.FreeleechDelete(userID, ih); err != nil {
+		// Tokens which have already expired in the UserStore only exist in the tracker
+		if err == consts.ErrInvalidFreeleech && tracked {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// FreeleechGetByUser returns the freeleech tokens of a user
+func (t *Tracker) FreeleechGetByUser(userID uint32) []model.FreeleechToken {
+	t.FreeleechMutex.RLock()
+	defer t.FreeleechMutex.RUnlock()
+	tokens := []model.FreeleechToken{}
+	for key, f := range t.Freeleech {
+		if key.UserID == userID {
+			tokens = append(tokens, f)
+		}
+	}
+	return tokens
+}
+
+// FreeleechReaper periodically removes freeleech tokens which have expired from the tracker and
+// backing store
+func (t *Tracker) FreeleechReaper() {
+	freeleechTicker := time.NewTicker(t.ReaperInterval)
+	for {
+		select {
+		case <-freeleechTicker.C:
+			t.RetireFreeleech(time.Now())
+		case <-t.ctx.Done():
+			return
+		}
+	}
+}
+
+// RetireFreeleech removes any freeleech tokens which have expired by the time provided
+func (t *Tracker) RetireFreeleech(now time.Time) {
+	t.FreeleechMutex.Lock()
+	defer t.FreeleechMutex.Unlock()
+	for key, f := range t.Freeleech {
+		if !f.Expired(now) {
+			continue
+		}
+		if err := t.Users.FreeleechDelete(f.UserID, f.InfoHash); err != nil && err != consts.ErrInvalidFreeleech {
+			log.Errorf("Failed to remove expired freeleech token %d %s: %s",
+				f.UserID, f.InfoHash.String(), err.Error())
+			continue
+		}
+		delete(t.Freeleech, key)
+		log.Debugf("Retired expired freeleech token: %d %s", f.UserID, f.InfoHash.String())
+	}
+}
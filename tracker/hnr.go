@@ -0,0 +1,118 @@
+package tracker
+
+import (
+	"github.com/leighmacdonald/mika/consts"
+	"github.com/leighmacdonald/mika/model"
+	"github.com/leighmacdonald/mika/store"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// loadHNR reads the pending and flagged hit and run records known to the UserStore
+func loadHNR(us store.UserStore) map[model.UserTorrentKey]model.HitAndRun {
+	records := make(map[model.UserTorrentKey]model.HitAndRun)
+	hnr, err := us.HNRGetActive()
+	if err != nil {
+		log.Warnf("Failed to read hit and runs: %s", err.Error())
+		return records
+	}
+	for _, h := range hnr {
+		records[h.Key()] = h
+	}
+	return records
+}
+
+// hnrUpdate applies the announce to the users hit and run record for the torrent. A completed
+// event starts a new record and seeding announces accrue seeding time. Announces more than
+// 2 announce intervals apart are not counted as time seeded. Returns true if the record changed.
+func (t *Tracker) hnrUpdate(u model.UpdateState) (model.UserTorrentKey, bool) {
+	key := model.UserTorrentKey{UserID: u.UserID, InfoHash: u.InfoHash}
+	if t.HNRThreshold <= 0 || u.UserID == 0 {
+		return key, false
+	}
+	t.HNRMutex.Lock()
+	defer t.HNRMutex.Unlock()
+	h, found := t.HNR[key]
+	switch {
+	case !found && u.Event == consts.COMPLETED:
+		h = model.NewHitAndRun(u.UserID, u.InfoHash, u.Timestamp)
+	case found && u.Left == 0:
+		h.Seed(u.Timestamp, t.AnnInterval*2, t.HNRThreshold)
+	default:
+		return key, false
+	}
+	t.HNR[key] = h
+	return key, true
+}
+
+// hnrFlush flags any pending records which have not been seeded within the grace window and
+// returns the current state of the changed records to be written to the UserStore. Satisfied
+// records are no longer tracked once returned.
+func (t *Tracker) hnrFlush(changed map[model.UserTorrentKey]bool, now time.Time) []model.HitAndRun {
+	t.HNRMutex.Lock()
+	defer t.HNRMutex.Unlock()
+	for key, h := range t.HNR {
+		if h.Expired(now, t.HNRGrace) {
+			h.Status = model.HNRFlagged
+			t.HNR[key] = h
+			changed[key] = true
+			log.Debugf("Flagged hit and run: %d %s", h.UserID, h.InfoHash.String())
+		}
+	}
+	var records []model.HitAndRun
+	for key := range changed {
+		delete(changed, key)
+		// Records forgiven since they changed are not written back
+		h, found := t.HNR[key]
+		if !found {
+			continue
+		}
+		if h.Status == model.HNRSatisfied {
+			delete(t.HNR, key)
+		}
+		records = append(records, h)
+	}
+	return records
+}
+
+// HNRGetByUser returns the hit and run records for a user. Records which have changed since the
+// last sync with the UserStore are returned in their current state.
+func (t *Tracker) HNRGetByUser(userID uint32) ([]model.HitAndRun, error) {
+	stored, err := t.Users.HNRGetByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	records := make(map[model.UserTorrentKey]model.HitAndRun)
+	for _, h := range stored {
+		records[h.Key()] = h
+	}
+	t.HNRMutex.RLock()
+	for key, h := range t.HNR {
+		if key.UserID == userID {
+			records[key] = h
+		}
+	}
+	t.HNRMutex.RUnlock()
+	hnr := []model.HitAndRun{}
+	for _, h := range records {
+		hnr = append(hnr, h)
+	}
+	return hnr, nil
+}
+
+// HNRForgive removes the hit and run record from the tracker and the UserStore
+func (t *Tracker) HNRForgive(userID uint32, ih model.InfoHash) error {
+	key := model.UserTorrentKey{UserID: userID, InfoHash: ih}
+	t.HNRMutex.Lock()
+	defer t.HNRMutex.Unlock()
+	_, tracked := t.HNR[key]
+	delete(t.HNR, key)
+	if err := t.Users.HNRDelete(userID, ih); err != nil {
+		// Records which have not been synced yet only exist in the tracker
+		if err == consts.ErrInvalidHNR && tracked {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package tracker
+
+import (
+	"github.com/leighmacdonald/mika/consts"
+	"github.com/leighmacdonald/mika/model"
+	"github.com/leighmacdonald/mika/store"
+	"github.com/leighmacdonald/mika/util"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// PasskeyRotate replaces the passkey of the user with the passkey provided, or a newly generated
+// passkey when empty. The previous passkey keeps working until the expiry provided, a zero expiry
+// uses the PasskeyGrace period. The previous passkey is returned with a zero value when it stops
+// working immediately.
+func (t *Tracker) PasskeyRotate(userID uint32, passkey string, expire time.Time, now time.Time) (model.User, model.Passkey, error) {
+	var usr model.User
+	if err := t.Users.GetByID(&usr, userID); err != nil {
+		return usr, model.Passkey{}, consts.ErrInvalidUser
+	}
+	if passkey == "" {
+		passkey = util.NewPasskey()
+	}
+	if len(passkey) != 20 {
+		return usr, model.Passkey{}, consts.ErrMalformedRequest
+	}
+	var existing model.User
+	if err := t.Users.GetByPasskey(&existing, passkey); err == nil {
+		return usr, model.Passkey{}, consts.ErrDuplicate
+	}
+	if expire.IsZero() && t.PasskeyGrace > 0 {
+		expire = now.Add(t.PasskeyGrace)
+	}
+	var previous model.Passkey
+	if expire.After(now) {
+		previous = model.Passkey{
+			Passkey:     usr.Passkey,
+			UserID:      usr.UserID,
+			Label:       model.PasskeyLabelPrevious,
+			TimeCreated: now,
+			TimeExpire:  expire,
+		}
+		// Added before the passkey is replaced so the user is never left without a working passkey.
+		// The users passkey was read from the store so it is already in its stored form.
+		if err := t.digestUsers().PasskeyAdd(previous); err != nil {
+			return usr, model.Passkey{}, errors.Wrap(err, "Failed to keep previous passkey")
+		}
+	}
+	if err := t.Users.SetPasskey(usr.UserID, passkey); err != nil {
+		return usr, model.Passkey{}, err
+	}
+	usr.Passkey = passkey
+	t.passkeyCleanup(usr.UserID, now)
+	return usr, previous, nil
+}
+
+// passkeyCleanup removes the additional passkeys of the user which have expired
+func (t *Tracker) passkeyCleanup(userID uint32, now time.Time) {
+	passkeys, err := t.Users.PasskeyGetByUser(userID)
+	if err != nil {
+		log.Errorf("Failed to read passkeys of user %d: %s", userID, err.Error())
+		return
+	}
+	for _, pk := range passkeys {
+		if !pk.Expired(now) {
+			continue
+		}
+		if err := t.digestUsers().PasskeyDelete(pk.Passkey); err != nil && err != consts.ErrInvalidPasskey {
+			log.Errorf("Failed to remove expired passkey of user %d: %s", userID, err.Error())
+		}
+	}
+}
+
+// PasskeyAdd gives the user an additional passkey with the label provided, or a newly generated
+// passkey when empty. Labels must be unique among the users passkeys which have not expired.
+// A zero expiry creates a passkey which works until it is revoked.
+func (t *Tracker) PasskeyAdd(userID uint32, label string, passkey string, expire time.Time, now time.Time) (model.Passkey, error) {
+	var usr model.User
+	if err := t.Users.GetByID(&usr, userID); err != nil {
+		return model.Passkey{}, consts.ErrInvalidUser
+	}
+	if passkey == "" {
+		passkey = util.NewPasskey()
+	}
+	pk := model.Passkey{
+		Passkey:     passkey,
+		UserID:      usr.UserID,
+		Label:       label,
+		TimeCreated: now,
+		TimeExpire:  expire,
+	}
+	if label == "" || pk.Validate() != nil {
+		return model.Passkey{}, consts.ErrMalformedRequest
+	}
+	var existing model.User
+	if err := t.Users.GetByPasskey(&existing, passkey); err == nil {
+		return model.Passkey{}, consts.ErrDuplicate
+	}
+	t.passkeyCleanup(usr.UserID, now)
+	passkeys, err := t.Users.PasskeyGetByUser(usr.UserID)
+	if err != nil {
+		return model.Passkey{}, errors.Wrap(err, "Failed to read passkeys")
+	}
+	for _, p := range passkeys {
+		if p.Label == label {
+			return model.Passkey{}, consts.ErrDuplicate
+		}
+	}
+	if err := t.Users.PasskeyAdd(pk); err != nil {
+		return model.Passkey{}, err
+	}
+	return pk, nil
+}
+
+// PasskeyRevoke removes one of the additional passkeys of the user. The passkey may also be given in
+// the stored form listed by the UserStore, eg: its digest when passkeys are hashed. Peers which
+// announced with the passkey are rejected from their next announce.
+func (t *Tracker) PasskeyRevoke(userID uint32, passkey string) error {
+	passkeys, err := t.Users.PasskeyGetByUser(userID)
+	if err != nil {
+		return errors.Wrap(err, "Failed to read passkeys")
+	}
+	hashed := t.hashPasskey(passkey)
+	for _, pk := range passkeys {
+		if pk.Passkey == passkey || pk.Passkey == hashed {
+			return t.digestUsers().PasskeyDelete(pk.Passkey)
+		}
+	}
+	return consts.ErrInvalidPasskey
+}
+
+// PasskeyLookup returns the additional passkey of the user which the announce was made with.
+// Announces using the users own passkey are not found. The passkey of the user is in its stored
+// form so it is compared to the stored form of the announced passkey.
+func (t *Tracker) PasskeyLookup(usr model.User, passkey string) (model.Passkey, bool) {
+	if passkey == "" || t.hashPasskey(passkey) == usr.Passkey {
+		return model.Passkey{}, false
+	}
+	var pk model.Passkey
+	if err := t.Users.PasskeyGet(&pk, passkey); err != nil {
+		if err != consts.ErrInvalidPasskey {
+			log.Errorf("Failed to read passkey of user %d: %s", usr.UserID, err.Error())
+		}
+		return model.Passkey{}, false
+	}
+	if pk.UserID != usr.UserID {
+		return model.Passkey{}, false
+	}
+	return pk, true
+}
+
+// hashPasskey returns the passkey in the form it is persisted by the UserStore
+func (t *Tracker) hashPasskey(passkey string) string {
+	if hasher, ok := t.Users.(store.PasskeyHasher); ok {
+		return hasher.HashPasskey(passkey)
+	}
+	return passkey
+}
+
+// digestUsers returns the UserStore to use with passkeys read back from the UserStore, which are
+// already in the form they are persisted
+func (t *Tracker) digestUsers() store.UserStore {
+	if hasher, ok := t.Users.(store.PasskeyHasher); ok {
+		return hasher.DigestStore()
+	}
+	return t.Users
+}
+
+// ValidUser returns true if the user read from the UserStore is valid, accepting the digest of the
+// users passkey when the UserStore hashes passkeys
+func (t *Tracker) ValidUser(usr model.User) bool {
+	if _, ok := t.Users.(store.PasskeyHasher); ok {
+		return usr.ValidDigest()
+	}
+	return usr.Valid()
+}
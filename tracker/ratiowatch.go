@@ -0,0 +1,217 @@
+package tracker
+
+import (
+	"github.com/leighmacdonald/mika/consts"
+	"github.com/leighmacdonald/mika/model"
+	"github.com/leighmacdonald/mika/store"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// loadRatioWatch reads the warned and disabled ratio watch records known to the UserStore
+func loadRatioWatch(us store.UserStore) map[uint32]model.RatioWatch {
+	records := make(map[uint32]model.RatioWatch)
+	rw, err := us.RatioWatchGetActive()
+	if err != nil {
+		log.Warnf("Failed to read ratio watches: %s", err.Error())
+		return records
+	}
+	for _, r := range rw {
+		records[r.UserID] = r
+	}
+	return records
+}
+
+// belowRatio returns true if the user has downloaded enough for their ratio to be enforced and
+// their ratio is below the required ratio
+func (t *Tracker) belowRatio(usr model.User) bool {
+	if t.RatioWatchRatio <= 0 || usr.Downloaded == 0 || usr.Downloaded < t.RatioWatchMinDownload {
+		return false
+	}
+	return usr.Ratio() < t.RatioWatchRatio
+}
+
+// ratioWatchChange is a ratio watch record changed by the tracker which has not been written to the
+// UserStore yet
+type ratioWatchChange struct {
+	rw model.RatioWatch
+	// downloadEnabled is set when the change enables or disables downloading for the user
+	downloadEnabled *bool
+}
+
+// ratioWatchBatch holds the pending ratio watch changes keyed by user id
+type ratioWatchBatch map[uint32]ratioWatchChange
+
+// add replaces the pending change of the user, keeping any earlier change to downloading which
+// the new change does not override
+func (b ratioWatchBatch) add(c ratioWatchChange) {
+	if prev, found := b[c.rw.UserID]; found && c.downloadEnabled == nil {
+		c.downloadEnabled = prev.downloadEnabled
+	}
+	b[c.rw.UserID] = c
+}
+
+// ratioWatchSync writes the pending ratio watch changes to the UserStore
+func (t *Tracker) ratioWatchSync(b ratioWatchBatch) {
+	for userID, c := range b {
+		if c.downloadEnabled != nil {
+			if err := t.Users.SetDownloadEnabled(userID, *c.downloadEnabled); err != nil {
+				log.Errorf("Failed to set downloading for ratio watch %d: %s", userID, err.Error())
+			}
+		}
+		if err := t.Users.RatioWatchAdd(c.rw); err != nil {
+			log.Errorf("Failed to save ratio watch for user %d: %s", userID, err.Error())
+		}
+	}
+}
+
+// ratioWatchNext returns the ratio watch record of the user after applying their current ratio.
+// Users falling below the ratio start a warning period, users still below the ratio once it expires
+// have downloading disabled and users whose ratio recovers are cleared, re-enabling downloading if
+// it was disabled. The returned bool is false when the record does not change.
+func (t *Tracker) ratioWatchNext(usr model.User, rw model.RatioWatch, found bool, now time.Time) (ratioWatchChange, bool) {
+	ratio := usr.Ratio()
+	switch {
+	case !found && t.belowRatio(usr):
+		return ratioWatchChange{rw: model.NewRatioWatch(usr.UserID, ratio, t.RatioWatchRatio, now, t.RatioWatchPeriod)}, true
+	case found && ratio >= rw.RequiredRatio:
+		c := ratioWatchChange{rw: rw}
+		if rw.Status == model.RatioWatchDisabled {
+			enabled := true
+			c.downloadEnabled = &enabled
+		}
+		c.rw.Transition(model.RatioWatchCleared, ratio, now)
+		return c, true
+	case found && rw.Expired(now):
+		disabled := false
+		c := ratioWatchChange{rw: rw, downloadEnabled: &disabled}
+		c.rw.Transition(model.RatioWatchDisabled, ratio, now)
+		return c, true
+	default:
+		return ratioWatchChange{}, false
+	}
+}
+
+// ratioWatchUpdate applies the users current ratio to their ratio watch record. The tracker is
+// updated immediately while the change is queued to be written to the UserStore by the StatWorker.
+// The caller must hold the write lock.
+func (t *Tracker) ratioWatchUpdate(usr model.User, now time.Time) (model.RatioWatch, bool) {
+	rw, found := t.RatioWatch[usr.UserID]
+	c, changed := t.ratioWatchNext(usr, rw, found, now)
+	if !changed {
+		return rw, found
+	}
+	log.Debugf("Ratio watch %s: %d", c.rw.Status, usr.UserID)
+	if c.rw.Active() {
+		t.RatioWatch[usr.UserID] = c.rw
+	} else {
+		delete(t.RatioWatch, usr.UserID)
+	}
+	t.ratioWatchChan <- c
+	return c.rw, true
+}
+
+// RatioWatchCheck applies the users current ratio to their ratio watch record, returning the
+// warning message to send to the user in announce responses if they are being watched. The
+// write lock is only taken when the record changes.
+func (t *Tracker) RatioWatchCheck(usr model.User, now time.Time) string {
+	if usr.UserID == 0 {
+		return ""
+	}
+	t.RatioWatchMutex.RLock()
+	rw, found := t.RatioWatch[usr.UserID]
+	_, changed := t.ratioWatchNext(usr, rw, found, now)
+	t.RatioWatchMutex.RUnlock()
+	if changed {
+		t.RatioWatchMutex.Lock()
+		rw, found = t.ratioWatchUpdate(usr, now)
+		t.RatioWatchMutex.Unlock()
+	}
+	if !found {
+		return ""
+	}
+	return rw.Warning(now)
+}
+
+// RatioWatchGet returns the ratio watch record of the user. Warned and disabled records are read
+// from the tracker as their latest changes may not have been written to the UserStore yet.
+func (t *Tracker) RatioWatchGet(rw *model.RatioWatch, userID uint32) error {
+	t.RatioWatchMutex.RLock()
+	active, found := t.RatioWatch[userID]
+	t.RatioWatchMutex.RUnlock()
+	if found {
+		*rw = active
+		return nil
+	}
+	return t.Users.RatioWatchGet(rw, userID)
+}
+
+// RatioWatchGetAll returns the warned and disabled ratio watch records
+func (t *Tracker) RatioWatchGetAll() []model.RatioWatch {
+	t.RatioWatchMutex.RLock()
+	defer t.RatioWatchMutex.RUnlock()
+	records := []model.RatioWatch{}
+	for _, rw := range t.RatioWatch {
+		records = append(records, rw)
+	}
+	return records
+}
+
+// RatioWatchClear clears the users ratio watch, re-enabling downloading if it was disabled. Users
+// who are still below the ratio start a new warning period on their next announce.
+func (t *Tracker) RatioWatchClear(userID uint32, now time.Time) error {
+	t.RatioWatchMutex.Lock()
+	defer t.RatioWatchMutex.Unlock()
+	rw, found := t.RatioWatch[userID]
+	if !found {
+		return consts.ErrInvalidRatioWatch
+	}
+	c := ratioWatchChange{rw: rw}
+	if rw.Status == model.RatioWatchDisabled {
+		enabled := true
+		c.downloadEnabled = &enabled
+		if err := t.Users.SetDownloadEnabled(userID, true); err != nil {
+			return err
+		}
+	}
+	c.rw.Transition(model.RatioWatchCleared, rw.Ratio, now)
+	if err := t.Users.RatioWatchAdd(c.rw); err != nil {
+		return err
+	}
+	delete(t.RatioWatch, userID)
+	// Also queued so the cleared record replaces any earlier change still waiting to be written
+	t.ratioWatchChan <- c
+	return nil
+}
+
+// RatioWatchReaper periodically disables downloading for users whose warning period has expired
+// without their ratio recovering
+func (t *Tracker) RatioWatchReaper() {
+	ratioWatchTicker := time.NewTicker(t.ReaperInterval)
+	for {
+		select {
+		case <-ratioWatchTicker.C:
+			t.EnforceRatioWatch(time.Now())
+		case <-t.ctx.Done():
+			return
+		}
+	}
+}
+
+// EnforceRatioWatch applies the current ratio of each user whose warning period has expired by
+// the time provided
+func (t *Tracker) EnforceRatioWatch(now time.Time) {
+	t.RatioWatchMutex.Lock()
+	defer t.RatioWatchMutex.Unlock()
+	for userID, rw := range t.RatioWatch {
+		if !rw.Expired(now) {
+			continue
+		}
+		var usr model.User
+		if err := t.Users.GetByID(&usr, userID); err != nil {
+			log.Errorf("Failed to read user for ratio watch %d: %s", userID, err.Error())
+			continue
+		}
+		t.ratioWatchUpdate(usr, now)
+	}
+}
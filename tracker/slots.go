@@ -0,0 +1,21 @@
+package tracker
+
+import (
+	"github.com/leighmacdonald/mika/config"
+	"github.com/leighmacdonald/mika/model"
+	"github.com/spf13/viper"
+)
+
+// newSlotLimits returns the configured tracker wide peer slot limits
+func newSlotLimits() model.SlotLimits {
+	return model.SlotLimits{
+		Leech:      viper.GetInt(string(config.TrackerSlotsLeech)),
+		Seed:       viper.GetInt(string(config.TrackerSlotsSeed)),
+		PerTorrent: viper.GetInt(string(config.TrackerSlotsPerTorrent)),
+	}
+}
+
+// SlotLimits returns the peer slot limits which apply to the user
+func (t *Tracker) SlotLimits(usr model.User) model.SlotLimits {
+	return t.Slots.Override(usr.SlotLimits)
+}
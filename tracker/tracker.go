@@ -2,6 +2,7 @@ package tracker
 
 import (
 	"context"
+	"encoding/hex"
 	"github.com/leighmacdonald/mika/config"
 	"github.com/leighmacdonald/mika/consts"
 	"github.com/leighmacdonald/mika/geo"
@@ -18,6 +19,34 @@ import (
 	"sync"
 )
 
+// ScrapeFullPolicy defines how scrape requests without any info hashes are handled
+type ScrapeFullPolicy string
+
+const (
+	// ScrapeFullDeny rejects all full scrape requests
+	ScrapeFullDeny ScrapeFullPolicy = "deny"
+	// ScrapeFullAllow allows any user to perform a full scrape
+	ScrapeFullAllow ScrapeFullPolicy = "allow"
+	// ScrapeFullAdmin only allows admin users to perform a full scrape
+	ScrapeFullAdmin ScrapeFullPolicy = "admin"
+)
+
+// parseScrapeFullPolicy returns the matching ScrapeFullPolicy, defaulting to ScrapeFullDeny
+// for unknown values
+func parseScrapeFullPolicy(s string) ScrapeFullPolicy {
+	switch ScrapeFullPolicy(s) {
+	case ScrapeFullAllow:
+		return ScrapeFullAllow
+	case ScrapeFullAdmin:
+		return ScrapeFullAdmin
+	case ScrapeFullDeny:
+		return ScrapeFullDeny
+	default:
+		log.Warnf("Unknown full scrape policy %s, denying full scrapes", s)
+		return ScrapeFullDeny
+	}
+}
+
 // Tracker is the main application struct used to tie all the discreet components together
 type Tracker struct {
 	// ctx is the master context used in the tracker, children contexts must use
@@ -34,17 +63,100 @@ type Tracker struct {
 	Public bool
 	// If Public is true, this will allow unknown info_hashes to be automatically tracked
 	AutoRegister bool
+	// IPv6 enables tracking of IPv6 peer addresses, sent to clients via the peers6 key
+	IPv6 bool
+	// IPv6Only disables tracking of IPv4 peer addresses
+	IPv6Only bool
+	// AllowNonCompact enables the dictionary model peer list for clients requesting compact=0
+	AllowNonCompact bool
+	// WebSocket enables the WebTorrent websocket tracker endpoint used by browser peers
+	WebSocket bool
+	// TrackerID is sent to clients that have not already been issued a tracker id
+	TrackerID string
 	// ReaperInterval is how often we can for dead peers in swarms
 	ReaperInterval time.Duration
 	AnnInterval    time.Duration
 	AnnIntervalMin time.Duration
 	BatchInterval  time.Duration
 	// MaxPeers is the max number of peers we send in an announce
-	MaxPeers        int
+	MaxPeers int
+	// ScrapeMaxHashes is the max number of info hashes returned in a scrape
+	ScrapeMaxHashes int
+	// ScrapeFull is the policy used for scrapes without any info hashes
+	ScrapeFull ScrapeFullPolicy
+	// ScrapeIntervalMin is sent to clients as the minimum interval between scrapes
+	ScrapeIntervalMin time.Duration
+	// ScrapeCacheTTL is how long scrape results are cached for
+	ScrapeCacheTTL  time.Duration
 	StateUpdateChan chan model.UpdateState
 	// Whitelist and whitelist lock
 	WhitelistMutex *sync.RWMutex
 	Whitelist      map[string]model.WhiteListClient
+	// Promotions are the scheduled multiplier promotions keyed by name and the promotions lock
+	PromotionsMutex *sync.RWMutex
+	Promotions      map[string]model.Promotion
+	// Bans is the index of banned addresses and CIDR ranges and the bans lock
+	BansMutex *sync.RWMutex
+	Bans      model.BanList
+	// HNRThreshold is how long users must seed a torrent after completing it, 0 disables hit and run tracking
+	HNRThreshold time.Duration
+	// HNRGrace is how long users can stop seeding before a pending record is flagged as a hit and run
+	HNRGrace time.Duration
+	// HNR holds the pending and flagged hit and run records and the hit and run lock
+	HNRMutex *sync.RWMutex
+	HNR      map[model.UserTorrentKey]model.HitAndRun
+	// Freeleech holds the personal freeleech tokens of users and the freeleech lock
+	FreeleechMutex *sync.RWMutex
+	Freeleech      map[model.UserTorrentKey]model.FreeleechToken
+	// Bonus is the formula used to award bonus points for seeding
+	Bonus BonusFormula
+	// RatioWatchRatio is the minimum ratio users must maintain, 0 disables ratio watch
+	RatioWatchRatio float64
+	// RatioWatchMinDownload is how many bytes a user must download before their ratio is enforced
+	RatioWatchMinDownload uint64
+	// RatioWatchPeriod is how long users below the ratio are warned before downloading is disabled
+	RatioWatchPeriod time.Duration
+	// RatioWatch holds the warned and disabled ratio watch records keyed by user id and the ratio watch lock
+	RatioWatchMutex *sync.RWMutex
+	RatioWatch      map[uint32]model.RatioWatch
+	// ratioWatchChan queues the ratio watch changes to be written to the UserStore by the StatWorker
+	ratioWatchChan chan ratioWatchChange
+	// LeechDeniedReason is sent to users with downloading disabled who try to leech
+	LeechDeniedReason string
+	// Slots are the tracker wide peer slot limits, these can be overridden for each user
+	Slots model.SlotLimits
+	// PasskeyGrace is how long a users previous passkey keeps working after it is rotated
+	PasskeyGrace time.Duration
+	// RateLimiter tracks the request rate buckets
+	RateLimiter store.RateLimiter
+	// RateLimitPasskey is the request rate allowed for each passkey
+	RateLimitPasskey store.Rate
+	// RateLimitIP is the request rate allowed for each IP
+	RateLimitIP store.Rate
+	// RateLimitTorrent is the announce rate allowed for each passkey & torrent
+	RateLimitTorrent store.Rate
+}
+
+// parseRate parses the rate limit for the config key provided, disabling the limit if it is invalid
+func parseRate(key config.Key) store.Rate {
+	rate, err := store.ParseRate(config.GetString(key))
+	if err != nil {
+		log.Errorf("Invalid rate limit for %s, disabling: %s", key, err.Error())
+	}
+	return rate
+}
+
+// newTrackerID returns the configured tracker id, or a randomly generated one when the
+// config value is empty
+func newTrackerID(id string) string {
+	if id != "" {
+		return id
+	}
+	b, err := util.GenRandomBytes(8)
+	if err != nil {
+		log.Panicf("Failed to generate tracker id: %s", err)
+	}
+	return hex.EncodeToString(b)
 }
 
 // PeerReaper will call the store.PeerStore.Reap() function periodically. This is
@@ -61,20 +173,175 @@ func (t *Tracker) PeerReaper() {
 	}
 }
 
+// PromotionReaper periodically removes promotions which have ended from the tracker and backing store
+func (t *Tracker) PromotionReaper() {
+	promoTicker := time.NewTicker(t.ReaperInterval)
+	for {
+		select {
+		case <-promoTicker.C:
+			t.RetirePromotions(time.Now())
+		case <-t.ctx.Done():
+			return
+		}
+	}
+}
+
+// RetirePromotions removes any promotions which have ended by the time provided
+func (t *Tracker) RetirePromotions(now time.Time) {
+	t.PromotionsMutex.Lock()
+	defer t.PromotionsMutex.Unlock()
+	for name, promo := range t.Promotions {
+		if !promo.Expired(now) {
+			continue
+		}
+		if err := t.Torrents.PromotionDelete(promo); err != nil && err != consts.ErrInvalidPromotion {
+			log.Errorf("Failed to remove expired promotion %s: %s", name, err.Error())
+			continue
+		}
+		delete(t.Promotions, name)
+		log.Debugf("Retired expired promotion: %s", name)
+	}
+}
+
+// Multipliers returns the effective upload and download multipliers for the torrent at the time
+// provided. The most generous multipliers of the torrent itself and any active promotions which
+// apply to it are used.
+func (t *Tracker) Multipliers(tor model.Torrent, now time.Time) (multiUp float64, multiDn float64) {
+	multiUp, multiDn = tor.MultiUp, tor.MultiDn
+	t.PromotionsMutex.RLock()
+	defer t.PromotionsMutex.RUnlock()
+	for _, promo := range t.Promotions {
+		if !promo.Active(now) || !promo.Applies(tor) {
+			continue
+		}
+		if promo.MultiUp > multiUp {
+			multiUp = promo.MultiUp
+		}
+		if promo.MultiDn < multiDn {
+			multiDn = promo.MultiDn
+		}
+	}
+	return multiUp, multiDn
+}
+
+// loadPromotions reads the promotions known to the TorrentStore
+func loadPromotions(ts store.TorrentStore) map[string]model.Promotion {
+	promotions := make(map[string]model.Promotion)
+	promos, err := ts.PromotionGetAll()
+	if err != nil {
+		log.Warnf("Failed to read promotions: %s", err.Error())
+		return promotions
+	}
+	for _, promo := range promos {
+		promotions[promo.Name] = promo
+	}
+	return promotions
+}
+
+// peerSessionTTL is how long the counters for a peer session are kept after its last announce
+const peerSessionTTL = time.Hour
+
+// peerSession holds the last transfer counters reported by a peer
+type peerSession struct {
+	uploaded   uint64
+	downloaded uint64
+	updated    time.Time
+}
+
+// peerSessions tracks the counters reported by each peer so that only the change between
+// announces is accounted for.
+type peerSessions map[model.PeerHash]peerSession
+
+// counterDelta returns the change between the previous and current counters. A counter lower than
+// the previous value means the client restarted without sending a started event, so the current
+// value is used as the change since the restart.
+func counterDelta(prev uint64, current uint64) uint64 {
+	if current < prev {
+		return current
+	}
+	return current - prev
+}
+
+// delta returns the amount uploaded and downloaded since the peers previous announce and updates
+// the session with the newly reported counters. Sessions which are not being tracked use the previous
+// counters known by the PeerStore. A started event always begins a new session.
+func (s peerSessions) delta(u model.UpdateState) (uploaded uint64, downloaded uint64) {
+	pHash := model.NewPeerHash(u.InfoHash, u.PeerID)
+	sess, found := s[pHash]
+	switch {
+	case u.Event == consts.STARTED:
+		sess = peerSession{}
+	case !found:
+		sess = peerSession{uploaded: u.PrevUploaded, downloaded: u.PrevDownloaded}
+	}
+	uploaded = counterDelta(sess.uploaded, u.Uploaded)
+	downloaded = counterDelta(sess.downloaded, u.Downloaded)
+	if u.Event == consts.STOPPED {
+		delete(s, pHash)
+	} else {
+		s[pHash] = peerSession{uploaded: u.Uploaded, downloaded: u.Downloaded, updated: u.Timestamp}
+	}
+	return uploaded, downloaded
+}
+
+// purge removes any sessions which have not been updated within the ttl
+func (s peerSessions) purge(ttl time.Duration) {
+	for k, v := range s {
+		if time.Since(v.updated) > ttl {
+			delete(s, k)
+		}
+	}
+}
+
+// applyMultiplier returns the amount credited for a transfer using the torrents multiplier. Multipliers
+// of 0 or less, eg: freeleech, credit nothing.
+func applyMultiplier(amount uint64, multi float64) uint64 {
+	if multi <= 0 {
+		return 0
+	}
+	return uint64(float64(amount) * multi)
+}
+
+// newSnatch creates the snatch for a completed event. The session totals reported by the client are
+// used for the initial transfer totals.
+func newSnatch(u model.UpdateState) model.Snatch {
+	var client string
+	if c, ok := model.ParseClient(u.PeerID); ok {
+		client = c.String()
+	}
+	return model.Snatch{
+		UserID:        u.UserID,
+		InfoHash:      u.InfoHash,
+		TimeCompleted: u.Timestamp,
+		IP:            u.IP,
+		Client:        client,
+		Uploaded:      u.Uploaded,
+		Downloaded:    u.Downloaded,
+	}
+}
+
 // StatWorker handles summing up stats for users/peers/torrents to be sent to the
 // backing stores for long term storage.
 // No locking required for these data sets
 func (t *Tracker) StatWorker() {
 	syncTicker := time.NewTicker(t.BatchInterval)
-	userBatch := make(map[string]model.UserStats)
+	userBatch := make(map[uint32]model.UserStats)
 	peerBatch := make(map[model.PeerHash]model.PeerStats)
 	torrentBatch := make(map[model.InfoHash]model.TorrentStats)
+	sessions := make(peerSessions)
+	hnrChanged := make(map[model.UserTorrentKey]bool)
+	snatchBatch := make(map[model.UserTorrentKey]model.SnatchStats)
+	passkeyBatch := make(map[string]model.PasskeyUsage)
+	ratioWatchChanges := make(ratioWatchBatch)
+	var snatches []model.Snatch
 	for {
 		select {
 		case <-syncTicker.C:
+			sessions.purge(peerSessionTTL)
+			hnrBatch := t.hnrFlush(hnrChanged, time.Now())
 			// Copy the maps to pass into the go routine call. At the same time deleting
 			// the existing values
-			userBatchCopy := make(map[string]model.UserStats)
+			userBatchCopy := make(map[uint32]model.UserStats)
 			for k, v := range userBatch {
 				userBatchCopy[k] = v
 				delete(userBatch, k)
@@ -89,6 +356,23 @@ func (t *Tracker) StatWorker() {
 				torrentBatchCopy[k] = v
 				delete(torrentBatch, k)
 			}
+			snatchBatchCopy := make(map[model.UserTorrentKey]model.SnatchStats)
+			for k, v := range snatchBatch {
+				snatchBatchCopy[k] = v
+				delete(snatchBatch, k)
+			}
+			passkeyBatchCopy := make(map[string]model.PasskeyUsage)
+			for k, v := range passkeyBatch {
+				passkeyBatchCopy[k] = v
+				delete(passkeyBatch, k)
+			}
+			ratioWatchCopy := make(ratioWatchBatch)
+			for k, v := range ratioWatchChanges {
+				ratioWatchCopy[k] = v
+				delete(ratioWatchChanges, k)
+			}
+			snatchesCopy := snatches
+			snatches = nil
 			// TODO make sure we dont exec this more than once at a time
 			go func() {
 				// Send current copies of data to stores
@@ -101,12 +385,45 @@ func (t *Tracker) StatWorker() {
 				if err := t.Torrents.Sync(torrentBatchCopy); err != nil {
 					log.Errorf(err.Error())
 				}
+				if len(hnrBatch) > 0 {
+					if err := t.Users.HNRSync(hnrBatch); err != nil {
+						log.Errorf(err.Error())
+					}
+				}
+				// New snatches must exist before their transfer totals are updated
+				if len(snatchesCopy) > 0 {
+					if err := t.Users.SnatchAdd(snatchesCopy); err != nil {
+						log.Errorf(err.Error())
+					}
+				}
+				if len(snatchBatchCopy) > 0 {
+					if err := t.Users.SnatchSync(snatchBatchCopy); err != nil {
+						log.Errorf(err.Error())
+					}
+				}
+				if len(passkeyBatchCopy) > 0 {
+					if err := t.Users.PasskeySync(passkeyBatchCopy); err != nil {
+						log.Errorf(err.Error())
+					}
+				}
+				t.ratioWatchSync(ratioWatchCopy)
 			}()
+		case c := <-t.ratioWatchChan:
+			ratioWatchChanges.add(c)
 		case u := <-t.StateUpdateChan:
-			ub, found := userBatch[u.Passkey]
+			if u.AltPasskey {
+				passkeyBatch[u.Passkey] = model.PasskeyUsage{IP: u.IP, TimeLastUsed: u.Timestamp}
+			}
+			ub, found := userBatch[u.UserID]
 			if !found {
 				ub = model.UserStats{}
 			}
+			if u.LeechDenied {
+				// Denied announces never joined the swarm so only the attempt is recorded
+				ub.LeechDenied++
+				userBatch[u.UserID] = ub
+				continue
+			}
 			tb, found := torrentBatch[u.InfoHash]
 			if !found {
 				tb = model.TorrentStats{}
@@ -116,21 +433,39 @@ func (t *Tracker) StatWorker() {
 			if !found {
 				pb = model.PeerStats{}
 			}
-			// Global user stats
-			ub.Uploaded += u.Uploaded
-			ub.Downloaded += u.Downloaded
+			// Seeding time is measured from the previous announce so it must be read before the
+			// session is updated
+			seeded := sessions.seeded(u, t.AnnInterval*2)
+			// Clients report cumulative totals for the session, only count what has changed
+			uploaded, downloaded := sessions.delta(u)
+
+			// Global user stats. Raw totals are kept alongside the credited totals so they
+			// remain available for cheat analysis.
+			ub.Uploaded += applyMultiplier(uploaded, u.MultiUp)
+			multiDn := u.MultiDn
+			if t.FreeleechActive(u.UserID, u.InfoHash, u.Timestamp) {
+				// Personal freeleech tokens override any download multiplier
+				multiDn = 0
+			}
+			ub.Downloaded += applyMultiplier(downloaded, multiDn)
+			ub.UploadedRaw += uploaded
+			ub.DownloadedRaw += downloaded
 			ub.Announces++
+			ub.BonusPoints += t.Bonus.Points(u.Size, u.Seeders, seeded)
 
 			// Peer stats
-			pb.Downloaded += u.Downloaded
-			pb.Uploaded += u.Uploaded
+			pb.Downloaded += downloaded
+			pb.Uploaded += uploaded
+			pb.SessionUploaded = u.Uploaded
+			pb.SessionDownloaded = u.Downloaded
+			pb.Left = u.Left
 			pb.LastAnnounce = u.Timestamp
 			pb.Announces++
 
 			// Global torrent stats
 			tb.Announces++
-			tb.Uploaded += u.Uploaded
-			tb.Downloaded += u.Downloaded
+			tb.Uploaded += uploaded
+			tb.Downloaded += downloaded
 
 			switch u.Event {
 			case consts.ANNOUNCE:
@@ -157,7 +492,23 @@ func (t *Tracker) StatWorker() {
 					log.Errorf("Could not remove peer from swarm: %s", err.Error())
 				}
 			}
-			userBatch[u.Passkey] = ub
+			if key, changed := t.hnrUpdate(u); changed {
+				hnrChanged[key] = true
+			}
+			if u.UserID > 0 {
+				key := model.UserTorrentKey{UserID: u.UserID, InfoHash: u.InfoHash}
+				if u.Event == consts.COMPLETED {
+					// The session totals of the new snatch already include any transfers in the batch
+					delete(snatchBatch, key)
+					snatches = append(snatches, newSnatch(u))
+				} else {
+					sb := snatchBatch[key]
+					sb.Uploaded += uploaded
+					sb.Downloaded += downloaded
+					snatchBatch[key] = sb
+				}
+			}
+			userBatch[u.UserID] = ub
 			torrentBatch[u.InfoHash] = tb
 			peerBatch[pHash] = pb
 		case <-t.ctx.Done():
@@ -186,6 +537,9 @@ func New(ctx context.Context) (*Tracker, error) {
 	if err3 != nil {
 		return nil, errors.Wrap(err3, "Failed to setup user store")
 	}
+	if secret := viper.GetString(string(config.StoreUsersPasskeySecret)); secret != "" {
+		u = store.NewHashedUserStore(u, secret)
+	}
 
 	var geodb geo.Provider
 	if config.GetBool(config.GeodbEnabled) {
@@ -193,6 +547,11 @@ func New(ctx context.Context) (*Tracker, error) {
 	} else {
 		geodb = &geo.DummyProvider{}
 	}
+	rl, err5 := store.NewRateLimiter(viper.GetString(string(config.StoreRateLimitType)),
+		config.GetStoreConfig(config.RateLimit))
+	if err5 != nil {
+		return nil, errors.Wrap(err5, "Failed to setup rate limiter")
+	}
 	whitelist := make(map[string]model.WhiteListClient)
 	wl, err4 := s.WhiteListGetAll()
 	if err4 != nil {
@@ -203,20 +562,53 @@ func New(ctx context.Context) (*Tracker, error) {
 		}
 	}
 	return &Tracker{
-		ctx:             ctx,
-		StateUpdateChan: make(chan model.UpdateState, 1000),
-		Torrents:        s,
-		Peers:           p,
-		Users:           u,
-		Geodb:           geodb,
-		GeodbEnabled:    viper.GetBool(string(config.GeodbEnabled)),
-		Whitelist:       whitelist,
-		WhitelistMutex:  &sync.RWMutex{},
-		MaxPeers:        50,
-		BatchInterval:   viper.GetDuration(string(config.TrackerBatchUpdateInterval)),
-		ReaperInterval:  viper.GetDuration(string(config.TrackerReaperInterval)),
-		AnnInterval:     viper.GetDuration(string(config.TrackerAnnounceInterval)),
-		AnnIntervalMin:  viper.GetDuration(string(config.TrackerAnnounceIntervalMin)),
+		ctx:                   ctx,
+		StateUpdateChan:       make(chan model.UpdateState, 1000),
+		Torrents:              s,
+		Peers:                 p,
+		Users:                 u,
+		Geodb:                 geodb,
+		GeodbEnabled:          viper.GetBool(string(config.GeodbEnabled)),
+		IPv6:                  viper.GetBool(string(config.TrackerIPv6)),
+		IPv6Only:              viper.GetBool(string(config.TrackerIPv6Only)),
+		AllowNonCompact:       viper.GetBool(string(config.TrackerAllowNonCompact)),
+		WebSocket:             viper.GetBool(string(config.TrackerWebSocket)),
+		TrackerID:             newTrackerID(viper.GetString(string(config.TrackerID))),
+		Whitelist:             whitelist,
+		WhitelistMutex:        &sync.RWMutex{},
+		Promotions:            loadPromotions(s),
+		PromotionsMutex:       &sync.RWMutex{},
+		Bans:                  loadBans(s),
+		BansMutex:             &sync.RWMutex{},
+		HNRThreshold:          viper.GetDuration(string(config.TrackerHNRThreshold)),
+		HNRGrace:              viper.GetDuration(string(config.TrackerHNRGrace)),
+		HNR:                   loadHNR(u),
+		HNRMutex:              &sync.RWMutex{},
+		Freeleech:             loadFreeleech(u),
+		FreeleechMutex:        &sync.RWMutex{},
+		Bonus:                 newBonusFormula(),
+		RatioWatchRatio:       viper.GetFloat64(string(config.TrackerRatioWatchRatio)),
+		RatioWatchMinDownload: viper.GetUint64(string(config.TrackerRatioWatchMinDownload)),
+		RatioWatchPeriod:      viper.GetDuration(string(config.TrackerRatioWatchPeriod)),
+		RatioWatch:            loadRatioWatch(u),
+		RatioWatchMutex:       &sync.RWMutex{},
+		ratioWatchChan:        make(chan ratioWatchChange, 1000),
+		LeechDeniedReason:     viper.GetString(string(config.TrackerDownloadDisabledReason)),
+		Slots:                 newSlotLimits(),
+		PasskeyGrace:          viper.GetDuration(string(config.TrackerPasskeyGrace)),
+		MaxPeers:              50,
+		BatchInterval:         viper.GetDuration(string(config.TrackerBatchUpdateInterval)),
+		ReaperInterval:        viper.GetDuration(string(config.TrackerReaperInterval)),
+		AnnInterval:           viper.GetDuration(string(config.TrackerAnnounceInterval)),
+		AnnIntervalMin:        viper.GetDuration(string(config.TrackerAnnounceIntervalMin)),
+		ScrapeMaxHashes:       viper.GetInt(string(config.TrackerScrapeMaxHashes)),
+		ScrapeFull:            parseScrapeFullPolicy(viper.GetString(string(config.TrackerScrapeFull))),
+		ScrapeIntervalMin:     viper.GetDuration(string(config.TrackerScrapeIntervalMin)),
+		ScrapeCacheTTL:        viper.GetDuration(string(config.TrackerScrapeCacheTTL)),
+		RateLimiter:           rl,
+		RateLimitPasskey:      parseRate(config.TrackerRateLimitPasskey),
+		RateLimitIP:           parseRate(config.TrackerRateLimitIP),
+		RateLimitTorrent:      parseRate(config.TrackerRateLimitTorrent),
 	}, nil
 }
 
@@ -238,6 +630,9 @@ func NewTestTracker() (*Tracker, model.Torrents, model.Users, model.Swarm) {
 	if err != nil {
 		log.Panicf("Failed to setup user store: %s", err)
 	}
+	if secret := viper.GetString(string(config.StoreUsersPasskeySecret)); secret != "" {
+		us = store.NewHashedUserStore(us, secret)
+	}
 	var users model.Users
 	for i := 0; i < userCount; i++ {
 		usr := store.GenerateTestUser()
@@ -260,6 +655,10 @@ func NewTestTracker() (*Tracker, model.Torrents, model.Users, model.Swarm) {
 		}
 		torrents = append(torrents, t)
 	}
+	rl, err := store.NewRateLimiter("memory", config.StoreConfig{})
+	if err != nil {
+		log.Panicf("Failed to setup rate limiter: %s", err)
+	}
 	wl, err := ts.WhiteListGetAll()
 	if err != nil {
 		log.Warnf("Failed to read any client whitelists, all clients allowed")
@@ -286,18 +685,51 @@ func NewTestTracker() (*Tracker, model.Torrents, model.Users, model.Swarm) {
 		geodb = &geo.DummyProvider{}
 	}
 	return &Tracker{
-		Torrents:        ts,
-		Peers:           ps,
-		Users:           us,
-		Geodb:           geodb,
-		GeodbEnabled:    viper.GetBool(string(config.GeodbEnabled)),
-		WhitelistMutex:  &sync.RWMutex{},
-		Whitelist:       wlm,
-		MaxPeers:        50,
-		StateUpdateChan: make(chan model.UpdateState, 1000),
-		ReaperInterval:  viper.GetDuration(string(config.TrackerReaperInterval)),
-		AnnInterval:     viper.GetDuration(string(config.TrackerAnnounceInterval)),
-		AnnIntervalMin:  viper.GetDuration(string(config.TrackerAnnounceIntervalMin)),
+		Torrents:              ts,
+		Peers:                 ps,
+		Users:                 us,
+		Geodb:                 geodb,
+		GeodbEnabled:          viper.GetBool(string(config.GeodbEnabled)),
+		IPv6:                  viper.GetBool(string(config.TrackerIPv6)),
+		IPv6Only:              viper.GetBool(string(config.TrackerIPv6Only)),
+		AllowNonCompact:       viper.GetBool(string(config.TrackerAllowNonCompact)),
+		WebSocket:             viper.GetBool(string(config.TrackerWebSocket)),
+		TrackerID:             newTrackerID(viper.GetString(string(config.TrackerID))),
+		WhitelistMutex:        &sync.RWMutex{},
+		Whitelist:             wlm,
+		PromotionsMutex:       &sync.RWMutex{},
+		Promotions:            loadPromotions(ts),
+		BansMutex:             &sync.RWMutex{},
+		Bans:                  loadBans(ts),
+		HNRThreshold:          viper.GetDuration(string(config.TrackerHNRThreshold)),
+		HNRGrace:              viper.GetDuration(string(config.TrackerHNRGrace)),
+		HNRMutex:              &sync.RWMutex{},
+		HNR:                   loadHNR(us),
+		Freeleech:             loadFreeleech(us),
+		FreeleechMutex:        &sync.RWMutex{},
+		Bonus:                 newBonusFormula(),
+		RatioWatchRatio:       viper.GetFloat64(string(config.TrackerRatioWatchRatio)),
+		RatioWatchMinDownload: viper.GetUint64(string(config.TrackerRatioWatchMinDownload)),
+		RatioWatchPeriod:      viper.GetDuration(string(config.TrackerRatioWatchPeriod)),
+		RatioWatch:            loadRatioWatch(us),
+		RatioWatchMutex:       &sync.RWMutex{},
+		ratioWatchChan:        make(chan ratioWatchChange, 1000),
+		LeechDeniedReason:     viper.GetString(string(config.TrackerDownloadDisabledReason)),
+		Slots:                 newSlotLimits(),
+		PasskeyGrace:          viper.GetDuration(string(config.TrackerPasskeyGrace)),
+		MaxPeers:              50,
+		StateUpdateChan:       make(chan model.UpdateState, 1000),
+		ReaperInterval:        viper.GetDuration(string(config.TrackerReaperInterval)),
+		AnnInterval:           viper.GetDuration(string(config.TrackerAnnounceInterval)),
+		AnnIntervalMin:        viper.GetDuration(string(config.TrackerAnnounceIntervalMin)),
+		ScrapeMaxHashes:       viper.GetInt(string(config.TrackerScrapeMaxHashes)),
+		ScrapeFull:            parseScrapeFullPolicy(viper.GetString(string(config.TrackerScrapeFull))),
+		ScrapeIntervalMin:     viper.GetDuration(string(config.TrackerScrapeIntervalMin)),
+		ScrapeCacheTTL:        viper.GetDuration(string(config.TrackerScrapeCacheTTL)),
+		RateLimiter:           rl,
+		RateLimitPasskey:      parseRate(config.TrackerRateLimitPasskey),
+		RateLimitIP:           parseRate(config.TrackerRateLimitIP),
+		RateLimitTorrent:      parseRate(config.TrackerRateLimitTorrent),
 	}, torrents, users, peers
 }
 
@@ -1 +1,477 @@
 package tracker
+
+import (
+	"github.com/leighmacdonald/mika/consts"
+	"github.com/leighmacdonald/mika/model"
+	"github.com/leighmacdonald/mika/store"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPeerSessions_Delta(t *testing.T) {
+	s := make(peerSessions)
+	p := store.GenerateTestPeer()
+	ih := store.GenerateTestTorrent().InfoHash
+	update := func(event consts.AnnounceType, up uint64, dn uint64) (uint64, uint64) {
+		return s.delta(model.UpdateState{
+			InfoHash: ih, PeerID: p.PeerID, Event: event, Uploaded: up, Downloaded: dn, Timestamp: time.Now(),
+		})
+	}
+	up, dn := update(consts.STARTED, 0, 0)
+	require.Equal(t, uint64(0), up)
+	require.Equal(t, uint64(0), dn)
+	// Cumulative counters only count the change
+	up, dn = update(consts.ANNOUNCE, 1000, 500)
+	require.Equal(t, uint64(1000), up)
+	require.Equal(t, uint64(500), dn)
+	up, dn = update(consts.ANNOUNCE, 1500, 500)
+	require.Equal(t, uint64(500), up)
+	require.Equal(t, uint64(0), dn)
+	// Counter reset without a started event
+	up, dn = update(consts.ANNOUNCE, 200, 100)
+	require.Equal(t, uint64(200), up)
+	require.Equal(t, uint64(100), dn)
+	up, _ = update(consts.STOPPED, 300, 100)
+	require.Equal(t, uint64(100), up)
+	require.Empty(t, s)
+
+	// Untracked sessions, eg: after a restart, use the counters known by the peer store
+	up, dn = s.delta(model.UpdateState{
+		InfoHash: ih, PeerID: p.PeerID, Event: consts.ANNOUNCE, Uploaded: 5000, Downloaded: 1000,
+		PrevUploaded: 4000, PrevDownloaded: 1000, Timestamp: time.Now(),
+	})
+	require.Equal(t, uint64(1000), up)
+	require.Equal(t, uint64(0), dn)
+	s.purge(0)
+	require.Empty(t, s)
+}
+
+func TestApplyMultiplier(t *testing.T) {
+	require.Equal(t, uint64(1000), applyMultiplier(1000, 1.0))
+	require.Equal(t, uint64(2000), applyMultiplier(1000, 2.0))
+	require.Equal(t, uint64(500), applyMultiplier(1000, 0.5))
+	// Freeleech
+	require.Equal(t, uint64(0), applyMultiplier(1000, 0))
+	require.Equal(t, uint64(0), applyMultiplier(1000, -1))
+}
+
+func TestTracker_Multipliers(t *testing.T) {
+	tkr, torrents, _, _ := NewTestTracker()
+	now := time.Now()
+	tagged := torrents[0]
+	tagged.Tags = model.Tags{"Movies"}
+	promos := []model.Promotion{
+		{Name: "tag", Scope: model.PromotionTag, Tag: "movies", MultiUp: 1, MultiDn: 0.5,
+			TimeStart: now.Add(-time.Hour), TimeEnd: now.Add(time.Hour)},
+		{Name: "torrent", Scope: model.PromotionTorrent, InfoHashes: model.InfoHashes{torrents[1].InfoHash},
+			MultiUp: 2, MultiDn: 1, TimeStart: now.Add(-time.Hour), TimeEnd: now.Add(time.Hour)},
+		{Name: "upcoming", Scope: model.PromotionGlobal, MultiUp: 3, MultiDn: 0,
+			TimeStart: now.Add(time.Hour), TimeEnd: now.Add(2 * time.Hour)},
+		{Name: "expired", Scope: model.PromotionGlobal, MultiUp: 3, MultiDn: 0,
+			TimeStart: now.Add(-2 * time.Hour), TimeEnd: now.Add(-time.Hour)},
+	}
+	for _, p := range promos {
+		require.NoError(t, tkr.Torrents.PromotionAdd(p))
+		tkr.Promotions[p.Name] = p
+	}
+	up, dn := tkr.Multipliers(tagged, now)
+	require.Equal(t, 1.0, up)
+	require.Equal(t, 0.5, dn)
+	up, dn = tkr.Multipliers(torrents[1], now)
+	require.Equal(t, 2.0, up)
+	require.Equal(t, 1.0, dn)
+	up, dn = tkr.Multipliers(torrents[2], now)
+	require.Equal(t, 1.0, up)
+	require.Equal(t, 1.0, dn)
+	// Once started the global promotion is the most generous for every torrent
+	up, dn = tkr.Multipliers(torrents[1], now.Add(90*time.Minute))
+	require.Equal(t, 3.0, up)
+	require.Equal(t, 0.0, dn)
+
+	tkr.RetirePromotions(now)
+	require.Equal(t, 3, len(tkr.Promotions))
+	_, found := tkr.Promotions["expired"]
+	require.False(t, found)
+	stored, err := tkr.Torrents.PromotionGetAll()
+	require.NoError(t, err)
+	require.Equal(t, 3, len(stored))
+}
+
+func TestTracker_HNR(t *testing.T) {
+	tkr, torrents, users, _ := NewTestTracker()
+	tkr.HNRThreshold = time.Hour
+	tkr.HNRGrace = 2 * time.Hour
+	tkr.AnnInterval = 30 * time.Minute
+	now := time.Now()
+	changed := make(map[model.UserTorrentKey]bool)
+	update := func(tor model.Torrent, event consts.AnnounceType, left uint32, ts time.Time) {
+		key, ok := tkr.hnrUpdate(model.UpdateState{UserID: users[0].UserID, InfoHash: tor.InfoHash,
+			Event: event, Left: left, Timestamp: ts})
+		if ok {
+			changed[key] = true
+		}
+	}
+	// Seeding without completing the torrent is not tracked
+	update(torrents[0], consts.ANNOUNCE, 0, now)
+	require.Equal(t, 0, len(changed))
+
+	// Seeds for the threshold
+	update(torrents[0], consts.COMPLETED, 0, now)
+	update(torrents[0], consts.ANNOUNCE, 0, now.Add(30*time.Minute))
+	update(torrents[0], consts.ANNOUNCE, 0, now.Add(time.Hour))
+	// Stops seeding immediately
+	update(torrents[1], consts.COMPLETED, 0, now)
+	// Gaps between announces larger than 2 intervals are not counted
+	update(torrents[2], consts.COMPLETED, 0, now)
+	update(torrents[2], consts.STARTED, 0, now.Add(90*time.Minute))
+	update(torrents[2], consts.ANNOUNCE, 0, now.Add(2*time.Hour))
+
+	records := tkr.hnrFlush(changed, now.Add(150*time.Minute))
+	require.Equal(t, 3, len(records))
+	require.Equal(t, 0, len(changed))
+	require.NoError(t, tkr.Users.HNRSync(records))
+	status := func(tor model.Torrent) model.HitAndRun {
+		stored, err := tkr.HNRGetByUser(users[0].UserID)
+		require.NoError(t, err)
+		for _, h := range stored {
+			if h.InfoHash == tor.InfoHash {
+				return h
+			}
+		}
+		t.Fatalf("No hit and run for %s", tor.InfoHash.String())
+		return model.HitAndRun{}
+	}
+	require.Equal(t, model.HNRSatisfied, status(torrents[0]).Status)
+	require.Equal(t, uint32(3600), status(torrents[0]).SeedTime)
+	require.Equal(t, model.HNRFlagged, status(torrents[1]).Status)
+	require.Equal(t, model.HNRPending, status(torrents[2]).Status)
+	require.Equal(t, uint32(1800), status(torrents[2]).SeedTime)
+	// Satisfied records are no longer tracked
+	require.Equal(t, 2, len(tkr.HNR))
+
+	// Flagged records can be cleared by seeding
+	update(torrents[1], consts.STARTED, 0, now.Add(3*time.Hour))
+	update(torrents[1], consts.ANNOUNCE, 0, now.Add(210*time.Minute))
+	update(torrents[1], consts.ANNOUNCE, 0, now.Add(4*time.Hour))
+	require.Equal(t, model.HNRSatisfied, status(torrents[1]).Status)
+
+	require.NoError(t, tkr.HNRForgive(users[0].UserID, torrents[2].InfoHash))
+	require.Error(t, tkr.HNRForgive(users[0].UserID, torrents[2].InfoHash))
+	_, found := tkr.HNR[model.UserTorrentKey{UserID: users[0].UserID, InfoHash: torrents[2].InfoHash}]
+	require.False(t, found)
+}
+
+func TestTracker_Freeleech(t *testing.T) {
+	tkr, torrents, users, _ := NewTestTracker()
+	now := time.Now()
+	token := model.FreeleechToken{UserID: users[0].UserID, InfoHash: torrents[0].InfoHash,
+		TimeCreated: now, TimeExpire: now.Add(time.Hour)}
+	expiring := model.FreeleechToken{UserID: users[0].UserID, InfoHash: torrents[1].InfoHash,
+		TimeCreated: now, TimeExpire: now.Add(time.Minute)}
+	require.NoError(t, tkr.FreeleechGrant(token))
+	require.NoError(t, tkr.FreeleechGrant(expiring))
+	require.True(t, tkr.FreeleechActive(users[0].UserID, torrents[0].InfoHash, now))
+	require.False(t, tkr.FreeleechActive(users[0].UserID, torrents[0].InfoHash, now.Add(time.Hour)))
+	require.False(t, tkr.FreeleechActive(users[1].UserID, torrents[0].InfoHash, now))
+	require.False(t, tkr.FreeleechActive(users[0].UserID, torrents[2].InfoHash, now))
+	require.Equal(t, 2, len(tkr.FreeleechGetByUser(users[0].UserID)))
+
+	tkr.RetireFreeleech(now.Add(30 * time.Minute))
+	require.Equal(t, 1, len(tkr.Freeleech))
+	stored, err := tkr.Users.FreeleechGetByUser(users[0].UserID)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(stored))
+	require.Equal(t, torrents[0].InfoHash, stored[0].InfoHash)
+
+	require.NoError(t, tkr.FreeleechConsume(users[0].UserID, torrents[0].InfoHash))
+	require.Equal(t, consts.ErrInvalidFreeleech, tkr.FreeleechConsume(users[0].UserID, torrents[0].InfoHash))
+	require.False(t, tkr.FreeleechActive(users[0].UserID, torrents[0].InfoHash, now))
+}
+
+func TestTracker_Bans(t *testing.T) {
+	tkr, _, _, _ := NewTestTracker()
+	now := time.Now()
+	permanent, err := model.NewBan("10.0.0.0/24", "network", now, time.Time{})
+	require.NoError(t, err)
+	expiring, err := model.NewBan("2001:db8::1", "address", now, now.Add(time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, tkr.BanAdd([]model.Ban{permanent, expiring}))
+	ban, found := tkr.BanCheck(net.ParseIP("10.0.0.200"), now)
+	require.True(t, found)
+	require.Equal(t, permanent.CIDR, ban.CIDR)
+	_, found = tkr.BanCheck(net.ParseIP("10.0.1.1"), now)
+	require.False(t, found)
+	_, found = tkr.BanCheck(net.ParseIP("2001:db8::1"), now)
+	require.True(t, found)
+	_, found = tkr.BanCheck(net.ParseIP("2001:db8::1"), now.Add(time.Hour))
+	require.False(t, found)
+
+	// Re-adding a ban replaces it
+	permanent.Reason = "replaced"
+	require.NoError(t, tkr.BanAdd([]model.Ban{permanent}))
+	require.Equal(t, 2, len(tkr.BanGetAll()))
+	ban, _ = tkr.BanCheck(net.ParseIP("10.0.0.1"), now)
+	require.Equal(t, "replaced", ban.Reason)
+
+	tkr.RetireBans(now.Add(2 * time.Hour))
+	require.Equal(t, 1, len(tkr.BanGetAll()))
+	stored, err := tkr.Torrents.BanGetAll()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(stored))
+
+	require.NoError(t, tkr.BanDelete(permanent.CIDR))
+	require.Equal(t, consts.ErrInvalidBan, tkr.BanDelete(permanent.CIDR))
+	_, found = tkr.BanCheck(net.ParseIP("10.0.0.1"), now)
+	require.False(t, found)
+}
+
+func TestTracker_RatioWatch(t *testing.T) {
+	tkr, _, users, _ := NewTestTracker()
+	tkr.RatioWatchRatio = 0.5
+	tkr.RatioWatchMinDownload = 1000
+	tkr.RatioWatchPeriod = time.Hour
+	now := time.Now()
+	usr := users[0]
+	usr.DownloadEnabled = true
+	usr.Uploaded = 100
+	usr.Downloaded = 500
+	require.NoError(t, tkr.Users.Add(usr))
+	// Users who have not downloaded enough are not watched
+	require.Empty(t, tkr.RatioWatchCheck(usr, now))
+	require.Equal(t, 0, len(tkr.RatioWatch))
+
+	usr.Downloaded = 2000
+	require.NoError(t, tkr.Users.Add(usr))
+	require.Contains(t, tkr.RatioWatchCheck(usr, now), "downloading will be disabled")
+	require.Equal(t, model.RatioWatchWarned, tkr.RatioWatch[usr.UserID].Status)
+	// Nothing changes until the warning period expires
+	tkr.EnforceRatioWatch(now.Add(30 * time.Minute))
+	require.Equal(t, model.RatioWatchWarned, tkr.RatioWatch[usr.UserID].Status)
+	tkr.EnforceRatioWatch(now.Add(2 * time.Hour))
+	require.Equal(t, model.RatioWatchDisabled, tkr.RatioWatch[usr.UserID].Status)
+	var stored model.User
+	// Changes are only written to the store by the StatWorker
+	require.NoError(t, tkr.Users.GetByID(&stored, usr.UserID))
+	require.True(t, stored.DownloadEnabled)
+	flushRatioWatch(tkr)
+	require.NoError(t, tkr.Users.GetByID(&stored, usr.UserID))
+	require.False(t, stored.DownloadEnabled)
+	require.Contains(t, tkr.RatioWatchCheck(stored, now.Add(2*time.Hour)), "downloading is disabled")
+
+	// Seeding back above the ratio clears the watch and re-enables downloading
+	stored.Uploaded = 1000
+	require.NoError(t, tkr.Users.Add(stored))
+	require.Empty(t, tkr.RatioWatchCheck(stored, now.Add(3*time.Hour)))
+	require.Equal(t, 0, len(tkr.RatioWatch))
+	flushRatioWatch(tkr)
+	require.NoError(t, tkr.Users.GetByID(&stored, usr.UserID))
+	require.True(t, stored.DownloadEnabled)
+	var rw model.RatioWatch
+	require.NoError(t, tkr.Users.RatioWatchGet(&rw, usr.UserID))
+	require.Equal(t, model.RatioWatchCleared, rw.Status)
+
+	require.NotEmpty(t, tkr.RatioWatchCheck(usr, now))
+	require.Equal(t, 1, len(tkr.RatioWatchGetAll()))
+	// Active records are read from the tracker before they are written to the store
+	require.NoError(t, tkr.RatioWatchGet(&rw, usr.UserID))
+	require.Equal(t, model.RatioWatchWarned, rw.Status)
+	require.NoError(t, tkr.RatioWatchClear(usr.UserID, now))
+	require.Equal(t, consts.ErrInvalidRatioWatch, tkr.RatioWatchClear(usr.UserID, now))
+	// The queued warning is replaced by the cleared record
+	flushRatioWatch(tkr)
+	require.NoError(t, tkr.RatioWatchGet(&rw, usr.UserID))
+	require.Equal(t, model.RatioWatchCleared, rw.Status)
+}
+
+// flushRatioWatch writes the queued ratio watch changes to the store as the StatWorker would
+func flushRatioWatch(tkr *Tracker) {
+	b := make(ratioWatchBatch)
+	for {
+		select {
+		case c := <-tkr.ratioWatchChan:
+			b.add(c)
+		default:
+			tkr.ratioWatchSync(b)
+			return
+		}
+	}
+}
+
+func TestNewSnatch(t *testing.T) {
+	now := time.Now()
+	u := model.UpdateState{UserID: 1, PeerID: model.PeerIDFromString("-qB4250-000000000000"),
+		IP: net.ParseIP("12.34.56.78"), Uploaded: 100, Downloaded: 1000, Event: consts.COMPLETED, Timestamp: now}
+	s := newSnatch(u)
+	require.Equal(t, uint32(1), s.UserID)
+	require.Equal(t, "qBittorrent 4.2.5.0", s.Client)
+	require.Equal(t, now, s.TimeCompleted)
+	require.True(t, u.IP.Equal(s.IP))
+	require.Equal(t, uint64(100), s.Uploaded)
+	require.Equal(t, uint64(1000), s.Downloaded)
+}
+
+func TestBonusFormula_Points(t *testing.T) {
+	f := BonusFormula{Base: 1, Size: 0.5, Seeders: 2}
+	const size = 4 << 30
+	require.Equal(t, 6.0, f.Points(size, 1, time.Hour))
+	// The announcing seeder is always counted
+	require.Equal(t, 6.0, f.Points(size, 0, time.Hour))
+	require.Equal(t, 3.0, f.Points(size, 4, time.Hour))
+	require.Equal(t, 1.5, f.Points(size, 4, 30*time.Minute))
+	require.Equal(t, 0.0, f.Points(size, 1, 0))
+	require.Equal(t, 0.0, BonusFormula{}.Points(size, 1, time.Hour))
+}
+
+func TestPeerSessions_Seeded(t *testing.T) {
+	s := make(peerSessions)
+	p := store.GenerateTestPeer()
+	ih := store.GenerateTestTorrent().InfoHash
+	now := time.Now()
+	maxGap := time.Minute
+	update := func(event consts.AnnounceType, left uint32, ts time.Time) time.Duration {
+		u := model.UpdateState{InfoHash: ih, PeerID: p.PeerID, Event: event, Left: left, Timestamp: ts}
+		seeded := s.seeded(u, maxGap)
+		s.delta(u)
+		return seeded
+	}
+	require.Equal(t, time.Duration(0), update(consts.STARTED, 100, now))
+	// Leeching does not count
+	require.Equal(t, time.Duration(0), update(consts.ANNOUNCE, 50, now.Add(30*time.Second)))
+	// The interval the download completed in was spent leeching
+	require.Equal(t, time.Duration(0), update(consts.COMPLETED, 0, now.Add(40*time.Second)))
+	require.Equal(t, 30*time.Second, update(consts.ANNOUNCE, 0, now.Add(70*time.Second)))
+	// Gaps longer than the max gap are not counted
+	require.Equal(t, time.Duration(0), update(consts.ANNOUNCE, 0, now.Add(200*time.Second)))
+	require.Equal(t, 20*time.Second, update(consts.STOPPED, 0, now.Add(220*time.Second)))
+	// Stopped sessions are no longer tracked
+	require.Equal(t, time.Duration(0), update(consts.ANNOUNCE, 0, now.Add(230*time.Second)))
+}
+
+func TestTracker_PasskeyRotate(t *testing.T) {
+	tkr, _, users, _ := NewTestTracker()
+	tkr.PasskeyGrace = time.Hour
+	now := time.Now()
+	oldPasskey := users[0].Passkey
+	_, _, err := tkr.PasskeyRotate(users[0].UserID, "short", time.Time{}, now)
+	require.Equal(t, consts.ErrMalformedRequest, err)
+	_, _, err = tkr.PasskeyRotate(users[0].UserID, users[1].Passkey, time.Time{}, now)
+	require.Equal(t, consts.ErrDuplicate, err)
+	_, _, err = tkr.PasskeyRotate(0, "", time.Time{}, now)
+	require.Equal(t, consts.ErrInvalidUser, err)
+
+	usr, previous, err := tkr.PasskeyRotate(users[0].UserID, "", time.Time{}, now)
+	require.NoError(t, err)
+	require.NotEqual(t, oldPasskey, usr.Passkey)
+	require.Equal(t, oldPasskey, previous.Passkey)
+	require.True(t, now.Add(time.Hour).Equal(previous.TimeExpire))
+	// The previous passkey works until the grace period expires and is warned to redownload
+	var fetched model.User
+	require.NoError(t, tkr.Users.GetByPasskey(&fetched, oldPasskey))
+	require.Equal(t, usr.Passkey, fetched.Passkey)
+	pk, found := tkr.PasskeyLookup(fetched, oldPasskey)
+	require.True(t, found)
+	require.Equal(t, model.PasskeyLabelPrevious, pk.Label)
+	require.NotEmpty(t, pk.Warning(now))
+	_, found = tkr.PasskeyLookup(fetched, usr.Passkey)
+	require.False(t, found)
+
+	// Rotating again with no grace stops the current passkey immediately and removes expired passkeys
+	tkr.PasskeyGrace = 0
+	rotated, previous, err := tkr.PasskeyRotate(users[0].UserID, "", time.Time{}, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, previous.Passkey)
+	require.Error(t, tkr.Users.GetByPasskey(&fetched, usr.Passkey))
+	require.NoError(t, tkr.Users.GetByPasskey(&fetched, rotated.Passkey))
+	passkeys, err := tkr.Users.PasskeyGetByUser(users[0].UserID)
+	require.NoError(t, err)
+	require.Empty(t, passkeys)
+}
+
+func TestTracker_PasskeyAdd(t *testing.T) {
+	tkr, _, users, _ := NewTestTracker()
+	now := time.Now()
+	_, err := tkr.PasskeyAdd(0, "seedbox", "", time.Time{}, now)
+	require.Equal(t, consts.ErrInvalidUser, err)
+	_, err = tkr.PasskeyAdd(users[0].UserID, "", "", time.Time{}, now)
+	require.Equal(t, consts.ErrMalformedRequest, err)
+	_, err = tkr.PasskeyAdd(users[0].UserID, "seedbox", "short", time.Time{}, now)
+	require.Equal(t, consts.ErrMalformedRequest, err)
+	_, err = tkr.PasskeyAdd(users[0].UserID, "seedbox", users[1].Passkey, time.Time{}, now)
+	require.Equal(t, consts.ErrDuplicate, err)
+
+	seedbox, err := tkr.PasskeyAdd(users[0].UserID, "seedbox", "", time.Time{}, now)
+	require.NoError(t, err)
+	require.Len(t, seedbox.Passkey, 20)
+	laptop, err := tkr.PasskeyAdd(users[0].UserID, "laptop", "", time.Time{}, now)
+	require.NoError(t, err)
+	_, err = tkr.PasskeyAdd(users[0].UserID, "seedbox", "", time.Time{}, now)
+	require.Equal(t, consts.ErrDuplicate, err)
+	// Every passkey resolves to the same user
+	for _, passkey := range []string{seedbox.Passkey, laptop.Passkey} {
+		var usr model.User
+		require.NoError(t, tkr.Users.GetByPasskey(&usr, passkey))
+		require.Equal(t, users[0].UserID, usr.UserID)
+		pk, found := tkr.PasskeyLookup(usr, passkey)
+		require.True(t, found)
+		require.Empty(t, pk.Warning(now))
+	}
+	// Each passkey is revoked on its own and only by its owner
+	require.Equal(t, consts.ErrInvalidPasskey, tkr.PasskeyRevoke(users[1].UserID, seedbox.Passkey))
+	require.NoError(t, tkr.PasskeyRevoke(users[0].UserID, seedbox.Passkey))
+	require.Equal(t, consts.ErrInvalidPasskey, tkr.PasskeyRevoke(users[0].UserID, seedbox.Passkey))
+	var usr model.User
+	require.Error(t, tkr.Users.GetByPasskey(&usr, seedbox.Passkey))
+	require.NoError(t, tkr.Users.GetByPasskey(&usr, laptop.Passkey))
+	// The label of a revoked passkey can be reused
+	_, err = tkr.PasskeyAdd(users[0].UserID, "seedbox", "", time.Time{}, now)
+	require.NoError(t, err)
+}
+
+func TestTracker_HashedPasskeys(t *testing.T) {
+	tkr, _, users, _ := NewTestTracker()
+	hashed := store.NewHashedUserStore(tkr.Users, "secret")
+	_, err := hashed.Migrate()
+	require.NoError(t, err)
+	tkr.Users = hashed
+	tkr.PasskeyGrace = time.Hour
+	now := time.Now()
+	var usr model.User
+	require.NoError(t, tkr.Users.GetByPasskey(&usr, users[0].Passkey))
+	require.Equal(t, hashed.HashPasskey(users[0].Passkey), usr.Passkey)
+	_, found := tkr.PasskeyLookup(usr, users[0].Passkey)
+	require.False(t, found)
+
+	// Generated passkeys are returned in plain form while only their digest is persisted
+	rotated, previous, err := tkr.PasskeyRotate(users[0].UserID, "", time.Time{}, now)
+	require.NoError(t, err)
+	require.Len(t, rotated.Passkey, 20)
+	require.Equal(t, usr.Passkey, previous.Passkey)
+	require.NoError(t, tkr.Users.GetByPasskey(&usr, users[0].Passkey))
+	pk, found := tkr.PasskeyLookup(usr, users[0].Passkey)
+	require.True(t, found)
+	require.Equal(t, model.PasskeyLabelPrevious, pk.Label)
+	seedbox, err := tkr.PasskeyAdd(users[0].UserID, "seedbox", "", time.Time{}, now)
+	require.NoError(t, err)
+	require.Len(t, seedbox.Passkey, 20)
+	require.NoError(t, tkr.Users.GetByPasskey(&usr, seedbox.Passkey))
+	pk, found = tkr.PasskeyLookup(usr, seedbox.Passkey)
+	require.True(t, found)
+	require.Equal(t, "seedbox", pk.Label)
+	require.NoError(t, tkr.PasskeyRevoke(users[0].UserID, seedbox.Passkey))
+	require.Error(t, tkr.Users.GetByPasskey(&usr, seedbox.Passkey))
+	// Passkeys can also be revoked using the digest listed by the store
+	require.Equal(t, consts.ErrInvalidPasskey, tkr.PasskeyRevoke(users[1].UserID, previous.Passkey))
+	require.NoError(t, tkr.PasskeyRevoke(users[0].UserID, previous.Passkey))
+	require.Error(t, tkr.Users.GetByPasskey(&usr, users[0].Passkey))
+	// Expired previous passkeys are removed by their digest when rotating again
+	_, err = tkr.PasskeyAdd(users[0].UserID, "laptop", "", now.Add(time.Minute), now)
+	require.NoError(t, err)
+	_, _, err = tkr.PasskeyRotate(users[0].UserID, "", time.Time{}, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	passkeys, err := tkr.Users.PasskeyGetByUser(users[0].UserID)
+	require.NoError(t, err)
+	require.Len(t, passkeys, 1)
+	require.Equal(t, model.PasskeyLabelPrevious, passkeys[0].Label)
+}
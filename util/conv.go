@@ -57,6 +57,16 @@ func StringToUInt64(s string, def uint64) uint64 {
 	return uint64(v)
 }
 
+// StringToInt64 converts a string to a int64 returning a default value on failure
+func StringToInt64(s string, def int64) int64 {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		log.Warnf("failed to parse int64 value: %s", s)
+		return def
+	}
+	return v
+}
+
 // StringToFloat64 converts a string to a float64 returning a default value on failure
 func StringToFloat64(s string, def float64) float64 {
 	v, err := strconv.ParseFloat(s, 64)
@@ -30,6 +30,11 @@ func TestStringToUInt64(t *testing.T) {
 	require.Equal(t, uint64(10), StringToUInt64("", 10))
 }
 
+func TestStringToInt64(t *testing.T) {
+	require.Equal(t, int64(-1000000000000), StringToInt64("-1000000000000", 1))
+	require.Equal(t, int64(10), StringToInt64("", 10))
+}
+
 func TestStringToFloat64(t *testing.T) {
 	require.Equal(t, 10.500, StringToFloat64("10.500", 1))
 	require.Equal(t, 10.0, StringToFloat64("", 10))